@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"time"
+	"warehouse-api/internal/config"
+	"warehouse-api/internal/eventbus"
+	"warehouse-api/internal/health"
+	"warehouse-api/internal/metrics"
+	"warehouse-api/internal/migrate"
+	"warehouse-api/internal/repositories"
+	"warehouse-api/internal/services"
+	"warehouse-api/internal/workers"
+	"warehouse-api/migrations"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// readinessTimeout bounds each readiness check, well inside the timeouts
+// probes are usually given.
+const readinessTimeout = 2 * time.Second
+
+// app holds the services shared by the HTTP server and the CLI commands.
+// serve runs its background workers in workers, which the readiness checks
+// in health watch along with the database and its schema.
+type app struct {
+	store                 repositories.Store
+	metrics               *prometheus.Registry
+	health                *health.Checker
+	workers               *workers.Group
+	requestTimeout        time.Duration
+	bulkRequestTimeout    time.Duration
+	adminUsername         string
+	adminPasswordHash     string
+	streamAllowedOrigins  []string
+	productService        *services.ProductService
+	locationService       *services.LocationService
+	stockService          *services.StockService
+	valuationService      *services.ValuationService
+	ledgerService         *services.LedgerService
+	reconciliationService *services.ReconciliationService
+	importService         *services.ImportService
+	exportService         *services.ExportService
+	webhookService        *services.WebhookService
+	outboxService         *services.OutboxService
+	streamService         *services.StreamService
+}
+
+func newApp(cfg *config.Config, db *sql.DB) *app {
+	var store repositories.Store
+	if cfg.DBDriver == config.DriverSQLite {
+		store = repositories.NewSQLiteStore(db)
+	} else {
+		store = repositories.NewPostgresStore(db)
+	}
+
+	// The services count their units of work through the instrumented
+	// store; a.store stays the concrete one, which serve needs to listen
+	// for notifications on SQLite
+	registry := metrics.NewRegistry(db, store)
+	instrumented := metrics.InstrumentStore(store)
+
+	// Initialize services
+	var sink eventbus.Sink
+	if cfg.OutboxSink == "stdout" {
+		sink = eventbus.NewWriterSink(os.Stdout)
+	}
+	webhookService := services.NewWebhookService(instrumented)
+	outboxService := services.NewOutboxService(instrumented, sink)
+	streamService := services.NewStreamService(instrumented)
+	events := services.EventRecorders{outboxService, webhookService, streamService}
+
+	// Migrations were loaded once already by setup, so this cannot fail
+	// unless the binary is broken; then the schema is never ready
+	group := workers.NewGroup()
+	checker := health.NewChecker(readinessTimeout)
+	migrator, err := migrate.New(db, cfg.DBDriver, migrations.For(cfg.DBDriver))
+	checkSchema := func(context.Context) error { return err }
+	if err == nil {
+		checkSchema = migrator.Check
+	}
+	checker.Add("database", db.PingContext)
+	checker.Add("migrations", checkSchema)
+	checker.Add("workers", group.Check)
+
+	productService := services.NewProductService(instrumented, events)
+	locationService := services.NewLocationService(instrumented, events)
+	stockService := services.NewStockService(instrumented, events)
+
+	return &app{
+		store:                 store,
+		metrics:               registry,
+		health:                checker,
+		workers:               group,
+		requestTimeout:        cfg.RequestTimeout,
+		bulkRequestTimeout:    cfg.BulkRequestTimeout,
+		adminUsername:         cfg.AdminUsername,
+		adminPasswordHash:     cfg.AdminPasswordHash,
+		streamAllowedOrigins:  cfg.StreamAllowedOrigins,
+		productService:        productService,
+		locationService:       locationService,
+		stockService:          stockService,
+		valuationService:      services.NewValuationService(instrumented),
+		ledgerService:         services.NewLedgerService(instrumented),
+		reconciliationService: services.NewReconciliationService(instrumented, stockService),
+		importService:         services.NewImportService(instrumented, productService, locationService, stockService),
+		exportService:         services.NewExportService(instrumented),
+		webhookService:        webhookService,
+		outboxService:         outboxService,
+		streamService:         streamService,
+	}
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"warehouse-api/internal/config"
+	"warehouse-api/internal/logging"
+)
+
+const configUsage = `Usage: warehouse-api config print [--redacted | -show-secrets] [flags]
+
+Prints the configuration the other commands would run with, given the same
+config file, environment and flags, as a YAML config file commented with the
+source of each value. Secrets are redacted, as --redacted asks, unless
+-show-secrets is given. Exits 1 when the configuration does not validate.`
+
+// runConfig implements `warehouse-api config print [--redacted | -show-secrets]`,
+// writing the configuration to stdout and usage to stderr. It returns the
+// exit status.
+func runConfig(args []string, stdout, stderr io.Writer) int {
+	if len(args) == 0 || args[0] != "print" {
+		fmt.Fprintln(stderr, configUsage)
+		return 2
+	}
+
+	flags := flag.NewFlagSet("config print", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	// Redacting is the default; --redacted stays so scripts may say so
+	redacted := flags.Bool("redacted", true, "print secrets as "+config.Redacted+" (the default)")
+	showSecrets := flags.Bool("show-secrets", false, "print secrets instead of "+config.Redacted+"; overrides --redacted")
+	loader := config.NewLoader(flags)
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), configUsage)
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args[1:]); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		return 2
+	}
+
+	cfg, err := loader.Resolve()
+	if err != nil {
+		return configFailed("Invalid configuration", err)
+	}
+	if err := cfg.Print(stdout, *showSecrets || !*redacted); err != nil {
+		return configFailed("Failed to print the configuration", err)
+	}
+	if err := cfg.Validate(); err != nil {
+		return configFailed("Invalid configuration", err)
+	}
+	return 0
+}
+
+// configFailed logs err as fatal does and returns the exit status for it.
+func configFailed(msg string, err error) int {
+	slog.LogAttrs(context.Background(), slog.LevelError, msg, logging.Err(err))
+	return 1
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"warehouse-api/internal/config"
+)
+
+func TestConfigPrintRedacted(t *testing.T) {
+	const secret, password = "config-print-test-secret-0123456789", "hunter2hunter2"
+	// A bcrypt hash of a password of the test's own
+	const passwordHash = "$2a$04$XaDxuBY0spUMvRpl1W.es.4mqJCzDWePAKPMHdAuqaBsydQObcGDm"
+	args := []string{"print", "--redacted", "-env", "production", "-auth.jwt_secret", secret, "-auth.admin_password_hash", passwordHash, "-database.password", password}
+
+	var stdout, stderr bytes.Buffer
+	if status := runConfig(args, &stdout, &stderr); status != 0 {
+		t.Fatalf("config print --redacted exited %d: %s", status, stderr.String())
+	}
+	printed := stdout.String()
+	for _, s := range []string{secret, passwordHash, password} {
+		if strings.Contains(printed, s) {
+			t.Errorf("printed configuration holds secret %q:\n%s", s, printed)
+		}
+	}
+	if want := "jwt_secret: '" + config.Redacted + "' # flag --auth.jwt_secret"; !strings.Contains(printed, want) {
+		t.Errorf("printed configuration lacks %q:\n%s", want, printed)
+	}
+
+	// -show-secrets wins over --redacted
+	stdout.Reset()
+	if status := runConfig(append(args, "-show-secrets"), &stdout, &stderr); status != 0 {
+		t.Fatalf("config print --redacted -show-secrets exited %d: %s", status, stderr.String())
+	}
+	if !strings.Contains(stdout.String(), secret) {
+		t.Errorf("printed configuration lacks the shown secret:\n%s", stdout.String())
+	}
+
+	// A configuration that does not validate is still printed, and fails
+	stdout.Reset()
+	if status := runConfig([]string{"print", "--redacted", "-env", "production", "-auth.jwt_secret", "secret"}, &stdout, &stderr); status != 1 {
+		t.Errorf("invalid configuration exited %d, want 1", status)
+	}
+	if !strings.Contains(stdout.String(), "jwt_secret: '"+config.Redacted+"'") {
+		t.Errorf("invalid configuration printed as:\n%s", stdout.String())
+	}
+}
@@ -0,0 +1,1061 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+	"warehouse-api/internal/config"
+	"warehouse-api/internal/logging"
+	"warehouse-api/internal/middleware"
+	"warehouse-api/internal/migrate"
+	"warehouse-api/internal/models"
+	"warehouse-api/internal/repositories"
+	"warehouse-api/internal/services"
+	"warehouse-api/internal/tracing"
+	"warehouse-api/internal/utils"
+	"warehouse-api/migrations"
+
+	"github.com/gorilla/websocket"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// e2eServer drives the full HTTP router, wired to a freshly migrated
+// database, the way a client would.
+type e2eServer struct {
+	t      *testing.T
+	db     *sql.DB
+	app    *app
+	router http.Handler
+	token  string
+}
+
+// runE2E runs test once against each storage backend, as the subtests
+// postgres and sqlite.
+func runE2E(t *testing.T, test func(t *testing.T, s *e2eServer)) {
+	for _, driver := range []string{config.DriverPostgres, config.DriverSQLite} {
+		driver := driver
+		t.Run(driver, func(t *testing.T) {
+			test(t, newE2EServer(t, driver))
+		})
+	}
+}
+
+// e2ePassword logs in as admin; the server holds only its hash, made once at
+// the cheapest cost so logging in stays fast.
+const e2ePassword = "admin123"
+
+var e2ePasswordHash = func() string {
+	hash, err := bcrypt.GenerateFromPassword([]byte(e2ePassword), bcrypt.MinCost)
+	if err != nil {
+		panic(err)
+	}
+	return string(hash)
+}()
+
+// e2eConfig is the configuration the servers under test run with.
+func e2eConfig(driver string) *config.Config {
+	return &config.Config{DBDriver: driver, OutboxSink: "none", AdminUsername: "admin", AdminPasswordHash: e2ePasswordHash}
+}
+
+func newE2EServer(t *testing.T, driver string) *e2eServer {
+	t.Helper()
+
+	cfg := e2eConfig(driver)
+	var db *sql.DB
+	if driver == config.DriverSQLite {
+		db = openSQLiteTestDB(t, cfg)
+	} else {
+		db = openTestDB(t)
+	}
+	utils.InitJWT("e2e-test-secret")
+	a := newApp(cfg, db)
+	return &e2eServer{t: t, db: db, app: a, router: newRouter(a)}
+}
+
+// e2eResponse is a decoded response: the success envelope or a problem.
+type e2eResponse struct {
+	Status  int
+	Data    json.RawMessage
+	Problem utils.Problem
+}
+
+func (s *e2eServer) do(method, path string, body interface{}) *e2eResponse {
+	s.t.Helper()
+
+	var reader *bytes.Reader
+	switch b := body.(type) {
+	case nil:
+		reader = bytes.NewReader(nil)
+	case string:
+		reader = bytes.NewReader([]byte(b))
+	default:
+		encoded, err := json.Marshal(b)
+		if err != nil {
+			s.t.Fatalf("encode %s %s body: %v", method, path, err)
+		}
+		reader = bytes.NewReader(encoded)
+	}
+
+	req := httptest.NewRequest(method, path, reader)
+	req.Header.Set("Content-Type", "application/json")
+	if s.token != "" {
+		req.Header.Set("Authorization", "Bearer "+s.token)
+	}
+	rec := httptest.NewRecorder()
+	s.router.ServeHTTP(rec, req)
+
+	res := &e2eResponse{Status: rec.Code}
+	if strings.HasPrefix(rec.Header().Get("Content-Type"), utils.ProblemContentType) {
+		if err := json.Unmarshal(rec.Body.Bytes(), &res.Problem); err != nil {
+			s.t.Fatalf("%s %s: decode problem: %v", method, path, err)
+		}
+		return res
+	}
+
+	var envelope struct {
+		Success bool            `json:"success"`
+		Data    json.RawMessage `json:"data"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &envelope); err != nil {
+		s.t.Fatalf("%s %s: decode response %q: %v", method, path, rec.Body.String(), err)
+	}
+	res.Data = envelope.Data
+	return res
+}
+
+// ok performs a request that must succeed and decodes its data into out.
+func (s *e2eServer) ok(method, path string, body, out interface{}) {
+	s.t.Helper()
+	res := s.do(method, path, body)
+	if res.Status != http.StatusOK {
+		s.t.Fatalf("%s %s = %d %s (%s), want 200", method, path, res.Status, res.Problem.Code, res.Problem.Detail)
+	}
+	if out != nil {
+		if err := json.Unmarshal(res.Data, out); err != nil {
+			s.t.Fatalf("%s %s: decode data: %v", method, path, err)
+		}
+	}
+}
+
+// fails performs a request that must fail with the given status and code.
+func (s *e2eServer) fails(method, path string, body interface{}, status int, code string) *utils.Problem {
+	s.t.Helper()
+	res := s.do(method, path, body)
+	if res.Status != status || res.Problem.Code != code {
+		s.t.Fatalf("%s %s = %d %q, want %d %q", method, path, res.Status, res.Problem.Code, status, code)
+	}
+	return &res.Problem
+}
+
+func (s *e2eServer) login() {
+	s.t.Helper()
+	var login models.LoginResponse
+	s.ok("POST", "/api/auth/login", models.LoginRequest{Username: "admin", Password: e2ePassword}, &login)
+	s.token = login.Token
+}
+
+func (s *e2eServer) createProduct(sku string) *models.Product {
+	s.t.Helper()
+	var product models.Product
+	s.ok("POST", "/api/products", models.CreateProductRequest{SKUName: sku, CostingMethod: models.CostingFIFO}, &product)
+	return &product
+}
+
+func (s *e2eServer) createLocation(code string, capacity int) *models.Location {
+	s.t.Helper()
+	var location models.Location
+	s.ok("POST", "/api/locations", models.CreateLocationRequest{Code: code, Name: "Aisle " + code, Capacity: capacity}, &location)
+	return &location
+}
+
+func (s *e2eServer) post(productID, locationID int, movementType string, quantity int) *models.StockMovement {
+	s.t.Helper()
+	var movement models.StockMovement
+	s.ok("POST", "/api/stock-movements", models.CreateStockMovementRequest{
+		ProductID:  productID,
+		LocationID: locationID,
+		Type:       movementType,
+		Quantity:   quantity,
+	}, &movement)
+	return &movement
+}
+
+func TestE2EAuthentication(t *testing.T) {
+	runE2E(t, func(t *testing.T, s *e2eServer) {
+
+		s.fails("GET", "/api/products", nil, http.StatusUnauthorized, "missing_token")
+		s.token = "not-a-token"
+		s.fails("GET", "/api/products", nil, http.StatusUnauthorized, "invalid_token")
+		s.token = ""
+
+		s.fails("POST", "/api/auth/login", models.LoginRequest{Username: "admin", Password: "wrong"}, http.StatusUnauthorized, "invalid_credentials")
+		s.fails("POST", "/api/auth/login", models.LoginRequest{Username: "root", Password: e2ePassword}, http.StatusUnauthorized, "invalid_credentials")
+		problem := s.fails("POST", "/api/auth/login", `{"username": "admin"}`, http.StatusBadRequest, "validation_failed")
+		if len(problem.Errors) != 1 || problem.Errors[0].Field != "password" {
+			t.Errorf("errors = %+v, want one for password", problem.Errors)
+		}
+		s.fails("POST", "/api/auth/login", `{`, http.StatusBadRequest, "invalid_body")
+
+		s.login()
+		if s.token == "" {
+			t.Fatal("login returned no token")
+		}
+		s.ok("GET", "/api/products", nil, nil)
+	})
+}
+
+func TestE2EProbes(t *testing.T) {
+	runE2E(t, func(t *testing.T, s *e2eServer) {
+		probe := func(path string) (int, *models.HealthReport) {
+			rec := httptest.NewRecorder()
+			s.router.ServeHTTP(rec, httptest.NewRequest("GET", path, nil))
+			var report models.HealthReport
+			if err := json.Unmarshal(rec.Body.Bytes(), &report); err != nil {
+				t.Fatalf("GET %s: decode %q: %v", path, rec.Body.String(), err)
+			}
+			return rec.Code, &report
+		}
+		unready := func(check, want string) {
+			t.Helper()
+			code, report := probe("/readyz")
+			if code != http.StatusServiceUnavailable || report.Status != models.HealthUnavailable || !strings.Contains(report.Checks[check], want) {
+				t.Errorf("GET /readyz = %d %+v, want 503 with %s failing with %q", code, report, check, want)
+			}
+			if code, _ := probe("/livez"); code != http.StatusOK {
+				t.Errorf("GET /livez = %d while %s fails, want 200", code, check)
+			}
+		}
+
+		for _, path := range []string{"/livez", "/readyz", "/health"} {
+			if code, report := probe(path); code != http.StatusOK || report.Status != models.HealthOK {
+				t.Errorf("GET %s = %d %+v, want 200 ok", path, code, report)
+			}
+		}
+		if _, report := probe("/readyz"); len(report.Checks) != 3 {
+			t.Errorf("checks = %v, want database, migrations and workers", report.Checks)
+		}
+
+		// A worker that returns before shutdown has stopped for good
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		s.app.workers.Go(ctx, "broken", func(context.Context) {})
+		s.app.workers.Wait()
+		unready("workers", "broken")
+
+		if _, err := s.db.Exec(`UPDATE schema_migrations SET dirty = TRUE WHERE version = 1`); err != nil {
+			t.Fatal(err)
+		}
+		unready("migrations", "dirty")
+
+		s.db.Close()
+		unready("database", "closed")
+
+		// Once draining, the process is never ready
+		s.app.health.Drain()
+		if code, report := probe("/readyz"); code != http.StatusServiceUnavailable || report.Status != models.HealthShuttingDown {
+			t.Errorf("GET /readyz while draining = %d %+v, want 503 shutting_down", code, report)
+		}
+	})
+}
+
+func TestStreamsEndOnShutdown(t *testing.T) {
+	s := newE2EServer(t, config.DriverSQLite)
+	s.login()
+
+	// An SSE stream in flight ends once the stream service closes, so it
+	// does not hold up the server's drain
+	server := httptest.NewServer(s.router)
+	defer server.Close()
+	req, _ := http.NewRequest("GET", server.URL+"/api/stream", nil)
+	req.Header.Set("Authorization", "Bearer "+s.token)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("GET /api/stream = %d %s, want an event stream", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+
+	s.app.streamService.Close()
+	ended := make(chan error, 1)
+	go func() {
+		_, err := io.Copy(io.Discard, resp.Body)
+		ended <- err
+	}()
+	select {
+	case err := <-ended:
+		if err != nil {
+			t.Errorf("read stream: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("stream still open after the stream service closed")
+	}
+
+	// Later subscriptions end at once
+	if sub := s.app.streamService.Subscribe(&models.StreamFilter{}); !sub.ShuttingDown() {
+		t.Error("subscription after Close is open")
+	}
+}
+
+func TestStreamWebSocketChecksOrigin(t *testing.T) {
+	s := newE2EServer(t, config.DriverSQLite)
+	s.login()
+	s.app.streamAllowedOrigins = []string{"https://App.example.com"}
+	server := httptest.NewServer(newRouter(s.app))
+	defer server.Close()
+
+	wsURL := "ws" + strings.TrimPrefix(server.URL, "http") + "/api/stream/ws?access_token=" + s.token
+	for _, tc := range []struct {
+		origin string
+		want   int
+	}{
+		{"", http.StatusSwitchingProtocols},
+		{server.URL, http.StatusSwitchingProtocols},
+		{"https://app.example.com", http.StatusSwitchingProtocols},
+		{"https://evil.example.com", http.StatusForbidden},
+		{"http://app.example.com", http.StatusForbidden},
+	} {
+		header := http.Header{}
+		if tc.origin != "" {
+			header.Set("Origin", tc.origin)
+		}
+		conn, resp, err := websocket.DefaultDialer.Dial(wsURL, header)
+		if conn != nil {
+			conn.Close()
+		}
+		if resp == nil {
+			t.Fatalf("dial with origin %q: %v", tc.origin, err)
+		}
+		if resp.StatusCode != tc.want {
+			t.Errorf("WebSocket with origin %q = %d, want %d", tc.origin, resp.StatusCode, tc.want)
+		}
+	}
+}
+
+func TestE2ETimeouts(t *testing.T) {
+	runE2E(t, func(t *testing.T, s *e2eServer) {
+		s.login()
+
+		s.app.requestTimeout = time.Nanosecond
+		s.router = newRouter(s.app)
+		problem := s.fails("GET", "/api/products", nil, http.StatusGatewayTimeout, "timeout")
+		if problem.Status != http.StatusGatewayTimeout {
+			t.Errorf("problem status = %d, want 504", problem.Status)
+		}
+		s.fails("POST", "/api/products", models.CreateProductRequest{SKUName: "LATE-1", CostingMethod: models.CostingFIFO}, http.StatusGatewayTimeout, "timeout")
+
+		// Bulk routes have their own, longer deadline
+		s.ok("POST", "/api/stock/snapshots", nil, nil)
+
+		s.app.requestTimeout = 0
+		s.router = newRouter(s.app)
+		var list struct {
+			Products []*models.Product `json:"products"`
+		}
+		s.ok("GET", "/api/products", nil, &list)
+		if len(list.Products) != 0 {
+			t.Errorf("products = %+v, want the timed out create to have written nothing", list.Products)
+		}
+	})
+}
+
+func TestE2EMetrics(t *testing.T) {
+	runE2E(t, func(t *testing.T, s *e2eServer) {
+		s.login()
+
+		product := s.createProduct("METRIC-1")
+		location := s.createLocation("M1", 4)
+		s.post(product.ID, location.ID, "IN", 3)
+		s.fails("POST", "/api/stock-movements", models.CreateStockMovementRequest{
+			ProductID: product.ID, LocationID: location.ID, Type: "OUT", Quantity: 5,
+		}, http.StatusBadRequest, "insufficient_quantity")
+
+		req := httptest.NewRequest("GET", "/metrics", nil)
+		rec := httptest.NewRecorder()
+		s.router.ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("GET /metrics = %d, want 200", rec.Code)
+		}
+		body := rec.Body.String()
+		for _, want := range []string{
+			`warehouse_http_request_duration_seconds_count{method="POST",route="/api/stock-movements",status="200"}`,
+			`warehouse_http_request_duration_seconds_count{method="POST",route="/api/stock-movements",status="400"}`,
+			`warehouse_stock_movements_posted_total{source="MANUAL",type="IN"}`,
+			`warehouse_stock_movements_rejected_total{reason="insufficient_quantity"}`,
+			`warehouse_db_transactions_total{outcome="committed"}`,
+			`warehouse_db_transactions_total{outcome="rolled_back"}`,
+			`warehouse_location_usage_units{location="M1",warehouse=""} 3`,
+			`warehouse_location_utilisation_ratio{location="M1",warehouse=""} 0.75`,
+			`go_sql_open_connections{db_name="warehouse"}`,
+		} {
+			if !strings.Contains(body, want) {
+				t.Errorf("metrics lack %s", want)
+			}
+		}
+
+		// With the database gone the location gauges drop out, the rest stay
+		s.db.Close()
+		rec = httptest.NewRecorder()
+		s.router.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("GET /metrics with the database down = %d, want 200", rec.Code)
+		}
+		body = rec.Body.String()
+		if !strings.Contains(body, `warehouse_stock_movements_posted_total{source="MANUAL",type="IN"}`) {
+			t.Error("metrics with the database down lack the movement counters")
+		}
+		if strings.Contains(body, "warehouse_location_usage_units") {
+			t.Error("metrics with the database down report location usage")
+		}
+	})
+}
+
+func TestE2ETracing(t *testing.T) {
+	spans := tracetest.NewInMemoryExporter()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(spans))
+	otel.SetTracerProvider(provider)
+	t.Cleanup(func() { provider.Shutdown(context.Background()) })
+	if _, err := tracing.Setup(context.Background(), &config.Config{TracesExporter: config.TracesExporterNone}); err != nil {
+		t.Fatal(err)
+	}
+
+	runE2E(t, func(t *testing.T, s *e2eServer) {
+		s.login()
+
+		var traceParents []string
+		receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			traceParents = append(traceParents, r.Header.Get("traceparent"))
+		}))
+		defer receiver.Close()
+		s.ok("POST", "/api/webhooks", models.CreateWebhookRequest{URL: receiver.URL, EventTypes: []string{"movement.created"}}, nil)
+
+		product := s.createProduct("TRACED-1")
+		location := s.createLocation("T1", 10)
+		spans.Reset()
+
+		// The client's trace continues through the request and its webhook
+		const traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+		body, _ := json.Marshal(models.CreateStockMovementRequest{ProductID: product.ID, LocationID: location.ID, Type: "IN", Quantity: 1})
+		req := httptest.NewRequest("POST", "/api/stock-movements", bytes.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+s.token)
+		req.Header.Set("traceparent", "00-"+traceID+"-00f067aa0ba902b7-01")
+		rec := httptest.NewRecorder()
+		s.router.ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("POST /api/stock-movements = %d, want 200", rec.Code)
+		}
+
+		byName := map[string]int{}
+		for _, span := range spans.GetSpans() {
+			if span.SpanContext.TraceID().String() != traceID {
+				t.Errorf("span %s is in trace %s, want %s", span.Name, span.SpanContext.TraceID(), traceID)
+			}
+			byName[span.Name]++
+		}
+		if byName["/api/stock-movements"] != 1 || byName["StockService.Create"] != 1 {
+			t.Errorf("spans = %v, want the request and StockService.Create", byName)
+		}
+		// Product and location lookups, cost layers and usage, then the
+		// product update and the movement, layer and event inserts
+		if byName["SELECT"] < 4 || byName["INSERT"] < 3 || byName["UPDATE"] < 1 {
+			t.Errorf("spans = %v, want a span for each statement", byName)
+		}
+
+		if attempted, err := s.app.webhookService.DeliverDue(context.Background()); err != nil || attempted != 1 {
+			t.Fatalf("DeliverDue = %d, %v, want 1 attempt", attempted, err)
+		}
+		if len(traceParents) != 1 || !strings.HasPrefix(traceParents[0], "00-"+traceID+"-") {
+			t.Errorf("webhook traceparent = %v, want one in trace %s", traceParents, traceID)
+		}
+	})
+}
+
+func TestE2ELogging(t *testing.T) {
+	var logs bytes.Buffer
+	previous := slog.Default()
+	slog.SetDefault(logging.New(&logs, slog.LevelDebug))
+	t.Cleanup(func() { slog.SetDefault(previous) })
+
+	runE2E(t, func(t *testing.T, s *e2eServer) {
+		s.login()
+		product := s.createProduct("LOGGED-1")
+		location := s.createLocation("L1", 10)
+		logs.Reset()
+
+		send := func(method, path string, body interface{}, requestID string) *httptest.ResponseRecorder {
+			encoded, _ := json.Marshal(body)
+			req := httptest.NewRequest(method, path, bytes.NewReader(encoded))
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("Authorization", "Bearer "+s.token)
+			if requestID != "" {
+				req.Header.Set(middleware.RequestIDHeader, requestID)
+			}
+			rec := httptest.NewRecorder()
+			s.router.ServeHTTP(rec, req)
+			return rec
+		}
+
+		// A client's request ID is echoed and tags the service's records too
+		rec := send("POST", "/api/stock-movements", models.CreateStockMovementRequest{ProductID: product.ID, LocationID: location.ID, Type: "IN", Quantity: 1}, "client-id-1")
+		if rec.Code != http.StatusOK || rec.Header().Get(middleware.RequestIDHeader) != "client-id-1" {
+			t.Fatalf("POST /api/stock-movements = %d with request ID %q, want 200 and the client's", rec.Code, rec.Header().Get(middleware.RequestIDHeader))
+		}
+		// An invalid one is replaced
+		rec = send("GET", fmt.Sprintf("/api/products/%d/stock-card", product.ID+1000), nil, "has spaces")
+		generated := rec.Header().Get(middleware.RequestIDHeader)
+		if rec.Code != http.StatusNotFound || len(generated) != 32 {
+			t.Fatalf("GET stock card = %d with request ID %q, want 404 and a generated ID", rec.Code, generated)
+		}
+
+		var posted, request, missing map[string]interface{}
+		for _, line := range strings.Split(strings.TrimSpace(logs.String()), "\n") {
+			var record map[string]interface{}
+			if err := json.Unmarshal([]byte(line), &record); err != nil {
+				t.Fatalf("log line %q is not JSON: %v", line, err)
+			}
+			switch {
+			case record["msg"] == "Stock movement posted":
+				posted = record
+			case record["msg"] == "request" && record["request_id"] == "client-id-1":
+				request = record
+			case record["msg"] == "request" && record["request_id"] == generated:
+				missing = record
+			}
+		}
+		if posted == nil || posted["request_id"] != "client-id-1" || posted["username"] != "admin" {
+			t.Errorf("movement record = %v, want the request's ID and username", posted)
+		}
+		if request == nil || request["route"] != "/api/stock-movements" || request["status"] != float64(200) ||
+			request["username"] != "admin" || request["latency_ms"] == nil {
+			t.Errorf("request record = %v, want its route, status, username and latency", request)
+		}
+		if missing == nil || missing["level"] != "WARN" || missing["route"] != "/api/products/:id/stock-card" ||
+			missing["error_class"] != "not_found" || missing["error_code"] != services.ErrProductNotFound.Code {
+			t.Errorf("failed request record = %v, want a warning with the route template and error class", missing)
+		}
+		if headers, _ := request["headers"].(map[string]interface{}); headers["Authorization"] != logging.Redacted {
+			t.Errorf("logged headers = %v, want Authorization redacted", request["headers"])
+		}
+		if strings.Contains(logs.String(), s.token) {
+			t.Error("logs contain the bearer token")
+		}
+	})
+}
+
+func TestE2EProducts(t *testing.T) {
+	runE2E(t, func(t *testing.T, s *e2eServer) {
+		s.login()
+
+		widget := s.createProduct("WIDGET-1")
+		s.createProduct("GADGET-1")
+		if widget.ID == 0 || widget.CostingMethod != models.CostingFIFO || widget.Quantity != 0 {
+			t.Errorf("created product = %+v", widget)
+		}
+
+		s.fails("POST", "/api/products", models.CreateProductRequest{SKUName: "WIDGET-1"}, http.StatusConflict, "sku_exists")
+		s.fails("POST", "/api/products", models.CreateProductRequest{SKUName: "X", CostingMethod: "LIFO"}, http.StatusBadRequest, "validation_failed")
+		s.fails("POST", "/api/products", models.CreateProductRequest{}, http.StatusBadRequest, "validation_failed")
+
+		var list struct {
+			Products   []*models.Product       `json:"products"`
+			Pagination models.CursorPagination `json:"pagination"`
+		}
+		s.ok("GET", "/api/products?search=widget", nil, &list)
+		if len(list.Products) != 1 || list.Products[0].ID != widget.ID {
+			t.Errorf("search returned %+v, want WIDGET-1 only", list.Products)
+		}
+
+		s.ok("GET", "/api/products?limit=1&sort=sku_name", nil, &list)
+		if len(list.Products) != 1 || list.Products[0].SKUName != "GADGET-1" || !list.Pagination.HasMore {
+			t.Fatalf("first page = %+v %+v, want GADGET-1 with more", list.Products, list.Pagination)
+		}
+		s.ok("GET", "/api/products?limit=1&sort=sku_name&cursor="+list.Pagination.NextCursor, nil, &list)
+		if len(list.Products) != 1 || list.Products[0].SKUName != "WIDGET-1" || list.Pagination.HasMore {
+			t.Errorf("second page = %+v %+v, want WIDGET-1 and no more", list.Products, list.Pagination)
+		}
+		s.fails("GET", "/api/products?sort=password", nil, http.StatusBadRequest, "invalid_sort")
+		s.fails("GET", "/api/products?limit=zero", nil, http.StatusBadRequest, "invalid_parameter")
+
+		reorderLevel := 3
+		var updated models.Product
+		s.ok("PUT", fmt.Sprintf("/api/products/%d", widget.ID), models.UpdateProductRequest{
+			SKUName:       "WIDGET-2",
+			CostingMethod: models.CostingAVG,
+			ReorderLevel:  &reorderLevel,
+		}, &updated)
+		if updated.SKUName != "WIDGET-2" || updated.CostingMethod != models.CostingAVG || updated.ReorderLevel != 3 {
+			t.Errorf("updated product = %+v", updated)
+		}
+
+		s.fails("PUT", "/api/products/9999", models.UpdateProductRequest{SKUName: "NOPE"}, http.StatusNotFound, "product_not_found")
+		s.fails("PUT", "/api/products/abc", models.UpdateProductRequest{SKUName: "NOPE"}, http.StatusBadRequest, "invalid_parameter")
+		s.fails("PUT", fmt.Sprintf("/api/products/%d", widget.ID), models.UpdateProductRequest{SKUName: "GADGET-1"}, http.StatusConflict, "sku_exists")
+	})
+}
+
+func TestE2ELocations(t *testing.T) {
+	runE2E(t, func(t *testing.T, s *e2eServer) {
+		s.login()
+
+		s.createLocation("A-01", 100)
+		s.createLocation("B-01", 50)
+
+		s.fails("POST", "/api/locations", models.CreateLocationRequest{Code: "A-01", Name: "Again", Capacity: 10}, http.StatusConflict, "location_code_exists")
+		problem := s.fails("POST", "/api/locations", models.CreateLocationRequest{Code: "C-01", Name: "No room"}, http.StatusBadRequest, "validation_failed")
+		if len(problem.Errors) != 1 || problem.Errors[0].Field != "capacity" {
+			t.Errorf("errors = %+v, want one for capacity", problem.Errors)
+		}
+
+		var list struct {
+			Locations []*models.LocationWithUsage `json:"locations"`
+		}
+		s.ok("GET", "/api/locations?min_capacity=60", nil, &list)
+		if len(list.Locations) != 1 || list.Locations[0].Code != "A-01" || list.Locations[0].Available != 100 {
+			t.Errorf("locations = %+v, want A-01 with 100 available", list.Locations)
+		}
+	})
+}
+
+func TestE2EStockMovements(t *testing.T) {
+	runE2E(t, func(t *testing.T, s *e2eServer) {
+		s.login()
+
+		product := s.createProduct("WIDGET-1")
+		location := s.createLocation("A-01", 10)
+
+		in := s.post(product.ID, location.ID, "IN", 8)
+		if in.CreatedBy != "admin" || in.Source != models.MovementSourceManual {
+			t.Errorf("movement by %q from %q, want admin via MANUAL", in.CreatedBy, in.Source)
+		}
+		s.post(product.ID, location.ID, "OUT", 3)
+
+		movement := func(productID, locationID int, movementType string, quantity int) models.CreateStockMovementRequest {
+			return models.CreateStockMovementRequest{ProductID: productID, LocationID: locationID, Type: movementType, Quantity: quantity}
+		}
+		s.fails("POST", "/api/stock-movements", movement(product.ID, location.ID, "OUT", 6), http.StatusBadRequest, "insufficient_quantity")
+		s.fails("POST", "/api/stock-movements", movement(product.ID, location.ID, "IN", 6), http.StatusBadRequest, "capacity_exceeded")
+		s.fails("POST", "/api/stock-movements", movement(9999, location.ID, "IN", 1), http.StatusNotFound, "product_not_found")
+		s.fails("POST", "/api/stock-movements", movement(product.ID, 9999, "IN", 1), http.StatusNotFound, "location_not_found")
+		s.fails("POST", "/api/stock-movements", movement(product.ID, location.ID, "MOVE", 1), http.StatusBadRequest, "validation_failed")
+		s.fails("POST", "/api/stock-movements", movement(product.ID, location.ID, "IN", 0), http.StatusBadRequest, "validation_failed")
+
+		var products struct {
+			Products []*models.Product `json:"products"`
+		}
+		s.ok("GET", fmt.Sprintf("/api/products?id=%d", product.ID), nil, &products)
+		if len(products.Products) != 1 || products.Products[0].Quantity != 5 {
+			t.Fatalf("products = %+v, want quantity 5", products.Products)
+		}
+
+		var list struct {
+			Movements  []*models.StockMovement `json:"movements"`
+			Pagination models.CursorPagination `json:"pagination"`
+		}
+		s.ok("GET", "/api/stock-movements?type=IN", nil, &list)
+		if len(list.Movements) != 1 || list.Movements[0].ID != in.ID {
+			t.Errorf("IN movements = %+v, want only the receipt", list.Movements)
+		}
+		s.fails("GET", "/api/stock-movements?product_id=abc", nil, http.StatusBadRequest, "invalid_parameter")
+
+		var batch models.BatchStockMovementResult
+		s.ok("POST", "/api/stock-movements/batch", models.BatchStockMovementRequest{
+			Mode: models.BatchModeBestEffort,
+			Movements: []*models.CreateStockMovementRequest{
+				{ProductID: product.ID, LocationID: location.ID, Type: "IN", Quantity: 5},
+				{ProductID: product.ID, LocationID: location.ID, Type: "IN", Quantity: 1},
+			},
+		}, &batch)
+		if batch.Succeeded != 1 || batch.Failed != 1 {
+			t.Errorf("batch = %d succeeded, %d failed, want 1 and 1", batch.Succeeded, batch.Failed)
+		}
+
+		// Reversing the receipt needs its 8 units on hand
+		s.post(product.ID, location.ID, "OUT", 5)
+		s.fails("POST", fmt.Sprintf("/api/stock-movements/%d/reverse", in.ID), models.ReverseStockMovementRequest{Reason: "miscount"}, http.StatusBadRequest, "insufficient_quantity")
+		s.post(product.ID, location.ID, "IN", 3)
+
+		var reversal models.StockMovementReversal
+		s.ok("POST", fmt.Sprintf("/api/stock-movements/%d/reverse", in.ID), models.ReverseStockMovementRequest{Reason: "miscount"}, &reversal)
+		if reversal.Reversal.Type != "OUT" || reversal.Reversal.Quantity != 8 || reversal.Original.ReversedBy != "admin" {
+			t.Errorf("reversal = %+v of %+v", reversal.Reversal, reversal.Original)
+		}
+		s.fails("POST", fmt.Sprintf("/api/stock-movements/%d/reverse", in.ID), models.ReverseStockMovementRequest{Reason: "again"}, http.StatusConflict, "already_reversed")
+		s.fails("POST", fmt.Sprintf("/api/stock-movements/%d/reverse", reversal.Reversal.ID), models.ReverseStockMovementRequest{Reason: "undo"}, http.StatusBadRequest, "reversal_not_reversible")
+		s.fails("POST", "/api/stock-movements/9999/reverse", models.ReverseStockMovementRequest{Reason: "gone"}, http.StatusNotFound, "stock_movement_not_found")
+		s.fails("POST", fmt.Sprintf("/api/stock-movements/%d/reverse", in.ID), `{}`, http.StatusBadRequest, "validation_failed")
+
+		s.ok("GET", fmt.Sprintf("/api/products?id=%d", product.ID), nil, &products)
+		if products.Products[0].Quantity != 0 {
+			t.Errorf("quantity after reversal = %d, want 0", products.Products[0].Quantity)
+		}
+	})
+}
+
+func TestE2EReports(t *testing.T) {
+	runE2E(t, func(t *testing.T, s *e2eServer) {
+		s.login()
+
+		widget := s.createProduct("WIDGET-1")
+		var bolt models.Product
+		s.ok("POST", "/api/products", models.CreateProductRequest{SKUName: "BOLT-1", CostingMethod: models.CostingAVG}, &bolt)
+		location := s.createLocation("A-01", 100)
+
+		receive := func(productID, quantity int, unitCost float64) {
+			s.ok("POST", "/api/stock-movements", models.CreateStockMovementRequest{
+				ProductID: productID, LocationID: location.ID, Type: "IN", Quantity: quantity, UnitCost: &unitCost,
+			}, nil)
+		}
+		receive(widget.ID, 10, 2.5)
+		s.post(widget.ID, location.ID, "OUT", 4)
+		receive(bolt.ID, 4, 1)
+		receive(bolt.ID, 4, 2)
+
+		var valuation models.ValuationReport
+		s.ok("GET", "/api/reports/valuation", nil, &valuation)
+		if valuation.TotalValue != 27 || len(valuation.Products) != 2 {
+			t.Errorf("valuation = %v over %d products, want 27 over 2", valuation.TotalValue, len(valuation.Products))
+		}
+		for _, p := range valuation.Products {
+			if p.ProductID == bolt.ID && (p.Quantity != 8 || p.Value != 12) {
+				t.Errorf("BOLT-1 valued at %d for %v, want 8 for 12 at the average cost", p.Quantity, p.Value)
+			}
+		}
+
+		s.ok("POST", "/api/stock/snapshots", nil, nil)
+		s.post(widget.ID, location.ID, "OUT", 1)
+
+		var balances models.StockBalanceReport
+		s.ok("GET", fmt.Sprintf("/api/stock?product_id=%d", widget.ID), nil, &balances)
+		if balances.SnapshotID == nil || len(balances.Products) != 1 || balances.Products[0].Quantity != 5 {
+			t.Errorf("balances = %+v from snapshot %v, want WIDGET-1 at 5 from a snapshot", balances.Products, balances.SnapshotID)
+		}
+		s.ok("GET", "/api/stock?as_of=2000-01-01", nil, &balances)
+		if len(balances.Products) != 0 {
+			t.Errorf("balances in 2000 = %+v, want none", balances.Products)
+		}
+
+		var card models.StockCard
+		s.ok("GET", fmt.Sprintf("/api/products/%d/stock-card", widget.ID), nil, &card)
+		if card.ClosingBalance != 5 || len(card.Entries) != 3 {
+			t.Errorf("stock card closes at %d after %d entries, want 5 after 3", card.ClosingBalance, len(card.Entries))
+		}
+
+		var list struct {
+			Movements []*models.StockMovement `json:"movements"`
+		}
+		s.ok("GET", fmt.Sprintf("/api/stock-movements?product_id=%d&product_id=%d&start_date=2000-01-01", widget.ID, bolt.ID), nil, &list)
+		if len(list.Movements) != 5 {
+			t.Errorf("movements since 2000 = %d, want 5", len(list.Movements))
+		}
+		s.ok("GET", "/api/stock-movements?end_date=2000-01-01", nil, &list)
+		if len(list.Movements) != 0 {
+			t.Errorf("movements before 2000 = %d, want 0", len(list.Movements))
+		}
+
+		var reconciliation models.ReconciliationReport
+		s.ok("GET", "/api/stock/reconciliation", nil, &reconciliation)
+		if len(reconciliation.Discrepancies) != 0 {
+			t.Errorf("discrepancies = %+v, want none", reconciliation.Discrepancies)
+		}
+	})
+}
+
+func TestE2EValuationReportsUnlayeredStock(t *testing.T) {
+	runE2E(t, func(t *testing.T, s *e2eServer) {
+		s.login()
+
+		var product models.Product
+		s.ok("POST", "/api/products", models.CreateProductRequest{SKUName: "LOOSE-1", Quantity: 4}, &product)
+		location := s.createLocation("A-01", 100)
+		unitCost := 2.0
+		s.ok("POST", "/api/stock-movements", models.CreateStockMovementRequest{
+			ProductID: product.ID, LocationID: location.ID, Type: "IN", Quantity: 6, UnitCost: &unitCost,
+		}, nil)
+		s.post(product.ID, location.ID, "OUT", 1)
+
+		var valuation models.ValuationReport
+		s.ok("GET", "/api/reports/valuation", nil, &valuation)
+		if len(valuation.Products) != 1 {
+			t.Fatalf("valued %d products, want 1", len(valuation.Products))
+		}
+		p := valuation.Products[0]
+		if p.Quantity != 9 || p.UnlayeredQuantity != 4 || p.Value != 18 || len(p.Locations) != 1 || p.Locations[0].Quantity != 5 {
+			t.Errorf("LOOSE-1 valued at %d (%d unlayered) for %v over %+v, want 9 (4 unlayered) for 18 over 5 at A-01",
+				p.Quantity, p.UnlayeredQuantity, p.Value, p.Locations)
+		}
+
+		s.ok("GET", "/api/reports/valuation?as_of=2000-01-01T00:00:00Z", nil, &valuation)
+		if len(valuation.Products) != 0 {
+			t.Errorf("valuation in 2000 = %+v, want none", valuation.Products)
+		}
+	})
+}
+
+// TestE2ENonUTCSession checks that time windows compare instants, not wall
+// clocks, when the database sessions run in a time zone other than UTC.
+func TestE2ENonUTCSession(t *testing.T) {
+	db := openTestDB(t, "timezone=Asia/Jakarta")
+	utils.InitJWT("e2e-test-secret")
+	a := newApp(e2eConfig(config.DriverPostgres), db)
+	s := &e2eServer{t: t, db: db, app: a, router: newRouter(a)}
+	s.login()
+
+	var zone string
+	if err := db.QueryRow("SHOW timezone").Scan(&zone); err != nil || zone != "Asia/Jakarta" {
+		t.Fatalf("session time zone = %q (%v), want Asia/Jakarta", zone, err)
+	}
+
+	product := s.createProduct("WIDGET-1")
+	location := s.createLocation("A-01", 100)
+	before := time.Now().Add(-time.Second).Truncate(time.Second)
+	s.post(product.ID, location.ID, "IN", 5)
+	after := time.Now().Truncate(time.Second).Add(time.Second)
+
+	jakarta := time.FixedZone("WIB", 7*60*60)
+	for _, at := range []time.Time{after.UTC(), after.In(jakarta)} {
+		var balances models.StockBalanceReport
+		s.ok("GET", "/api/stock?as_of="+url.QueryEscape(at.Format(time.RFC3339)), nil, &balances)
+		if len(balances.Products) != 1 || balances.Products[0].Quantity != 5 {
+			t.Errorf("balances as of %s = %+v, want WIDGET-1 at 5", at.Format(time.RFC3339), balances.Products)
+		}
+	}
+	for _, at := range []time.Time{before.UTC(), before.In(jakarta)} {
+		var balances models.StockBalanceReport
+		s.ok("GET", "/api/stock?as_of="+url.QueryEscape(at.Format(time.RFC3339)), nil, &balances)
+		if len(balances.Products) != 0 {
+			t.Errorf("balances as of %s = %+v, want none", at.Format(time.RFC3339), balances.Products)
+		}
+	}
+
+	var list struct {
+		Movements []*models.StockMovement `json:"movements"`
+	}
+	for _, at := range []string{before.UTC().Format(time.RFC3339), before.In(jakarta).Format(time.RFC3339), before.UTC().Format("2006-01-02T15:04:05")} {
+		s.ok("GET", "/api/stock-movements?start_date="+url.QueryEscape(at), nil, &list)
+		if len(list.Movements) != 1 {
+			t.Errorf("movements since %s = %d, want 1", at, len(list.Movements))
+		}
+		s.ok("GET", "/api/stock-movements?end_date="+url.QueryEscape(at), nil, &list)
+		if len(list.Movements) != 0 {
+			t.Errorf("movements until %s = %d, want 0", at, len(list.Movements))
+		}
+	}
+}
+
+// TestE2EMigrationsOutwaitStatementTimeout checks that migrating waits for
+// another process's migration lock beyond the statement_timeout the server's
+// sessions run with, and leaves that timeout in place afterwards.
+func TestE2EMigrationsOutwaitStatementTimeout(t *testing.T) {
+	// openTestDB migrates under the timeout too, one statement at a time
+	db := openTestDB(t, "statement_timeout=50ms")
+	db.SetMaxOpenConns(2)
+
+	other, err := db.Conn(context.Background())
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	defer other.Close()
+	if _, err := other.ExecContext(context.Background(), "SELECT pg_advisory_lock($1)", migrate.LockID); err != nil {
+		t.Fatalf("take the migration lock: %v", err)
+	}
+	go func() {
+		time.Sleep(300 * time.Millisecond)
+		other.ExecContext(context.Background(), "SELECT pg_advisory_unlock($1)", migrate.LockID)
+	}()
+
+	migrator, err := migrate.New(db, config.DriverPostgres, migrations.For(config.DriverPostgres))
+	if err != nil {
+		t.Fatalf("load migrations: %v", err)
+	}
+	start := time.Now()
+	if _, err := migrator.Up(); err != nil {
+		t.Fatalf("migrate while the lock is held for 300ms: %v", err)
+	}
+	if waited := time.Since(start); waited < 250*time.Millisecond {
+		t.Errorf("migrated after %v, before the lock was released", waited)
+	}
+
+	// other is still held, so the pool's only idle connection is the one
+	// that migrated, and it is back to the timeout of the database
+	var timeout string
+	if err := db.QueryRow("SHOW statement_timeout").Scan(&timeout); err != nil || timeout != "50ms" {
+		t.Errorf("statement_timeout after migrating = %q (%v), want 50ms", timeout, err)
+	}
+}
+
+func TestE2EWebhooks(t *testing.T) {
+	runE2E(t, func(t *testing.T, s *e2eServer) {
+		s.login()
+
+		var received []string
+		receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			received = append(received, r.Header.Get("X-Webhook-Event"))
+		}))
+		defer receiver.Close()
+
+		var subscription models.WebhookSubscription
+		s.ok("POST", "/api/webhooks", models.CreateWebhookRequest{URL: receiver.URL, EventTypes: []string{"movement.created"}}, &subscription)
+		if subscription.Secret == "" {
+			t.Error("subscription created without a secret")
+		}
+		var subscriptions []*models.WebhookSubscription
+		s.ok("GET", "/api/webhooks", nil, &subscriptions)
+		if len(subscriptions) != 1 || len(subscriptions[0].EventTypes) != 1 || subscriptions[0].EventTypes[0] != "movement.created" || subscriptions[0].Secret != "" {
+			t.Errorf("subscriptions = %+v, want one for movement.created without its secret", subscriptions)
+		}
+
+		product := s.createProduct("WIDGET-1")
+		location := s.createLocation("A-01", 10)
+		s.post(product.ID, location.ID, "IN", 1)
+
+		var deliveries struct {
+			Deliveries []*models.WebhookDelivery `json:"deliveries"`
+		}
+		s.ok("GET", "/api/webhooks/deliveries?status=pending", nil, &deliveries)
+		if len(deliveries.Deliveries) != 1 || deliveries.Deliveries[0].EventType != "movement.created" {
+			t.Fatalf("pending deliveries = %+v, want the movement only", deliveries.Deliveries)
+		}
+		delivery := deliveries.Deliveries[0]
+
+		deliver := func() {
+			t.Helper()
+			if attempted, err := s.app.webhookService.DeliverDue(context.Background()); err != nil || attempted != 1 {
+				t.Fatalf("DeliverDue = %d, %v, want 1 attempt", attempted, err)
+			}
+		}
+		deliver()
+		s.ok("GET", "/api/webhooks/deliveries?status=delivered", nil, &deliveries)
+		if len(deliveries.Deliveries) != 1 || deliveries.Deliveries[0].DeliveredAt == nil {
+			t.Errorf("delivered deliveries = %+v, want the movement", deliveries.Deliveries)
+		}
+
+		var redelivered models.WebhookDelivery
+		s.ok("POST", fmt.Sprintf("/api/webhooks/deliveries/%d/redeliver", delivery.ID), nil, &redelivered)
+		if redelivered.Status != models.WebhookDeliveryPending || redelivered.Attempts != 0 {
+			t.Errorf("redelivered = %+v, want pending with no attempts", redelivered)
+		}
+		deliver()
+		if len(received) != 2 || received[0] != "movement.created" {
+			t.Errorf("received %v, want movement.created twice", received)
+		}
+
+		s.fails("POST", "/api/webhooks/deliveries/9999/redeliver", nil, http.StatusNotFound, "webhook_delivery_not_found")
+		s.ok("DELETE", fmt.Sprintf("/api/webhooks/%d", subscription.ID), nil, nil)
+		s.fails("DELETE", fmt.Sprintf("/api/webhooks/%d", subscription.ID), nil, http.StatusNotFound, "webhook_subscription_not_found")
+	})
+}
+
+// eventPage is the data of GET /api/events.
+type eventPage struct {
+	Events            []*models.OutboxEvent `json:"events"`
+	NextAfterPosition int64                 `json:"next_after_position"`
+}
+
+func eventIDs(page *eventPage) []string {
+	ids := make([]string, 0, len(page.Events))
+	for _, event := range page.Events {
+		ids = append(ids, event.EventID)
+	}
+	return ids
+}
+
+func TestE2EEvents(t *testing.T) {
+	runE2E(t, func(t *testing.T, s *e2eServer) {
+		s.login()
+		ctx := context.Background()
+		product := s.createProduct("EVT-1")
+
+		// Events are served once the relay has positioned them
+		var page eventPage
+		s.ok("GET", "/api/events", nil, &page)
+		if len(page.Events) != 0 || page.NextAfterPosition != 0 {
+			t.Fatalf("before relaying got %d events, next %d", len(page.Events), page.NextAfterPosition)
+		}
+		if _, err := s.app.outboxService.Relay(ctx); err != nil {
+			t.Fatalf("relay: %v", err)
+		}
+		s.ok("GET", fmt.Sprintf("/api/events?aggregate_type=product&aggregate_id=%d", product.ID), nil, &page)
+		if len(page.Events) != 1 || page.Events[0].EventType != models.EventProductCreated || page.Events[0].Position == nil {
+			t.Fatalf("got events %+v", page.Events)
+		}
+		if page.NextAfterPosition != *page.Events[0].Position {
+			t.Errorf("next_after_position = %d, want %d", page.NextAfterPosition, *page.Events[0].Position)
+		}
+
+		s.ok("GET", fmt.Sprintf("/api/events?after_position=%d", page.NextAfterPosition), nil, &page)
+		if len(page.Events) != 0 {
+			t.Errorf("after the last position got %v", eventIDs(&page))
+		}
+		s.fails("GET", "/api/events?after_position=x", nil, http.StatusBadRequest, "invalid_parameter")
+	})
+}
+
+// TestE2EEventsFollowCommitOrder records an event in each of two interleaved
+// transactions, so the one holding the lower ID commits last, and checks that
+// a consumer paging through /api/events still receives both.
+func TestE2EEventsFollowCommitOrder(t *testing.T) {
+	runE2E(t, func(t *testing.T, s *e2eServer) {
+		if _, ok := s.app.store.(*repositories.SQLiteStore); ok {
+			t.Skip("SQLite serialises write transactions, so their commits cannot interleave")
+		}
+		s.login()
+		ctx := context.Background()
+		outbox := s.app.outboxService
+
+		begin := func(eventID string) repositories.Tx {
+			tx, err := s.app.store.Begin(ctx)
+			if err != nil {
+				t.Fatalf("begin: %v", err)
+			}
+			t.Cleanup(func() { tx.Rollback() })
+			event := &models.Event{ID: eventID, Type: models.EventProductUpdated, OccurredAt: time.Now(), AggregateType: models.AggregateProduct, AggregateID: 1}
+			if err := outbox.Record(ctx, tx, event); err != nil {
+				t.Fatalf("record %s: %v", eventID, err)
+			}
+			return tx
+		}
+		relay := func() {
+			if _, err := outbox.Relay(ctx); err != nil {
+				t.Fatalf("relay: %v", err)
+			}
+		}
+
+		slow := begin("slow")
+		fast := begin("fast")
+		if err := fast.Commit(); err != nil {
+			t.Fatalf("commit fast: %v", err)
+		}
+		relay()
+
+		var page eventPage
+		s.ok("GET", "/api/events", nil, &page)
+		if ids := eventIDs(&page); len(ids) != 1 || ids[0] != "fast" {
+			t.Fatalf("with slow uncommitted got %v, want [fast]", ids)
+		}
+
+		if err := slow.Commit(); err != nil {
+			t.Fatalf("commit slow: %v", err)
+		}
+		relay()
+
+		s.ok("GET", fmt.Sprintf("/api/events?after_position=%d", page.NextAfterPosition), nil, &page)
+		if ids := eventIDs(&page); len(ids) != 1 || ids[0] != "slow" {
+			t.Fatalf("after fast got %v, want [slow]", ids)
+		}
+	})
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"warehouse-api/internal/config"
+	"warehouse-api/internal/logging"
+	"warehouse-api/internal/models"
+	"warehouse-api/internal/tabular"
+)
+
+// runImport implements
+// `warehouse-api import [-dry-run] [-user name] <products|locations|opening-balances> FILE`.
+// It prints the import report as JSON and exits with status 1 when any row
+// was rejected.
+func runImport(args []string) {
+	flags := flag.NewFlagSet("import", flag.ExitOnError)
+	dryRun := flags.Bool("dry-run", false, "validate every row without writing anything")
+	user := flags.String("user", "import", "recorded as created_by on opening balance movements")
+	loader := config.NewLoader(flags)
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: warehouse-api import [flags] <products|locations|opening-balances> FILE")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	if flags.NArg() != 2 {
+		flags.Usage()
+		os.Exit(2)
+	}
+	kind, path := flags.Arg(0), flags.Arg(1)
+	if kind != models.ImportProducts && kind != models.ImportLocations && kind != models.ImportOpeningBalances {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	format, err := tabular.FormatFromFilename(path)
+	if err != nil {
+		fatal("Failed to import", slog.String("path", path), logging.Err(err))
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		fatal("Failed to import", slog.String("path", path), logging.Err(err))
+	}
+	rows, err := tabular.Read(file, format)
+	file.Close()
+	if err != nil {
+		fatal("Failed to read import file", slog.String("path", path), logging.Err(err))
+	}
+
+	cfg, db := setup(loader)
+	report, err := newApp(cfg, db).importService.Import(context.Background(), kind, rows, *dryRun, *user)
+	db.Close()
+	if err != nil {
+		fatal("Failed to import", slog.String("kind", kind), logging.Err(err))
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(report); err != nil {
+		fatal("Failed to write report", logging.Err(err))
+	}
+
+	if len(report.Errors) > 0 {
+		os.Exit(1)
+	}
+}
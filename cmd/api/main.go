@@ -1,134 +1,268 @@
 package main
 
 import (
+	"context"
+	"crypto/tls"
 	"database/sql"
+	"errors"
+	"flag"
 	"fmt"
-	"log"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
 	"warehouse-api/internal/config"
-	"warehouse-api/internal/handlers"
-	"warehouse-api/internal/middleware"
+	"warehouse-api/internal/grpcserver"
+	"warehouse-api/internal/logging"
+	"warehouse-api/internal/migrate"
 	"warehouse-api/internal/repositories"
 	"warehouse-api/internal/services"
+	"warehouse-api/internal/tracing"
 	"warehouse-api/internal/utils"
+	"warehouse-api/internal/workers"
+	"warehouse-api/migrations"
 
-	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
 )
 
 func main() {
-	// Load configuration
-	cfg, err := config.LoadConfig()
+	// Log at info until the configuration names a level
+	slog.SetDefault(logging.New(os.Stderr, slog.LevelInfo))
+
+	// serve is the default, so flags may follow the binary directly
+	command, args := "serve", os.Args[1:]
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		command, args = args[0], args[1:]
+	}
+	switch command {
+	case "serve":
+	case "reconcile":
+		runReconcile(args)
+		return
+	case "import":
+		runImport(args)
+		return
+	case "migrate":
+		runMigrate(args)
+		return
+	case "config":
+		os.Exit(runConfig(args, os.Stdout, os.Stderr))
+	default:
+		fatal("Unknown command (expected serve, reconcile, import, migrate or config)", slog.String("command", command))
+	}
+
+	if err := serve(args); err != nil {
+		os.Exit(1)
+	}
+}
+
+// serve runs the REST and gRPC servers and the background workers until
+// SIGINT or SIGTERM, then shuts down gracefully: the readiness probe starts
+// failing and the streams end, the servers stop accepting connections and
+// wait up to SHUTDOWN_TIMEOUT for in-flight requests, the workers stop, and
+// finally traces are flushed and the pool closed. A second signal kills the
+// process at once.
+func serve(args []string) error {
+	flags := flag.NewFlagSet("serve", flag.ExitOnError)
+	loader := config.NewLoader(flags)
+	flags.Parse(args)
+
+	cfg, db := setup(loader)
+	defer db.Close()
+
+	shutdownTracing, err := tracing.Setup(context.Background(), cfg)
 	if err != nil {
-		log.Fatal("Failed to load config:", err)
+		fatal("Failed to set up tracing", logging.Err(err))
 	}
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := shutdownTracing(ctx); err != nil {
+			slog.Error("Failed to flush traces", logging.Err(err))
+		}
+	}()
 
-	// Initialize JWT
-	utils.InitJWT(cfg.JWTSecret)
+	signals, stopSignals := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stopSignals()
 
-	// Connect to database
-	db, err := config.ConnectDB(cfg)
+	a := newApp(cfg, db)
+
+	// Start background workers. They run until the servers have drained,
+	// since requests still in flight may rely on them
+	workerCtx, stopWorkers := context.WithCancel(context.Background())
+	defer stopWorkers()
+	a.workers.Go(workerCtx, "snapshots", workers.NewSnapshotWorker(a.ledgerService, cfg.SnapshotInterval).Run)
+	a.workers.Go(workerCtx, "webhooks", workers.NewWebhookWorker(a.webhookService, cfg.WebhookPollInterval).Run)
+	a.workers.Go(workerCtx, "outbox", workers.NewOutboxRelay(a.outboxService, cfg.OutboxPollInterval).Run)
+
+	if store, ok := a.store.(*repositories.SQLiteStore); ok {
+		// A SQLite database has a single process, which hears its own
+		// commits
+		payloads := store.Listen(services.StreamChannel)
+		a.workers.Go(workerCtx, "stream", func(ctx context.Context) {
+			a.streamService.RunLocal(ctx, payloads)
+		})
+	} else {
+		// Listen for committed movements from every replica
+		listener := pq.NewListener(cfg.DSN(), 10*time.Second, time.Minute, func(event pq.ListenerEventType, err error) {
+			if err != nil {
+				slog.Warn("Stream listener lost its connection", logging.Err(err))
+			}
+		})
+		if err := listener.Listen(services.StreamChannel); err != nil {
+			fatal("Failed to listen for stream notifications", slog.String("channel", services.StreamChannel), logging.Err(err))
+		}
+		defer listener.Close()
+		a.workers.Go(workerCtx, "stream", func(ctx context.Context) {
+			a.streamService.Run(ctx, listener)
+		})
+	}
+
+	// Serve the gRPC API alongside the REST API
+	grpcListener, err := net.Listen("tcp", fmt.Sprintf(":%s", cfg.GRPCPort))
 	if err != nil {
-		log.Fatal("Failed to connect to database:", err)
+		fatal("Failed to listen on the gRPC port", slog.String("port", cfg.GRPCPort), logging.Err(err))
 	}
-	defer db.Close()
 
-	// Run migrations
-	if err := runMigrations(db); err != nil {
-		log.Fatal("Failed to run migrations:", err)
+	// Serve both APIs over TLS when given a certificate
+	var tlsConfig *tls.Config
+	var grpcOptions []grpc.ServerOption
+	if cfg.TLSCertFile != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.TLSCertFile, cfg.TLSKeyFile)
+		if err != nil {
+			fatal("Failed to load the TLS certificate", logging.Err(err))
+		}
+		tlsConfig = &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12}
+		grpcOptions = append(grpcOptions, grpc.Creds(credentials.NewTLS(tlsConfig)))
 	}
+	grpcServer := grpcserver.New(a.productService, a.locationService, a.stockService, a.streamService, cfg.GRPCAPIKeys, grpcOptions...)
 
-	// Initialize repositories
-	productRepo := repositories.NewProductRepository(db)
-	locationRepo := repositories.NewLocationRepository(db)
-	stockRepo := repositories.NewStockMovementRepository(db)
+	server := &http.Server{
+		Addr:         fmt.Sprintf(":%s", cfg.Port),
+		Handler:      newRouter(a),
+		TLSConfig:    tlsConfig,
+		ReadTimeout:  cfg.HTTPReadTimeout,
+		WriteTimeout: cfg.HTTPWriteTimeout,
+		IdleTimeout:  cfg.HTTPIdleTimeout,
+	}
 
-	// Initialize services
-	productService := services.NewProductService(productRepo)
-	locationService := services.NewLocationService(locationRepo)
-	stockService := services.NewStockService(stockRepo, productRepo, locationRepo, db)
+	serveErr := make(chan error, 2)
+	go func() {
+		slog.Info("gRPC server starting", slog.String("port", cfg.GRPCPort), slog.Bool("tls", tlsConfig != nil))
+		if err := grpcServer.Serve(grpcListener); err != nil {
+			serveErr <- fmt.Errorf("gRPC server: %w", err)
+		}
+	}()
+	go func() {
+		slog.Info("Server starting", slog.String("port", cfg.Port), slog.Bool("tls", tlsConfig != nil))
+		var err error
+		if tlsConfig != nil {
+			err = server.ListenAndServeTLS("", "")
+		} else {
+			err = server.ListenAndServe()
+		}
+		if !errors.Is(err, http.ErrServerClosed) {
+			serveErr <- fmt.Errorf("HTTP server: %w", err)
+		}
+	}()
 
-	// Initialize handlers
-	authHandler := handlers.NewAuthHandler()
-	productHandler := handlers.NewProductHandler(productService)
-	locationHandler := handlers.NewLocationHandler(locationService)
-	stockHandler := handlers.NewStockHandler(stockService)
+	select {
+	case <-signals.Done():
+		slog.Info("Shutting down")
+	case err = <-serveErr:
+		slog.Error("Shutting down after a server failed", logging.Err(err))
+	}
+	stopSignals()
 
-	// Setup router
-	router := gin.Default()
+	a.health.Drain()
+	a.streamService.Close()
 
-	// Middleware
-	router.Use(middleware.LoggerMiddleware())
-	router.Use(gin.Recovery())
+	shutdownCtx := context.Background()
+	if cfg.ShutdownTimeout > 0 {
+		var cancel context.CancelFunc
+		shutdownCtx, cancel = context.WithTimeout(shutdownCtx, cfg.ShutdownTimeout)
+		defer cancel()
+	}
 
-	// Health check
-	router.GET("/health", func(c *gin.Context) {
-		c.JSON(200, gin.H{"status": "ok"})
-	})
+	if shutdownErr := server.Shutdown(shutdownCtx); shutdownErr != nil {
+		slog.Error("HTTP requests still in flight at the shutdown timeout", logging.Err(shutdownErr))
+		server.Close()
+	}
 
-	// Public routes
-	api := router.Group("/api")
-	{
-		api.POST("/auth/login", authHandler.Login)
+	grpcStopped := make(chan struct{})
+	go func() {
+		grpcServer.GracefulStop()
+		close(grpcStopped)
+	}()
+	select {
+	case <-grpcStopped:
+	case <-shutdownCtx.Done():
+		slog.Error("gRPC calls still in flight at the shutdown timeout")
+		grpcServer.Stop()
 	}
 
-	// Protected routes
-	protected := api.Group("")
-	protected.Use(middleware.AuthMiddleware())
-	{
-		// Products
-		protected.GET("/products", productHandler.GetAll)
-		protected.POST("/products", productHandler.Create)
-		protected.PUT("/products/:id", productHandler.Update)
+	stopWorkers()
+	a.workers.Wait()
+	slog.Info("Shut down")
+	return err
+}
 
-		// Locations
-		protected.GET("/locations", locationHandler.GetAll)
-		protected.POST("/locations", locationHandler.Create)
+// setup loads the configuration, connects to the database and brings the
+// schema up to date, or with AUTO_MIGRATE=false checks that it is. Every
+// command but migrate starts with it, so none runs against a dirty schema.
+func setup(loader *config.Loader) (*config.Config, *sql.DB) {
+	cfg, db := connect(loader)
 
-		// Stock Movements
-		protected.POST("/stock-movements", stockHandler.Create)
-		protected.GET("/stock-movements", stockHandler.GetAll)
+	migrator, err := migrate.New(db, cfg.DBDriver, migrations.For(cfg.DBDriver))
+	if err != nil {
+		fatal("Failed to load migrations", logging.Err(err))
 	}
-
-	// Start server
-	addr := fmt.Sprintf(":%s", cfg.Port)
-	log.Printf("Server starting on port %s", cfg.Port)
-	if err := router.Run(addr); err != nil {
-		log.Fatal("Failed to start server:", err)
+	if cfg.AutoMigrate {
+		_, err = migrator.Up()
+	} else {
+		err = migrator.Verify()
+	}
+	if err != nil {
+		fatal("Refusing to start", logging.Err(err))
 	}
+
+	return cfg, db
 }
 
-func runMigrations(db *sql.DB) error {
-	schema := `
-		CREATE TABLE IF NOT EXISTS products (
-			id SERIAL PRIMARY KEY,
-			sku_name VARCHAR(100) NOT NULL UNIQUE,
-			quantity INTEGER NOT NULL DEFAULT 0,
-			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-			updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
-		);
-
-		CREATE TABLE IF NOT EXISTS locations (
-			id SERIAL PRIMARY KEY,
-			code VARCHAR(50) NOT NULL UNIQUE,
-			name VARCHAR(100) NOT NULL,
-			capacity INTEGER NOT NULL,
-			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
-		);
-
-		CREATE TABLE IF NOT EXISTS stock_movements (
-			id SERIAL PRIMARY KEY,
-			product_id INTEGER REFERENCES products(id) ON DELETE CASCADE,
-			location_id INTEGER REFERENCES locations(id) ON DELETE CASCADE,
-			type VARCHAR(10) CHECK (type IN ('IN', 'OUT')) NOT NULL,
-			quantity INTEGER NOT NULL CHECK (quantity > 0),
-			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
-		);
-
-		CREATE INDEX IF NOT EXISTS idx_stock_movements_product_id ON stock_movements(product_id);
-		CREATE INDEX IF NOT EXISTS idx_stock_movements_location_id ON stock_movements(location_id);
-		CREATE INDEX IF NOT EXISTS idx_stock_movements_created_at ON stock_movements(created_at);
-	`
-
-	_, err := db.Exec(schema)
-	return err
+// connect loads the configuration, refusing to go on when it does not
+// validate, and connects to the database.
+func connect(loader *config.Loader) (*config.Config, *sql.DB) {
+	// Load configuration
+	cfg, err := loader.Load()
+	if err != nil {
+		fatal("Invalid configuration", logging.Err(err))
+	}
+	slog.SetDefault(logging.New(os.Stderr, cfg.LogLevel))
+	if cfg.Env == config.EnvDevelopment {
+		slog.Warn("Running in development mode; secrets are not checked")
+	}
+
+	// Initialize JWT
+	utils.InitJWT(cfg.JWTSecret)
+
+	// Connect to database
+	db, err := config.ConnectDB(cfg)
+	if err != nil {
+		fatal("Failed to connect to database", logging.Err(err))
+	}
+
+	return cfg, db
 }
 
+// fatal logs msg at error level and exits, for failures no command can carry
+// on from.
+func fatal(msg string, attrs ...slog.Attr) {
+	slog.LogAttrs(context.Background(), slog.LevelError, msg, attrs...)
+	os.Exit(1)
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"warehouse-api/internal/config"
+	"warehouse-api/internal/logging"
+	"warehouse-api/internal/migrate"
+	"warehouse-api/migrations"
+)
+
+const migrateUsage = `Usage: warehouse-api migrate <command>
+
+Commands:
+  up                apply every pending migration
+  down [-steps N]   revert the latest N applied migrations (default 1)
+  status            list migrations and their state; exits 1 when the schema is dirty
+  force VERSION     record VERSION as fully applied and clean, without running anything`
+
+// runMigrate implements `warehouse-api migrate <up|down|status|force>`. Unlike
+// the other commands it does not migrate on startup, so it can inspect and
+// repair a dirty schema.
+func runMigrate(args []string) {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, migrateUsage)
+		os.Exit(2)
+	}
+
+	command, args := args[0], args[1:]
+	flags := flag.NewFlagSet("migrate "+command, flag.ExitOnError)
+	steps := 1
+	if command == "down" {
+		flags.IntVar(&steps, "steps", 1, "number of migrations to revert")
+	}
+	loader := config.NewLoader(flags)
+	flags.Usage = func() { fmt.Fprintln(flags.Output(), migrateUsage) }
+	flags.Parse(args)
+
+	var version int
+	switch command {
+	case "up", "down", "status":
+		if flags.NArg() != 0 {
+			flags.Usage()
+			os.Exit(2)
+		}
+	case "force":
+		var err error
+		if flags.NArg() != 1 {
+			flags.Usage()
+			os.Exit(2)
+		}
+		if version, err = strconv.Atoi(flags.Arg(0)); err != nil || version < 0 {
+			fatal("Invalid version", slog.String("version", flags.Arg(0)))
+		}
+	default:
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	cfg, db := connect(loader)
+	defer db.Close()
+
+	migrator, err := migrate.New(db, cfg.DBDriver, migrations.For(cfg.DBDriver))
+	if err != nil {
+		fatal("Failed to load migrations", logging.Err(err))
+	}
+
+	switch command {
+	case "up":
+		count, err := migrator.Up()
+		if err != nil {
+			fatal("Failed to migrate", logging.Err(err))
+		}
+		slog.Info("Applied migrations", slog.Int("count", count))
+	case "down":
+		count, err := migrator.Down(steps)
+		if err != nil {
+			fatal("Failed to revert", logging.Err(err))
+		}
+		slog.Info("Reverted migrations", slog.Int("count", count))
+	case "force":
+		if err := migrator.Force(version); err != nil {
+			fatal("Failed to force version", logging.Err(err))
+		}
+		slog.Info("Schema recorded at version", slog.Int("version", version))
+	case "status":
+		if !printStatus(migrator) {
+			db.Close()
+			os.Exit(1)
+		}
+	}
+}
+
+// printStatus writes one line per migration and reports whether the schema
+// is clean.
+func printStatus(migrator *migrate.Migrator) bool {
+	statuses, err := migrator.Status()
+	if err != nil {
+		fatal("Failed to read migration status", logging.Err(err))
+	}
+
+	clean := true
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "VERSION\tNAME\tSTATE\tAPPLIED AT")
+	for _, s := range statuses {
+		version, name, appliedAt := 0, "", ""
+		if s.Migration != nil {
+			version, name = s.Migration.Version, s.Migration.Name
+		}
+		if s.Applied != nil {
+			version, name = s.Applied.Version, s.Applied.Name
+			appliedAt = s.Applied.AppliedAt.Format("2006-01-02 15:04:05")
+		}
+
+		if s.Dirty() {
+			clean = false
+		}
+		fmt.Fprintf(w, "%04d\t%s\t%s\t%s\n", version, name, s.State(), appliedAt)
+	}
+	w.Flush()
+	return clean
+}
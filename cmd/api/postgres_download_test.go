@@ -0,0 +1,198 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/xi2/xz"
+)
+
+// postgresVersion is the PostgreSQL downloaded when none is installed. The
+// zonky embedded-postgres project publishes a build of it for each platform
+// to Maven Central, as a jar holding a tar.xz of the installation.
+const postgresVersion = "16.9.0"
+
+// postgresRepository is the Maven repository the builds are downloaded
+// from; TEST_POSTGRES_REPOSITORY names a mirror.
+const postgresRepository = "https://repo1.maven.org/maven2"
+
+// downloadPostgres returns the bin directory of the PostgreSQL build for this
+// platform, downloading and unpacking it into the user's cache the first
+// time, so later runs need no network.
+func downloadPostgres() (string, error) {
+	platform, err := postgresPlatform()
+	if err != nil {
+		return "", err
+	}
+	cache, err := postgresCache()
+	if err != nil {
+		return "", err
+	}
+	dir := filepath.Join(cache, "postgres-"+postgresVersion+"-"+platform)
+	binDir := filepath.Join(dir, "bin")
+	if _, err := os.Stat(filepath.Join(binDir, "initdb")); err == nil {
+		return binDir, nil
+	}
+
+	repository := os.Getenv("TEST_POSTGRES_REPOSITORY")
+	if repository == "" {
+		repository = postgresRepository
+	}
+	artifact := "embedded-postgres-binaries-" + platform
+	url := fmt.Sprintf("%s/io/zonky/test/postgres/%s/%s/%s-%s.jar", strings.TrimSuffix(repository, "/"), artifact, postgresVersion, artifact, postgresVersion)
+	jar, err := download(url)
+	if err != nil {
+		return "", err
+	}
+	checksum, err := download(url + ".sha256")
+	if err != nil {
+		return "", err
+	}
+	if sum := sha256.Sum256(jar); hex.EncodeToString(sum[:]) != strings.TrimSpace(string(checksum)) {
+		return "", fmt.Errorf("%s does not match its SHA-256 checksum", url)
+	}
+
+	// Unpack beside the final directory and rename it into place, so an
+	// interrupted or concurrent run never leaves a partial installation
+	if err := os.MkdirAll(cache, 0o755); err != nil {
+		return "", err
+	}
+	tmp, err := os.MkdirTemp(cache, ".download-")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(tmp)
+	if err := os.Chmod(tmp, 0o755); err != nil {
+		return "", err
+	}
+	if err := unpackPostgres(jar, tmp); err != nil {
+		return "", fmt.Errorf("unpack %s: %w", url, err)
+	}
+	if err := os.Rename(tmp, dir); err != nil {
+		// Another run may have unpacked it first
+		if _, statErr := os.Stat(filepath.Join(binDir, "initdb")); statErr != nil {
+			return "", err
+		}
+	}
+	return binDir, nil
+}
+
+// postgresPlatform names this platform as the zonky builds do.
+func postgresPlatform() (string, error) {
+	arch := runtime.GOARCH
+	switch {
+	case arch == "arm64" && (runtime.GOOS == "linux" || runtime.GOOS == "darwin"):
+		arch = "arm64v8"
+	case arch != "amd64":
+		return "", fmt.Errorf("no PostgreSQL build is published for %s/%s", runtime.GOOS, arch)
+	}
+	if _, err := os.Stat("/etc/alpine-release"); err == nil {
+		arch += "-alpine"
+	}
+	return runtime.GOOS + "-" + arch, nil
+}
+
+// postgresCache is the directory downloaded builds are kept in. PostgreSQL
+// runs as nobody when the tests run as root, and root's own cache is closed
+// to it, so root keeps them in the shared temporary directory instead.
+func postgresCache() (string, error) {
+	if os.Geteuid() == 0 {
+		return filepath.Join(os.TempDir(), "warehouse-api-postgres"), nil
+	}
+	cache, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(cache, "warehouse-api", "postgres"), nil
+}
+
+func download(url string) ([]byte, error) {
+	resp, err := http.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET %s: %s", url, resp.Status)
+	}
+	return io.ReadAll(resp.Body)
+}
+
+// unpackPostgres extracts the tar.xz inside jar into dir.
+func unpackPostgres(jar []byte, dir string) error {
+	archive, err := zip.NewReader(bytes.NewReader(jar), int64(len(jar)))
+	if err != nil {
+		return err
+	}
+	var txz *zip.File
+	for _, f := range archive.File {
+		if strings.HasSuffix(f.Name, ".txz") {
+			txz = f
+		}
+	}
+	if txz == nil {
+		return errors.New("no .txz in the jar")
+	}
+	compressed, err := txz.Open()
+	if err != nil {
+		return err
+	}
+	defer compressed.Close()
+	decompressed, err := xz.NewReader(compressed, 0)
+	if err != nil {
+		return err
+	}
+
+	files := tar.NewReader(decompressed)
+	for {
+		header, err := files.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if !filepath.IsLocal(header.Name) {
+			return fmt.Errorf("entry %q escapes the installation", header.Name)
+		}
+		path := filepath.Join(dir, header.Name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			return err
+		}
+
+		switch header.Typeflag {
+		case tar.TypeDir:
+			err = os.MkdirAll(path, 0o755)
+		case tar.TypeSymlink:
+			err = os.Symlink(header.Linkname, path)
+		case tar.TypeReg:
+			err = writeFile(path, files, os.FileMode(header.Mode).Perm())
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func writeFile(path string, r io.Reader, mode os.FileMode) error {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, mode)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
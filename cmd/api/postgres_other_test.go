@@ -0,0 +1,11 @@
+//go:build !unix
+
+package main
+
+import "os/exec"
+
+// asPostgresUser leaves cmd as it is: only Unix has root to step down from.
+func asPostgresUser(cmd *exec.Cmd) {}
+
+// givePostgresUser leaves dir as it is, for the same reason.
+func givePostgresUser(dir string) error { return nil }
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"warehouse-api/internal/migrate"
+	"warehouse-api/migrations"
+
+	"github.com/lib/pq"
+)
+
+// testPostgres is the server the end-to-end tests run against: the one named
+// by TEST_DATABASE_URL, or else a throwaway cluster started on first use and
+// stopped by TestMain, from the local PostgreSQL binaries or, without any,
+// from binaries downloaded once into the user's cache.
+var testPostgres struct {
+	once     sync.Once
+	dsn      string
+	dataDir  string
+	pgCtl    string
+	err      error
+	database atomic.Int32
+}
+
+// openTestDB creates an empty database for one test, migrates it and drops it
+// when the test ends. settings, such as "timezone=Asia/Jakarta", become the
+// defaults of every session on the database. The test fails when PostgreSQL
+// cannot be started, and is skipped only when TEST_DATABASE_URL is "skip".
+func openTestDB(t *testing.T, settings ...string) *sql.DB {
+	t.Helper()
+
+	if os.Getenv("TEST_DATABASE_URL") == "skip" {
+		t.Skip("TEST_DATABASE_URL=skip: PostgreSQL is not tested")
+	}
+	testPostgres.once.Do(startPostgres)
+	if testPostgres.err != nil {
+		t.Fatalf("start PostgreSQL: %v\nInstall PostgreSQL, let the tests download it once, point TEST_DATABASE_URL at a server, or set TEST_DATABASE_URL=skip to test SQLite only", testPostgres.err)
+	}
+
+	admin, err := sql.Open("postgres", testPostgres.dsn)
+	if err != nil {
+		t.Fatalf("connect to PostgreSQL: %v", err)
+	}
+	defer admin.Close()
+
+	name := fmt.Sprintf("warehouse_e2e_%d_%d", os.Getpid(), testPostgres.database.Add(1))
+	if _, err := admin.Exec("CREATE DATABASE " + pq.QuoteIdentifier(name)); err != nil {
+		t.Fatalf("create database: %v", err)
+	}
+	for _, setting := range settings {
+		key, value, _ := strings.Cut(setting, "=")
+		if _, err := admin.Exec("ALTER DATABASE " + pq.QuoteIdentifier(name) + " SET " + pq.QuoteIdentifier(key) + " TO " + pq.QuoteLiteral(value)); err != nil {
+			t.Fatalf("set %s: %v", setting, err)
+		}
+	}
+
+	db, err := sql.Open("postgres", withDatabase(testPostgres.dsn, name))
+	if err != nil {
+		t.Fatalf("connect to %s: %v", name, err)
+	}
+	t.Cleanup(func() {
+		db.Close()
+		admin, err := sql.Open("postgres", testPostgres.dsn)
+		if err != nil {
+			return
+		}
+		defer admin.Close()
+		admin.Exec("DROP DATABASE IF EXISTS " + pq.QuoteIdentifier(name))
+	})
+
+	migrator, err := migrate.New(db, "postgres", migrations.FS)
+	if err != nil {
+		t.Fatalf("load migrations: %v", err)
+	}
+	if _, err := migrator.Up(); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+
+	return db
+}
+
+// withDatabase points a lib/pq key/value DSN or URL at another database.
+func withDatabase(dsn, name string) string {
+	if strings.HasPrefix(dsn, "postgres://") || strings.HasPrefix(dsn, "postgresql://") {
+		base, query, _ := strings.Cut(dsn, "?")
+		if i := strings.LastIndex(base, "/"); i > strings.Index(base, "//")+1 {
+			base = base[:i]
+		}
+		dsn = base + "/" + name
+		if query != "" {
+			dsn += "?" + query
+		}
+		return dsn
+	}
+	return dsn + " dbname=" + name
+}
+
+func startPostgres() {
+	if dsn := os.Getenv("TEST_DATABASE_URL"); dsn != "" {
+		testPostgres.dsn = dsn
+		return
+	}
+
+	binDir, ok := postgresBinDir()
+	if !ok {
+		var err error
+		if binDir, err = downloadPostgres(); err != nil {
+			testPostgres.err = fmt.Errorf("no PostgreSQL binaries installed, and downloading them failed: %w", err)
+			return
+		}
+	}
+
+	dataDir, err := os.MkdirTemp("", "warehouse-e2e-")
+	if err != nil {
+		testPostgres.err = err
+		return
+	}
+	testPostgres.dataDir = dataDir
+	testPostgres.pgCtl = filepath.Join(binDir, "pg_ctl")
+	if err := givePostgresUser(dataDir); err != nil {
+		testPostgres.err = fmt.Errorf("hand the data directory to the PostgreSQL user: %w", err)
+		return
+	}
+
+	// The server listens on a Unix socket in its data directory only, so
+	// it needs no free TCP port and is unreachable from outside
+	initdb := postgresCommand(dataDir, filepath.Join(binDir, "initdb"),
+		"-D", filepath.Join(dataDir, "data"), "-U", "postgres", "-A", "trust", "--no-sync")
+	if out, err := initdb.CombinedOutput(); err != nil {
+		testPostgres.err = fmt.Errorf("initdb: %v: %s", err, out)
+		return
+	}
+
+	start := postgresCommand(dataDir, testPostgres.pgCtl, "start", "-w",
+		"-D", filepath.Join(dataDir, "data"),
+		"-l", filepath.Join(dataDir, "postgres.log"),
+		"-o", fmt.Sprintf("-F -k %s -c listen_addresses=''", dataDir))
+	if out, err := start.CombinedOutput(); err != nil {
+		testPostgres.err = fmt.Errorf("pg_ctl start: %v: %s", err, out)
+		return
+	}
+
+	testPostgres.dsn = fmt.Sprintf("host=%s port=5432 user=postgres sslmode=disable", dataDir)
+}
+
+// postgresCommand runs a PostgreSQL binary from dir as the PostgreSQL user.
+func postgresCommand(dir, name string, args ...string) *exec.Cmd {
+	cmd := exec.Command(name, args...)
+	cmd.Dir = dir
+	asPostgresUser(cmd)
+	return cmd
+}
+
+// stopPostgres stops the cluster startPostgres started, if any.
+func stopPostgres() {
+	if testPostgres.dataDir == "" {
+		return
+	}
+	postgresCommand(testPostgres.dataDir, testPostgres.pgCtl, "stop", "-m", "immediate", "-D", filepath.Join(testPostgres.dataDir, "data")).Run()
+	os.RemoveAll(testPostgres.dataDir)
+}
+
+// postgresBinDir finds the directory holding initdb and pg_ctl: the one on
+// PATH, the one pg_config reports, or a versioned install in a usual place.
+func postgresBinDir() (string, bool) {
+	if path, err := exec.LookPath("initdb"); err == nil {
+		return filepath.Dir(path), true
+	}
+	if out, err := exec.Command("pg_config", "--bindir").Output(); err == nil {
+		dir := strings.TrimSpace(string(out))
+		if _, err := os.Stat(filepath.Join(dir, "initdb")); err == nil {
+			return dir, true
+		}
+	}
+
+	for _, pattern := range []string{
+		"/usr/lib/postgresql/*/bin",
+		"/usr/pgsql-*/bin",
+		"/usr/local/pgsql/bin",
+		"/opt/homebrew/opt/postgresql*/bin",
+		"/usr/local/opt/postgresql*/bin",
+	} {
+		dirs, _ := filepath.Glob(pattern)
+		// Prefer the newest version
+		for i := len(dirs) - 1; i >= 0; i-- {
+			if _, err := os.Stat(filepath.Join(dirs[i], "initdb")); err == nil {
+				return dirs[i], true
+			}
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,36 @@
+//go:build unix
+
+package main
+
+import (
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"syscall"
+)
+
+// nobody is the user the test cluster runs as when the tests run as root,
+// which PostgreSQL refuses.
+const nobody = 65534
+
+// asPostgresUser makes cmd run as nobody when the tests run as root.
+func asPostgresUser(cmd *exec.Cmd) {
+	if os.Geteuid() == 0 {
+		cmd.SysProcAttr = &syscall.SysProcAttr{Credential: &syscall.Credential{Uid: nobody, Gid: nobody}}
+	}
+}
+
+// givePostgresUser hands dir to nobody when the tests run as root, so the
+// cluster can write its data, socket and log there.
+func givePostgresUser(dir string) error {
+	if os.Geteuid() != 0 {
+		return nil
+	}
+	return filepath.WalkDir(dir, func(path string, _ fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		return os.Lchown(path, nobody, nobody)
+	})
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"os"
+	"warehouse-api/internal/config"
+	"warehouse-api/internal/logging"
+	"warehouse-api/internal/models"
+)
+
+// runReconcile implements `warehouse-api reconcile [-repair] [-location-id N]`.
+// It prints the reconciliation report as JSON and exits with status 1 when
+// discrepancies remain unrepaired.
+func runReconcile(args []string) {
+	flags := flag.NewFlagSet("reconcile", flag.ExitOnError)
+	repair := flags.Bool("repair", false, "post ADJUSTMENT movements to repair product quantity drift")
+	locationID := flags.Int("location-id", 0, "location receiving IN adjustments for products not held anywhere in the ledger")
+	user := flags.String("user", "reconcile", "recorded as created_by on adjustment movements")
+	loader := config.NewLoader(flags)
+	flags.Parse(args)
+
+	cfg, db := setup(loader)
+
+	req := &models.ReconcileRequest{Repair: *repair}
+	if *locationID > 0 {
+		req.LocationID = locationID
+	}
+
+	report, err := newApp(cfg, db).reconciliationService.Reconcile(context.Background(), req, *user)
+	db.Close()
+	if err != nil {
+		fatal("Failed to reconcile stock ledger", logging.Err(err))
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(report); err != nil {
+		fatal("Failed to write report", logging.Err(err))
+	}
+
+	for _, d := range report.Discrepancies {
+		if !d.Repaired {
+			os.Exit(1)
+		}
+	}
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"net/http"
+	"warehouse-api/internal/gql"
+	"warehouse-api/internal/handlers"
+	"warehouse-api/internal/middleware"
+	"warehouse-api/internal/tracing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
+)
+
+// probeRoutes are polled by orchestrators and scrapers. They are not traced,
+// and only logged at debug level.
+var probeRoutes = map[string]bool{"/health": true, "/livez": true, "/readyz": true, "/metrics": true}
+
+// newRouter registers every HTTP route. The OpenAPI document in
+// internal/docs must describe each of them.
+func newRouter(a *app) *gin.Engine {
+	// Initialize handlers
+	authHandler := handlers.NewAuthHandler(a.adminUsername, a.adminPasswordHash)
+	productHandler := handlers.NewProductHandler(a.productService)
+	locationHandler := handlers.NewLocationHandler(a.locationService)
+	stockHandler := handlers.NewStockHandler(a.stockService)
+	reportHandler := handlers.NewReportHandler(a.valuationService)
+	ledgerHandler := handlers.NewLedgerHandler(a.ledgerService, a.reconciliationService)
+	importHandler := handlers.NewImportHandler(a.importService)
+	exportHandler := handlers.NewExportHandler(a.exportService)
+	webhookHandler := handlers.NewWebhookHandler(a.webhookService)
+	eventHandler := handlers.NewEventHandler(a.outboxService)
+	streamHandler := handlers.NewStreamHandler(a.streamService, a.streamAllowedOrigins)
+	healthHandler := handlers.NewHealthHandler(a.health)
+	graphqlHandler := handlers.NewGraphQLHandler(gql.NewSchema(a.productService, a.locationService, a.stockService))
+
+	// Setup router
+	router := gin.New()
+
+	// Middleware. Tracing comes first so the spans cover the others, and
+	// leaves out the probes and scrapes that would drown out real requests.
+	// The request log then sees the trace and request IDs, and every
+	// response, including those of recovered panics
+	router.Use(otelgin.Middleware(tracing.ServiceName, otelgin.WithFilter(func(r *http.Request) bool {
+		return !probeRoutes[r.URL.Path]
+	})))
+	router.Use(middleware.RequestID())
+	router.Use(middleware.Logger(probeRoutes))
+	router.Use(middleware.Recovery())
+	router.Use(middleware.Metrics())
+
+	// Probes. /health predates the split and reports readiness
+	router.GET("/livez", healthHandler.Livez)
+	router.GET("/readyz", healthHandler.Readyz)
+	router.GET("/health", healthHandler.Readyz)
+
+	// Prometheus metrics. A collector that fails drops its own metrics, not
+	// the whole scrape
+	router.GET("/metrics", gin.WrapH(promhttp.HandlerFor(a.metrics, promhttp.HandlerOpts{
+		ErrorHandling: promhttp.ContinueOnError,
+	})))
+
+	// API documentation
+	router.GET("/openapi.json", handlers.OpenAPISpec)
+	router.GET("/docs", handlers.SwaggerUI)
+
+	// Public routes
+	api := router.Group("/api")
+	{
+		api.POST("/auth/login", middleware.Timeout(a.requestTimeout), authHandler.Login)
+	}
+
+	// Protected routes
+	protected := api.Group("")
+	protected.Use(middleware.AuthMiddleware(), middleware.Timeout(a.requestTimeout))
+	{
+		// Products
+		protected.GET("/products", productHandler.GetAll)
+		protected.POST("/products", productHandler.Create)
+		protected.PUT("/products/:id", productHandler.Update)
+		protected.GET("/products/:id/stock-card", ledgerHandler.GetStockCard)
+
+		// Locations
+		protected.GET("/locations", locationHandler.GetAll)
+		protected.POST("/locations", locationHandler.Create)
+
+		// Stock Movements
+		protected.POST("/stock-movements", stockHandler.Create)
+		protected.GET("/stock-movements", stockHandler.GetAll)
+		protected.POST("/stock-movements/:id/reverse", stockHandler.Reverse)
+
+		// Stock ledger
+		protected.GET("/stock", ledgerHandler.GetBalances)
+		protected.GET("/stock/snapshots", ledgerHandler.GetSnapshots)
+		protected.GET("/stock/reconciliation", ledgerHandler.GetReconciliation)
+
+		// Webhooks
+		protected.GET("/webhooks", webhookHandler.GetAll)
+		protected.POST("/webhooks", webhookHandler.Create)
+		protected.DELETE("/webhooks/:id", webhookHandler.Delete)
+		protected.GET("/webhooks/deliveries", webhookHandler.GetDeliveries)
+		protected.POST("/webhooks/deliveries/:id/redeliver", webhookHandler.Redeliver)
+
+		// Event stream
+		protected.GET("/events", eventHandler.GetAll)
+
+		// Reports
+		protected.GET("/reports/valuation", reportHandler.Valuation)
+	}
+
+	// Bulk routes read or write the whole ledger or a whole file, so they
+	// get longer than the other protected routes
+	bulk := api.Group("")
+	bulk.Use(middleware.AuthMiddleware(), middleware.Timeout(a.bulkRequestTimeout))
+	{
+		bulk.POST("/stock-movements/batch", stockHandler.CreateBatch)
+		bulk.POST("/stock/snapshots", ledgerHandler.CreateSnapshot)
+		bulk.POST("/stock/reconciliation", ledgerHandler.Reconcile)
+
+		// Imports
+		bulk.POST("/imports/products", importHandler.ImportProducts)
+		bulk.POST("/imports/locations", importHandler.ImportLocations)
+		bulk.POST("/imports/opening-balances", importHandler.ImportOpeningBalances)
+
+		// Exports
+		bulk.GET("/exports/stock-movements", exportHandler.StockMovements)
+		bulk.GET("/exports/stock", exportHandler.Stock)
+		bulk.GET("/exports/locations", exportHandler.Locations)
+	}
+
+	// Real-time stream, open for as long as the client listens
+	stream := api.Group("/stream")
+	stream.Use(middleware.StreamAuthMiddleware())
+	{
+		stream.GET("", streamHandler.Events)
+		stream.GET("/ws", streamHandler.WebSocket)
+	}
+
+	// GraphQL
+	router.POST("/graphql", middleware.AuthMiddleware(), middleware.Timeout(a.requestTimeout), graphqlHandler.Query)
+
+	return router
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+	"warehouse-api/internal/config"
+	"warehouse-api/internal/migrate"
+	"warehouse-api/migrations"
+)
+
+// openSQLiteTestDB creates a migrated SQLite database for one test in its
+// temporary directory and points cfg at it.
+func openSQLiteTestDB(t *testing.T, cfg *config.Config) *sql.DB {
+	t.Helper()
+
+	cfg.DBPath = filepath.Join(t.TempDir(), "warehouse.db")
+	db, err := config.ConnectDB(cfg)
+	if err != nil {
+		t.Fatalf("open SQLite: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	migrator, err := migrate.New(db, config.DriverSQLite, migrations.For(config.DriverSQLite))
+	if err != nil {
+		t.Fatalf("load migrations: %v", err)
+	}
+	if _, err := migrator.Up(); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+
+	return db
+}
@@ -0,0 +1,187 @@
+// Package apperrors defines the typed errors services return instead of bare
+// messages. Every error has a Kind, which decides the HTTP and gRPC status it
+// is reported with, and a Code, a stable machine-readable identifier clients
+// can branch on while messages are free to change.
+package apperrors
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+)
+
+type Kind int
+
+const (
+	// Internal is an unexpected failure. Its message is logged, never shown.
+	Internal Kind = iota
+	// Invalid means the request is malformed or fails validation.
+	Invalid
+	// Unauthenticated means the caller did not prove who they are.
+	Unauthenticated
+	// NotFound means a resource the request names does not exist.
+	NotFound
+	// Conflict means the request clashes with an existing resource or with
+	// something already done to it.
+	Conflict
+	// FailedPrecondition means a business rule rejects the request in the
+	// current state, such as taking out more stock than is on hand.
+	FailedPrecondition
+	// Unprocessable means a well-formed upload has invalid content.
+	Unprocessable
+	// Timeout means the request ran out of time before it finished, either
+	// its own deadline or the database's statement timeout.
+	Timeout
+)
+
+// String returns the snake_case name of k, the error class logs report.
+func (k Kind) String() string {
+	switch k {
+	case Invalid:
+		return "invalid"
+	case Unauthenticated:
+		return "unauthenticated"
+	case NotFound:
+		return "not_found"
+	case Conflict:
+		return "conflict"
+	case FailedPrecondition:
+		return "failed_precondition"
+	case Unprocessable:
+		return "unprocessable"
+	case Timeout:
+		return "timeout"
+	default:
+		return "internal"
+	}
+}
+
+// HTTPStatus returns the status code errors of kind k are answered with.
+func (k Kind) HTTPStatus() int {
+	switch k {
+	case Invalid, FailedPrecondition:
+		return http.StatusBadRequest
+	case Unauthenticated:
+		return http.StatusUnauthorized
+	case NotFound:
+		return http.StatusNotFound
+	case Conflict:
+		return http.StatusConflict
+	case Unprocessable:
+		return http.StatusUnprocessableEntity
+	case Timeout:
+		return http.StatusGatewayTimeout
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// Codes shared by errors that are not tied to one domain rule.
+const (
+	CodeInternal         = "internal_error"
+	CodeInvalidBody      = "invalid_body"
+	CodeInvalidParameter = "invalid_parameter"
+	CodeValidationFailed = "validation_failed"
+	CodeTimeout          = "timeout"
+)
+
+// ErrTimeout reports a request that ran past its deadline.
+var ErrTimeout = New(Timeout, CodeTimeout, "The request took too long and was cancelled")
+
+// FieldError describes why a single field failed validation. Field is the
+// JSON name of the field.
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+type Error struct {
+	Kind    Kind
+	Code    string
+	Message string
+	// Fields lists the failing fields of a validation error.
+	Fields []FieldError
+	// Details is extra data for the client, such as an import report.
+	Details interface{}
+}
+
+func New(kind Kind, code, message string) *Error {
+	return &Error{Kind: kind, Code: code, Message: message}
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// Is matches errors by code, so a copy of a sentinel carrying different
+// details still satisfies errors.Is.
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	return ok && t.Code == e.Code
+}
+
+// Extensions exposes the code in the extensions of GraphQL errors.
+func (e *Error) Extensions() map[string]interface{} {
+	return map[string]interface{}{"code": e.Code}
+}
+
+// WithDetails returns a copy of e carrying details.
+func (e *Error) WithDetails(details interface{}) *Error {
+	copied := *e
+	copied.Details = details
+	return &copied
+}
+
+// InvalidParameter reports a malformed path or query parameter.
+func InvalidParameter(message string) *Error {
+	return New(Invalid, CodeInvalidParameter, message)
+}
+
+// Validation reports the fields of a request that failed validation. Its
+// message lists them, so it reads well where only the message is shown.
+func Validation(fields []FieldError) *Error {
+	messages := make([]string, 0, len(fields))
+	for _, field := range fields {
+		messages = append(messages, field.Field+" "+field.Message)
+	}
+	return &Error{
+		Kind:    Invalid,
+		Code:    CodeValidationFailed,
+		Message: strings.Join(messages, "; "),
+		Fields:  fields,
+	}
+}
+
+// As returns the *Error in err's chain. An exceeded deadline, or a Postgres
+// query cancelled by statement_timeout, is ErrTimeout. Other errors without
+// one are reported as Internal, keeping err as the message for logs.
+func As(err error) *Error {
+	var appErr *Error
+	if errors.As(err, &appErr) {
+		return appErr
+	}
+	if errors.Is(err, context.DeadlineExceeded) || sqlState(err) == queryCanceled {
+		return ErrTimeout
+	}
+	return &Error{Kind: Internal, Code: CodeInternal, Message: err.Error()}
+}
+
+// KindOf returns the kind of the *Error in err's chain, or Internal.
+func KindOf(err error) Kind {
+	return As(err).Kind
+}
+
+// queryCanceled is the Postgres SQLSTATE of a statement cancelled by
+// statement_timeout or by its context.
+const queryCanceled = "57014"
+
+// sqlState returns the SQLSTATE of a database error in err's chain, or "".
+// Drivers are matched by method so this package need not import them.
+func sqlState(err error) string {
+	var dbErr interface{ SQLState() string }
+	if errors.As(err, &dbErr) {
+		return dbErr.SQLState()
+	}
+	return ""
+}
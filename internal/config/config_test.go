@@ -0,0 +1,246 @@
+package config
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testSecret = "0123456789abcdef0123456789abcdef"
+
+// testPasswordHash is a bcrypt hash of a password of the tests' own.
+const testPasswordHash = "$2a$04$XaDxuBY0spUMvRpl1W.es.4mqJCzDWePAKPMHdAuqaBsydQObcGDm"
+
+// load resolves the configuration from a config file named name holding
+// contents, when name is set, and args as flags. Every variable a setting
+// reads is cleared first, so the caller's environment does not leak in.
+func load(t *testing.T, name, contents string, args ...string) (*Config, error) {
+	t.Helper()
+	for _, s := range settings {
+		for _, env := range s.env {
+			t.Setenv(env, "")
+		}
+	}
+	t.Setenv("CONFIG_FILE", "")
+
+	if name != "" {
+		path := filepath.Join(t.TempDir(), name)
+		if err := os.WriteFile(path, []byte(contents), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		args = append([]string{"-config", path}, args...)
+	}
+
+	flags := flag.NewFlagSet("test", flag.ContinueOnError)
+	loader := NewLoader(flags)
+	if err := flags.Parse(args); err != nil {
+		t.Fatal(err)
+	}
+	return loader.Resolve()
+}
+
+func source(c *Config, key string) string {
+	for _, v := range c.Values() {
+		if v.Key == key {
+			return v.Source
+		}
+	}
+	return ""
+}
+
+func TestLaterLayersOverrideEarlierOnes(t *testing.T) {
+	c, err := load(t, "warehouse.yaml", `
+database:
+  host: file-host
+  port: 5433
+  name: file-db
+grpc:
+  api_keys: [file-key-one, file-key-two]
+`, "-database.name", "flag-db")
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if c.DBHost != "file-host" || c.DBPort != "5433" || c.DBName != "flag-db" || c.DBUser != "postgres" {
+		t.Errorf("got host %q port %q name %q user %q", c.DBHost, c.DBPort, c.DBName, c.DBUser)
+	}
+	if len(c.GRPCAPIKeys) != 2 || c.GRPCAPIKeys[1] != "file-key-two" {
+		t.Errorf("got api keys %q", c.GRPCAPIKeys)
+	}
+	if got := source(c, "database.name"); got != "flag --database.name" {
+		t.Errorf("database.name source = %q", got)
+	}
+
+	t.Setenv("DB_PORT", "6543")
+	flags := flag.NewFlagSet("test", flag.ContinueOnError)
+	loader := NewLoader(flags)
+	if err := flags.Parse(nil); err != nil {
+		t.Fatal(err)
+	}
+	c, err = loader.Resolve()
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if c.DBPort != "6543" || source(c, "database.port") != "env DB_PORT" {
+		t.Errorf("got port %q from %q, want 6543 from env DB_PORT", c.DBPort, source(c, "database.port"))
+	}
+}
+
+func TestTOMLConfigFile(t *testing.T) {
+	c, err := load(t, "warehouse.toml", `
+env = "development"
+
+[database]
+driver = "sqlite"
+max_open_conns = 1
+`)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if c.Env != EnvDevelopment || c.DBDriver != DriverSQLite || c.DBMaxOpenConns != 1 {
+		t.Errorf("got env %q driver %q max open conns %d", c.Env, c.DBDriver, c.DBMaxOpenConns)
+	}
+}
+
+func TestResolveRejectsUnknownKeysAndBadValues(t *testing.T) {
+	if _, err := load(t, "warehouse.yaml", "database:\n  hots: typo\n"); err == nil || !strings.Contains(err.Error(), "database.hots") {
+		t.Errorf("unknown key: got %v", err)
+	}
+	if _, err := load(t, "warehouse.ini", "port=1"); err == nil {
+		t.Error("unsupported extension: got no error")
+	}
+
+	_, err := load(t, "", "", "-database.sslmode", "prefer", "-server.port", "0", "-webhooks.poll_interval", "0s")
+	if err == nil {
+		t.Fatal("bad values: got no error")
+	}
+	for _, key := range []string{"database.sslmode", "server.port", "webhooks.poll_interval"} {
+		if !strings.Contains(err.Error(), key) {
+			t.Errorf("error %q does not name %s", err, key)
+		}
+	}
+}
+
+func TestValidateRefusesPlaceholderSecretsOutsideDevelopment(t *testing.T) {
+	c, err := load(t, "", "")
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	err = c.Validate()
+	if err == nil {
+		t.Fatal("defaults validated in production")
+	}
+	for _, key := range []string{"auth.jwt_secret", "auth.admin_password_hash", "database.password"} {
+		if !strings.Contains(err.Error(), key) {
+			t.Errorf("error %q does not name %s", err, key)
+		}
+	}
+
+	for _, args := range [][]string{
+		{"-auth.jwt_secret", "your-secret-key-change-in-production", "-database.password", "hunter2hunter2"},
+		{"-auth.jwt_secret", "too-short", "-database.password", "hunter2hunter2"},
+		{"-auth.jwt_secret", testSecret, "-database.password", "it.supabase"},
+		{"-auth.jwt_secret", testSecret, "-database.password", "hunter2hunter2", "-grpc.api_keys", "short"},
+		{"-auth.jwt_secret", testSecret, "-database.password", "hunter2hunter2", "-server.tls_cert_file", "cert.pem"},
+		{"-auth.jwt_secret", testSecret, "-database.password", "hunter2hunter2", "-auth.admin_username", ""},
+		{"-auth.jwt_secret", testSecret, "-database.password", "hunter2hunter2", "-auth.admin_password_hash", ""},
+		{"-auth.jwt_secret", testSecret, "-database.password", "hunter2hunter2", "-auth.admin_password_hash", "admin123"},
+		{"-auth.jwt_secret", testSecret, "-database.password", "hunter2hunter2", "-server.stream_allowed_origins", "app.example.com"},
+		{"-auth.jwt_secret", testSecret, "-database.password", "hunter2hunter2", "-server.stream_allowed_origins", "https://app.example.com/stream"},
+	} {
+		// The flags given last win, so each case may replace the hash
+		c, err := load(t, "", "", append([]string{"-auth.admin_password_hash", testPasswordHash}, args...)...)
+		if err != nil {
+			t.Fatalf("load %q: %v", args, err)
+		}
+		if c.Validate() == nil {
+			t.Errorf("%q validated", args)
+		}
+	}
+
+	c, err = load(t, "", "", "-auth.jwt_secret", testSecret, "-auth.admin_password_hash", testPasswordHash, "-database.password", "hunter2hunter2",
+		"-server.stream_allowed_origins", "https://app.example.com, http://localhost:3000")
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if err := c.Validate(); err != nil {
+		t.Errorf("validate: %v", err)
+	}
+}
+
+func TestDevelopmentRunsWithoutSecrets(t *testing.T) {
+	c, err := load(t, "", "", "-env", "development")
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if err := c.Validate(); err != nil {
+		t.Fatalf("validate: %v", err)
+	}
+	if c.JWTSecret == "" || source(c, "auth.jwt_secret") != SourceDevDefault {
+		t.Errorf("got JWT secret %q from %q", c.JWTSecret, source(c, "auth.jwt_secret"))
+	}
+	if c.AdminUsername != "admin" || c.AdminPasswordHash == "" || source(c, "auth.admin_password_hash") != SourceDevDefault {
+		t.Errorf("got admin %q with password hash %q from %q", c.AdminUsername, c.AdminPasswordHash, source(c, "auth.admin_password_hash"))
+	}
+
+	// The development secrets are refused once the environment changes
+	for _, args := range [][]string{
+		{"-auth.jwt_secret", devJWTSecret, "-auth.admin_password_hash", testPasswordHash},
+		{"-auth.jwt_secret", testSecret, "-auth.admin_password_hash", devAdminPasswordHash},
+	} {
+		c, err = load(t, "", "", append(args, "-database.password", "hunter2hunter2")...)
+		if err != nil {
+			t.Fatalf("load: %v", err)
+		}
+		if c.Validate() == nil {
+			t.Errorf("development secret validated in production: %q", args)
+		}
+	}
+}
+
+func TestPrintRedactsSecrets(t *testing.T) {
+	c, err := load(t, "", "", "-auth.jwt_secret", testSecret, "-database.password", "hunter2hunter2", "-database.host", "db.internal")
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+
+	var out bytes.Buffer
+	if err := c.Print(&out, false); err != nil {
+		t.Fatalf("print: %v", err)
+	}
+	printed := out.String()
+	for _, secret := range []string{testSecret, "hunter2hunter2"} {
+		if strings.Contains(printed, secret) {
+			t.Errorf("printed configuration holds secret %q:\n%s", secret, printed)
+		}
+	}
+	for _, want := range []string{"password: '" + Redacted + "' # flag --database.password", "host: db.internal # flag --database.host"} {
+		if !strings.Contains(printed, want) {
+			t.Errorf("printed configuration lacks %q:\n%s", want, printed)
+		}
+	}
+
+	// With the secrets shown, the printed configuration is a config file
+	// that loads back to the same settings.
+	out.Reset()
+	if err := c.Print(&out, true); err != nil {
+		t.Fatalf("print: %v", err)
+	}
+	reloaded, err := load(t, "printed.yaml", out.String())
+	if err != nil {
+		t.Fatalf("load printed configuration: %v", err)
+	}
+	if reloaded.JWTSecret != testSecret || reloaded.DBHost != "db.internal" || reloaded.DBMaxOpenConns != c.DBMaxOpenConns {
+		t.Errorf("printed configuration loaded back as %+v", reloaded)
+	}
+}
+
+func TestDSNQuotesValues(t *testing.T) {
+	c := &Config{DBHost: "db", DBPort: "5432", DBUser: "app", DBPassword: `it's a \secret`, DBName: "warehouse", DBSSLMode: "verify-full", DBSSLRootCert: "/etc/ca.pem"}
+	want := `host='db' port='5432' user='app' password='it\'s a \\secret' dbname='warehouse' sslmode=verify-full sslrootcert='/etc/ca.pem'`
+	if got := c.DSN(); got != want {
+		t.Errorf("DSN() = %s, want %s", got, want)
+	}
+}
@@ -0,0 +1,446 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/joho/godotenv"
+	"github.com/pelletier/go-toml/v2"
+	"gopkg.in/yaml.v3"
+)
+
+// devJWTSecret signs tokens in development when JWT_SECRET is unset. It is
+// published here, so Validate refuses it everywhere else.
+const devJWTSecret = "development-only-jwt-secret-do-not-deploy"
+
+// devAdminPasswordHash is the bcrypt hash of admin123, the password that
+// logs in as auth.admin_username in development when ADMIN_PASSWORD_HASH is
+// unset. Like devJWTSecret, Validate refuses it everywhere else.
+const devAdminPasswordHash = "$2a$10$lkf/69ecajAxxHZNdaGyr.BJ5WjiQSDMOZDWmdFtYD3hC8dyMoS32"
+
+// Redacted replaces the value of a secret in printed configuration.
+const Redacted = "[REDACTED]"
+
+// A setting is one configuration value. Its key names it in a config file,
+// where each dot is a level of nesting, and is also its flag. It is read
+// from the first of its environment variables that is set.
+type setting struct {
+	key    string
+	env    []string
+	def    string
+	secret bool
+	usage  string
+	parse  func(c *Config, value string) error
+}
+
+// settings lists every setting in the order they are printed.
+var settings = []setting{
+	{key: "env", env: []string{"APP_ENV"}, def: EnvProduction, usage: "development or production; development relaxes the checks on secrets",
+		parse: oneOf(func(c *Config) *string { return &c.Env }, EnvDevelopment, EnvProduction)},
+
+	{key: "server.port", env: []string{"PORT"}, def: "8080", usage: "port the REST API listens on",
+		parse: port(func(c *Config) *string { return &c.Port })},
+	{key: "server.tls_cert_file", env: []string{"TLS_CERT_FILE"}, usage: "certificate the REST and gRPC servers serve TLS with",
+		parse: text(func(c *Config) *string { return &c.TLSCertFile })},
+	{key: "server.tls_key_file", env: []string{"TLS_KEY_FILE"}, usage: "private key of server.tls_cert_file",
+		parse: text(func(c *Config) *string { return &c.TLSKeyFile })},
+	{key: "server.stream_allowed_origins", env: []string{"STREAM_ALLOWED_ORIGINS"}, usage: "comma-separated origins whose pages may open the WebSocket stream besides the API's own",
+		parse: list(func(c *Config) *[]string { return &c.StreamAllowedOrigins })},
+	{key: "server.request_timeout", env: []string{"REQUEST_TIMEOUT"}, def: "15s", usage: "deadline of each request, 0 for none",
+		parse: duration(func(c *Config) *time.Duration { return &c.RequestTimeout }, false)},
+	{key: "server.bulk_request_timeout", env: []string{"BULK_REQUEST_TIMEOUT"}, def: "2m", usage: "deadline of imports, exports and other requests touching the whole ledger, 0 for none",
+		parse: duration(func(c *Config) *time.Duration { return &c.BulkRequestTimeout }, false)},
+	{key: "server.read_timeout", env: []string{"HTTP_READ_TIMEOUT"}, def: "1m", usage: "time to read a request, body included, 0 for none",
+		parse: duration(func(c *Config) *time.Duration { return &c.HTTPReadTimeout }, false)},
+	{key: "server.write_timeout", env: []string{"HTTP_WRITE_TIMEOUT"}, def: "3m", usage: "time to write a response, 0 for none",
+		parse: duration(func(c *Config) *time.Duration { return &c.HTTPWriteTimeout }, false)},
+	{key: "server.idle_timeout", env: []string{"HTTP_IDLE_TIMEOUT"}, def: "2m", usage: "time an idle keep-alive connection stays open, 0 for none",
+		parse: duration(func(c *Config) *time.Duration { return &c.HTTPIdleTimeout }, false)},
+	{key: "server.shutdown_timeout", env: []string{"SHUTDOWN_TIMEOUT"}, def: "30s", usage: "wait for in-flight requests on shutdown, 0 for no limit",
+		parse: duration(func(c *Config) *time.Duration { return &c.ShutdownTimeout }, false)},
+
+	{key: "grpc.port", env: []string{"GRPC_PORT"}, def: "9090", usage: "port the gRPC API listens on",
+		parse: port(func(c *Config) *string { return &c.GRPCPort })},
+	{key: "grpc.api_keys", env: []string{"GRPC_API_KEYS"}, secret: true, usage: "comma-separated API keys accepted in x-api-key",
+		parse: list(func(c *Config) *[]string { return &c.GRPCAPIKeys })},
+
+	{key: "auth.jwt_secret", env: []string{"JWT_SECRET"}, secret: true, usage: "key JWTs are signed with, at least 32 bytes",
+		parse: text(func(c *Config) *string { return &c.JWTSecret })},
+	{key: "auth.admin_username", env: []string{"ADMIN_USERNAME"}, def: "admin", usage: "username POST /api/auth/login accepts",
+		parse: text(func(c *Config) *string { return &c.AdminUsername })},
+	{key: "auth.admin_password_hash", env: []string{"ADMIN_PASSWORD_HASH"}, secret: true, usage: "bcrypt hash of the password of auth.admin_username",
+		parse: text(func(c *Config) *string { return &c.AdminPasswordHash })},
+
+	{key: "database.driver", env: []string{"DB_DRIVER"}, def: DriverPostgres, usage: "postgres or sqlite",
+		parse: oneOf(func(c *Config) *string { return &c.DBDriver }, DriverPostgres, DriverSQLite)},
+	{key: "database.path", env: []string{"DB_PATH"}, def: "warehouse.db", usage: "SQLite database file",
+		parse: text(func(c *Config) *string { return &c.DBPath })},
+	{key: "database.host", env: []string{"DB_HOST"}, def: "localhost", usage: "Postgres host",
+		parse: text(func(c *Config) *string { return &c.DBHost })},
+	{key: "database.port", env: []string{"DB_PORT"}, def: "5432", usage: "Postgres port",
+		parse: port(func(c *Config) *string { return &c.DBPort })},
+	{key: "database.user", env: []string{"DB_USER"}, def: "postgres", usage: "Postgres user",
+		parse: text(func(c *Config) *string { return &c.DBUser })},
+	{key: "database.password", env: []string{"DB_PASSWORD"}, secret: true, usage: "Postgres password",
+		parse: text(func(c *Config) *string { return &c.DBPassword })},
+	{key: "database.name", env: []string{"DB_NAME"}, def: "warehouse", usage: "Postgres database",
+		parse: text(func(c *Config) *string { return &c.DBName })},
+	{key: "database.sslmode", env: []string{"DB_SSLMODE"}, def: "require", usage: "disable, require, verify-ca or verify-full",
+		parse: oneOf(func(c *Config) *string { return &c.DBSSLMode }, "disable", "require", "verify-ca", "verify-full")},
+	{key: "database.sslrootcert", env: []string{"DB_SSLROOTCERT"}, usage: "CA certificate the verify sslmodes check the server against",
+		parse: text(func(c *Config) *string { return &c.DBSSLRootCert })},
+	{key: "database.sslcert", env: []string{"DB_SSLCERT"}, usage: "client certificate presented to Postgres",
+		parse: text(func(c *Config) *string { return &c.DBSSLCert })},
+	{key: "database.sslkey", env: []string{"DB_SSLKEY"}, usage: "private key of database.sslcert",
+		parse: text(func(c *Config) *string { return &c.DBSSLKey })},
+	{key: "database.max_open_conns", env: []string{"DB_MAX_OPEN_CONNS"}, def: "25", usage: "largest number of open connections, 0 for no limit",
+		parse: count(func(c *Config) *int { return &c.DBMaxOpenConns })},
+	{key: "database.max_idle_conns", env: []string{"DB_MAX_IDLE_CONNS"}, def: "10", usage: "connections kept open between uses",
+		parse: count(func(c *Config) *int { return &c.DBMaxIdleConns })},
+	{key: "database.conn_max_lifetime", env: []string{"DB_CONN_MAX_LIFETIME"}, def: "30m", usage: "age at which a connection is replaced, 0 for none",
+		parse: duration(func(c *Config) *time.Duration { return &c.DBConnMaxLifetime }, false)},
+	{key: "database.conn_max_idle_time", env: []string{"DB_CONN_MAX_IDLE_TIME"}, def: "5m", usage: "idle time after which a connection is closed, 0 for none",
+		parse: duration(func(c *Config) *time.Duration { return &c.DBConnMaxIdleTime }, false)},
+	{key: "database.connect_timeout", env: []string{"DB_CONNECT_TIMEOUT"}, def: "10s", usage: "time to connect to Postgres, 0 for no limit",
+		parse: duration(func(c *Config) *time.Duration { return &c.DBConnectTimeout }, false)},
+	{key: "database.statement_timeout", env: []string{"DB_STATEMENT_TIMEOUT"}, def: "2m", usage: "Postgres statement_timeout, 0 for none",
+		parse: duration(func(c *Config) *time.Duration { return &c.DBStatementTimeout }, false)},
+	{key: "database.auto_migrate", env: []string{"AUTO_MIGRATE"}, def: "true", usage: "apply pending migrations at startup",
+		parse: boolean(func(c *Config) *bool { return &c.AutoMigrate })},
+
+	{key: "snapshots.interval", env: []string{"SNAPSHOT_INTERVAL"}, def: "24h", usage: "time between stock snapshots",
+		parse: duration(func(c *Config) *time.Duration { return &c.SnapshotInterval }, true)},
+	{key: "webhooks.poll_interval", env: []string{"WEBHOOK_POLL_INTERVAL"}, def: "5s", usage: "time between polls for due webhook deliveries",
+		parse: duration(func(c *Config) *time.Duration { return &c.WebhookPollInterval }, true)},
+	{key: "outbox.sink", env: []string{"OUTBOX_SINK"}, def: "none", usage: "none or stdout",
+		parse: oneOf(func(c *Config) *string { return &c.OutboxSink }, "none", "stdout")},
+	{key: "outbox.poll_interval", env: []string{"OUTBOX_POLL_INTERVAL"}, def: "1s", usage: "time between polls of the outbox",
+		parse: duration(func(c *Config) *time.Duration { return &c.OutboxPollInterval }, true)},
+
+	{key: "log.level", env: []string{"LOG_LEVEL"}, def: "info", usage: "debug, info, warn or error",
+		parse: func(c *Config, value string) error { return c.LogLevel.UnmarshalText([]byte(value)) }},
+
+	{key: "tracing.exporter", env: []string{"OTEL_TRACES_EXPORTER"}, def: TracesExporterNone, usage: "none or otlp",
+		parse: oneOf(func(c *Config) *string { return &c.TracesExporter }, TracesExporterNone, TracesExporterOTLP)},
+	{key: "tracing.otlp_protocol", env: []string{"OTEL_EXPORTER_OTLP_TRACES_PROTOCOL", "OTEL_EXPORTER_OTLP_PROTOCOL"}, def: OTLPProtocolHTTP, usage: "grpc or http/protobuf",
+		parse: oneOf(func(c *Config) *string { return &c.OTLPProtocol }, OTLPProtocolGRPC, OTLPProtocolHTTP)},
+}
+
+func text(field func(*Config) *string) func(*Config, string) error {
+	return func(c *Config, value string) error {
+		*field(c) = value
+		return nil
+	}
+}
+
+func oneOf(field func(*Config) *string, allowed ...string) func(*Config, string) error {
+	return func(c *Config, value string) error {
+		for _, a := range allowed {
+			if value == a {
+				*field(c) = value
+				return nil
+			}
+		}
+		return fmt.Errorf("%q, expected %s", value, strings.Join(allowed, ", "))
+	}
+}
+
+func port(field func(*Config) *string) func(*Config, string) error {
+	return func(c *Config, value string) error {
+		if n, err := strconv.Atoi(value); err != nil || n < 1 || n > 65535 {
+			return fmt.Errorf("%q, expected a port from 1 to 65535", value)
+		}
+		*field(c) = value
+		return nil
+	}
+}
+
+func count(field func(*Config) *int) func(*Config, string) error {
+	return func(c *Config, value string) error {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 {
+			return fmt.Errorf("%q, expected a whole number of at least 0", value)
+		}
+		*field(c) = n
+		return nil
+	}
+}
+
+// duration parses a time.Duration such as 15s. Positive ones must not be 0,
+// for intervals a ticker runs on.
+func duration(field func(*Config) *time.Duration, positive bool) func(*Config, string) error {
+	return func(c *Config, value string) error {
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return err
+		}
+		if d < 0 || positive && d == 0 {
+			if positive {
+				return fmt.Errorf("%q, expected a positive duration", value)
+			}
+			return fmt.Errorf("%q, expected a duration of at least 0", value)
+		}
+		*field(c) = d
+		return nil
+	}
+}
+
+func boolean(field func(*Config) *bool) func(*Config, string) error {
+	return func(c *Config, value string) error {
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("%q, expected true or false", value)
+		}
+		*field(c) = b
+		return nil
+	}
+}
+
+func list(field func(*Config) *[]string) func(*Config, string) error {
+	return func(c *Config, value string) error {
+		var items []string
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		*field(c) = items
+		return nil
+	}
+}
+
+// The sources a setting is resolved from, apart from a config file, which is
+// named by its path, an environment variable, named "env " and the variable,
+// and a flag, named "flag --" and the flag.
+const (
+	SourceDefault    = "default"
+	SourceDevDefault = "development default"
+)
+
+// Value is a setting as resolved, with where its value came from.
+type Value struct {
+	Key    string
+	Value  string
+	Source string
+	Secret bool
+}
+
+// Loader resolves the configuration in layers, each overriding the one
+// before: the defaults, a YAML or TOML config file, the environment,
+// including a .env file in the working directory, and the command-line flags.
+type Loader struct {
+	flags *flag.FlagSet
+	file  *string
+}
+
+// NewLoader defines a flag on flags for every setting, and -config for the
+// config file. Parse flags before calling Load.
+func NewLoader(flags *flag.FlagSet) *Loader {
+	l := &Loader{
+		flags: flags,
+		file:  flags.String("config", "", "YAML or TOML config file (env CONFIG_FILE)"),
+	}
+	for _, s := range settings {
+		flags.String(s.key, s.def, fmt.Sprintf("%s (env %s)", s.usage, strings.Join(s.env, ", ")))
+	}
+	return l
+}
+
+// Load resolves the configuration and validates it.
+func (l *Loader) Load() (*Config, error) {
+	c, err := l.Resolve()
+	if err != nil {
+		return nil, err
+	}
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Resolve resolves the configuration without validating it, so one that
+// does not pass can still be printed. It fails on a config file that cannot
+// be read or has unknown keys, and on values that do not parse, naming the
+// source of each.
+func (l *Loader) Resolve() (*Config, error) {
+	// The .env file is optional; variables already set take precedence
+	_ = godotenv.Load()
+
+	path := *l.file
+	if path == "" {
+		path = os.Getenv("CONFIG_FILE")
+	}
+	var file map[string]string
+	if path != "" {
+		var err error
+		if file, err = readFile(path); err != nil {
+			return nil, err
+		}
+	}
+
+	flagged := make(map[string]string)
+	l.flags.Visit(func(f *flag.Flag) { flagged[f.Name] = f.Value.String() })
+
+	c := &Config{}
+	var errs []error
+	for _, s := range settings {
+		v := Value{Key: s.key, Value: s.def, Source: SourceDefault, Secret: s.secret}
+		if value, ok := file[s.key]; ok {
+			v.Value, v.Source = value, path
+		}
+		for _, env := range s.env {
+			if value := os.Getenv(env); value != "" {
+				v.Value, v.Source = value, "env "+env
+				break
+			}
+		}
+		if value, ok := flagged[s.key]; ok {
+			v.Value, v.Source = value, "flag --"+s.key
+		}
+		if err := s.parse(c, v.Value); err != nil {
+			errs = append(errs, fmt.Errorf("invalid %s from %s: %w", s.key, v.Source, err))
+		}
+		c.values = append(c.values, v)
+	}
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+
+	if c.Env == EnvDevelopment && c.JWTSecret == "" {
+		c.JWTSecret = devJWTSecret
+		c.set("auth.jwt_secret", devJWTSecret, SourceDevDefault)
+	}
+	if c.Env == EnvDevelopment && c.AdminPasswordHash == "" {
+		c.AdminPasswordHash = devAdminPasswordHash
+		c.set("auth.admin_password_hash", devAdminPasswordHash, SourceDevDefault)
+	}
+	return c, nil
+}
+
+func (c *Config) set(key, value, source string) {
+	for i := range c.values {
+		if c.values[i].Key == key {
+			c.values[i].Value, c.values[i].Source = value, source
+		}
+	}
+}
+
+// readFile reads a config file, YAML or TOML by its extension, flattened to
+// the dotted keys of the settings.
+func readFile(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	var tree map[string]any
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &tree)
+	case ".toml":
+		err = toml.Unmarshal(data, &tree)
+	default:
+		return nil, fmt.Errorf("config file %s: unsupported extension %q, expected .yaml, .yml or .toml", path, ext)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("config file %s: %w", path, err)
+	}
+
+	known := make(map[string]bool, len(settings))
+	for _, s := range settings {
+		known[s.key] = true
+	}
+	values := make(map[string]string)
+	var unknown []string
+	flatten("", tree, func(key string, value any) {
+		if !known[key] {
+			unknown = append(unknown, key)
+			return
+		}
+		values[key] = scalar(value)
+	})
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return nil, fmt.Errorf("config file %s: unknown settings %s", path, strings.Join(unknown, ", "))
+	}
+	return values, nil
+}
+
+func flatten(prefix string, tree map[string]any, visit func(key string, value any)) {
+	for key, value := range tree {
+		if prefix != "" {
+			key = prefix + "." + key
+		}
+		if nested, ok := value.(map[string]any); ok {
+			flatten(key, nested, visit)
+			continue
+		}
+		visit(key, value)
+	}
+}
+
+// scalar formats a value decoded from a config file as the text the setting
+// parses; lists, such as grpc.api_keys, are joined with commas.
+func scalar(value any) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case []any:
+		items := make([]string, len(v))
+		for i, item := range v {
+			items[i] = scalar(item)
+		}
+		return strings.Join(items, ",")
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// Values returns every setting as resolved, in the order Print writes them.
+func (c *Config) Values() []Value {
+	return append([]Value(nil), c.values...)
+}
+
+// Print writes the configuration as a YAML config file, each value
+// commented with its source. Secrets that are set read [REDACTED] unless
+// showSecrets is set.
+func (c *Config) Print(w io.Writer, showSecrets bool) error {
+	root := &yaml.Node{Kind: yaml.MappingNode}
+	sections := map[string]*yaml.Node{"": root}
+	for _, v := range c.values {
+		section, name := "", v.Key
+		if i := strings.LastIndex(v.Key, "."); i >= 0 {
+			section, name = v.Key[:i], v.Key[i+1:]
+		}
+		parent, ok := sections[section]
+		if !ok {
+			parent = &yaml.Node{Kind: yaml.MappingNode}
+			root.Content = append(root.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: section}, parent)
+			sections[section] = parent
+		}
+
+		value := v.Value
+		if !showSecrets && v.Secret && value != "" {
+			value = Redacted
+		}
+		parent.Content = append(parent.Content,
+			&yaml.Node{Kind: yaml.ScalarNode, Value: name},
+			&yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: value, LineComment: v.Source},
+		)
+	}
+
+	encoder := yaml.NewEncoder(w)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(root); err != nil {
+		return err
+	}
+	return encoder.Close()
+}
@@ -0,0 +1,9 @@
+// Package docs embeds the OpenAPI document describing the HTTP API. The
+// document is maintained by hand; the tests in this package and in cmd/api
+// fail when it drifts from the registered routes or from internal/models.
+package docs
+
+import _ "embed"
+
+//go:embed openapi.json
+var OpenAPI []byte
@@ -0,0 +1,227 @@
+package docs
+
+import (
+	"encoding/json"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io/fs"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+type schema struct {
+	Type       string             `json:"type"`
+	Ref        string             `json:"$ref"`
+	Properties map[string]*schema `json:"properties"`
+	Items      *schema            `json:"items"`
+	Required   []string           `json:"required"`
+	Enum       []string           `json:"enum"`
+}
+
+// TestModelsMatchOpenAPI fails when a JSON model in internal/models (or the
+// utils.APIResponse envelope) and its schema in openapi.json disagree on
+// fields, types, required fields or allowed values.
+func TestModelsMatchOpenAPI(t *testing.T) {
+	var spec struct {
+		Components struct {
+			Schemas map[string]*schema `json:"schemas"`
+		} `json:"components"`
+	}
+	if err := json.Unmarshal(OpenAPI, &spec); err != nil {
+		t.Fatalf("parse openapi.json: %v", err)
+	}
+
+	structs := parseStructs(t, filepath.Join("..", "models"), nil)
+	for name, st := range parseStructs(t, filepath.Join("..", "utils"), map[string]bool{"APIResponse": true, "Problem": true}) {
+		structs[name] = st
+	}
+
+	names := make([]string, 0, len(structs))
+	for name := range structs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		fields := jsonFields(structs, structs[name])
+		if len(fields) == 0 {
+			continue
+		}
+
+		s, ok := spec.Components.Schemas[name]
+		if !ok {
+			t.Errorf("%s has no schema in openapi.json", name)
+			continue
+		}
+
+		var required []string
+		for _, f := range fields {
+			prop, ok := s.Properties[f.name]
+			if !ok {
+				t.Errorf("%s.%s is missing from its schema", name, f.name)
+				continue
+			}
+			checkType(t, name+"."+f.name, f.typ, prop)
+
+			rules := strings.Split(f.binding, ",")
+			target := prop
+			for _, rule := range rules {
+				switch {
+				case rule == "dive":
+					target = prop.Items
+				case rule == "required" && target == prop:
+					required = append(required, f.name)
+				case strings.HasPrefix(rule, "oneof="):
+					want := strings.Split(strings.TrimPrefix(rule, "oneof="), " ")
+					if target == nil || !reflect.DeepEqual(target.Enum, want) {
+						t.Errorf("%s.%s: binding allows %v, schema enum does not match", name, f.name, want)
+					}
+				}
+			}
+		}
+
+		for prop := range s.Properties {
+			if !hasField(fields, prop) {
+				t.Errorf("schema %s has property %s, which is not a field of the model", name, prop)
+			}
+		}
+
+		sort.Strings(required)
+		documented := append([]string(nil), s.Required...)
+		sort.Strings(documented)
+		if !reflect.DeepEqual(required, documented) && (len(required) > 0 || len(documented) > 0) {
+			t.Errorf("%s: required fields are %v in the model but %v in the schema", name, required, documented)
+		}
+	}
+}
+
+type field struct {
+	name    string
+	typ     ast.Expr
+	binding string
+}
+
+// parseStructs returns the struct types declared in dir, limited to only when
+// it is not nil.
+func parseStructs(t *testing.T, dir string, only map[string]bool) map[string]*ast.StructType {
+	t.Helper()
+
+	pkgs, err := parser.ParseDir(token.NewFileSet(), dir, func(info fs.FileInfo) bool {
+		return !strings.HasSuffix(info.Name(), "_test.go")
+	}, 0)
+	if err != nil {
+		t.Fatalf("parse %s: %v", dir, err)
+	}
+
+	structs := map[string]*ast.StructType{}
+	for _, pkg := range pkgs {
+		for _, file := range pkg.Files {
+			for _, decl := range file.Decls {
+				gen, ok := decl.(*ast.GenDecl)
+				if !ok || gen.Tok != token.TYPE {
+					continue
+				}
+				for _, spec := range gen.Specs {
+					ts := spec.(*ast.TypeSpec)
+					st, ok := ts.Type.(*ast.StructType)
+					if ok && (only == nil || only[ts.Name.Name]) {
+						structs[ts.Name.Name] = st
+					}
+				}
+			}
+		}
+	}
+	return structs
+}
+
+// jsonFields lists the JSON-visible fields of st, flattening embedded
+// structs as encoding/json does.
+func jsonFields(structs map[string]*ast.StructType, st *ast.StructType) []field {
+	var fields []field
+	for _, f := range st.Fields.List {
+		tag := reflect.StructTag("")
+		if f.Tag != nil {
+			tag = reflect.StructTag(strings.Trim(f.Tag.Value, "`"))
+		}
+
+		if len(f.Names) == 0 {
+			if ident, ok := f.Type.(*ast.Ident); ok && structs[ident.Name] != nil {
+				fields = append(fields, jsonFields(structs, structs[ident.Name])...)
+			}
+			continue
+		}
+
+		name := strings.Split(tag.Get("json"), ",")[0]
+		if name == "" || name == "-" {
+			continue
+		}
+		fields = append(fields, field{name: name, typ: f.Type, binding: tag.Get("binding")})
+	}
+	return fields
+}
+
+func hasField(fields []field, name string) bool {
+	for _, f := range fields {
+		if f.name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// checkType compares a Go field type with its schema. Pointers are
+// unwrapped; maps must be objects; interface{} and json.RawMessage accept any
+// schema.
+func checkType(t *testing.T, where string, expr ast.Expr, s *schema) {
+	t.Helper()
+
+	switch e := expr.(type) {
+	case *ast.StarExpr:
+		checkType(t, where, e.X, s)
+	case *ast.ArrayType:
+		if s.Type != "array" || s.Items == nil {
+			t.Errorf("%s: expected an array schema", where)
+			return
+		}
+		checkType(t, where+"[]", e.Elt, s.Items)
+	case *ast.MapType:
+		expectType(t, where, "object", s)
+	case *ast.InterfaceType:
+	case *ast.SelectorExpr:
+		switch pkg := e.X.(*ast.Ident).Name + "." + e.Sel.Name; pkg {
+		case "time.Time":
+			expectType(t, where, "string", s)
+		case "json.RawMessage":
+		default:
+			t.Errorf("%s: unhandled type %s", where, pkg)
+		}
+	case *ast.Ident:
+		switch e.Name {
+		case "int", "int64":
+			expectType(t, where, "integer", s)
+		case "float64":
+			expectType(t, where, "number", s)
+		case "string":
+			expectType(t, where, "string", s)
+		case "bool":
+			expectType(t, where, "boolean", s)
+		default:
+			if want := "#/components/schemas/" + e.Name; s.Ref != want {
+				t.Errorf("%s: expected $ref %s, got %q", where, want, s.Ref)
+			}
+		}
+	default:
+		t.Errorf("%s: unhandled type %T", where, expr)
+	}
+}
+
+func expectType(t *testing.T, where, want string, s *schema) {
+	t.Helper()
+	if s.Type != want {
+		t.Errorf("%s: expected type %s, got %q", where, want, s.Type)
+	}
+}
@@ -0,0 +1,96 @@
+// Package eventbus defines where outbox events are published. A Sink maps
+// onto a NATS subject or a Kafka topic: Subject names the stream and Key
+// selects the partition, so messages with the same key stay in order.
+package eventbus
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"sync"
+)
+
+// Message is one event as handed to a sink.
+type Message struct {
+	ID      string          `json:"id"`
+	Subject string          `json:"subject"`
+	Key     string          `json:"key"`
+	Payload json.RawMessage `json:"payload"`
+}
+
+// Sink publishes messages. Publish must return only once the message is
+// durably accepted; the relay treats an error as "not published" and retries
+// the message, so sinks must tolerate duplicates.
+type Sink interface {
+	Publish(ctx context.Context, msg *Message) error
+}
+
+// WriterSink writes each message as a line of JSON, for piping the stream to
+// another process or a log collector.
+type WriterSink struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func NewWriterSink(w io.Writer) *WriterSink {
+	return &WriterSink{w: w}
+}
+
+func (s *WriterSink) Publish(ctx context.Context, msg *Message) error {
+	line, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err = s.w.Write(append(line, '\n'))
+	return err
+}
+
+// MemorySink delivers messages to in-process subscribers. It is meant for
+// tests and single-process setups.
+type MemorySink struct {
+	mu          sync.Mutex
+	messages    []*Message
+	subscribers []chan *Message
+}
+
+func NewMemorySink() *MemorySink {
+	return &MemorySink{}
+}
+
+func (s *MemorySink) Publish(ctx context.Context, msg *Message) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.messages = append(s.messages, msg)
+	for _, ch := range s.subscribers {
+		select {
+		case ch <- msg:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+// Subscribe returns a channel receiving every message published from now on.
+// Publishing blocks until each subscriber has taken the message, so the
+// buffer should cover the largest burst expected.
+func (s *MemorySink) Subscribe(buffer int) <-chan *Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ch := make(chan *Message, buffer)
+	s.subscribers = append(s.subscribers, ch)
+	return ch
+}
+
+// Messages returns every message published so far, in order.
+func (s *MemorySink) Messages() []*Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]*Message(nil), s.messages...)
+}
@@ -0,0 +1,97 @@
+package gql
+
+import "sync"
+
+// keySet collects the IDs of one kind of record seen while resolving a
+// request, in the order they were seen.
+type keySet struct {
+	mu   sync.Mutex
+	seen map[int]bool
+	keys []int
+}
+
+func newKeySet() *keySet {
+	return &keySet{seen: make(map[int]bool)}
+}
+
+func (k *keySet) add(ids ...int) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	for _, id := range ids {
+		if !k.seen[id] {
+			k.seen[id] = true
+			k.keys = append(k.keys, id)
+		}
+	}
+}
+
+func (k *keySet) all() []int {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	return append([]int(nil), k.keys...)
+}
+
+// loader batches lookups by ID within one request. Resolvers add the IDs they
+// will need to keys as soon as they are created; the first load then fetches
+// every ID in keys that is not loaded yet with a single call to fetch, so
+// resolving a list of N records costs one query instead of N.
+type loader[V any] struct {
+	keys  *keySet
+	fetch func(ids []int) (map[int]V, error)
+
+	mu     sync.Mutex
+	loaded map[int]V
+	failed map[int]error
+}
+
+func newLoader[V any](keys *keySet, fetch func(ids []int) (map[int]V, error)) *loader[V] {
+	return &loader[V]{keys: keys, fetch: fetch, loaded: make(map[int]V), failed: make(map[int]error)}
+}
+
+// prime stores a value that was already fetched, such as a record from a list
+// query, so it is not fetched again.
+func (l *loader[V]) prime(id int, value V) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.loaded[id] = value
+}
+
+// load returns the value for id, or the zero value if fetch did not return
+// one. Concurrent loads wait for the batch in flight and are then served
+// from it. When a fetch fails, every ID in its batch loads as its error, so
+// the rest of the request does not retry them one by one.
+func (l *loader[V]) load(id int) (V, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var zero V
+	if value, ok := l.loaded[id]; ok {
+		return value, nil
+	}
+	if err, ok := l.failed[id]; ok {
+		return zero, err
+	}
+
+	l.keys.add(id)
+	var batch []int
+	for _, key := range l.keys.all() {
+		_, loaded := l.loaded[key]
+		_, failed := l.failed[key]
+		if !loaded && !failed {
+			batch = append(batch, key)
+		}
+	}
+
+	values, err := l.fetch(batch)
+	if err != nil {
+		for _, key := range batch {
+			l.failed[key] = err
+		}
+		return zero, err
+	}
+	for _, key := range batch {
+		l.loaded[key] = values[key]
+	}
+	return l.loaded[id], nil
+}
@@ -0,0 +1,103 @@
+package gql
+
+import (
+	"errors"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+// fetchLog records the batches a loader fetches.
+type fetchLog struct {
+	batches [][]int
+}
+
+// counted wraps l.fetch so every batch it fetches is recorded in log. Fetches
+// run under the loader's lock, so the log needs none of its own.
+func counted[V any](l *loader[V], log *fetchLog) {
+	fetch := l.fetch
+	l.fetch = func(ids []int) (map[int]V, error) {
+		batch := append([]int(nil), ids...)
+		sort.Ints(batch)
+		log.batches = append(log.batches, batch)
+		return fetch(ids)
+	}
+}
+
+func expectBatches(t *testing.T, name string, log *fetchLog, want ...[]int) {
+	t.Helper()
+	if !reflect.DeepEqual(log.batches, want) {
+		t.Errorf("%s fetched %v, want %v", name, log.batches, want)
+	}
+}
+
+func TestLoaderBatchesKnownKeys(t *testing.T) {
+	keys := newKeySet()
+	names := newLoader(keys, func(ids []int) (map[int]string, error) {
+		values := map[int]string{}
+		for _, id := range ids {
+			if id != 3 {
+				values[id] = string(rune('a' + id))
+			}
+		}
+		return values, nil
+	})
+	var log fetchLog
+	counted(names, &log)
+
+	keys.add(1, 2, 3)
+	for _, tc := range []struct {
+		id   int
+		want string
+	}{{2, "c"}, {1, "b"}, {3, ""}, {2, "c"}} {
+		got, err := names.load(tc.id)
+		if err != nil || got != tc.want {
+			t.Errorf("load(%d) = %q, %v; want %q", tc.id, got, err, tc.want)
+		}
+	}
+	expectBatches(t, "known keys", &log, []int{1, 2, 3})
+
+	// A key seen later is fetched on its own, without the loaded ones
+	names.prime(5, "primed")
+	keys.add(4, 5)
+	if got, err := names.load(4); err != nil || got != "e" {
+		t.Errorf("load(4) = %q, %v; want \"e\"", got, err)
+	}
+	if got, err := names.load(5); err != nil || got != "primed" {
+		t.Errorf("load(5) = %q, %v; want \"primed\"", got, err)
+	}
+	expectBatches(t, "later keys", &log, []int{1, 2, 3}, []int{4})
+}
+
+func TestLoaderFailsTheWholeBatch(t *testing.T) {
+	keys := newKeySet()
+	fail := errors.New("database is down")
+	names := newLoader(keys, func(ids []int) (map[int]string, error) {
+		for _, id := range ids {
+			if id == 2 {
+				return nil, fail
+			}
+		}
+		values := map[int]string{}
+		for _, id := range ids {
+			values[id] = "ok"
+		}
+		return values, nil
+	})
+	var log fetchLog
+	counted(names, &log)
+
+	keys.add(1, 2)
+	for _, id := range []int{1, 2, 1} {
+		if _, err := names.load(id); !errors.Is(err, fail) {
+			t.Errorf("load(%d) error = %v, want %v", id, err, fail)
+		}
+	}
+	expectBatches(t, "failed batch", &log, []int{1, 2})
+
+	// Keys outside the failed batch still load
+	if got, err := names.load(3); err != nil || got != "ok" {
+		t.Errorf("load(3) = %q, %v; want \"ok\"", got, err)
+	}
+	expectBatches(t, "after failure", &log, []int{1, 2}, []int{3})
+}
@@ -0,0 +1,125 @@
+package gql
+
+import (
+	"context"
+	"sync"
+	"warehouse-api/internal/models"
+)
+
+// loaders holds the batching loaders for one request. Product and location
+// IDs are shared between the loaders keyed by them, so an ID seen anywhere
+// in the response is fetched together with its siblings. Loaders register the
+// IDs referenced by what they fetch as soon as a batch arrives, so the next
+// level of the query is batched as a whole too.
+type loaders struct {
+	productIDs  *keySet
+	locationIDs *keySet
+
+	products         *loader[*models.Product]
+	locations        *loader[*models.LocationWithUsage]
+	productStock     *loader[[]*models.StockBalanceLine]
+	locationContents *loader[[]*models.StockBalanceLine]
+
+	mu              sync.Mutex
+	recentMovements map[int]*loader[[]*models.StockMovement] // by limit
+	fetchRecent     func(limit int) func(ids []int) (map[int][]*models.StockMovement, error)
+}
+
+// newLoaders returns the loaders for one query; their fetches run under ctx,
+// the query's context.
+func (s *Schema) newLoaders(ctx context.Context) *loaders {
+	l := &loaders{
+		productIDs:      newKeySet(),
+		locationIDs:     newKeySet(),
+		recentMovements: make(map[int]*loader[[]*models.StockMovement]),
+	}
+
+	l.products = newLoader(l.productIDs, func(ids []int) (map[int]*models.Product, error) {
+		products, err := s.productService.GetByIDs(ctx, ids)
+		if err != nil {
+			return nil, err
+		}
+		byID := make(map[int]*models.Product, len(products))
+		for _, product := range products {
+			byID[product.ID] = product
+		}
+		return byID, nil
+	})
+
+	l.locations = newLoader(l.locationIDs, func(ids []int) (map[int]*models.LocationWithUsage, error) {
+		locations, err := s.locationService.GetWithUsageByIDs(ctx, ids)
+		if err != nil {
+			return nil, err
+		}
+		byID := make(map[int]*models.LocationWithUsage, len(locations))
+		for _, location := range locations {
+			byID[location.ID] = location
+		}
+		return byID, nil
+	})
+
+	l.productStock = newLoader(l.productIDs, func(ids []int) (map[int][]*models.StockBalanceLine, error) {
+		lines, err := s.stockService.GetBalancesByProducts(ctx, ids)
+		if err != nil {
+			return nil, err
+		}
+		byProduct := make(map[int][]*models.StockBalanceLine)
+		for _, line := range lines {
+			l.locationIDs.add(line.LocationID)
+			byProduct[line.ProductID] = append(byProduct[line.ProductID], line)
+		}
+		return byProduct, nil
+	})
+
+	l.locationContents = newLoader(l.locationIDs, func(ids []int) (map[int][]*models.StockBalanceLine, error) {
+		lines, err := s.stockService.GetBalancesByLocations(ctx, ids)
+		if err != nil {
+			return nil, err
+		}
+		byLocation := make(map[int][]*models.StockBalanceLine)
+		for _, line := range lines {
+			l.productIDs.add(line.ProductID)
+			byLocation[line.LocationID] = append(byLocation[line.LocationID], line)
+		}
+		return byLocation, nil
+	})
+
+	l.fetchRecent = func(limit int) func(ids []int) (map[int][]*models.StockMovement, error) {
+		return func(ids []int) (map[int][]*models.StockMovement, error) {
+			movements, err := s.stockService.GetRecentByProducts(ctx, ids, limit)
+			if err != nil {
+				return nil, err
+			}
+			byProduct := make(map[int][]*models.StockMovement)
+			for _, movement := range movements {
+				l.locationIDs.add(movement.LocationID)
+				byProduct[movement.ProductID] = append(byProduct[movement.ProductID], movement)
+			}
+			return byProduct, nil
+		}
+	}
+
+	return l
+}
+
+// recent returns the loader for the latest limit movements per product.
+// Fields asking for different limits are batched separately.
+func (l *loaders) recent(limit int) *loader[[]*models.StockMovement] {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if _, ok := l.recentMovements[limit]; !ok {
+		l.recentMovements[limit] = newLoader(l.productIDs, l.fetchRecent(limit))
+	}
+	return l.recentMovements[limit]
+}
+
+type loadersKey struct{}
+
+func withLoaders(ctx context.Context, l *loaders) context.Context {
+	return context.WithValue(ctx, loadersKey{}, l)
+}
+
+func loadersFrom(ctx context.Context) *loaders {
+	return ctx.Value(loadersKey{}).(*loaders)
+}
@@ -0,0 +1,415 @@
+package gql
+
+import (
+	"context"
+	"fmt"
+	"warehouse-api/internal/models"
+
+	graphql "github.com/graph-gophers/graphql-go"
+)
+
+// maxLimit caps the page size and recent_movements limit.
+const maxLimit = 100
+
+func clampLimit(limit int32) int {
+	if limit < 1 {
+		return 10
+	}
+	if limit > maxLimit {
+		return maxLimit
+	}
+	return int(limit)
+}
+
+func optionalInt(v *int32) *int {
+	if v == nil {
+		return nil
+	}
+	i := int(*v)
+	return &i
+}
+
+func intList(v *[]int32) []int {
+	if v == nil {
+		return nil
+	}
+	ints := make([]int, 0, len(*v))
+	for _, i := range *v {
+		ints = append(ints, int(i))
+	}
+	return ints
+}
+
+// pageArgs are the arguments shared by every paginated list.
+type pageArgs struct {
+	Sort   string
+	Cursor string
+	Limit  int32
+}
+
+func (a pageArgs) request() models.PageRequest {
+	return models.PageRequest{Cursor: a.Cursor, Sort: a.Sort, Limit: clampLimit(a.Limit)}
+}
+
+type queryResolver struct {
+	s *Schema
+}
+
+func (r *queryResolver) Products(ctx context.Context, args struct {
+	IDs           *[]int32
+	Search        string
+	CostingMethod string
+	MinQuantity   *int32
+	MaxQuantity   *int32
+	pageArgs
+}) (*productPageResolver, error) {
+	filter := &models.ProductFilter{
+		IDs:           intList(args.IDs),
+		Search:        args.Search,
+		CostingMethod: args.CostingMethod,
+		MinQuantity:   optionalInt(args.MinQuantity),
+		MaxQuantity:   optionalInt(args.MaxQuantity),
+		PageRequest:   args.request(),
+	}
+
+	products, pagination, err := r.s.productService.GetAll(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	l := loadersFrom(ctx)
+	resolvers := make([]*productResolver, 0, len(products))
+	for _, product := range products {
+		resolvers = append(resolvers, newProductResolver(l, product))
+	}
+	return &productPageResolver{products: resolvers, pageInfo: &pageInfoResolver{pagination}}, nil
+}
+
+func (r *queryResolver) Product(ctx context.Context, args struct{ ID int32 }) (*productResolver, error) {
+	l := loadersFrom(ctx)
+	product, err := l.products.load(int(args.ID))
+	if err != nil || product == nil {
+		return nil, err
+	}
+	return newProductResolver(l, product), nil
+}
+
+func (r *queryResolver) Locations(ctx context.Context, args struct {
+	IDs         *[]int32
+	Search      string
+	Warehouse   string
+	MinCapacity *int32
+	MaxCapacity *int32
+	pageArgs
+}) (*locationPageResolver, error) {
+	filter := &models.LocationFilter{
+		IDs:         intList(args.IDs),
+		Search:      args.Search,
+		Warehouse:   args.Warehouse,
+		MinCapacity: optionalInt(args.MinCapacity),
+		MaxCapacity: optionalInt(args.MaxCapacity),
+		PageRequest: args.request(),
+	}
+
+	locations, pagination, err := r.s.locationService.GetAll(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	l := loadersFrom(ctx)
+	resolvers := make([]*locationResolver, 0, len(locations))
+	for _, location := range locations {
+		resolvers = append(resolvers, newLocationResolver(l, location))
+	}
+	return &locationPageResolver{locations: resolvers, pageInfo: &pageInfoResolver{pagination}}, nil
+}
+
+func (r *queryResolver) Location(ctx context.Context, args struct{ ID int32 }) (*locationResolver, error) {
+	l := loadersFrom(ctx)
+	location, err := l.locations.load(int(args.ID))
+	if err != nil || location == nil {
+		return nil, err
+	}
+	return newLocationResolver(l, location), nil
+}
+
+func (r *queryResolver) StockMovements(ctx context.Context, args struct {
+	ProductIDs  *[]int32
+	LocationIDs *[]int32
+	Type        *string
+	Source      string
+	CreatedBy   string
+	Reference   string
+	MinQuantity *int32
+	MaxQuantity *int32
+	StartDate   *string
+	EndDate     *string
+	pageArgs
+}) (*stockMovementPageResolver, error) {
+	filter := &models.StockMovementFilter{
+		ProductIDs:  intList(args.ProductIDs),
+		LocationIDs: intList(args.LocationIDs),
+		Type:        args.Type,
+		Source:      args.Source,
+		CreatedBy:   args.CreatedBy,
+		Reference:   args.Reference,
+		MinQuantity: optionalInt(args.MinQuantity),
+		MaxQuantity: optionalInt(args.MaxQuantity),
+		StartDate:   args.StartDate,
+		EndDate:     args.EndDate,
+		PageRequest: args.request(),
+	}
+
+	movements, pagination, err := r.s.stockService.GetAll(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	l := loadersFrom(ctx)
+	resolvers := make([]*stockMovementResolver, 0, len(movements))
+	for _, movement := range movements {
+		resolvers = append(resolvers, newStockMovementResolver(l, movement))
+	}
+	return &stockMovementPageResolver{movements: resolvers, pageInfo: &pageInfoResolver{pagination}}, nil
+}
+
+type pageInfoResolver struct {
+	p *models.CursorPagination
+}
+
+func (r *pageInfoResolver) Limit() int32  { return int32(r.p.Limit) }
+func (r *pageInfoResolver) Sort() string  { return r.p.Sort }
+func (r *pageInfoResolver) HasMore() bool { return r.p.HasMore }
+
+func (r *pageInfoResolver) NextCursor() *string {
+	if r.p.NextCursor == "" {
+		return nil
+	}
+	return &r.p.NextCursor
+}
+
+type productPageResolver struct {
+	products []*productResolver
+	pageInfo *pageInfoResolver
+}
+
+func (r *productPageResolver) Products() []*productResolver { return r.products }
+func (r *productPageResolver) PageInfo() *pageInfoResolver  { return r.pageInfo }
+
+type locationPageResolver struct {
+	locations []*locationResolver
+	pageInfo  *pageInfoResolver
+}
+
+func (r *locationPageResolver) Locations() []*locationResolver { return r.locations }
+func (r *locationPageResolver) PageInfo() *pageInfoResolver    { return r.pageInfo }
+
+type stockMovementPageResolver struct {
+	movements []*stockMovementResolver
+	pageInfo  *pageInfoResolver
+}
+
+func (r *stockMovementPageResolver) StockMovements() []*stockMovementResolver { return r.movements }
+func (r *stockMovementPageResolver) PageInfo() *pageInfoResolver              { return r.pageInfo }
+
+type productResolver struct {
+	l *loaders
+	p *models.Product
+}
+
+// newProductResolver primes the product loader with p, and registers its ID so
+// the stock and recent movements of every product in the response are
+// loaded together.
+func newProductResolver(l *loaders, p *models.Product) *productResolver {
+	l.productIDs.add(p.ID)
+	l.products.prime(p.ID, p)
+	return &productResolver{l: l, p: p}
+}
+
+func (r *productResolver) ID() int32             { return int32(r.p.ID) }
+func (r *productResolver) SKUName() string       { return r.p.SKUName }
+func (r *productResolver) Quantity() int32       { return int32(r.p.Quantity) }
+func (r *productResolver) CostingMethod() string { return r.p.CostingMethod }
+func (r *productResolver) AverageCost() float64  { return r.p.AverageCost }
+func (r *productResolver) ReorderLevel() int32   { return int32(r.p.ReorderLevel) }
+func (r *productResolver) CreatedAt() graphql.Time {
+	return graphql.Time{Time: r.p.CreatedAt}
+}
+func (r *productResolver) UpdatedAt() graphql.Time {
+	return graphql.Time{Time: r.p.UpdatedAt}
+}
+
+func (r *productResolver) Stock() ([]*productStockResolver, error) {
+	lines, err := r.l.productStock.load(r.p.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	resolvers := make([]*productStockResolver, 0, len(lines))
+	for _, line := range lines {
+		resolvers = append(resolvers, &productStockResolver{l: r.l, line: line})
+	}
+	return resolvers, nil
+}
+
+func (r *productResolver) RecentMovements(args struct{ Limit int32 }) ([]*stockMovementResolver, error) {
+	movements, err := r.l.recent(clampLimit(args.Limit)).load(r.p.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	resolvers := make([]*stockMovementResolver, 0, len(movements))
+	for _, movement := range movements {
+		resolvers = append(resolvers, newStockMovementResolver(r.l, movement))
+	}
+	return resolvers, nil
+}
+
+type productStockResolver struct {
+	l    *loaders
+	line *models.StockBalanceLine
+}
+
+func (r *productStockResolver) Location() (*locationResolver, error) {
+	return loadLocation(r.l, r.line.LocationID)
+}
+
+func (r *productStockResolver) Quantity() int32 { return int32(r.line.Quantity) }
+
+type locationResolver struct {
+	l   *loaders
+	loc *models.LocationWithUsage
+}
+
+// newLocationResolver primes the location loader with loc, and registers its
+// ID so the contents of every location in the response are loaded together.
+func newLocationResolver(l *loaders, loc *models.LocationWithUsage) *locationResolver {
+	l.locationIDs.add(loc.ID)
+	l.locations.prime(loc.ID, loc)
+	return &locationResolver{l: l, loc: loc}
+}
+
+func (r *locationResolver) ID() int32           { return int32(r.loc.ID) }
+func (r *locationResolver) Code() string        { return r.loc.Code }
+func (r *locationResolver) Name() string        { return r.loc.Name }
+func (r *locationResolver) Warehouse() string   { return r.loc.Warehouse }
+func (r *locationResolver) Capacity() int32     { return int32(r.loc.Capacity) }
+func (r *locationResolver) CurrentUsage() int32 { return int32(r.loc.CurrentUsage) }
+func (r *locationResolver) Available() int32    { return int32(r.loc.Available) }
+func (r *locationResolver) CreatedAt() graphql.Time {
+	return graphql.Time{Time: r.loc.CreatedAt}
+}
+
+func (r *locationResolver) Contents() ([]*locationContentResolver, error) {
+	lines, err := r.l.locationContents.load(r.loc.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	resolvers := make([]*locationContentResolver, 0, len(lines))
+	for _, line := range lines {
+		resolvers = append(resolvers, &locationContentResolver{l: r.l, line: line})
+	}
+	return resolvers, nil
+}
+
+type locationContentResolver struct {
+	l    *loaders
+	line *models.StockBalanceLine
+}
+
+func (r *locationContentResolver) Product() (*productResolver, error) {
+	return loadProduct(r.l, r.line.ProductID)
+}
+
+func (r *locationContentResolver) Quantity() int32 { return int32(r.line.Quantity) }
+
+type stockMovementResolver struct {
+	l *loaders
+	m *models.StockMovement
+}
+
+// newStockMovementResolver registers the movement's product and location so
+// they are loaded together with those of its siblings.
+func newStockMovementResolver(l *loaders, m *models.StockMovement) *stockMovementResolver {
+	l.productIDs.add(m.ProductID)
+	l.locationIDs.add(m.LocationID)
+	return &stockMovementResolver{l: l, m: m}
+}
+
+func (r *stockMovementResolver) ID() int32            { return int32(r.m.ID) }
+func (r *stockMovementResolver) ProductID() int32     { return int32(r.m.ProductID) }
+func (r *stockMovementResolver) LocationID() int32    { return int32(r.m.LocationID) }
+func (r *stockMovementResolver) Type() string         { return r.m.Type }
+func (r *stockMovementResolver) Quantity() int32      { return int32(r.m.Quantity) }
+func (r *stockMovementResolver) UnitCost() float64    { return r.m.UnitCost }
+func (r *stockMovementResolver) TotalCost() float64   { return r.m.TotalCost }
+func (r *stockMovementResolver) AverageCost() float64 { return r.m.AverageCost }
+func (r *stockMovementResolver) Source() string       { return r.m.Source }
+func (r *stockMovementResolver) Reference() string    { return r.m.Reference }
+func (r *stockMovementResolver) Note() string         { return r.m.Note }
+func (r *stockMovementResolver) CreatedBy() string    { return r.m.CreatedBy }
+func (r *stockMovementResolver) CreatedAt() graphql.Time {
+	return graphql.Time{Time: r.m.CreatedAt}
+}
+
+func (r *stockMovementResolver) ReversalOf() *int32 {
+	if r.m.ReversalOf == nil {
+		return nil
+	}
+	id := int32(*r.m.ReversalOf)
+	return &id
+}
+
+func (r *stockMovementResolver) ReversedAt() *graphql.Time {
+	if r.m.ReversedAt == nil {
+		return nil
+	}
+	return &graphql.Time{Time: *r.m.ReversedAt}
+}
+
+func (r *stockMovementResolver) ReversedBy() *string     { return optionalString(r.m.ReversedBy) }
+func (r *stockMovementResolver) ReversalReason() *string { return optionalString(r.m.ReversalReason) }
+
+func (r *stockMovementResolver) Product() (*productResolver, error) {
+	return loadProduct(r.l, r.m.ProductID)
+}
+
+func (r *stockMovementResolver) Location() (*locationResolver, error) {
+	return loadLocation(r.l, r.m.LocationID)
+}
+
+func optionalString(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
+
+// loadProduct resolves a product referenced by ID. The foreign keys guarantee
+// it exists, so a missing product is reported as an error rather than null.
+func loadProduct(l *loaders, id int) (*productResolver, error) {
+	product, err := l.products.load(id)
+	if err != nil {
+		return nil, err
+	}
+	if product == nil {
+		return nil, errNotFound("product", id)
+	}
+	return &productResolver{l: l, p: product}, nil
+}
+
+func loadLocation(l *loaders, id int) (*locationResolver, error) {
+	location, err := l.locations.load(id)
+	if err != nil {
+		return nil, err
+	}
+	if location == nil {
+		return nil, errNotFound("location", id)
+	}
+	return &locationResolver{l: l, loc: location}, nil
+}
+
+func errNotFound(kind string, id int) error {
+	return fmt.Errorf("%s %d not found", kind, id)
+}
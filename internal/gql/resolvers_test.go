@@ -0,0 +1,196 @@
+package gql
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+	"warehouse-api/internal/models"
+	"warehouse-api/internal/repositories/memory"
+	"warehouse-api/internal/services"
+
+	graphql "github.com/graph-gophers/graphql-go"
+)
+
+const movementsQuery = `{
+  stock_movements(limit: 10) {
+    stock_movements {
+      id
+      product_id
+      location_id
+      product { id sku_name stock { location { code } quantity } }
+      location { id code }
+    }
+  }
+}`
+
+// movementsResult is the data movementsQuery answers with.
+type movementsResult struct {
+	StockMovements struct {
+		StockMovements []struct {
+			ID         int `json:"id"`
+			ProductID  int `json:"product_id"`
+			LocationID int `json:"location_id"`
+			Product    struct {
+				ID      int    `json:"id"`
+				SKUName string `json:"sku_name"`
+				Stock   []struct {
+					Location struct {
+						Code string `json:"code"`
+					} `json:"location"`
+					Quantity int `json:"quantity"`
+				} `json:"stock"`
+			} `json:"product"`
+			Location struct {
+				ID   int    `json:"id"`
+				Code string `json:"code"`
+			} `json:"location"`
+		} `json:"stock_movements"`
+	} `json:"stock_movements"`
+}
+
+// testSchema is a schema over an in-memory store holding two products, each
+// received at two locations.
+type testSchema struct {
+	*Schema
+	skus  map[int]string
+	codes map[int]string
+}
+
+func newTestSchema(t *testing.T) *testSchema {
+	t.Helper()
+	ctx := context.Background()
+
+	store := memory.New()
+	events := services.EventRecorders{}
+	products := services.NewProductService(store, events)
+	locations := services.NewLocationService(store, events)
+	stock := services.NewStockService(store, events)
+	s := &testSchema{Schema: NewSchema(products, locations, stock), skus: map[int]string{}, codes: map[int]string{}}
+
+	var productIDs, locationIDs []int
+	for _, sku := range []string{"SKU-1", "SKU-2"} {
+		product, err := products.Create(ctx, &models.CreateProductRequest{SKUName: sku, CostingMethod: models.CostingFIFO})
+		if err != nil {
+			t.Fatalf("create product: %v", err)
+		}
+		s.skus[product.ID] = sku
+		productIDs = append(productIDs, product.ID)
+	}
+	for _, code := range []string{"A1", "B1"} {
+		location, err := locations.Create(ctx, &models.CreateLocationRequest{Code: code, Name: code, Capacity: 100})
+		if err != nil {
+			t.Fatalf("create location: %v", err)
+		}
+		s.codes[location.ID] = code
+		locationIDs = append(locationIDs, location.ID)
+	}
+	for _, locationID := range locationIDs {
+		for _, productID := range productIDs {
+			_, err := stock.Create(ctx, &models.CreateStockMovementRequest{ProductID: productID, LocationID: locationID, Type: "IN", Quantity: 1}, "tester")
+			if err != nil {
+				t.Fatalf("create movement: %v", err)
+			}
+		}
+	}
+	return s
+}
+
+// exec runs query with loaders whose fetches are recorded, after letting
+// adjust replace them.
+func (s *testSchema) exec(query string, adjust func(l *loaders)) (*graphql.Response, map[string]*fetchLog) {
+	ctx := context.Background()
+	l := s.newLoaders(ctx)
+	if adjust != nil {
+		adjust(l)
+	}
+	logs := map[string]*fetchLog{"products": {}, "locations": {}, "product stock": {}}
+	counted(l.products, logs["products"])
+	counted(l.locations, logs["locations"])
+	counted(l.productStock, logs["product stock"])
+	return s.schema.Exec(withLoaders(ctx, l), query, "", nil), logs
+}
+
+func TestMovementsResolveProductsAndLocationsInOneBatch(t *testing.T) {
+	s := newTestSchema(t)
+
+	resp, logs := s.exec(movementsQuery, nil)
+	if len(resp.Errors) > 0 {
+		t.Fatalf("errors: %v", resp.Errors)
+	}
+	var result movementsResult
+	if err := json.Unmarshal(resp.Data, &result); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+
+	movements := result.StockMovements.StockMovements
+	if len(movements) != 4 {
+		t.Fatalf("got %d movements, want 4", len(movements))
+	}
+	for _, m := range movements {
+		if m.Product.ID != m.ProductID || m.Product.SKUName != s.skus[m.ProductID] {
+			t.Errorf("movement %d of product %d resolved product %d %q", m.ID, m.ProductID, m.Product.ID, m.Product.SKUName)
+		}
+		if m.Location.ID != m.LocationID || m.Location.Code != s.codes[m.LocationID] {
+			t.Errorf("movement %d at location %d resolved location %d %q", m.ID, m.LocationID, m.Location.ID, m.Location.Code)
+		}
+		if len(m.Product.Stock) != 2 || m.Product.Stock[0].Location.Code != "A1" || m.Product.Stock[1].Location.Code != "B1" {
+			t.Errorf("movement %d resolved product stock %+v, want one unit at A1 and B1", m.ID, m.Product.Stock)
+		}
+	}
+
+	expectBatches(t, "products", logs["products"], []int{1, 2})
+	expectBatches(t, "product stock", logs["product stock"], []int{1, 2})
+	// The locations of the product stock were seen before the first
+	// location was loaded, so they come in the same batch.
+	expectBatches(t, "locations", logs["locations"], []int{1, 2})
+}
+
+func TestMovementsReportMissingAndFailedKeys(t *testing.T) {
+	s := newTestSchema(t)
+
+	// Location 2 is not returned, as though it were deleted mid-request
+	resp, logs := s.exec(movementsQuery, func(l *loaders) {
+		fetch := l.locations.fetch
+		l.locations.fetch = func(ids []int) (map[int]*models.LocationWithUsage, error) {
+			locations, err := fetch(ids)
+			delete(locations, 2)
+			return locations, err
+		}
+	})
+	// A location appears in the movements, the product stock and so on, so
+	// count distinct paths: one per movement at location 2
+	missing := map[string]bool{}
+	for _, err := range resp.Errors {
+		if err.Message != "location 2 not found" {
+			t.Errorf("unexpected error %v at %v", err.Message, err.Path)
+			continue
+		}
+		if len(err.Path) == 4 && err.Path[3] == "location" {
+			missing[fmt.Sprint(err.Path)] = true
+		}
+	}
+	if len(missing) != 2 {
+		t.Errorf("movement locations missing at %v, want the 2 movements at location 2", missing)
+	}
+	expectBatches(t, "locations", logs["locations"], []int{1, 2})
+
+	// A failed fetch fails every key in its batch, without fetching again
+	fail := errors.New("database is down")
+	resp, logs = s.exec(movementsQuery, func(l *loaders) {
+		l.products.fetch = func(ids []int) (map[int]*models.Product, error) { return nil, fail }
+	})
+	failed := 0
+	for _, err := range resp.Errors {
+		if err.Message != fail.Error() || len(err.Path) != 4 || err.Path[3] != "product" {
+			t.Errorf("unexpected error %v at %v", err.Message, err.Path)
+			continue
+		}
+		failed++
+	}
+	if failed != 4 {
+		t.Errorf("%d movement products failed, want 4", failed)
+	}
+	expectBatches(t, "products", logs["products"], []int{1, 2})
+}
@@ -0,0 +1,50 @@
+// Package gql serves read-only GraphQL queries over products, locations and
+// stock movements for dashboards. Nested fields are resolved through
+// per-request loaders that batch lookups, so a query costs one repository
+// call per field path rather than one per record.
+package gql
+
+import (
+	"context"
+	_ "embed"
+	"warehouse-api/internal/services"
+
+	graphql "github.com/graph-gophers/graphql-go"
+)
+
+//go:embed schema.graphql
+var schemaSDL string
+
+// maxDepth bounds how deeply queries may nest, since every level can fan out
+// to every product or location.
+const maxDepth = 8
+
+type Schema struct {
+	schema *graphql.Schema
+
+	productService  *services.ProductService
+	locationService *services.LocationService
+	stockService    *services.StockService
+}
+
+func NewSchema(
+	productService *services.ProductService,
+	locationService *services.LocationService,
+	stockService *services.StockService,
+) *Schema {
+	s := &Schema{
+		productService:  productService,
+		locationService: locationService,
+		stockService:    stockService,
+	}
+	s.schema = graphql.MustParseSchema(schemaSDL, &queryResolver{s: s},
+		graphql.UseStringDescriptions(),
+		graphql.MaxDepth(maxDepth),
+	)
+	return s
+}
+
+// Exec runs a query with a fresh set of loaders.
+func (s *Schema) Exec(ctx context.Context, query, operationName string, variables map[string]interface{}) *graphql.Response {
+	return s.schema.Exec(withLoaders(ctx, s.newLoaders(ctx)), query, operationName, variables)
+}
@@ -0,0 +1,85 @@
+package grpcserver
+
+import (
+	"context"
+	"crypto/subtle"
+	"strings"
+	"warehouse-api/internal/logging"
+	"warehouse-api/internal/utils"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// APIKeyUser is recorded as created_by for calls authenticated by API key.
+const APIKeyUser = "api-key"
+
+// Username returns the caller the auth interceptors attached to ctx. It is
+// the username the logs of the call report.
+func Username(ctx context.Context) string {
+	return logging.Username(ctx)
+}
+
+// authenticator accepts the same JWTs as the REST API in the authorization
+// metadata, or one of the configured keys in x-api-key.
+type authenticator struct {
+	apiKeys []string
+}
+
+func (a *authenticator) authenticate(ctx context.Context) (context.Context, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+
+	if keys := md.Get("x-api-key"); len(keys) > 0 {
+		for _, key := range a.apiKeys {
+			if subtle.ConstantTimeCompare([]byte(keys[0]), []byte(key)) == 1 {
+				return logging.WithUsername(ctx, APIKeyUser), nil
+			}
+		}
+		return nil, status.Error(codes.Unauthenticated, "invalid API key")
+	}
+
+	values := md.Get("authorization")
+	if len(values) == 0 {
+		return nil, status.Error(codes.Unauthenticated, "authorization or x-api-key metadata required")
+	}
+
+	parts := strings.Split(values[0], " ")
+	if len(parts) != 2 || parts[0] != "Bearer" {
+		return nil, status.Error(codes.Unauthenticated, "invalid authorization metadata format")
+	}
+
+	claims, err := utils.ValidateToken(parts[1])
+	if err != nil {
+		return nil, status.Error(codes.Unauthenticated, "invalid or expired token")
+	}
+
+	return logging.WithUsername(ctx, claims.Username), nil
+}
+
+func (a *authenticator) unary(ctx context.Context, req interface{}, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	ctx, err := a.authenticate(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+func (a *authenticator) stream(srv interface{}, ss grpc.ServerStream, _ *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	ctx, err := a.authenticate(ss.Context())
+	if err != nil {
+		return err
+	}
+	return handler(srv, &authenticatedStream{ServerStream: ss, ctx: ctx})
+}
+
+// authenticatedStream carries the caller's context into stream handlers.
+type authenticatedStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *authenticatedStream) Context() context.Context {
+	return s.ctx
+}
@@ -0,0 +1,125 @@
+package grpcserver
+
+import (
+	"time"
+	"warehouse-api/internal/models"
+	warehousev1 "warehouse-api/proto/warehouse/v1"
+
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func productToProto(p *models.Product) *warehousev1.Product {
+	return &warehousev1.Product{
+		Id:            int32(p.ID),
+		SkuName:       p.SKUName,
+		Quantity:      int32(p.Quantity),
+		CostingMethod: p.CostingMethod,
+		AverageCost:   p.AverageCost,
+		ReorderLevel:  int32(p.ReorderLevel),
+		CreatedAt:     timestamppb.New(p.CreatedAt),
+		UpdatedAt:     timestamppb.New(p.UpdatedAt),
+	}
+}
+
+func locationToProto(l *models.Location) *warehousev1.Location {
+	return &warehousev1.Location{
+		Id:        int32(l.ID),
+		Code:      l.Code,
+		Name:      l.Name,
+		Warehouse: l.Warehouse,
+		Capacity:  int32(l.Capacity),
+		CreatedAt: timestamppb.New(l.CreatedAt),
+	}
+}
+
+func locationUsageToProto(l *models.LocationWithUsage) *warehousev1.Location {
+	location := locationToProto(&l.Location)
+	location.CurrentUsage = int32(l.CurrentUsage)
+	location.Available = int32(l.Available)
+	return location
+}
+
+func movementToProto(m *models.StockMovement) *warehousev1.StockMovement {
+	movement := &warehousev1.StockMovement{
+		Id:             int32(m.ID),
+		ProductId:      int32(m.ProductID),
+		LocationId:     int32(m.LocationID),
+		Type:           m.Type,
+		Quantity:       int32(m.Quantity),
+		UnitCost:       m.UnitCost,
+		TotalCost:      m.TotalCost,
+		AverageCost:    m.AverageCost,
+		Source:         m.Source,
+		Reference:      m.Reference,
+		Note:           m.Note,
+		CreatedBy:      m.CreatedBy,
+		CreatedAt:      timestamppb.New(m.CreatedAt),
+		ReversedBy:     m.ReversedBy,
+		ReversalReason: m.ReversalReason,
+		ReversedAt:     optionalTimestamp(m.ReversedAt),
+	}
+	if m.ReversalOf != nil {
+		reversalOf := int32(*m.ReversalOf)
+		movement.ReversalOf = &reversalOf
+	}
+	return movement
+}
+
+func balanceToProto(b *models.StreamBalanceData) *warehousev1.StockBalance {
+	return &warehousev1.StockBalance{
+		ProductId:       int32(b.ProductID),
+		SkuName:         b.SKUName,
+		LocationId:      int32(b.LocationID),
+		LocationCode:    b.LocationCode,
+		Warehouse:       b.Warehouse,
+		Quantity:        int32(b.Quantity),
+		ProductQuantity: int32(b.ProductQuantity),
+	}
+}
+
+// streamMessageToProto converts a StreamService update. It returns nil for
+// message types it does not know.
+func streamMessageToProto(msg *models.StreamMessage) *warehousev1.WatchMovementsResponse {
+	switch data := msg.Data.(type) {
+	case *models.StockMovement:
+		return &warehousev1.WatchMovementsResponse{
+			Update: &warehousev1.WatchMovementsResponse_Movement{Movement: movementToProto(data)},
+		}
+	case *models.StreamBalanceData:
+		return &warehousev1.WatchMovementsResponse{
+			Update: &warehousev1.WatchMovementsResponse_Balance{Balance: balanceToProto(data)},
+		}
+	case *models.LocationWithUsage:
+		return &warehousev1.WatchMovementsResponse{
+			Update: &warehousev1.WatchMovementsResponse_LocationUsage{LocationUsage: locationUsageToProto(data)},
+		}
+	default:
+		return nil
+	}
+}
+
+func optionalTimestamp(t *time.Time) *timestamppb.Timestamp {
+	if t == nil {
+		return nil
+	}
+	return timestamppb.New(*t)
+}
+
+func optionalInt(v *int32) *int {
+	if v == nil {
+		return nil
+	}
+	i := int(*v)
+	return &i
+}
+
+func intList(v []int32) []int {
+	if len(v) == 0 {
+		return nil
+	}
+	ints := make([]int, 0, len(v))
+	for _, i := range v {
+		ints = append(ints, int(i))
+	}
+	return ints
+}
@@ -0,0 +1,42 @@
+package grpcserver
+
+import (
+	"context"
+	"log/slog"
+	"warehouse-api/internal/apperrors"
+	"warehouse-api/internal/logging"
+	"warehouse-api/internal/utils"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// invalidArgument reports the fields of req that failed validation.
+func invalidArgument(ctx context.Context, req interface{}, err error) error {
+	return serviceError(ctx, utils.ValidationError(req, err))
+}
+
+// serviceError maps an error to the status code matching its apperrors kind.
+// Errors without a kind are logged with the call's context and reported as
+// Internal.
+func serviceError(ctx context.Context, err error) error {
+	var code codes.Code
+	switch apperrors.KindOf(err) {
+	case apperrors.Invalid, apperrors.Unprocessable:
+		code = codes.InvalidArgument
+	case apperrors.Unauthenticated:
+		code = codes.Unauthenticated
+	case apperrors.NotFound:
+		code = codes.NotFound
+	case apperrors.Conflict:
+		code = codes.AlreadyExists
+	case apperrors.FailedPrecondition:
+		code = codes.FailedPrecondition
+	case apperrors.Timeout:
+		code = codes.DeadlineExceeded
+	default:
+		slog.ErrorContext(ctx, "gRPC call failed", logging.Err(err))
+		return status.Error(codes.Internal, "internal server error")
+	}
+	return status.Error(code, err.Error())
+}
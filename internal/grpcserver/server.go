@@ -0,0 +1,256 @@
+// Package grpcserver serves the WarehouseService defined in
+// proto/warehouse/v1. It calls the same services as the REST handlers, so
+// both APIs apply the same business rules.
+package grpcserver
+
+import (
+	"context"
+	"warehouse-api/internal/models"
+	"warehouse-api/internal/services"
+	"warehouse-api/internal/utils"
+	warehousev1 "warehouse-api/proto/warehouse/v1"
+
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type server struct {
+	warehousev1.UnimplementedWarehouseServiceServer
+
+	productService  *services.ProductService
+	locationService *services.LocationService
+	stockService    *services.StockService
+	streamService   *services.StreamService
+}
+
+// New returns a gRPC server with WarehouseService registered behind the auth
+// interceptors. apiKeys are accepted in x-api-key alongside JWTs. Every call
+// is traced, continuing the caller's trace when it sends one. opts, such as
+// TLS credentials, are passed on to grpc.NewServer.
+func New(
+	productService *services.ProductService,
+	locationService *services.LocationService,
+	stockService *services.StockService,
+	streamService *services.StreamService,
+	apiKeys []string,
+	opts ...grpc.ServerOption,
+) *grpc.Server {
+	auth := &authenticator{apiKeys: apiKeys}
+	s := grpc.NewServer(append([]grpc.ServerOption{
+		grpc.StatsHandler(otelgrpc.NewServerHandler()),
+		grpc.UnaryInterceptor(auth.unary),
+		grpc.StreamInterceptor(auth.stream),
+	}, opts...)...)
+	warehousev1.RegisterWarehouseServiceServer(s, &server{
+		productService:  productService,
+		locationService: locationService,
+		stockService:    stockService,
+		streamService:   streamService,
+	})
+	return s
+}
+
+func (s *server) ListProducts(ctx context.Context, req *warehousev1.ListProductsRequest) (*warehousev1.ListProductsResponse, error) {
+	filter := &models.ProductFilter{
+		IDs:           intList(req.Ids),
+		Search:        req.Search,
+		CostingMethod: req.CostingMethod,
+		MinQuantity:   optionalInt(req.MinQuantity),
+		MaxQuantity:   optionalInt(req.MaxQuantity),
+		PageRequest:   models.PageRequest{Cursor: req.Cursor, Sort: req.Sort, Limit: int(req.Limit)},
+	}
+
+	products, pagination, err := s.productService.GetAll(ctx, filter)
+	if err != nil {
+		return nil, serviceError(ctx, err)
+	}
+
+	resp := &warehousev1.ListProductsResponse{
+		Limit:      int32(pagination.Limit),
+		Sort:       pagination.Sort,
+		NextCursor: pagination.NextCursor,
+		HasMore:    pagination.HasMore,
+	}
+	for _, product := range products {
+		resp.Products = append(resp.Products, productToProto(product))
+	}
+	return resp, nil
+}
+
+func (s *server) GetProduct(ctx context.Context, req *warehousev1.GetProductRequest) (*warehousev1.Product, error) {
+	product, err := s.productService.GetByID(ctx, int(req.Id))
+	if err != nil {
+		return nil, serviceError(ctx, err)
+	}
+	return productToProto(product), nil
+}
+
+func (s *server) CreateProduct(ctx context.Context, req *warehousev1.CreateProductRequest) (*warehousev1.Product, error) {
+	create := &models.CreateProductRequest{
+		SKUName:       req.SkuName,
+		Quantity:      int(req.Quantity),
+		CostingMethod: req.CostingMethod,
+		ReorderLevel:  int(req.ReorderLevel),
+	}
+	if err := utils.ValidateStruct(create); err != nil {
+		return nil, invalidArgument(ctx, create, err)
+	}
+
+	product, err := s.productService.Create(ctx, create)
+	if err != nil {
+		return nil, serviceError(ctx, err)
+	}
+	return productToProto(product), nil
+}
+
+func (s *server) UpdateProduct(ctx context.Context, req *warehousev1.UpdateProductRequest) (*warehousev1.Product, error) {
+	update := &models.UpdateProductRequest{
+		SKUName:       req.SkuName,
+		Quantity:      int(req.Quantity),
+		CostingMethod: req.CostingMethod,
+		ReorderLevel:  optionalInt(req.ReorderLevel),
+	}
+	if err := utils.ValidateStruct(update); err != nil {
+		return nil, invalidArgument(ctx, update, err)
+	}
+
+	product, err := s.productService.Update(ctx, int(req.Id), update)
+	if err != nil {
+		return nil, serviceError(ctx, err)
+	}
+	return productToProto(product), nil
+}
+
+func (s *server) ListLocations(ctx context.Context, req *warehousev1.ListLocationsRequest) (*warehousev1.ListLocationsResponse, error) {
+	filter := &models.LocationFilter{
+		IDs:         intList(req.Ids),
+		Search:      req.Search,
+		Warehouse:   req.Warehouse,
+		MinCapacity: optionalInt(req.MinCapacity),
+		MaxCapacity: optionalInt(req.MaxCapacity),
+		PageRequest: models.PageRequest{Cursor: req.Cursor, Sort: req.Sort, Limit: int(req.Limit)},
+	}
+
+	locations, pagination, err := s.locationService.GetAll(ctx, filter)
+	if err != nil {
+		return nil, serviceError(ctx, err)
+	}
+
+	resp := &warehousev1.ListLocationsResponse{
+		Limit:      int32(pagination.Limit),
+		Sort:       pagination.Sort,
+		NextCursor: pagination.NextCursor,
+		HasMore:    pagination.HasMore,
+	}
+	for _, location := range locations {
+		resp.Locations = append(resp.Locations, locationUsageToProto(location))
+	}
+	return resp, nil
+}
+
+func (s *server) CreateLocation(ctx context.Context, req *warehousev1.CreateLocationRequest) (*warehousev1.Location, error) {
+	create := &models.CreateLocationRequest{
+		Code:      req.Code,
+		Name:      req.Name,
+		Warehouse: req.Warehouse,
+		Capacity:  int(req.Capacity),
+	}
+	if err := utils.ValidateStruct(create); err != nil {
+		return nil, invalidArgument(ctx, create, err)
+	}
+
+	location, err := s.locationService.Create(ctx, create)
+	if err != nil {
+		return nil, serviceError(ctx, err)
+	}
+	return locationToProto(location), nil
+}
+
+func (s *server) ListStockMovements(ctx context.Context, req *warehousev1.ListStockMovementsRequest) (*warehousev1.ListStockMovementsResponse, error) {
+	filter := &models.StockMovementFilter{
+		ProductIDs:  intList(req.ProductIds),
+		LocationIDs: intList(req.LocationIds),
+		Type:        req.Type,
+		Source:      req.Source,
+		CreatedBy:   req.CreatedBy,
+		Reference:   req.Reference,
+		MinQuantity: optionalInt(req.MinQuantity),
+		MaxQuantity: optionalInt(req.MaxQuantity),
+		StartDate:   req.StartDate,
+		EndDate:     req.EndDate,
+		PageRequest: models.PageRequest{Cursor: req.Cursor, Sort: req.Sort, Limit: int(req.Limit)},
+	}
+
+	movements, pagination, err := s.stockService.GetAll(ctx, filter)
+	if err != nil {
+		return nil, serviceError(ctx, err)
+	}
+
+	resp := &warehousev1.ListStockMovementsResponse{
+		Limit:      int32(pagination.Limit),
+		Sort:       pagination.Sort,
+		NextCursor: pagination.NextCursor,
+		HasMore:    pagination.HasMore,
+	}
+	for _, movement := range movements {
+		resp.Movements = append(resp.Movements, movementToProto(movement))
+	}
+	return resp, nil
+}
+
+func (s *server) CreateStockMovement(ctx context.Context, req *warehousev1.CreateStockMovementRequest) (*warehousev1.StockMovement, error) {
+	create := &models.CreateStockMovementRequest{
+		ProductID:  int(req.ProductId),
+		LocationID: int(req.LocationId),
+		Type:       req.Type,
+		Quantity:   int(req.Quantity),
+		UnitCost:   req.UnitCost,
+		Reference:  req.Reference,
+		Note:       req.Note,
+	}
+	if err := utils.ValidateStruct(create); err != nil {
+		return nil, invalidArgument(ctx, create, err)
+	}
+
+	movement, err := s.stockService.Create(ctx, create, Username(ctx))
+	if err != nil {
+		return nil, serviceError(ctx, err)
+	}
+	return movementToProto(movement), nil
+}
+
+// WatchMovements relays StreamService updates until the client goes away or
+// falls too far behind, in which case the stream ends with ResourceExhausted,
+// or the server shuts down, which ends it with Unavailable.
+func (s *server) WatchMovements(req *warehousev1.WatchMovementsRequest, stream warehousev1.WarehouseService_WatchMovementsServer) error {
+	sub := s.streamService.Subscribe(&models.StreamFilter{
+		ProductID:  optionalInt(req.ProductId),
+		LocationID: optionalInt(req.LocationId),
+		Warehouse:  req.Warehouse,
+	})
+	defer s.streamService.Unsubscribe(sub)
+
+	ctx := stream.Context()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case msg, ok := <-sub.Messages:
+			if !ok {
+				if sub.ShuttingDown() {
+					return status.Error(codes.Unavailable, "server shutting down")
+				}
+				return status.Error(codes.ResourceExhausted, "subscriber fell behind")
+			}
+			update := streamMessageToProto(msg)
+			if update == nil {
+				continue
+			}
+			if err := stream.Send(update); err != nil {
+				return err
+			}
+		}
+	}
+}
@@ -0,0 +1,256 @@
+package grpcserver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+	"warehouse-api/internal/apperrors"
+	"warehouse-api/internal/repositories/memory"
+	"warehouse-api/internal/services"
+	"warehouse-api/internal/utils"
+	warehousev1 "warehouse-api/proto/warehouse/v1"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+const testAPIKey = "grpc-test-api-key-0123456789"
+
+// testServer is the gRPC server wired to an in-memory store, served over an
+// in-process connection.
+type testServer struct {
+	store   *memory.Store
+	server  *grpc.Server
+	client  warehousev1.WarehouseServiceClient
+	payload chan string
+}
+
+func newTestServer(t *testing.T) *testServer {
+	t.Helper()
+
+	store := memory.New()
+	stream := services.NewStreamService(store)
+	events := services.EventRecorders{stream}
+	utils.InitJWT("grpc-test-secret")
+	s := &testServer{
+		store:   store,
+		server:  New(services.NewProductService(store, events), services.NewLocationService(store, events), services.NewStockService(store, events), stream, []string{testAPIKey}),
+		payload: make(chan string),
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go stream.RunLocal(ctx, s.payload)
+	t.Cleanup(cancel)
+
+	listener := bufconn.Listen(1 << 20)
+	go s.server.Serve(listener)
+	t.Cleanup(s.server.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufconn",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return listener.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	s.client = warehousev1.NewWarehouseServiceClient(conn)
+	return s
+}
+
+// withAPIKey returns a context that authenticates calls with testAPIKey.
+func withAPIKey() context.Context {
+	return metadata.AppendToOutgoingContext(context.Background(), "x-api-key", testAPIKey)
+}
+
+func expectCode(t *testing.T, name string, err error, want codes.Code) {
+	t.Helper()
+	if got := status.Code(err); got != want {
+		t.Errorf("%s: got %v (%v), want %v", name, got, err, want)
+	}
+}
+
+func TestAuthentication(t *testing.T) {
+	s := newTestServer(t)
+	token, err := utils.GenerateToken("alice")
+	if err != nil {
+		t.Fatalf("generate token: %v", err)
+	}
+
+	for _, tc := range []struct {
+		name     string
+		metadata []string
+		want     codes.Code
+	}{
+		{"valid JWT", []string{"authorization", "Bearer " + token}, codes.OK},
+		{"valid API key", []string{"x-api-key", testAPIKey}, codes.OK},
+		{"wrong API key", []string{"x-api-key", "not-the-key"}, codes.Unauthenticated},
+		{"wrong API key beside a valid JWT", []string{"x-api-key", "not-the-key", "authorization", "Bearer " + token}, codes.Unauthenticated},
+		{"invalid JWT", []string{"authorization", "Bearer not-a-token"}, codes.Unauthenticated},
+		{"malformed authorization", []string{"authorization", token}, codes.Unauthenticated},
+		{"missing metadata", nil, codes.Unauthenticated},
+	} {
+		ctx := context.Background()
+		if tc.metadata != nil {
+			ctx = metadata.AppendToOutgoingContext(ctx, tc.metadata...)
+		}
+		_, err := s.client.ListProducts(ctx, &warehousev1.ListProductsRequest{})
+		expectCode(t, tc.name, err, tc.want)
+
+		// Streams pass through the same check before the handler runs
+		stream, err := s.client.WatchMovements(ctx, &warehousev1.WatchMovementsRequest{})
+		if err == nil && tc.want != codes.OK {
+			_, err = stream.Recv()
+			expectCode(t, tc.name+" stream", err, tc.want)
+		}
+	}
+
+	// The caller is recorded on what it creates
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer "+token)
+	product, err := s.client.CreateProduct(ctx, &warehousev1.CreateProductRequest{SkuName: "SKU-1"})
+	if err != nil {
+		t.Fatalf("create product: %v", err)
+	}
+	location, err := s.client.CreateLocation(ctx, &warehousev1.CreateLocationRequest{Code: "A1", Name: "Aisle 1", Capacity: 10})
+	if err != nil {
+		t.Fatalf("create location: %v", err)
+	}
+	for _, tc := range []struct {
+		ctx  context.Context
+		want string
+	}{{ctx, "alice"}, {withAPIKey(), APIKeyUser}} {
+		movement, err := s.client.CreateStockMovement(tc.ctx, &warehousev1.CreateStockMovementRequest{ProductId: product.Id, LocationId: location.Id, Type: "IN", Quantity: 1})
+		if err != nil {
+			t.Fatalf("create movement: %v", err)
+		}
+		if movement.CreatedBy != tc.want {
+			t.Errorf("movement created by %q, want %q", movement.CreatedBy, tc.want)
+		}
+	}
+}
+
+func TestServiceErrorCodes(t *testing.T) {
+	ctx := context.Background()
+	for _, tc := range []struct {
+		err  error
+		want codes.Code
+	}{
+		{apperrors.New(apperrors.Invalid, "invalid", "bad"), codes.InvalidArgument},
+		{apperrors.New(apperrors.Unprocessable, "unprocessable", "bad upload"), codes.InvalidArgument},
+		{apperrors.New(apperrors.Unauthenticated, "unauthenticated", "who are you"), codes.Unauthenticated},
+		{apperrors.New(apperrors.NotFound, "not_found", "missing"), codes.NotFound},
+		{apperrors.New(apperrors.Conflict, "conflict", "taken"), codes.AlreadyExists},
+		{apperrors.New(apperrors.FailedPrecondition, "rejected", "not now"), codes.FailedPrecondition},
+		{apperrors.ErrTimeout, codes.DeadlineExceeded},
+		{fmt.Errorf("query: %w", context.DeadlineExceeded), codes.DeadlineExceeded},
+		{fmt.Errorf("wrapped: %w", services.ErrProductNotFound), codes.NotFound},
+		{errors.New("connection reset"), codes.Internal},
+	} {
+		err := serviceError(ctx, tc.err)
+		expectCode(t, tc.err.Error(), err, tc.want)
+		if tc.want == codes.Internal && status.Convert(err).Message() != "internal server error" {
+			t.Errorf("%v: internal error leaked as %q", tc.err, status.Convert(err).Message())
+		}
+	}
+
+	// The codes reach the client
+	s := newTestServer(t)
+	_, err := s.client.GetProduct(withAPIKey(), &warehousev1.GetProductRequest{Id: 42})
+	expectCode(t, "unknown product", err, codes.NotFound)
+	_, err = s.client.CreateProduct(withAPIKey(), &warehousev1.CreateProductRequest{})
+	expectCode(t, "product without SKU", err, codes.InvalidArgument)
+	product, err := s.client.CreateProduct(withAPIKey(), &warehousev1.CreateProductRequest{SkuName: "SKU-1"})
+	if err != nil {
+		t.Fatalf("create product: %v", err)
+	}
+	_, err = s.client.CreateProduct(withAPIKey(), &warehousev1.CreateProductRequest{SkuName: "SKU-1"})
+	expectCode(t, "duplicate SKU", err, codes.AlreadyExists)
+	location, err := s.client.CreateLocation(withAPIKey(), &warehousev1.CreateLocationRequest{Code: "A1", Name: "Aisle 1", Capacity: 10})
+	if err != nil {
+		t.Fatalf("create location: %v", err)
+	}
+	_, err = s.client.CreateStockMovement(withAPIKey(), &warehousev1.CreateStockMovementRequest{ProductId: product.Id, LocationId: location.Id, Type: "OUT", Quantity: 1})
+	expectCode(t, "OUT beyond stock on hand", err, codes.FailedPrecondition)
+}
+
+func TestWatchMovements(t *testing.T) {
+	s := newTestServer(t)
+	product, err := s.client.CreateProduct(withAPIKey(), &warehousev1.CreateProductRequest{SkuName: "SKU-1"})
+	if err != nil {
+		t.Fatalf("create product: %v", err)
+	}
+	location, err := s.client.CreateLocation(withAPIKey(), &warehousev1.CreateLocationRequest{Code: "A1", Name: "Aisle 1", Capacity: 10})
+	if err != nil {
+		t.Fatalf("create location: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(withAPIKey())
+	defer cancel()
+	stream, err := s.client.WatchMovements(ctx, &warehousev1.WatchMovementsRequest{ProductId: &product.Id})
+	if err != nil {
+		t.Fatalf("watch: %v", err)
+	}
+
+	posted, err := s.client.CreateStockMovement(withAPIKey(), &warehousev1.CreateStockMovementRequest{ProductId: product.Id, LocationId: location.Id, Type: "IN", Quantity: 3})
+	if err != nil {
+		t.Fatalf("create movement: %v", err)
+	}
+	// The product and location were announced before the movement
+	notifications := s.store.Notifications(services.StreamChannel)
+	if len(notifications) != 3 {
+		t.Fatalf("got %d notifications, want 3", len(notifications))
+	}
+	movementNotification := notifications[2]
+
+	// The stream subscribes once its handler runs, which the client cannot
+	// observe, so the notification is delivered until an update arrives.
+	received := make(chan *warehousev1.WatchMovementsResponse, 1)
+	go func() {
+		update, err := stream.Recv()
+		if err != nil {
+			t.Errorf("receive: %v", err)
+		}
+		received <- update
+	}()
+	var update *warehousev1.WatchMovementsResponse
+	deadline := time.After(5 * time.Second)
+	for update == nil {
+		select {
+		case update = <-received:
+		case s.payload <- movementNotification:
+			time.Sleep(10 * time.Millisecond)
+		case <-deadline:
+			t.Fatal("no update within 5s")
+		}
+	}
+	if movement := update.GetMovement(); movement == nil || movement.Id != posted.Id || movement.Quantity != 3 {
+		t.Fatalf("first update = %v, want movement %d", update, posted.Id)
+	}
+
+	// Cancelling ends the call on both sides: GracefulStop waits for the
+	// handler to return.
+	cancel()
+	for {
+		if _, err = stream.Recv(); err != nil {
+			break
+		}
+	}
+	expectCode(t, "receive after cancel", err, codes.Canceled)
+	stopped := make(chan struct{})
+	go func() {
+		s.server.GracefulStop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		t.Fatal("WatchMovements still running 5s after the client cancelled")
+	}
+}
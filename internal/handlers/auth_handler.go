@@ -1,34 +1,45 @@
 package handlers
 
 import (
+	"crypto/subtle"
+	"warehouse-api/internal/apperrors"
 	"warehouse-api/internal/models"
 	"warehouse-api/internal/utils"
 
 	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
 )
 
-type AuthHandler struct{}
+// AuthHandler logs in the one user the configuration names, checking the
+// password against its bcrypt hash.
+type AuthHandler struct {
+	username     string
+	passwordHash []byte
+}
 
-func NewAuthHandler() *AuthHandler {
-	return &AuthHandler{}
+func NewAuthHandler(username, passwordHash string) *AuthHandler {
+	return &AuthHandler{username: username, passwordHash: []byte(passwordHash)}
 }
 
 func (h *AuthHandler) Login(c *gin.Context) {
 	var req models.LoginRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		utils.BadRequestResponse(c, "Invalid request body")
+		utils.ErrorResponse(c, utils.ValidationError(&req, err))
 		return
 	}
 
-	// Hardcoded credentials for testing
-	if req.Username != "admin" || req.Password != "admin123" {
-		utils.UnauthorizedResponse(c, "Invalid credentials")
+	// The password is checked even for an unknown user, so the time taken
+	// does not tell which usernames exist
+	usernameOK := subtle.ConstantTimeCompare([]byte(req.Username), []byte(h.username)) == 1
+	passwordOK := bcrypt.CompareHashAndPassword(h.passwordHash, []byte(req.Password)) == nil
+	if !usernameOK || !passwordOK {
+		utils.ErrorResponse(c, apperrors.New(apperrors.Unauthenticated, "invalid_credentials", "Invalid credentials"))
 		return
 	}
 
 	token, err := utils.GenerateToken(req.Username)
 	if err != nil {
-		utils.InternalServerErrorResponse(c, "Failed to generate token", err)
+		utils.ErrorResponse(c, err)
 		return
 	}
 
@@ -41,4 +52,3 @@ func (h *AuthHandler) Login(c *gin.Context) {
 
 	utils.SuccessResponse(c, "Login successful", response)
 }
-
@@ -0,0 +1,63 @@
+package handlers
+
+import (
+	"strconv"
+	"warehouse-api/internal/apperrors"
+	"warehouse-api/internal/models"
+	"warehouse-api/internal/services"
+	"warehouse-api/internal/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+type EventHandler struct {
+	outboxService *services.OutboxService
+}
+
+func NewEventHandler(outboxService *services.OutboxService) *EventHandler {
+	return &EventHandler{outboxService: outboxService}
+}
+
+// GetAll reads the event stream in order. Consumers pass the position of the
+// last event they processed as after_position to continue where they left
+// off.
+func (h *EventHandler) GetAll(c *gin.Context) {
+	afterPosition, err := strconv.ParseInt(c.DefaultQuery("after_position", "0"), 10, 64)
+	if err != nil {
+		utils.ErrorResponse(c, apperrors.InvalidParameter("Invalid after_position"))
+		return
+	}
+
+	aggregateType := c.Query("aggregate_type")
+	switch aggregateType {
+	case "", models.AggregateProduct, models.AggregateLocation:
+	default:
+		utils.ErrorResponse(c, apperrors.InvalidParameter("Invalid aggregate_type, expected product or location"))
+		return
+	}
+
+	aggregateID, ok := optionalIntQuery(c, "aggregate_id")
+	if !ok {
+		return
+	}
+
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "100"))
+
+	events, err := h.outboxService.GetEvents(c.Request.Context(), afterPosition, limit, aggregateType, aggregateID)
+	if err != nil {
+		utils.ErrorResponse(c, err)
+		return
+	}
+
+	nextAfterPosition := afterPosition
+	if len(events) > 0 {
+		nextAfterPosition = *events[len(events)-1].Position
+	}
+
+	response := map[string]interface{}{
+		"events":              events,
+		"next_after_position": nextAfterPosition,
+	}
+
+	utils.SuccessResponse(c, "Events retrieved successfully", response)
+}
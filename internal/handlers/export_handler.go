@@ -0,0 +1,80 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"time"
+	"warehouse-api/internal/apperrors"
+	"warehouse-api/internal/logging"
+	"warehouse-api/internal/services"
+	"warehouse-api/internal/tabular"
+	"warehouse-api/internal/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+type ExportHandler struct {
+	exportService *services.ExportService
+}
+
+func NewExportHandler(exportService *services.ExportService) *ExportHandler {
+	return &ExportHandler{exportService: exportService}
+}
+
+// StockMovements streams every movement matching the same filters as
+// GET /stock-movements, without pagination.
+func (h *ExportHandler) StockMovements(c *gin.Context) {
+	filter, ok := parseMovementFilter(c)
+	if !ok {
+		return
+	}
+	h.export(c, "stock-movements", func(ctx context.Context, w io.Writer, format string) error {
+		return h.exportService.ExportMovements(ctx, w, format, filter)
+	})
+}
+
+func (h *ExportHandler) Stock(c *gin.Context) {
+	h.export(c, "stock", h.exportService.ExportStock)
+}
+
+func (h *ExportHandler) Locations(c *gin.Context) {
+	h.export(c, "locations", h.exportService.ExportLocations)
+}
+
+// export writes the response as an attachment in the format query parameter
+// (csv by default). Once rows have been sent the status can no longer change,
+// so a failure mid-stream drops the connection rather than letting the client
+// mistake a truncated file for a complete one.
+func (h *ExportHandler) export(c *gin.Context, name string, write func(ctx context.Context, w io.Writer, format string) error) {
+	format := c.DefaultQuery("format", tabular.FormatCSV)
+	switch format {
+	case tabular.FormatCSV, tabular.FormatXLSX, tabular.FormatNDJSON:
+	default:
+		utils.ErrorResponse(c, apperrors.InvalidParameter("Invalid format, expected csv, xlsx or ndjson"))
+		return
+	}
+
+	filename := fmt.Sprintf("%s-%s.%s", name, time.Now().UTC().Format("20060102-150405"), format)
+	c.Header("Content-Type", tabular.ContentType(format))
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+
+	err := write(c.Request.Context(), c.Writer, format)
+	if err == nil {
+		return
+	}
+
+	if !c.Writer.Written() {
+		c.Writer.Header().Del("Content-Type")
+		c.Writer.Header().Del("Content-Disposition")
+		utils.ErrorResponse(c, err)
+		return
+	}
+
+	slog.ErrorContext(c.Request.Context(), "Export failed after streaming started", slog.String("export", name), logging.Err(err))
+	c.Abort()
+	if conn, _, hijackErr := c.Writer.Hijack(); hijackErr == nil {
+		conn.Close()
+	}
+}
@@ -0,0 +1,32 @@
+package handlers
+
+import (
+	"net/http"
+	"warehouse-api/internal/gql"
+	"warehouse-api/internal/models"
+	"warehouse-api/internal/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+type GraphQLHandler struct {
+	schema *gql.Schema
+}
+
+func NewGraphQLHandler(schema *gql.Schema) *GraphQLHandler {
+	return &GraphQLHandler{schema: schema}
+}
+
+// Query executes a GraphQL query. As usual for GraphQL, the result is not
+// wrapped in APIResponse and query errors are reported in its errors field
+// with status 200.
+func (h *GraphQLHandler) Query(c *gin.Context) {
+	var req models.GraphQLRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ErrorResponse(c, utils.ValidationError(&req, err))
+		return
+	}
+
+	response := h.schema.Exec(c.Request.Context(), req.Query, req.OperationName, req.Variables)
+	c.JSON(http.StatusOK, response)
+}
@@ -0,0 +1,34 @@
+package handlers
+
+import (
+	"net/http"
+	"warehouse-api/internal/health"
+	"warehouse-api/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+type HealthHandler struct {
+	checker *health.Checker
+}
+
+func NewHealthHandler(checker *health.Checker) *HealthHandler {
+	return &HealthHandler{checker: checker}
+}
+
+// Livez answers 200 for as long as the process serves requests at all.
+func (h *HealthHandler) Livez(c *gin.Context) {
+	c.JSON(http.StatusOK, h.checker.Live())
+}
+
+// Readyz answers 200 when the database, its schema and the background
+// workers are usable, and 503 with the failing checks otherwise or once the
+// server is shutting down.
+func (h *HealthHandler) Readyz(c *gin.Context) {
+	report := h.checker.Ready(c.Request.Context())
+	status := http.StatusOK
+	if report.Status != models.HealthOK {
+		status = http.StatusServiceUnavailable
+	}
+	c.JSON(status, report)
+}
@@ -0,0 +1,83 @@
+package handlers
+
+import (
+	"strconv"
+	"warehouse-api/internal/apperrors"
+	"warehouse-api/internal/models"
+	"warehouse-api/internal/services"
+	"warehouse-api/internal/tabular"
+	"warehouse-api/internal/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+type ImportHandler struct {
+	importService *services.ImportService
+}
+
+func NewImportHandler(importService *services.ImportService) *ImportHandler {
+	return &ImportHandler{importService: importService}
+}
+
+func (h *ImportHandler) ImportProducts(c *gin.Context) {
+	h.importFile(c, models.ImportProducts)
+}
+
+func (h *ImportHandler) ImportLocations(c *gin.Context) {
+	h.importFile(c, models.ImportLocations)
+}
+
+func (h *ImportHandler) ImportOpeningBalances(c *gin.Context) {
+	h.importFile(c, models.ImportOpeningBalances)
+}
+
+// importFile reads the multipart "file" field as CSV or XLSX (from the format
+// query parameter or the file extension) and imports it. With dry_run=true
+// nothing is written and only the row-level report is returned.
+func (h *ImportHandler) importFile(c *gin.Context, kind string) {
+	dryRun, _ := strconv.ParseBool(c.DefaultQuery("dry_run", "false"))
+
+	header, err := c.FormFile("file")
+	if err != nil {
+		utils.ErrorResponse(c, apperrors.InvalidParameter("A file is required in the \"file\" form field"))
+		return
+	}
+
+	format := c.Query("format")
+	if format == "" {
+		format, err = tabular.FormatFromFilename(header.Filename)
+		if err != nil {
+			utils.ErrorResponse(c, apperrors.New(apperrors.Invalid, services.CodeInvalidFile, err.Error()))
+			return
+		}
+	}
+
+	file, err := header.Open()
+	if err != nil {
+		utils.ErrorResponse(c, err)
+		return
+	}
+	defer file.Close()
+
+	rows, err := tabular.Read(file, format)
+	if err != nil {
+		utils.ErrorResponse(c, apperrors.New(apperrors.Invalid, services.CodeInvalidFile, err.Error()))
+		return
+	}
+
+	report, err := h.importService.Import(c.Request.Context(), kind, rows, dryRun, c.GetString("username"))
+	if err != nil {
+		utils.ErrorResponse(c, err)
+		return
+	}
+
+	if len(report.Errors) > 0 {
+		utils.ErrorResponse(c, services.ErrImportRowsInvalid.WithDetails(report))
+		return
+	}
+	if dryRun {
+		utils.SuccessResponse(c, "Import file is valid", report)
+		return
+	}
+	utils.SuccessResponse(c, "Import completed successfully", report)
+}
@@ -0,0 +1,207 @@
+package handlers
+
+import (
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+	"warehouse-api/internal/apperrors"
+	"warehouse-api/internal/models"
+	"warehouse-api/internal/services"
+	"warehouse-api/internal/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+type LedgerHandler struct {
+	ledgerService         *services.LedgerService
+	reconciliationService *services.ReconciliationService
+}
+
+func NewLedgerHandler(ledgerService *services.LedgerService, reconciliationService *services.ReconciliationService) *LedgerHandler {
+	return &LedgerHandler{
+		ledgerService:         ledgerService,
+		reconciliationService: reconciliationService,
+	}
+}
+
+func (h *LedgerHandler) GetBalances(c *gin.Context) {
+	asOf := time.Now().UTC()
+	if asOfStr := c.Query("as_of"); asOfStr != "" {
+		parsed, err := parseTimeParam(asOfStr, true)
+		if err != nil {
+			utils.ErrorResponse(c, apperrors.InvalidParameter("Invalid as_of, expected RFC3339 timestamp or YYYY-MM-DD date"))
+			return
+		}
+		asOf = parsed
+	}
+
+	productID, ok := optionalIntQuery(c, "product_id")
+	if !ok {
+		return
+	}
+	locationID, ok := optionalIntQuery(c, "location_id")
+	if !ok {
+		return
+	}
+
+	report, err := h.ledgerService.GetBalances(c.Request.Context(), asOf, productID, locationID)
+	if err != nil {
+		utils.ErrorResponse(c, err)
+		return
+	}
+
+	utils.SuccessResponse(c, "Stock balances retrieved successfully", report)
+}
+
+func (h *LedgerHandler) CreateSnapshot(c *gin.Context) {
+	var req models.CreateSnapshotRequest
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		utils.ErrorResponse(c, utils.ValidationError(&req, err))
+		return
+	}
+
+	takenAt := time.Now().UTC().Add(-services.SnapshotSafetyLag)
+	if req.TakenAt != nil {
+		takenAt = req.TakenAt.UTC()
+	}
+
+	snapshot, err := h.ledgerService.CreateSnapshot(c.Request.Context(), takenAt)
+	if err != nil {
+		utils.ErrorResponse(c, err)
+		return
+	}
+
+	utils.SuccessResponse(c, "Stock snapshot created successfully", snapshot)
+}
+
+func (h *LedgerHandler) GetSnapshots(c *gin.Context) {
+	snapshots, err := h.ledgerService.GetSnapshots(c.Request.Context())
+	if err != nil {
+		utils.ErrorResponse(c, err)
+		return
+	}
+
+	utils.SuccessResponse(c, "Stock snapshots retrieved successfully", snapshots)
+}
+
+func (h *LedgerHandler) GetStockCard(c *gin.Context) {
+	productID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		utils.ErrorResponse(c, apperrors.InvalidParameter("Invalid product ID"))
+		return
+	}
+
+	locationID, ok := optionalIntQuery(c, "location_id")
+	if !ok {
+		return
+	}
+
+	var start, end *time.Time
+	if startStr := c.Query("start_date"); startStr != "" {
+		parsed, err := parseTimeParam(startStr, false)
+		if err != nil {
+			utils.ErrorResponse(c, apperrors.InvalidParameter("Invalid start_date, expected RFC3339 timestamp or YYYY-MM-DD date"))
+			return
+		}
+		start = &parsed
+	}
+	if endStr := c.Query("end_date"); endStr != "" {
+		parsed, err := parseTimeParam(endStr, true)
+		if err != nil {
+			utils.ErrorResponse(c, apperrors.InvalidParameter("Invalid end_date, expected RFC3339 timestamp or YYYY-MM-DD date"))
+			return
+		}
+		end = &parsed
+	}
+
+	card, err := h.ledgerService.GetStockCard(c.Request.Context(), productID, locationID, start, end)
+	if err != nil {
+		utils.ErrorResponse(c, err)
+		return
+	}
+
+	utils.SuccessResponse(c, "Stock card retrieved successfully", card)
+}
+
+// GetReconciliation reports ledger discrepancies without repairing them.
+func (h *LedgerHandler) GetReconciliation(c *gin.Context) {
+	report, err := h.reconciliationService.Reconcile(c.Request.Context(), &models.ReconcileRequest{}, c.GetString("username"))
+	if err != nil {
+		utils.ErrorResponse(c, err)
+		return
+	}
+
+	utils.SuccessResponse(c, "Stock ledger reconciled successfully", report)
+}
+
+func (h *LedgerHandler) Reconcile(c *gin.Context) {
+	var req models.ReconcileRequest
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		utils.ErrorResponse(c, utils.ValidationError(&req, err))
+		return
+	}
+
+	report, err := h.reconciliationService.Reconcile(c.Request.Context(), &req, c.GetString("username"))
+	if err != nil {
+		utils.ErrorResponse(c, err)
+		return
+	}
+
+	utils.SuccessResponse(c, "Stock ledger reconciled successfully", report)
+}
+
+// parseTimeParam accepts an RFC3339 timestamp or a YYYY-MM-DD date. A bare
+// date means the start of that day, or its last microsecond when endOfDay is
+// set, so "as of 2026-06-30" includes everything posted on the 30th.
+func parseTimeParam(value string, endOfDay bool) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t.UTC(), nil
+	}
+	t, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if endOfDay {
+		t = t.Add(24*time.Hour - time.Microsecond)
+	}
+	return t, nil
+}
+
+// optionalIntQuery parses an optional integer query parameter, answering 400
+// and returning ok=false when it is present but malformed.
+func optionalIntQuery(c *gin.Context, name string) (*int, bool) {
+	value := c.Query(name)
+	if value == "" {
+		return nil, true
+	}
+	parsed, err := strconv.Atoi(value)
+	if err != nil {
+		utils.ErrorResponse(c, apperrors.InvalidParameter("Invalid "+name))
+		return nil, false
+	}
+	return &parsed, true
+}
+
+// intListQuery parses an integer list parameter given either repeated
+// (?id=1&id=2) or comma-separated (?id=1,2), answering 400 and returning
+// ok=false when any value is malformed.
+func intListQuery(c *gin.Context, name string) ([]int, bool) {
+	var values []int
+	for _, param := range c.QueryArray(name) {
+		for _, value := range strings.Split(param, ",") {
+			value = strings.TrimSpace(value)
+			if value == "" {
+				continue
+			}
+			parsed, err := strconv.Atoi(value)
+			if err != nil {
+				utils.ErrorResponse(c, apperrors.InvalidParameter("Invalid "+name))
+				return nil, false
+			}
+			values = append(values, parsed)
+		}
+	}
+	return values, true
+}
@@ -17,29 +17,49 @@ func NewLocationHandler(locationService *services.LocationService) *LocationHand
 }
 
 func (h *LocationHandler) GetAll(c *gin.Context) {
-	locations, err := h.locationService.GetAll()
+	filter := &models.LocationFilter{
+		Search:    c.Query("search"),
+		Warehouse: c.Query("warehouse"),
+	}
+
+	var ok bool
+	if filter.PageRequest, ok = pageQuery(c); !ok {
+		return
+	}
+	if filter.IDs, ok = intListQuery(c, "id"); !ok {
+		return
+	}
+	if filter.MinCapacity, ok = optionalIntQuery(c, "min_capacity"); !ok {
+		return
+	}
+	if filter.MaxCapacity, ok = optionalIntQuery(c, "max_capacity"); !ok {
+		return
+	}
+
+	locations, pagination, err := h.locationService.GetAll(c.Request.Context(), filter)
 	if err != nil {
-		utils.InternalServerErrorResponse(c, "Failed to get locations", err)
+		utils.ErrorResponse(c, err)
 		return
 	}
 
-	utils.SuccessResponse(c, "Locations retrieved successfully", locations)
+	response := map[string]interface{}{
+		"locations":  locations,
+		"pagination": pagination,
+	}
+
+	utils.SuccessResponse(c, "Locations retrieved successfully", response)
 }
 
 func (h *LocationHandler) Create(c *gin.Context) {
 	var req models.CreateLocationRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		utils.BadRequestResponse(c, "Invalid request body: "+err.Error())
+		utils.ErrorResponse(c, utils.ValidationError(&req, err))
 		return
 	}
 
-	location, err := h.locationService.Create(&req)
+	location, err := h.locationService.Create(c.Request.Context(), &req)
 	if err != nil {
-		if err.Error() == "location code already exists" {
-			utils.BadRequestResponse(c, err.Error())
-			return
-		}
-		utils.InternalServerErrorResponse(c, "Failed to create location", err)
+		utils.ErrorResponse(c, err)
 		return
 	}
 
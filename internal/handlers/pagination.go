@@ -0,0 +1,29 @@
+package handlers
+
+import (
+	"strconv"
+	"warehouse-api/internal/apperrors"
+	"warehouse-api/internal/models"
+	"warehouse-api/internal/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// pageQuery reads the cursor, sort and limit parameters shared by the list
+// endpoints, answering 400 and returning ok=false when limit is malformed.
+// The sort and cursor are checked against the list being read later on.
+func pageQuery(c *gin.Context) (models.PageRequest, bool) {
+	page := models.PageRequest{
+		Cursor: c.Query("cursor"),
+		Sort:   c.Query("sort"),
+	}
+	if value := c.Query("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 1 {
+			utils.ErrorResponse(c, apperrors.InvalidParameter("Invalid limit"))
+			return page, false
+		}
+		page.Limit = limit
+	}
+	return page, true
+}
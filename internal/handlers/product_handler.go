@@ -2,6 +2,7 @@ package handlers
 
 import (
 	"strconv"
+	"warehouse-api/internal/apperrors"
 	"warehouse-api/internal/models"
 	"warehouse-api/internal/services"
 	"warehouse-api/internal/utils"
@@ -18,23 +19,34 @@ func NewProductHandler(productService *services.ProductService) *ProductHandler
 }
 
 func (h *ProductHandler) GetAll(c *gin.Context) {
-	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
-	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "10"))
-	search := c.Query("search")
+	filter := &models.ProductFilter{
+		Search:        c.Query("search"),
+		CostingMethod: c.Query("costing_method"),
+	}
+
+	var ok bool
+	if filter.PageRequest, ok = pageQuery(c); !ok {
+		return
+	}
+	if filter.IDs, ok = intListQuery(c, "id"); !ok {
+		return
+	}
+	if filter.MinQuantity, ok = optionalIntQuery(c, "min_quantity"); !ok {
+		return
+	}
+	if filter.MaxQuantity, ok = optionalIntQuery(c, "max_quantity"); !ok {
+		return
+	}
 
-	products, total, err := h.productService.GetAll(page, limit, search)
+	products, pagination, err := h.productService.GetAll(c.Request.Context(), filter)
 	if err != nil {
-		utils.InternalServerErrorResponse(c, "Failed to get products", err)
+		utils.ErrorResponse(c, err)
 		return
 	}
 
 	response := map[string]interface{}{
-		"products": products,
-		"pagination": map[string]interface{}{
-			"page":  page,
-			"limit": limit,
-			"total": total,
-		},
+		"products":   products,
+		"pagination": pagination,
 	}
 
 	utils.SuccessResponse(c, "Products retrieved successfully", response)
@@ -43,17 +55,13 @@ func (h *ProductHandler) GetAll(c *gin.Context) {
 func (h *ProductHandler) Create(c *gin.Context) {
 	var req models.CreateProductRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		utils.BadRequestResponse(c, "Invalid request body: "+err.Error())
+		utils.ErrorResponse(c, utils.ValidationError(&req, err))
 		return
 	}
 
-	product, err := h.productService.Create(&req)
+	product, err := h.productService.Create(c.Request.Context(), &req)
 	if err != nil {
-		if err.Error() == "SKU name already exists" {
-			utils.BadRequestResponse(c, err.Error())
-			return
-		}
-		utils.InternalServerErrorResponse(c, "Failed to create product", err)
+		utils.ErrorResponse(c, err)
 		return
 	}
 
@@ -63,27 +71,19 @@ func (h *ProductHandler) Create(c *gin.Context) {
 func (h *ProductHandler) Update(c *gin.Context) {
 	id, err := strconv.Atoi(c.Param("id"))
 	if err != nil {
-		utils.BadRequestResponse(c, "Invalid product ID")
+		utils.ErrorResponse(c, apperrors.InvalidParameter("Invalid product ID"))
 		return
 	}
 
 	var req models.UpdateProductRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		utils.BadRequestResponse(c, "Invalid request body: "+err.Error())
+		utils.ErrorResponse(c, utils.ValidationError(&req, err))
 		return
 	}
 
-	product, err := h.productService.Update(id, &req)
+	product, err := h.productService.Update(c.Request.Context(), id, &req)
 	if err != nil {
-		if err.Error() == "product not found" {
-			utils.NotFoundResponse(c, err.Error())
-			return
-		}
-		if err.Error() == "SKU name already exists" {
-			utils.BadRequestResponse(c, err.Error())
-			return
-		}
-		utils.InternalServerErrorResponse(c, "Failed to update product", err)
+		utils.ErrorResponse(c, err)
 		return
 	}
 
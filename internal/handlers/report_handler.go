@@ -0,0 +1,38 @@
+package handlers
+
+import (
+	"time"
+	"warehouse-api/internal/apperrors"
+	"warehouse-api/internal/services"
+	"warehouse-api/internal/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+type ReportHandler struct {
+	valuationService *services.ValuationService
+}
+
+func NewReportHandler(valuationService *services.ValuationService) *ReportHandler {
+	return &ReportHandler{valuationService: valuationService}
+}
+
+func (h *ReportHandler) Valuation(c *gin.Context) {
+	asOf := time.Now().UTC()
+	if asOfStr := c.Query("as_of"); asOfStr != "" {
+		parsed, err := time.Parse(time.RFC3339, asOfStr)
+		if err != nil {
+			utils.ErrorResponse(c, apperrors.InvalidParameter("Invalid as_of, expected RFC3339 timestamp"))
+			return
+		}
+		asOf = parsed.UTC()
+	}
+
+	report, err := h.valuationService.GetValuation(c.Request.Context(), asOf)
+	if err != nil {
+		utils.ErrorResponse(c, err)
+		return
+	}
+
+	utils.SuccessResponse(c, "Valuation retrieved successfully", report)
+}
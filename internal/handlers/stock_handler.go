@@ -2,6 +2,7 @@ package handlers
 
 import (
 	"strconv"
+	"warehouse-api/internal/apperrors"
 	"warehouse-api/internal/models"
 	"warehouse-api/internal/services"
 	"warehouse-api/internal/utils"
@@ -20,74 +21,115 @@ func NewStockHandler(stockService *services.StockService) *StockHandler {
 func (h *StockHandler) Create(c *gin.Context) {
 	var req models.CreateStockMovementRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		utils.BadRequestResponse(c, "Invalid request body: "+err.Error())
+		utils.ErrorResponse(c, utils.ValidationError(&req, err))
 		return
 	}
 
-	movement, err := h.stockService.Create(&req)
+	movement, err := h.stockService.Create(c.Request.Context(), &req, c.GetString("username"))
 	if err != nil {
-		if err.Error() == "product not found" || err.Error() == "location not found" {
-			utils.NotFoundResponse(c, err.Error())
-			return
-		}
-		if err.Error() == "insufficient product quantity" || err.Error() == "location capacity exceeded" {
-			utils.BadRequestResponse(c, err.Error())
-			return
-		}
-		utils.InternalServerErrorResponse(c, "Failed to create stock movement", err)
+		utils.ErrorResponse(c, err)
 		return
 	}
 
 	utils.SuccessResponse(c, "Stock movement created successfully", movement)
 }
 
-func (h *StockHandler) GetAll(c *gin.Context) {
-	filter := &models.StockMovementFilter{}
-
-	if productIDStr := c.Query("product_id"); productIDStr != "" {
-		if productID, err := strconv.Atoi(productIDStr); err == nil {
-			filter.ProductID = &productID
-		}
+func (h *StockHandler) CreateBatch(c *gin.Context) {
+	var req models.BatchStockMovementRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ErrorResponse(c, utils.ValidationError(&req, err))
+		return
 	}
 
-	if locationIDStr := c.Query("location_id"); locationIDStr != "" {
-		if locationID, err := strconv.Atoi(locationIDStr); err == nil {
-			filter.LocationID = &locationID
-		}
+	result, err := h.stockService.CreateBatch(c.Request.Context(), &req, c.GetString("username"))
+	if err != nil {
+		utils.ErrorResponse(c, err)
+		return
 	}
 
-	if typeStr := c.Query("type"); typeStr != "" {
-		filter.Type = &typeStr
+	utils.SuccessResponse(c, "Stock movements processed successfully", result)
+}
+
+func (h *StockHandler) Reverse(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		utils.ErrorResponse(c, apperrors.InvalidParameter("Invalid stock movement ID"))
+		return
 	}
 
-	if startDate := c.Query("start_date"); startDate != "" {
-		filter.StartDate = &startDate
+	var req models.ReverseStockMovementRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ErrorResponse(c, utils.ValidationError(&req, err))
+		return
 	}
 
-	if endDate := c.Query("end_date"); endDate != "" {
-		filter.EndDate = &endDate
+	reversal, err := h.stockService.Reverse(c.Request.Context(), id, &req, c.GetString("username"))
+	if err != nil {
+		utils.ErrorResponse(c, err)
+		return
 	}
 
-	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
-	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "10"))
-	filter.Page = page
-	filter.Limit = limit
+	utils.SuccessResponse(c, "Stock movement reversed successfully", reversal)
+}
 
-	movements, total, err := h.stockService.GetAll(filter)
+func (h *StockHandler) GetAll(c *gin.Context) {
+	filter, ok := parseMovementFilter(c)
+	if !ok {
+		return
+	}
+	if filter.PageRequest, ok = pageQuery(c); !ok {
+		return
+	}
+
+	movements, pagination, err := h.stockService.GetAll(c.Request.Context(), filter)
 	if err != nil {
-		utils.InternalServerErrorResponse(c, "Failed to get stock movements", err)
+		utils.ErrorResponse(c, err)
 		return
 	}
 
 	response := map[string]interface{}{
-		"movements": movements,
-		"pagination": map[string]interface{}{
-			"page":  page,
-			"limit": limit,
-			"total": total,
-		},
+		"movements":  movements,
+		"pagination": pagination,
 	}
 
 	utils.SuccessResponse(c, "Stock movements retrieved successfully", response)
 }
 
+// parseMovementFilter reads the filters shared by the movement list and
+// export endpoints, answering 400 and returning ok=false when a numeric
+// parameter is malformed.
+func parseMovementFilter(c *gin.Context) (*models.StockMovementFilter, bool) {
+	filter := &models.StockMovementFilter{
+		Source:    c.Query("source"),
+		CreatedBy: c.Query("created_by"),
+		Reference: c.Query("reference"),
+	}
+
+	var ok bool
+	if filter.ProductIDs, ok = intListQuery(c, "product_id"); !ok {
+		return nil, false
+	}
+	if filter.LocationIDs, ok = intListQuery(c, "location_id"); !ok {
+		return nil, false
+	}
+	if filter.MinQuantity, ok = optionalIntQuery(c, "min_quantity"); !ok {
+		return nil, false
+	}
+	if filter.MaxQuantity, ok = optionalIntQuery(c, "max_quantity"); !ok {
+		return nil, false
+	}
+
+	if typeStr := c.Query("type"); typeStr != "" {
+		filter.Type = &typeStr
+	}
+
+	if startDate := c.Query("start_date"); startDate != "" {
+		filter.StartDate = &startDate
+	}
+
+	if endDate := c.Query("end_date"); endDate != "" {
+		filter.EndDate = &endDate
+	}
+
+	return filter, true
+}
@@ -0,0 +1,176 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+	"warehouse-api/internal/logging"
+	"warehouse-api/internal/models"
+	"warehouse-api/internal/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+)
+
+const (
+	streamHeartbeat = 15 * time.Second
+	streamWriteWait = 10 * time.Second
+)
+
+type StreamHandler struct {
+	streamService  *services.StreamService
+	allowedOrigins map[string]bool
+	upgrader       websocket.Upgrader
+}
+
+// NewStreamHandler lets pages on the API's own origin, and on each of
+// allowedOrigins, open the WebSocket stream.
+func NewStreamHandler(streamService *services.StreamService, allowedOrigins []string) *StreamHandler {
+	h := &StreamHandler{streamService: streamService, allowedOrigins: make(map[string]bool)}
+	for _, origin := range allowedOrigins {
+		h.allowedOrigins[strings.ToLower(origin)] = true
+	}
+	h.upgrader.CheckOrigin = h.checkOrigin
+	return h
+}
+
+// checkOrigin accepts clients that send no Origin, which are not browsers,
+// and pages on the API's own origin or an allowed one. Browsers let any page
+// open a WebSocket, and the token may ride in access_token, so a page
+// elsewhere holding a user's token is refused.
+func (h *StreamHandler) checkOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	return strings.EqualFold(u.Host, r.Host) || h.allowedOrigins[strings.ToLower(origin)]
+}
+
+// parseStreamFilter reads the product_id, location_id and warehouse filters.
+func parseStreamFilter(c *gin.Context) (*models.StreamFilter, bool) {
+	filter := &models.StreamFilter{Warehouse: c.Query("warehouse")}
+
+	var ok bool
+	if filter.ProductID, ok = optionalIntQuery(c, "product_id"); !ok {
+		return nil, false
+	}
+	if filter.LocationID, ok = optionalIntQuery(c, "location_id"); !ok {
+		return nil, false
+	}
+	return filter, true
+}
+
+// Events streams updates as Server-Sent Events, one event per message named
+// after its type. Comment lines are sent as heartbeats so proxies keep the
+// connection open.
+func (h *StreamHandler) Events(c *gin.Context) {
+	filter, ok := parseStreamFilter(c)
+	if !ok {
+		return
+	}
+
+	// The stream outlives the server's write timeout. Recorders in tests
+	// do not support deadlines, which is fine
+	_ = http.NewResponseController(c.Writer).SetWriteDeadline(time.Time{})
+
+	sub := h.streamService.Subscribe(filter)
+	defer h.streamService.Unsubscribe(sub)
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+	fmt.Fprint(c.Writer, ": connected\n\n")
+	c.Writer.Flush()
+
+	heartbeat := time.NewTicker(streamHeartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-c.Request.Context().Done():
+			return
+		case <-heartbeat.C:
+			fmt.Fprint(c.Writer, ": ping\n\n")
+		case msg, open := <-sub.Messages:
+			if !open {
+				// Dropped for falling behind, or the server is shutting
+				// down; either way the client reconnects
+				return
+			}
+			data, err := json.Marshal(msg.Data)
+			if err != nil {
+				slog.ErrorContext(c.Request.Context(), "Failed to encode stream message", slog.String("event", msg.Type), logging.Err(err))
+				continue
+			}
+			fmt.Fprintf(c.Writer, "event: %s\ndata: %s\n\n", msg.Type, data)
+		}
+		c.Writer.Flush()
+	}
+}
+
+// WebSocket streams the same updates as Events over a WebSocket, one JSON
+// text message per update. Messages from the client are ignored.
+func (h *StreamHandler) WebSocket(c *gin.Context) {
+	filter, ok := parseStreamFilter(c)
+	if !ok {
+		return
+	}
+
+	conn, err := h.upgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		// Upgrade has already written the error response
+		return
+	}
+	defer conn.Close()
+
+	sub := h.streamService.Subscribe(filter)
+	defer h.streamService.Unsubscribe(sub)
+
+	// Read until the client goes away so close frames and pongs are handled
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	heartbeat := time.NewTicker(streamHeartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-closed:
+			return
+		case <-heartbeat.C:
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(streamWriteWait)); err != nil {
+				return
+			}
+		case msg, open := <-sub.Messages:
+			if !open {
+				closeMessage := websocket.FormatCloseMessage(websocket.CloseTryAgainLater, "subscriber fell behind")
+				if sub.ShuttingDown() {
+					closeMessage = websocket.FormatCloseMessage(websocket.CloseGoingAway, "server shutting down")
+				}
+				conn.WriteControl(websocket.CloseMessage, closeMessage, time.Now().Add(streamWriteWait))
+				return
+			}
+			conn.SetWriteDeadline(time.Now().Add(streamWriteWait))
+			if err := conn.WriteJSON(msg); err != nil {
+				return
+			}
+		}
+	}
+}
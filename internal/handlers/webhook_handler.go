@@ -0,0 +1,117 @@
+package handlers
+
+import (
+	"strconv"
+	"warehouse-api/internal/apperrors"
+	"warehouse-api/internal/models"
+	"warehouse-api/internal/services"
+	"warehouse-api/internal/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+type WebhookHandler struct {
+	webhookService *services.WebhookService
+}
+
+func NewWebhookHandler(webhookService *services.WebhookService) *WebhookHandler {
+	return &WebhookHandler{webhookService: webhookService}
+}
+
+func (h *WebhookHandler) Create(c *gin.Context) {
+	var req models.CreateWebhookRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ErrorResponse(c, utils.ValidationError(&req, err))
+		return
+	}
+
+	subscription, err := h.webhookService.CreateSubscription(c.Request.Context(), &req)
+	if err != nil {
+		utils.ErrorResponse(c, err)
+		return
+	}
+
+	utils.SuccessResponse(c, "Webhook subscription created successfully", subscription)
+}
+
+func (h *WebhookHandler) GetAll(c *gin.Context) {
+	subscriptions, err := h.webhookService.GetSubscriptions(c.Request.Context())
+	if err != nil {
+		utils.ErrorResponse(c, err)
+		return
+	}
+
+	utils.SuccessResponse(c, "Webhook subscriptions retrieved successfully", subscriptions)
+}
+
+func (h *WebhookHandler) Delete(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		utils.ErrorResponse(c, apperrors.InvalidParameter("Invalid webhook subscription ID"))
+		return
+	}
+
+	err = h.webhookService.DeleteSubscription(c.Request.Context(), id)
+	if err != nil {
+		utils.ErrorResponse(c, err)
+		return
+	}
+
+	utils.SuccessResponse(c, "Webhook subscription deleted successfully", nil)
+}
+
+// GetDeliveries lists deliveries, newest first. status=dead gives the
+// dead-letter list.
+func (h *WebhookHandler) GetDeliveries(c *gin.Context) {
+	filter := &models.WebhookDeliveryFilter{}
+
+	subscriptionID, ok := optionalIntQuery(c, "subscription_id")
+	if !ok {
+		return
+	}
+	filter.SubscriptionID = subscriptionID
+
+	switch status := c.Query("status"); status {
+	case "", models.WebhookDeliveryPending, models.WebhookDeliveryDelivered, models.WebhookDeliveryDead:
+		filter.Status = status
+	default:
+		utils.ErrorResponse(c, apperrors.InvalidParameter("Invalid status, expected pending, delivered or dead"))
+		return
+	}
+
+	filter.Page, _ = strconv.Atoi(c.DefaultQuery("page", "1"))
+	filter.Limit, _ = strconv.Atoi(c.DefaultQuery("limit", "10"))
+
+	deliveries, total, err := h.webhookService.GetDeliveries(c.Request.Context(), filter)
+	if err != nil {
+		utils.ErrorResponse(c, err)
+		return
+	}
+
+	response := map[string]interface{}{
+		"deliveries": deliveries,
+		"pagination": map[string]interface{}{
+			"page":  filter.Page,
+			"limit": filter.Limit,
+			"total": total,
+		},
+	}
+
+	utils.SuccessResponse(c, "Webhook deliveries retrieved successfully", response)
+}
+
+func (h *WebhookHandler) Redeliver(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		utils.ErrorResponse(c, apperrors.InvalidParameter("Invalid webhook delivery ID"))
+		return
+	}
+
+	delivery, err := h.webhookService.Redeliver(c.Request.Context(), id)
+	if err != nil {
+		utils.ErrorResponse(c, err)
+		return
+	}
+
+	utils.SuccessResponse(c, "Webhook delivery queued for redelivery", delivery)
+}
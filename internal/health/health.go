@@ -0,0 +1,78 @@
+// Package health decides what the liveness and readiness probes report. A
+// process is live for as long as it serves at all; it is ready while every
+// registered check passes and it is not shutting down, so load balancers
+// stop sending it requests before it stops taking them.
+package health
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+	"warehouse-api/internal/models"
+)
+
+// Check returns why a dependency is unusable, or nil.
+type Check func(ctx context.Context) error
+
+// Checker runs the readiness checks. Checks are registered with Add before
+// the server starts.
+type Checker struct {
+	timeout  time.Duration
+	names    []string
+	checks   []Check
+	draining atomic.Bool
+}
+
+// NewChecker returns a Checker that gives each check timeout to answer.
+func NewChecker(timeout time.Duration) *Checker {
+	return &Checker{timeout: timeout}
+}
+
+// Add registers check under name.
+func (c *Checker) Add(name string, check Check) {
+	c.names = append(c.names, name)
+	c.checks = append(c.checks, check)
+}
+
+// Drain marks the process as shutting down: from then on it is never ready.
+func (c *Checker) Drain() {
+	c.draining.Store(true)
+}
+
+// Live reports the process as live.
+func (c *Checker) Live() *models.HealthReport {
+	return &models.HealthReport{Status: models.HealthOK}
+}
+
+// Ready runs every check at once and reports whether all passed.
+func (c *Checker) Ready(ctx context.Context) *models.HealthReport {
+	if c.draining.Load() {
+		return &models.HealthReport{Status: models.HealthShuttingDown}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	results := make([]error, len(c.checks))
+	var wg sync.WaitGroup
+	for i, check := range c.checks {
+		wg.Add(1)
+		go func(i int, check Check) {
+			defer wg.Done()
+			results[i] = check(ctx)
+		}(i, check)
+	}
+	wg.Wait()
+
+	report := &models.HealthReport{Status: models.HealthOK, Checks: make(map[string]string, len(c.checks))}
+	for i, err := range results {
+		if err != nil {
+			report.Status = models.HealthUnavailable
+			report.Checks[c.names[i]] = err.Error()
+		} else {
+			report.Checks[c.names[i]] = models.HealthOK
+		}
+	}
+	return report
+}
@@ -0,0 +1,120 @@
+// Package logging writes the structured JSON logs of every command. Records
+// logged with a context carry the request ID, the authenticated username and
+// the trace and span IDs found in it, so a service logging with the request's
+// context needs no fields of its own to be tied to the request. Attributes
+// whose key names a secret are redacted wherever they are logged.
+package logging
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"strings"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// The keys of the attributes shared across packages. Other attributes use
+// snake_case keys naming what they hold, such as product_id.
+const (
+	KeyRequestID = "request_id"
+	KeyUsername  = "username"
+	KeyTraceID   = "trace_id"
+	KeySpanID    = "span_id"
+	KeyError     = "error"
+)
+
+// Redacted replaces the value of every attribute whose key names a secret.
+const Redacted = "[REDACTED]"
+
+// secretKeys are the substrings that mark an attribute key, compared without
+// case, as holding a secret: an Authorization header, a password, a JWT or
+// API key, or a query parameter such as access_token.
+var secretKeys = []string{"authorization", "password", "secret", "token", "api_key", "apikey", "cookie"}
+
+// New returns a logger writing JSON records of level and above to w.
+func New(w io.Writer, level slog.Level) *slog.Logger {
+	return slog.New(&contextHandler{slog.NewJSONHandler(w, &slog.HandlerOptions{
+		Level:       level,
+		ReplaceAttr: redact,
+	})})
+}
+
+// Err returns the attribute an error is logged under.
+func Err(err error) slog.Attr {
+	return slog.Any(KeyError, err)
+}
+
+func redact(_ []string, a slog.Attr) slog.Attr {
+	if a.Value.Kind() != slog.KindGroup && IsSecret(a.Key) {
+		return slog.String(a.Key, Redacted)
+	}
+	return a
+}
+
+// IsSecret reports whether an attribute, header or parameter named key holds
+// a secret that must not be logged.
+func IsSecret(key string) bool {
+	key = strings.ToLower(key)
+	for _, secret := range secretKeys {
+		if strings.Contains(key, secret) {
+			return true
+		}
+	}
+	return false
+}
+
+type requestIDKey struct{}
+
+type usernameKey struct{}
+
+// WithRequestID returns ctx carrying the ID of the request it serves.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestID returns the request ID in ctx, or "".
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// WithUsername returns ctx carrying the authenticated caller.
+func WithUsername(ctx context.Context, username string) context.Context {
+	return context.WithValue(ctx, usernameKey{}, username)
+}
+
+// Username returns the authenticated caller in ctx, or "".
+func Username(ctx context.Context) string {
+	username, _ := ctx.Value(usernameKey{}).(string)
+	return username
+}
+
+// contextHandler adds the request ID, username and trace IDs in the context
+// a record is logged with.
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h *contextHandler) Handle(ctx context.Context, r slog.Record) error {
+	if ctx != nil {
+		if id := RequestID(ctx); id != "" {
+			r.AddAttrs(slog.String(KeyRequestID, id))
+		}
+		if username := Username(ctx); username != "" {
+			r.AddAttrs(slog.String(KeyUsername, username))
+		}
+		if span := trace.SpanContextFromContext(ctx); span.IsValid() {
+			r.AddAttrs(slog.String(KeyTraceID, span.TraceID().String()), slog.String(KeySpanID, span.SpanID().String()))
+		}
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h *contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &contextHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h *contextHandler) WithGroup(name string) slog.Handler {
+	return &contextHandler{h.Handler.WithGroup(name)}
+}
@@ -0,0 +1,66 @@
+package metrics
+
+import (
+	"context"
+	"log/slog"
+	"time"
+	"warehouse-api/internal/logging"
+	"warehouse-api/internal/models"
+	"warehouse-api/internal/repositories"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// locationScrapeTimeout bounds the query a scrape runs, well inside
+// Prometheus's default scrape timeout of ten seconds.
+const locationScrapeTimeout = 5 * time.Second
+
+// locationCollector reports the capacity and current usage of every location,
+// read from the ledger when Prometheus scrapes rather than kept up to date on
+// every movement.
+type locationCollector struct {
+	store       repositories.Store
+	capacity    *prometheus.Desc
+	usage       *prometheus.Desc
+	utilisation *prometheus.Desc
+}
+
+func newLocationCollector(store repositories.Store) *locationCollector {
+	labels := []string{"location", "warehouse"}
+	return &locationCollector{
+		store: store,
+		capacity: prometheus.NewDesc(prometheus.BuildFQName(namespace, "location", "capacity_units"),
+			"Units the location can hold.", labels, nil),
+		usage: prometheus.NewDesc(prometheus.BuildFQName(namespace, "location", "usage_units"),
+			"Units the location holds.", labels, nil),
+		utilisation: prometheus.NewDesc(prometheus.BuildFQName(namespace, "location", "utilisation_ratio"),
+			"Units the location holds as a fraction of its capacity.", labels, nil),
+	}
+}
+
+func (c *locationCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.capacity
+	ch <- c.usage
+	ch <- c.utilisation
+}
+
+// Collect reports nothing for the locations it could not read. It logs the
+// error rather than failing the scrape, so the rest of the metrics are still
+// served while the database is down, when they matter most. A location
+// without capacity has no utilisation.
+func (c *locationCollector) Collect(ch chan<- prometheus.Metric) {
+	ctx, cancel := context.WithTimeout(context.Background(), locationScrapeTimeout)
+	defer cancel()
+
+	err := c.store.Locations().StreamAll(ctx, func(loc *models.LocationWithUsage) error {
+		ch <- prometheus.MustNewConstMetric(c.capacity, prometheus.GaugeValue, float64(loc.Capacity), loc.Code, loc.Warehouse)
+		ch <- prometheus.MustNewConstMetric(c.usage, prometheus.GaugeValue, float64(loc.CurrentUsage), loc.Code, loc.Warehouse)
+		if loc.Capacity > 0 {
+			ch <- prometheus.MustNewConstMetric(c.utilisation, prometheus.GaugeValue, float64(loc.CurrentUsage)/float64(loc.Capacity), loc.Code, loc.Warehouse)
+		}
+		return nil
+	})
+	if err != nil {
+		slog.Error("Failed to read locations for metrics", logging.Err(err))
+	}
+}
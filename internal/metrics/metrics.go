@@ -0,0 +1,77 @@
+// Package metrics defines the Prometheus metrics served on /metrics: request
+// latency, the database pool and transactions, and the stock ledger itself.
+// The counters are package variables that the middleware and services update
+// directly; NewRegistry gathers them with the collectors that read one app's
+// database on each scrape.
+package metrics
+
+import (
+	"database/sql"
+	"warehouse-api/internal/repositories"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+)
+
+const namespace = "warehouse"
+
+var (
+	// HTTPRequestDuration is labelled with the route template, such as
+	// /api/products/:id, so IDs do not multiply the series.
+	HTTPRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "http",
+		Name:      "request_duration_seconds",
+		Help:      "Time taken to answer HTTP requests, by method, route and status.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route", "status"})
+
+	// Transactions counts units of work by outcome, committed or
+	// rolled_back. A failed commit counts as rolled back.
+	Transactions = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "db",
+		Name:      "transactions_total",
+		Help:      "Units of work finished, by outcome.",
+	}, []string{"outcome"})
+
+	MovementsPosted = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "stock",
+		Name:      "movements_posted_total",
+		Help:      "Stock movements committed, by type and source.",
+	}, []string{"type", "source"})
+
+	// MovementsRejected is labelled with the error code of the rule that
+	// rejected the movement, such as insufficient_quantity.
+	MovementsRejected = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "stock",
+		Name:      "movements_rejected_total",
+		Help:      "Stock movements rejected by a stock rule, by reason.",
+	}, []string{"reason"})
+)
+
+// Outcomes of Transactions.
+const (
+	OutcomeCommitted  = "committed"
+	OutcomeRolledBack = "rolled_back"
+)
+
+// NewRegistry returns a registry holding the package's metrics, the Go
+// runtime and process metrics, the pool statistics of db and the utilisation
+// of every location in store.
+func NewRegistry(db *sql.DB, store repositories.Store) *prometheus.Registry {
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		collectors.NewDBStatsCollector(db, namespace),
+		newLocationCollector(store),
+		HTTPRequestDuration,
+		Transactions,
+		MovementsPosted,
+		MovementsRejected,
+	)
+	return registry
+}
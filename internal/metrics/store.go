@@ -0,0 +1,52 @@
+package metrics
+
+import (
+	"context"
+	"warehouse-api/internal/repositories"
+)
+
+// InstrumentStore returns store with every unit of work counted in
+// Transactions.
+func InstrumentStore(store repositories.Store) repositories.Store {
+	return instrumentedStore{Store: store}
+}
+
+type instrumentedStore struct {
+	repositories.Store
+}
+
+func (s instrumentedStore) Begin(ctx context.Context) (repositories.Tx, error) {
+	tx, err := s.Store.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &instrumentedTx{Tx: tx}, nil
+}
+
+// instrumentedTx counts the first Commit or Rollback only, since Rollback is
+// deferred after every Commit.
+type instrumentedTx struct {
+	repositories.Tx
+	done bool
+}
+
+func (t *instrumentedTx) Commit() error {
+	err := t.Tx.Commit()
+	if !t.done {
+		t.done = true
+		outcome := OutcomeCommitted
+		if err != nil {
+			outcome = OutcomeRolledBack
+		}
+		Transactions.WithLabelValues(outcome).Inc()
+	}
+	return err
+}
+
+func (t *instrumentedTx) Rollback() error {
+	if !t.done {
+		t.done = true
+		Transactions.WithLabelValues(OutcomeRolledBack).Inc()
+	}
+	return t.Tx.Rollback()
+}
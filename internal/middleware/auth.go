@@ -2,23 +2,39 @@ package middleware
 
 import (
 	"strings"
+	"warehouse-api/internal/apperrors"
+	"warehouse-api/internal/logging"
 	"warehouse-api/internal/utils"
 
 	"github.com/gin-gonic/gin"
 )
 
 func AuthMiddleware() gin.HandlerFunc {
+	return authMiddleware(false)
+}
+
+// StreamAuthMiddleware is AuthMiddleware that also accepts the token in the
+// access_token query parameter, because browsers cannot set headers on
+// EventSource and WebSocket connections.
+func StreamAuthMiddleware() gin.HandlerFunc {
+	return authMiddleware(true)
+}
+
+func authMiddleware(allowQueryToken bool) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		authHeader := c.GetHeader("Authorization")
+		if authHeader == "" && allowQueryToken && c.Query("access_token") != "" {
+			authHeader = "Bearer " + c.Query("access_token")
+		}
 		if authHeader == "" {
-			utils.UnauthorizedResponse(c, "Authorization header required")
+			utils.ErrorResponse(c, apperrors.New(apperrors.Unauthenticated, "missing_token", "Authorization header required"))
 			c.Abort()
 			return
 		}
 
 		parts := strings.Split(authHeader, " ")
 		if len(parts) != 2 || parts[0] != "Bearer" {
-			utils.UnauthorizedResponse(c, "Invalid authorization header format")
+			utils.ErrorResponse(c, apperrors.New(apperrors.Unauthenticated, "invalid_token", "Invalid authorization header format"))
 			c.Abort()
 			return
 		}
@@ -26,12 +42,13 @@ func AuthMiddleware() gin.HandlerFunc {
 		token := parts[1]
 		claims, err := utils.ValidateToken(token)
 		if err != nil {
-			utils.UnauthorizedResponse(c, "Invalid or expired token")
+			utils.ErrorResponse(c, apperrors.New(apperrors.Unauthenticated, "invalid_token", "Invalid or expired token"))
 			c.Abort()
 			return
 		}
 
 		c.Set("username", claims.Username)
+		c.Request = c.Request.WithContext(logging.WithUsername(c.Request.Context(), claims.Username))
 		c.Next()
 	}
 }
@@ -1,25 +1,149 @@
 package middleware
 
 import (
+	"crypto/rand"
+	"encoding/hex"
 	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"runtime/debug"
+	"strings"
 	"time"
+	"warehouse-api/internal/apperrors"
+	"warehouse-api/internal/logging"
+	"warehouse-api/internal/utils"
 
 	"github.com/gin-gonic/gin"
 )
 
-func LoggerMiddleware() gin.HandlerFunc {
-	return gin.LoggerWithFormatter(func(param gin.LogFormatterParams) string {
-		return fmt.Sprintf("%s - [%s] \"%s %s %s %d %s \"%s\" %s\"\n",
-			param.ClientIP,
-			param.TimeStamp.Format(time.RFC1123),
-			param.Method,
-			param.Path,
-			param.Request.Proto,
-			param.StatusCode,
-			param.Latency,
-			param.Request.UserAgent(),
-			param.ErrorMessage,
+// RequestIDHeader carries the ID of a request in and out.
+const RequestIDHeader = "X-Request-ID"
+
+// maxRequestIDLength bounds the request IDs accepted from clients, which end
+// up in every log record of the request.
+const maxRequestIDLength = 128
+
+// RequestID gives each request an ID: the client's X-Request-ID when it is a
+// plausible one, otherwise a random one. The ID is echoed in the response
+// header and attached to the request context, where every record logged
+// with it picks it up.
+func RequestID() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(RequestIDHeader)
+		if !validRequestID(id) {
+			id = newRequestID()
+		}
+		c.Header(RequestIDHeader, id)
+		c.Request = c.Request.WithContext(logging.WithRequestID(c.Request.Context(), id))
+		c.Next()
+	}
+}
+
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] <= ' ' || id[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+func newRequestID() string {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(id)
+}
+
+// Logger logs one record per request once it is answered: at error level for
+// a 5xx, warn for a 4xx and info otherwise, except that the quiet routes,
+// such as probes and scrapes, only log at debug. The route is the template
+// the request matched, and a request answered with an error carries its
+// class and code. At debug level the headers and query parameters are logged
+// too, with secrets such as the Authorization header redacted.
+func Logger(quiet map[string]bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		status := c.Writer.Status()
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+
+		level := slog.LevelInfo
+		switch {
+		case status >= http.StatusInternalServerError:
+			level = slog.LevelError
+		case status >= http.StatusBadRequest:
+			level = slog.LevelWarn
+		case quiet[route]:
+			level = slog.LevelDebug
+		}
+
+		ctx := c.Request.Context()
+		logger := slog.Default()
+		if !logger.Enabled(ctx, level) {
+			return
+		}
+
+		attrs := []slog.Attr{
+			slog.String("method", c.Request.Method),
+			slog.String("route", route),
+			slog.String("path", c.Request.URL.Path),
+			slog.Int("status", status),
+			slog.Float64("latency_ms", float64(time.Since(start).Microseconds())/1000),
+			slog.Int("bytes", c.Writer.Size()),
+			slog.String("client_ip", c.ClientIP()),
+			slog.String("user_agent", c.Request.UserAgent()),
+		}
+		if last := c.Errors.Last(); last != nil {
+			appErr, ok := last.Meta.(*apperrors.Error)
+			if !ok {
+				appErr = apperrors.As(last.Err)
+			}
+			attrs = append(attrs,
+				slog.String("error_class", appErr.Kind.String()),
+				slog.String("error_code", appErr.Code),
+				logging.Err(last.Err),
+			)
+		}
+		if logger.Enabled(ctx, slog.LevelDebug) {
+			attrs = append(attrs,
+				valuesGroup("headers", c.Request.Header),
+				valuesGroup("query", c.Request.URL.Query()),
+			)
+		}
+
+		logger.LogAttrs(ctx, level, "request", attrs...)
+	}
+}
+
+// valuesGroup logs headers or query parameters as a group, which the logger
+// redacts member by member.
+func valuesGroup(name string, values map[string][]string) slog.Attr {
+	attrs := make([]any, 0, len(values))
+	for key, v := range values {
+		attrs = append(attrs, slog.String(key, strings.Join(v, ", ")))
+	}
+	return slog.Group(name, attrs...)
+}
+
+// Recovery answers a request whose handler panicked with a 500, logging the
+// panic and its stack with the request's context.
+func Recovery() gin.HandlerFunc {
+	return gin.CustomRecoveryWithWriter(io.Discard, func(c *gin.Context, recovered any) {
+		slog.ErrorContext(c.Request.Context(), "handler panicked",
+			slog.String("panic", fmt.Sprint(recovered)),
+			slog.String("stack", string(debug.Stack())),
 		)
+		utils.ErrorResponse(c, fmt.Errorf("panic: %v", recovered))
+		c.Abort()
 	})
 }
-
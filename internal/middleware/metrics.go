@@ -0,0 +1,27 @@
+package middleware
+
+import (
+	"strconv"
+	"time"
+	"warehouse-api/internal/metrics"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Metrics records the latency of every request in
+// metrics.HTTPRequestDuration. Requests matching no route share the route
+// label "unmatched".
+func Metrics() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		metrics.HTTPRequestDuration.
+			WithLabelValues(c.Request.Method, route, strconv.Itoa(c.Writer.Status())).
+			Observe(time.Since(start).Seconds())
+	}
+}
@@ -0,0 +1,451 @@
+// Package migrate applies numbered schema migrations and records them, with
+// a checksum of each, in the schema_migrations table.
+//
+// Every run against Postgres holds an advisory lock, so replicas starting
+// together apply each migration once. A SQLite database belongs to a single
+// process and needs no lock. A migration runs in a transaction; its row is
+// marked dirty beforehand and cleaned in that transaction, so a row left
+// dirty means the migration failed and the database needs a look before
+// anything else runs against it.
+package migrate
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// LockID is the advisory lock key shared by every process migrating this
+// database. Holding it keeps migrations from running.
+const LockID int64 = 0x77682d6d6967
+
+// ErrDirty is returned when the recorded schema cannot be trusted: a
+// migration failed part-way, an applied migration was edited afterwards, or
+// the database is ahead of this binary.
+var ErrDirty = errors.New("schema is dirty")
+
+// ErrPending is returned by Verify when migrations have not been applied.
+var ErrPending = errors.New("schema has pending migrations")
+
+type Migration struct {
+	Version  int
+	Name     string
+	Up       string
+	Down     string
+	Checksum string // SHA-256 of Up
+}
+
+// Applied is a row of schema_migrations.
+type Applied struct {
+	Version   int
+	Name      string
+	Checksum  string
+	Dirty     bool
+	AppliedAt time.Time
+}
+
+// Status pairs a known migration with its row, if any. Migration is nil for
+// a version the database has but this binary does not.
+type Status struct {
+	Migration *Migration
+	Applied   *Applied
+}
+
+// State is pending, applied, dirty, modified (applied, but the file has
+// changed since) or unknown.
+func (s *Status) State() string {
+	switch {
+	case s.Migration == nil:
+		return "unknown"
+	case s.Applied == nil:
+		return "pending"
+	case s.Applied.Dirty:
+		return "dirty"
+	case s.Applied.Checksum != s.Migration.Checksum:
+		return "modified"
+	default:
+		return "applied"
+	}
+}
+
+// Dirty reports whether the state stops migrations and startup: dirty,
+// modified or unknown.
+func (s *Status) Dirty() bool {
+	state := s.State()
+	return state == "dirty" || state == "modified" || state == "unknown"
+}
+
+var fileName = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+// Load reads the NNNN_name.up.sql and NNNN_name.down.sql pairs at the root of
+// fsys, ordered by version.
+func Load(fsys fs.FS) ([]*Migration, error) {
+	files, err := fs.Glob(fsys, "*.sql")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := map[int]*Migration{}
+	for _, file := range files {
+		match := fileName.FindStringSubmatch(file)
+		if match == nil {
+			return nil, fmt.Errorf("migration %s: expected NNNN_name.up.sql or NNNN_name.down.sql", file)
+		}
+		version, _ := strconv.Atoi(match[1])
+		content, err := fs.ReadFile(fsys, file)
+		if err != nil {
+			return nil, err
+		}
+
+		m := byVersion[version]
+		if m == nil {
+			m = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = m
+		}
+		if m.Name != match[2] {
+			return nil, fmt.Errorf("migration %d has two names, %s and %s", version, m.Name, match[2])
+		}
+		if match[3] == "up" {
+			m.Up = string(content)
+		} else {
+			m.Down = string(content)
+		}
+	}
+
+	migrations := make([]*Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Version < 1 || m.Up == "" || m.Down == "" {
+			return nil, fmt.Errorf("migration %04d_%s needs a version from 1 and both up and down files", m.Version, m.Name)
+		}
+		sum := sha256.Sum256([]byte(m.Up))
+		m.Checksum = hex.EncodeToString(sum[:])
+		migrations = append(migrations, m)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+type Migrator struct {
+	db         *sql.DB
+	driver     string
+	migrations []*Migration
+}
+
+// New loads the migrations in fsys for db, opened with the named
+// database/sql driver: "postgres" or "sqlite".
+func New(db *sql.DB, driver string, fsys fs.FS) (*Migrator, error) {
+	migrations, err := Load(fsys)
+	if err != nil {
+		return nil, err
+	}
+	return &Migrator{db: db, driver: driver, migrations: migrations}, nil
+}
+
+// Up applies every pending migration in order and returns how many ran. It
+// refuses to run on a dirty schema.
+func (m *Migrator) Up() (int, error) {
+	count := 0
+	err := m.locked(func(conn *sql.Conn) error {
+		statuses, err := m.status(context.Background(), conn)
+		if err != nil {
+			return err
+		}
+		if err := checkClean(statuses); err != nil {
+			return err
+		}
+
+		for _, s := range statuses {
+			if s.Applied != nil {
+				continue
+			}
+			if err := apply(conn, s.Migration); err != nil {
+				return err
+			}
+			slog.Info("Applied migration", slog.Int("version", s.Migration.Version), slog.String("name", s.Migration.Name))
+			count++
+		}
+		return nil
+	})
+	return count, err
+}
+
+// Down reverts the latest steps applied migrations, newest first, and
+// returns how many were reverted.
+func (m *Migrator) Down(steps int) (int, error) {
+	count := 0
+	err := m.locked(func(conn *sql.Conn) error {
+		statuses, err := m.status(context.Background(), conn)
+		if err != nil {
+			return err
+		}
+		if err := checkClean(statuses); err != nil {
+			return err
+		}
+
+		for i := len(statuses) - 1; i >= 0 && count < steps; i-- {
+			s := statuses[i]
+			if s.Applied == nil {
+				continue
+			}
+			if err := revert(conn, s.Migration); err != nil {
+				return err
+			}
+			slog.Info("Reverted migration", slog.Int("version", s.Migration.Version), slog.String("name", s.Migration.Name))
+			count++
+		}
+		return nil
+	})
+	return count, err
+}
+
+// Status lists every known migration, and any unknown applied version, in
+// version order.
+func (m *Migrator) Status() ([]*Status, error) {
+	var statuses []*Status
+	err := m.locked(func(conn *sql.Conn) error {
+		var err error
+		statuses, err = m.status(context.Background(), conn)
+		return err
+	})
+	return statuses, err
+}
+
+// Verify returns ErrDirty or ErrPending unless every migration is applied
+// cleanly. It is for processes that must not migrate themselves.
+func (m *Migrator) Verify() error {
+	statuses, err := m.Status()
+	if err != nil {
+		return err
+	}
+	return checkCurrent(statuses)
+}
+
+// Check is Verify without the migration lock, cheap enough for a readiness
+// probe. While another process migrates, the schema reads as pending or
+// dirty.
+func (m *Migrator) Check(ctx context.Context) error {
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	statuses, err := m.status(ctx, conn)
+	if err != nil {
+		return err
+	}
+	return checkCurrent(statuses)
+}
+
+// Force records version as the current schema without running anything:
+// migrations up to it are marked applied and clean with their current
+// checksums, and later ones are forgotten. It is the way out of a dirty
+// schema once the database has been repaired by hand; version 0 forgets
+// every migration.
+func (m *Migrator) Force(version int) error {
+	if version != 0 && m.find(version) == nil {
+		return fmt.Errorf("unknown migration version %d", version)
+	}
+
+	return m.locked(func(conn *sql.Conn) error {
+		return inTx(conn, func(tx *sql.Tx) error {
+			if _, err := tx.Exec(`DELETE FROM schema_migrations WHERE version > $1`, version); err != nil {
+				return err
+			}
+			for _, mig := range m.migrations {
+				if mig.Version > version {
+					break
+				}
+				_, err := tx.Exec(`
+					INSERT INTO schema_migrations (version, name, checksum, dirty)
+					VALUES ($1, $2, $3, FALSE)
+					ON CONFLICT (version) DO UPDATE SET name = $2, checksum = $3, dirty = FALSE
+				`, mig.Version, mig.Name, mig.Checksum)
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	})
+}
+
+func (m *Migrator) find(version int) *Migration {
+	for _, mig := range m.migrations {
+		if mig.Version == version {
+			return mig
+		}
+	}
+	return nil
+}
+
+// locked runs fn on a single connection holding the advisory lock, after
+// making sure schema_migrations exists. Other processes wait for the lock.
+// On Postgres the connection runs without the statement_timeout the DSN
+// sets, which would cancel the wait for the lock or a long migration and so
+// stop the server starting; it is reset before the pool reuses it.
+func (m *Migrator) locked(fn func(conn *sql.Conn) error) error {
+	ctx := context.Background()
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if m.driver != "sqlite" {
+		if _, err := conn.ExecContext(ctx, `SET statement_timeout = 0`); err != nil {
+			return fmt.Errorf("lift statement timeout: %w", err)
+		}
+		defer conn.ExecContext(ctx, `RESET statement_timeout`)
+		if _, err := conn.ExecContext(ctx, `SELECT pg_advisory_lock($1)`, LockID); err != nil {
+			return fmt.Errorf("acquire migration lock: %w", err)
+		}
+		defer conn.ExecContext(ctx, `SELECT pg_advisory_unlock($1)`, LockID)
+	}
+
+	_, err = conn.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version INTEGER PRIMARY KEY,
+			name VARCHAR(255) NOT NULL,
+			checksum CHAR(64) NOT NULL,
+			dirty BOOLEAN NOT NULL DEFAULT FALSE,
+			applied_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+		)
+	`)
+	if err != nil {
+		return err
+	}
+
+	return fn(conn)
+}
+
+func (m *Migrator) status(ctx context.Context, conn *sql.Conn) ([]*Status, error) {
+	rows, err := conn.QueryContext(ctx,
+		`SELECT version, name, checksum, dirty, applied_at FROM schema_migrations ORDER BY version`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := map[int]*Applied{}
+	for rows.Next() {
+		a := &Applied{}
+		if err := rows.Scan(&a.Version, &a.Name, &a.Checksum, &a.Dirty, &a.AppliedAt); err != nil {
+			return nil, err
+		}
+		applied[a.Version] = a
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	statuses := make([]*Status, 0, len(m.migrations))
+	for _, mig := range m.migrations {
+		statuses = append(statuses, &Status{Migration: mig, Applied: applied[mig.Version]})
+		delete(applied, mig.Version)
+	}
+	for _, a := range applied {
+		statuses = append(statuses, &Status{Applied: a})
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].version() < statuses[j].version() })
+	return statuses, nil
+}
+
+func (s *Status) version() int {
+	if s.Migration != nil {
+		return s.Migration.Version
+	}
+	return s.Applied.Version
+}
+
+// checkClean returns ErrDirty, with the first offending migration, when any
+// status is dirty, modified or unknown.
+func checkClean(statuses []*Status) error {
+	for _, s := range statuses {
+		switch s.State() {
+		case "dirty":
+			return fmt.Errorf("%w: migration %04d_%s failed; repair the database, then run `migrate force VERSION` with the last version that is fully applied",
+				ErrDirty, s.Applied.Version, s.Applied.Name)
+		case "modified":
+			return fmt.Errorf("%w: migration %04d_%s was changed after it was applied; add a new migration instead",
+				ErrDirty, s.Migration.Version, s.Migration.Name)
+		case "unknown":
+			return fmt.Errorf("%w: the database has migration %04d_%s, which this binary does not know; deploy a newer binary",
+				ErrDirty, s.Applied.Version, s.Applied.Name)
+		}
+	}
+	return nil
+}
+
+// checkCurrent returns ErrDirty as checkClean does, or ErrPending when a
+// migration is not applied.
+func checkCurrent(statuses []*Status) error {
+	if err := checkClean(statuses); err != nil {
+		return err
+	}
+	for _, s := range statuses {
+		if s.Applied == nil {
+			return fmt.Errorf("%w: %04d_%s is not applied; run `migrate up`", ErrPending, s.Migration.Version, s.Migration.Name)
+		}
+	}
+	return nil
+}
+
+// apply marks mig dirty, then runs it and cleans the mark in one transaction.
+// If it fails the mark stays.
+func apply(conn *sql.Conn, mig *Migration) error {
+	ctx := context.Background()
+	_, err := conn.ExecContext(ctx,
+		`INSERT INTO schema_migrations (version, name, checksum, dirty) VALUES ($1, $2, $3, TRUE)`,
+		mig.Version, mig.Name, mig.Checksum)
+	if err != nil {
+		return err
+	}
+
+	return inTx(conn, func(tx *sql.Tx) error {
+		if _, err := tx.Exec(mig.Up); err != nil {
+			return fmt.Errorf("migration %04d_%s: %w", mig.Version, mig.Name, err)
+		}
+		_, err := tx.Exec(`UPDATE schema_migrations SET dirty = FALSE, applied_at = CURRENT_TIMESTAMP WHERE version = $1`, mig.Version)
+		return err
+	})
+}
+
+// revert marks mig dirty, then runs its down migration and forgets it in one
+// transaction. If it fails the mark stays.
+func revert(conn *sql.Conn, mig *Migration) error {
+	ctx := context.Background()
+	if _, err := conn.ExecContext(ctx, `UPDATE schema_migrations SET dirty = TRUE WHERE version = $1`, mig.Version); err != nil {
+		return err
+	}
+
+	return inTx(conn, func(tx *sql.Tx) error {
+		if _, err := tx.Exec(mig.Down); err != nil {
+			return fmt.Errorf("revert migration %04d_%s: %w", mig.Version, mig.Name, err)
+		}
+		_, err := tx.Exec(`DELETE FROM schema_migrations WHERE version = $1`, mig.Version)
+		return err
+	})
+}
+
+func inTx(conn *sql.Conn, fn func(tx *sql.Tx) error) error {
+	tx, err := conn.BeginTx(context.Background(), nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,61 @@
+package models
+
+import "time"
+
+// Event types published for inventory changes.
+const (
+	EventMovementCreated = "movement.created"
+	EventProductCreated  = "product.created"
+	EventProductUpdated  = "product.updated"
+	EventLocationCreated = "location.created"
+	EventStockLow        = "stock.low"
+	EventLocationFull    = "location.full"
+)
+
+// EventTypes lists every event type a subscriber can ask for.
+var EventTypes = []string{
+	EventMovementCreated,
+	EventProductCreated,
+	EventProductUpdated,
+	EventLocationCreated,
+	EventStockLow,
+	EventLocationFull,
+}
+
+// Aggregates an event can belong to. Events of one aggregate are published in
+// the order they were recorded.
+const (
+	AggregateProduct  = "product"
+	AggregateLocation = "location"
+)
+
+// Event is the envelope every published event is sent in.
+type Event struct {
+	ID         string      `json:"id"`
+	Type       string      `json:"type"`
+	OccurredAt time.Time   `json:"occurred_at"`
+	Data       interface{} `json:"data"`
+
+	AggregateType string `json:"-"`
+	AggregateID   int    `json:"-"`
+}
+
+// StockLowEvent is the data of a stock.low event, raised when an OUT movement
+// takes a product from above its reorder level to at or below it.
+type StockLowEvent struct {
+	ProductID    int    `json:"product_id"`
+	SKUName      string `json:"sku_name"`
+	Quantity     int    `json:"quantity"`
+	ReorderLevel int    `json:"reorder_level"`
+	MovementID   int    `json:"movement_id"`
+}
+
+// LocationFullEvent is the data of a location.full event, raised when an IN
+// movement uses up the last of a location's capacity.
+type LocationFullEvent struct {
+	LocationID   int    `json:"location_id"`
+	Code         string `json:"code"`
+	Capacity     int    `json:"capacity"`
+	CurrentUsage int    `json:"current_usage"`
+	MovementID   int    `json:"movement_id"`
+}
@@ -0,0 +1,15 @@
+package models
+
+// Health statuses reported by the probes.
+const (
+	HealthOK           = "ok"
+	HealthUnavailable  = "unavailable"
+	HealthShuttingDown = "shutting_down"
+)
+
+// HealthReport is the answer to a liveness or readiness probe. Checks maps
+// each readiness check to "ok" or the reason it failed.
+type HealthReport struct {
+	Status string            `json:"status"`
+	Checks map[string]string `json:"checks,omitempty"`
+}
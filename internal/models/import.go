@@ -0,0 +1,28 @@
+package models
+
+// Import kinds accepted by the import endpoints and command.
+const (
+	ImportProducts        = "products"
+	ImportLocations       = "locations"
+	ImportOpeningBalances = "opening-balances"
+)
+
+// ImportRowError describes why one row of an import file was rejected. Row
+// counts the header as row 1; Field is empty for errors about the whole row.
+type ImportRowError struct {
+	Row     int    `json:"row"`
+	Field   string `json:"field,omitempty"`
+	Message string `json:"message"`
+}
+
+// ImportReport summarises an import. Nothing is written unless every row is
+// valid and the import is not a dry run, in which case Imported equals
+// ValidRows.
+type ImportReport struct {
+	Kind      string            `json:"kind"`
+	DryRun    bool              `json:"dry_run"`
+	TotalRows int               `json:"total_rows"`
+	ValidRows int               `json:"valid_rows"`
+	Imported  int               `json:"imported"`
+	Errors    []*ImportRowError `json:"errors"`
+}
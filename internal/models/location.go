@@ -6,6 +6,7 @@ type Location struct {
 	ID        int       `json:"id"`
 	Code      string    `json:"code"`
 	Name      string    `json:"name"`
+	Warehouse string    `json:"warehouse"`
 	Capacity  int       `json:"capacity"`
 	CreatedAt time.Time `json:"created_at"`
 }
@@ -17,7 +18,19 @@ type LocationWithUsage struct {
 }
 
 type CreateLocationRequest struct {
-	Code     string `json:"code" binding:"required"`
-	Name     string `json:"name" binding:"required"`
-	Capacity int    `json:"capacity" binding:"required,gt=0"`
+	Code      string `json:"code" binding:"required"`
+	Name      string `json:"name" binding:"required"`
+	Warehouse string `json:"warehouse" binding:"max=50"`
+	Capacity  int    `json:"capacity" binding:"required,gt=0"`
+}
+
+// LocationFilter narrows the location list. Search matches part of the code
+// or name; the capacity bounds are inclusive.
+type LocationFilter struct {
+	IDs         []int
+	Search      string
+	Warehouse   string
+	MinCapacity *int
+	MaxCapacity *int
+	PageRequest
 }
@@ -0,0 +1,21 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// OutboxEvent is an event recorded in the transaction that raised it, waiting
+// for the relay to publish it. Position orders events by commit and is set by
+// the relay once the event has committed; readers page by it.
+type OutboxEvent struct {
+	ID            int64           `json:"id"`
+	Position      *int64          `json:"position"`
+	EventID       string          `json:"event_id"`
+	EventType     string          `json:"event_type"`
+	AggregateType string          `json:"aggregate_type"`
+	AggregateID   int             `json:"aggregate_id"`
+	Payload       json.RawMessage `json:"payload"`
+	CreatedAt     time.Time       `json:"created_at"`
+	PublishedAt   *time.Time      `json:"published_at"`
+}
@@ -0,0 +1,26 @@
+package models
+
+// Page sizes for list endpoints. A larger requested limit is capped at
+// MaxPageLimit.
+const (
+	DefaultPageLimit = 10
+	MaxPageLimit     = 100
+)
+
+// PageRequest selects one page of a keyset-paginated list. Cursor is the
+// next_cursor of the previous page and Sort names a whitelisted field,
+// prefixed with "-" for descending order.
+type PageRequest struct {
+	Cursor string
+	Sort   string
+	Limit  int
+}
+
+// CursorPagination describes the page that was returned. NextCursor is empty
+// on the last page.
+type CursorPagination struct {
+	Limit      int    `json:"limit"`
+	Sort       string `json:"sort"`
+	NextCursor string `json:"next_cursor,omitempty"`
+	HasMore    bool   `json:"has_more"`
+}
@@ -2,21 +2,44 @@ package models
 
 import "time"
 
+// Costing methods supported for inventory valuation.
+const (
+	CostingFIFO = "FIFO"
+	CostingAVG  = "AVG"
+)
+
 type Product struct {
-	ID        int       `json:"id"`
-	SKUName   string    `json:"sku_name"`
-	Quantity  int       `json:"quantity"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
+	ID            int       `json:"id"`
+	SKUName       string    `json:"sku_name"`
+	Quantity      int       `json:"quantity"`
+	CostingMethod string    `json:"costing_method"`
+	AverageCost   float64   `json:"average_cost"`
+	ReorderLevel  int       `json:"reorder_level"` // stock.low fires when quantity falls to this level
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
 }
 
 type CreateProductRequest struct {
-	SKUName  string `json:"sku_name" binding:"required"`
-	Quantity int    `json:"quantity" binding:"gte=0"`
+	SKUName       string `json:"sku_name" binding:"required"`
+	Quantity      int    `json:"quantity" binding:"gte=0"`
+	CostingMethod string `json:"costing_method" binding:"omitempty,oneof=FIFO AVG"`
+	ReorderLevel  int    `json:"reorder_level" binding:"gte=0"`
 }
 
 type UpdateProductRequest struct {
-	SKUName  string `json:"sku_name" binding:"required"`
-	Quantity int    `json:"quantity" binding:"gte=0"`
+	SKUName       string `json:"sku_name" binding:"required"`
+	Quantity      int    `json:"quantity" binding:"gte=0"`
+	CostingMethod string `json:"costing_method" binding:"omitempty,oneof=FIFO AVG"`
+	ReorderLevel  *int   `json:"reorder_level" binding:"omitempty,gte=0"`
 }
 
+// ProductFilter narrows the product list. Search matches part of the SKU
+// name; the quantity bounds are inclusive.
+type ProductFilter struct {
+	IDs           []int
+	Search        string
+	CostingMethod string
+	MinQuantity   *int
+	MaxQuantity   *int
+	PageRequest
+}
@@ -0,0 +1,45 @@
+package models
+
+import "time"
+
+// Discrepancy kinds reported by reconciliation.
+const (
+	// DiscrepancyProductQuantity: products.quantity differs from the sum of
+	// the product's movements.
+	DiscrepancyProductQuantity = "product_quantity"
+	// DiscrepancyLocationBalance: more of a product has left a location than
+	// ever entered it. Location usage clamps the negative balance to zero,
+	// so the location reports less stock than the ledger implies.
+	DiscrepancyLocationBalance = "location_balance"
+	// DiscrepancyLocationCapacity: the ledger puts more stock in a location
+	// than its capacity allows. This cannot be repaired by adjustments.
+	DiscrepancyLocationCapacity = "location_capacity"
+)
+
+// Discrepancy compares a stored or reported figure with the one implied by
+// the ledger. Difference is Stored minus Ledger.
+type Discrepancy struct {
+	Kind         string `json:"kind"`
+	ProductID    *int   `json:"product_id,omitempty"`
+	SKUName      string `json:"sku_name,omitempty"`
+	LocationID   *int   `json:"location_id,omitempty"`
+	LocationCode string `json:"location_code,omitempty"`
+	Stored       int    `json:"stored"`
+	Ledger       int    `json:"ledger"`
+	Difference   int    `json:"difference"`
+	Repaired     bool   `json:"repaired"`
+}
+
+type ReconcileRequest struct {
+	Repair bool `json:"repair"`
+	// LocationID receives IN adjustments for products that have no
+	// location holding stock in the ledger.
+	LocationID *int `json:"location_id"`
+}
+
+type ReconciliationReport struct {
+	CheckedAt     time.Time        `json:"checked_at"`
+	Repair        bool             `json:"repair"`
+	Discrepancies []*Discrepancy   `json:"discrepancies"`
+	Adjustments   []*StockMovement `json:"adjustments"`
+}
@@ -0,0 +1,66 @@
+package models
+
+import "time"
+
+// StockSnapshot records the ledger balance of every product at every location
+// at TakenAt, so point-in-time queries only replay movements made after it.
+type StockSnapshot struct {
+	ID        int       `json:"id"`
+	TakenAt   time.Time `json:"taken_at"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type CreateSnapshotRequest struct {
+	TakenAt *time.Time `json:"taken_at"`
+}
+
+// StockBalanceLine is the ledger balance of one product at one location.
+type StockBalanceLine struct {
+	ProductID    int
+	SKUName      string
+	LocationID   int
+	LocationCode string
+	LocationName string
+	Quantity     int
+}
+
+type LocationQuantity struct {
+	LocationID   int    `json:"location_id"`
+	LocationCode string `json:"location_code"`
+	LocationName string `json:"location_name"`
+	Quantity     int    `json:"quantity"`
+}
+
+type ProductBalance struct {
+	ProductID int                 `json:"product_id"`
+	SKUName   string              `json:"sku_name"`
+	Quantity  int                 `json:"quantity"`
+	Locations []*LocationQuantity `json:"locations"`
+}
+
+type StockBalanceReport struct {
+	AsOf       time.Time           `json:"as_of"`
+	SnapshotID *int                `json:"snapshot_id"`
+	Products   []*ProductBalance   `json:"products"`
+	Locations  []*LocationQuantity `json:"locations"`
+}
+
+type StockCardEntry struct {
+	MovementID int       `json:"movement_id"`
+	LocationID int       `json:"location_id"`
+	Type       string    `json:"type"`
+	Quantity   int       `json:"quantity"`
+	Balance    int       `json:"balance"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+type StockCard struct {
+	ProductID      int               `json:"product_id"`
+	SKUName        string            `json:"sku_name"`
+	LocationID     *int              `json:"location_id"`
+	StartDate      *time.Time        `json:"start_date"`
+	EndDate        *time.Time        `json:"end_date"`
+	OpeningBalance int               `json:"opening_balance"`
+	ClosingBalance int               `json:"closing_balance"`
+	Entries        []*StockCardEntry `json:"entries"`
+}
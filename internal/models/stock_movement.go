@@ -2,29 +2,96 @@ package models
 
 import "time"
 
+// Movement sources record why a movement was posted.
+const (
+	MovementSourceManual     = "MANUAL"
+	MovementSourceAdjustment = "ADJUSTMENT"
+	MovementSourceReversal   = "REVERSAL"
+	MovementSourceImport     = "IMPORT"
+)
+
 type StockMovement struct {
-	ID         int       `json:"id"`
-	ProductID  int       `json:"product_id"`
-	LocationID int       `json:"location_id"`
-	Type       string    `json:"type"` // IN or OUT
-	Quantity   int       `json:"quantity"`
-	CreatedAt  time.Time `json:"created_at"`
+	ID          int       `json:"id"`
+	ProductID   int       `json:"product_id"`
+	LocationID  int       `json:"location_id"`
+	Type        string    `json:"type"` // IN or OUT
+	Quantity    int       `json:"quantity"`
+	UnitCost    float64   `json:"unit_cost"`    // purchase cost for IN, COGS per unit for OUT
+	TotalCost   float64   `json:"total_cost"`   // value received for IN, COGS for OUT
+	AverageCost float64   `json:"average_cost"` // product moving-average cost after the movement
+	Source      string    `json:"source"`
+	Reference   string    `json:"reference"`
+	Note        string    `json:"note"`
+	CreatedBy   string    `json:"created_by"`
+	CreatedAt   time.Time `json:"created_at"`
+
+	// ReversalOf links a compensating movement to the movement it reverses;
+	// the Reversed* fields are set on the reversed movement.
+	ReversalOf     *int       `json:"reversal_of,omitempty"`
+	ReversedAt     *time.Time `json:"reversed_at,omitempty"`
+	ReversedBy     string     `json:"reversed_by,omitempty"`
+	ReversalReason string     `json:"reversal_reason,omitempty"`
 }
 
 type CreateStockMovementRequest struct {
-	ProductID  int    `json:"product_id" binding:"required"`
-	LocationID int    `json:"location_id" binding:"required"`
-	Type       string `json:"type" binding:"required,oneof=IN OUT"`
-	Quantity   int    `json:"quantity" binding:"required,gt=0"`
+	ProductID  int      `json:"product_id" binding:"required"`
+	LocationID int      `json:"location_id" binding:"required"`
+	Type       string   `json:"type" binding:"required,oneof=IN OUT"`
+	Quantity   int      `json:"quantity" binding:"required,gt=0"`
+	UnitCost   *float64 `json:"unit_cost" binding:"omitempty,gte=0"`
+	Reference  string   `json:"reference" binding:"max=100"`
+	Note       string   `json:"note"`
 }
 
-type StockMovementFilter struct {
-	ProductID  *int    `form:"product_id"`
-	LocationID *int    `form:"location_id"`
-	Type       *string `form:"type"`
-	StartDate  *string `form:"start_date"`
-	EndDate    *string `form:"end_date"`
-	Page       int     `form:"page,default=1"`
-	Limit      int     `form:"limit,default=10"`
+type ReverseStockMovementRequest struct {
+	Reason string `json:"reason" binding:"required"`
+}
+
+type StockMovementReversal struct {
+	Original *StockMovement `json:"original"`
+	Reversal *StockMovement `json:"reversal"`
+}
+
+// Batch posting modes.
+const (
+	// BatchModeAtomic posts every line or none of them.
+	BatchModeAtomic = "atomic"
+	// BatchModeBestEffort posts the lines that pass validation and reports
+	// the rest.
+	BatchModeBestEffort = "best_effort"
+)
+
+type BatchStockMovementRequest struct {
+	Mode      string                        `json:"mode" binding:"omitempty,oneof=atomic best_effort"`
+	Movements []*CreateStockMovementRequest `json:"movements" binding:"required,min=1,max=1000"`
+}
+
+type BatchLineResult struct {
+	Index    int            `json:"index"`
+	Success  bool           `json:"success"`
+	Movement *StockMovement `json:"movement,omitempty"`
+	Error    string         `json:"error,omitempty"`
 }
 
+type BatchStockMovementResult struct {
+	Mode      string             `json:"mode"`
+	Succeeded int                `json:"succeeded"`
+	Failed    int                `json:"failed"`
+	Results   []*BatchLineResult `json:"results"`
+}
+
+// StockMovementFilter narrows movement lists and exports. Empty fields do not
+// filter; ProductIDs and LocationIDs match any of the listed IDs.
+type StockMovementFilter struct {
+	ProductIDs  []int
+	LocationIDs []int
+	Type        *string
+	Source      string
+	CreatedBy   string
+	Reference   string
+	MinQuantity *int
+	MaxQuantity *int
+	StartDate   *string
+	EndDate     *string
+	PageRequest
+}
@@ -0,0 +1,39 @@
+package models
+
+// Real-time stream message types.
+const (
+	StreamMovement      = "movement"
+	StreamBalance       = "balance"
+	StreamLocationUsage = "location_usage"
+	StreamProduct       = "product"
+)
+
+// StreamMessage is one update pushed to stream subscribers. Data is a
+// StockMovement, StreamBalanceData, LocationWithUsage or Product depending on
+// Type.
+type StreamMessage struct {
+	Type string      `json:"type"`
+	Data interface{} `json:"data"`
+}
+
+// StreamBalanceData is the balance of a product after a movement, at the
+// movement's location and in total.
+type StreamBalanceData struct {
+	ProductID       int    `json:"product_id"`
+	SKUName         string `json:"sku_name"`
+	LocationID      int    `json:"location_id"`
+	LocationCode    string `json:"location_code"`
+	Warehouse       string `json:"warehouse"`
+	Quantity        int    `json:"quantity"`
+	ProductQuantity int    `json:"product_quantity"`
+}
+
+// StreamFilter limits a subscription to movements of one product, at one
+// location or within one warehouse. Unset fields match everything. Products
+// belong to no location, so their updates only reach subscriptions without a
+// location or warehouse; new locations only reach those without a product.
+type StreamFilter struct {
+	ProductID  *int
+	LocationID *int
+	Warehouse  string
+}
@@ -0,0 +1,67 @@
+package models
+
+import "time"
+
+// CostLayer is a quantity received by an IN movement at a given unit cost.
+// OUT movements draw down RemainingQuantity oldest layer first.
+type CostLayer struct {
+	ID                int       `json:"id"`
+	ProductID         int       `json:"product_id"`
+	LocationID        int       `json:"location_id"`
+	MovementID        int       `json:"movement_id"`
+	UnitCost          float64   `json:"unit_cost"`
+	Quantity          int       `json:"quantity"`
+	RemainingQuantity int       `json:"remaining_quantity"`
+	CreatedAt         time.Time `json:"created_at"`
+}
+
+// ValuationLine is the valued stock of one product at one location.
+type ValuationLine struct {
+	ProductID     int
+	SKUName       string
+	CostingMethod string
+	LocationID    int
+	LocationCode  string
+	LocationName  string
+	Quantity      int
+	LayerValue    float64
+	AverageCost   float64
+}
+
+// UnlayeredStock is the stock of a product that no cost layer accounts for,
+// such as the quantity it was created with or stock received before costing
+// was introduced.
+type UnlayeredStock struct {
+	ProductID     int
+	SKUName       string
+	CostingMethod string
+	Quantity      int
+	AverageCost   float64
+}
+
+type LocationValuation struct {
+	LocationID   int     `json:"location_id"`
+	LocationCode string  `json:"location_code"`
+	LocationName string  `json:"location_name"`
+	Quantity     int     `json:"quantity"`
+	Value        float64 `json:"value"`
+}
+
+// ProductValuation is the valued stock of one product. UnlayeredQuantity is
+// the part of Quantity that has no cost layer, and so no location; it is
+// valued at the average cost.
+type ProductValuation struct {
+	ProductID         int                  `json:"product_id"`
+	SKUName           string               `json:"sku_name"`
+	CostingMethod     string               `json:"costing_method"`
+	Quantity          int                  `json:"quantity"`
+	Value             float64              `json:"value"`
+	UnlayeredQuantity int                  `json:"unlayered_quantity"`
+	Locations         []*LocationValuation `json:"locations"`
+}
+
+type ValuationReport struct {
+	AsOf       time.Time           `json:"as_of"`
+	TotalValue float64             `json:"total_value"`
+	Products   []*ProductValuation `json:"products"`
+}
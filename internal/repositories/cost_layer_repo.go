@@ -0,0 +1,215 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"time"
+	"warehouse-api/internal/models"
+)
+
+type CostLayerRepository struct {
+	db DBTX
+}
+
+func NewCostLayerRepository(db *sql.DB) *CostLayerRepository {
+	return &CostLayerRepository{db: db}
+}
+
+func (r *CostLayerRepository) Create(ctx context.Context, layer *models.CostLayer) error {
+	query := `
+		INSERT INTO cost_layers (product_id, location_id, movement_id, unit_cost, quantity, remaining_quantity, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING id
+	`
+	return r.db.QueryRowContext(ctx, query,
+		layer.ProductID, layer.LocationID, layer.MovementID,
+		layer.UnitCost, layer.Quantity, layer.RemainingQuantity, layer.CreatedAt,
+	).Scan(&layer.ID)
+}
+
+// GetOpen returns the layers of a product that still hold stock, at every
+// location, oldest first: the order OUT movements consume those at their
+// own location.
+func (r *CostLayerRepository) GetOpen(ctx context.Context, productID int) ([]*models.CostLayer, error) {
+	query := `
+		SELECT id, product_id, location_id, movement_id, unit_cost, quantity, remaining_quantity, created_at
+		FROM cost_layers
+		WHERE product_id = $1 AND remaining_quantity > 0
+		ORDER BY created_at, id
+	`
+	rows, err := r.db.QueryContext(ctx, query, productID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var layers []*models.CostLayer
+	for rows.Next() {
+		layer := &models.CostLayer{}
+		err := rows.Scan(
+			&layer.ID, &layer.ProductID, &layer.LocationID, &layer.MovementID,
+			&layer.UnitCost, &layer.Quantity, &layer.RemainingQuantity, &layer.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		layers = append(layers, layer)
+	}
+
+	return layers, rows.Err()
+}
+
+// Consume draws quantity from a layer on behalf of an OUT movement and keeps
+// a consumption record so the layer can be reconstructed at any point in time.
+func (r *CostLayerRepository) Consume(ctx context.Context, layerID, movementID, quantity int, at time.Time) error {
+	_, err := r.db.ExecContext(ctx,
+		`UPDATE cost_layers SET remaining_quantity = remaining_quantity - $1 WHERE id = $2`,
+		quantity, layerID,
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = r.db.ExecContext(ctx,
+		`INSERT INTO cost_layer_consumptions (layer_id, movement_id, quantity, created_at) VALUES ($1, $2, $3, $4)`,
+		layerID, movementID, quantity, at,
+	)
+	return err
+}
+
+// GetValuation rebuilds the cost layers as they stood at asOf and returns the
+// remaining quantity and layer value per product and location, together with
+// the product's moving-average cost at that instant.
+func (r *CostLayerRepository) GetValuation(ctx context.Context, asOf time.Time) ([]*models.ValuationLine, error) {
+	query := `
+		WITH consumed AS (
+			SELECT layer_id, SUM(quantity) AS quantity
+			FROM cost_layer_consumptions
+			WHERE created_at <= $1
+			GROUP BY layer_id
+		),
+		layers AS (
+			SELECT cl.product_id, cl.location_id, cl.unit_cost,
+				cl.quantity - COALESCE(c.quantity, 0) AS remaining
+			FROM cost_layers cl
+			LEFT JOIN consumed c ON c.layer_id = cl.id
+			WHERE cl.created_at <= $1
+		),
+		avg_cost AS (
+			SELECT product_id, average_cost
+			FROM (
+				SELECT product_id, average_cost,
+					ROW_NUMBER() OVER (PARTITION BY product_id ORDER BY created_at DESC, id DESC) AS position
+				FROM stock_movements
+				WHERE created_at <= $1
+			) latest
+			WHERE position = 1
+		)
+		SELECT
+			p.id, p.sku_name, p.costing_method,
+			l.id, l.code, l.name,
+			SUM(layers.remaining), SUM(layers.remaining * layers.unit_cost),
+			COALESCE(a.average_cost, 0)
+		FROM layers
+		JOIN products p ON p.id = layers.product_id
+		JOIN locations l ON l.id = layers.location_id
+		LEFT JOIN avg_cost a ON a.product_id = p.id
+		WHERE layers.remaining > 0
+		GROUP BY p.id, p.sku_name, p.costing_method, l.id, l.code, l.name, a.average_cost
+		ORDER BY p.id, l.id
+	`
+	rows, err := r.db.QueryContext(ctx, query, asOf)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var lines []*models.ValuationLine
+	for rows.Next() {
+		line := &models.ValuationLine{}
+		err := rows.Scan(
+			&line.ProductID, &line.SKUName, &line.CostingMethod,
+			&line.LocationID, &line.LocationCode, &line.LocationName,
+			&line.Quantity, &line.LayerValue, &line.AverageCost,
+		)
+		if err != nil {
+			return nil, err
+		}
+		lines = append(lines, line)
+	}
+
+	return lines, rows.Err()
+}
+
+// GetUnlayered returns, per product, the stock on hand at asOf that no cost
+// layer holds, with the product's moving-average cost at that instant. The
+// quantity on hand at asOf is products.quantity less the movements posted
+// since; reconciliation adjustments and their reversals only bring the
+// ledger in line with products.quantity, so they are left out.
+func (r *CostLayerRepository) GetUnlayered(ctx context.Context, asOf time.Time) ([]*models.UnlayeredStock, error) {
+	query := `
+		WITH later AS (
+			SELECT m.product_id,
+				SUM(CASE WHEN m.type = 'IN' THEN m.quantity ELSE -m.quantity END) AS quantity
+			FROM stock_movements m
+			LEFT JOIN stock_movements reversed ON reversed.id = m.reversal_of
+			WHERE m.created_at > $1
+				AND m.source <> 'ADJUSTMENT'
+				AND COALESCE(reversed.source, '') <> 'ADJUSTMENT'
+			GROUP BY m.product_id
+		),
+		consumed AS (
+			SELECT layer_id, SUM(quantity) AS quantity
+			FROM cost_layer_consumptions
+			WHERE created_at <= $1
+			GROUP BY layer_id
+		),
+		layered AS (
+			SELECT cl.product_id, SUM(cl.quantity - COALESCE(c.quantity, 0)) AS quantity
+			FROM cost_layers cl
+			LEFT JOIN consumed c ON c.layer_id = cl.id
+			WHERE cl.created_at <= $1
+			GROUP BY cl.product_id
+		),
+		avg_cost AS (
+			SELECT product_id, average_cost
+			FROM (
+				SELECT product_id, average_cost,
+					ROW_NUMBER() OVER (PARTITION BY product_id ORDER BY created_at DESC, id DESC) AS position
+				FROM stock_movements
+				WHERE created_at <= $1
+			) latest
+			WHERE position = 1
+		),
+		unlayered AS (
+			SELECT p.id, p.sku_name, p.costing_method,
+				p.quantity - COALESCE(later.quantity, 0) - COALESCE(layered.quantity, 0) AS quantity,
+				COALESCE(a.average_cost, 0) AS average_cost
+			FROM products p
+			LEFT JOIN later ON later.product_id = p.id
+			LEFT JOIN layered ON layered.product_id = p.id
+			LEFT JOIN avg_cost a ON a.product_id = p.id
+			WHERE p.created_at <= $1
+		)
+		SELECT id, sku_name, costing_method, quantity, average_cost
+		FROM unlayered
+		WHERE quantity > 0
+		ORDER BY id
+	`
+	rows, err := r.db.QueryContext(ctx, query, asOf)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var stock []*models.UnlayeredStock
+	for rows.Next() {
+		s := &models.UnlayeredStock{}
+		if err := rows.Scan(&s.ProductID, &s.SKUName, &s.CostingMethod, &s.Quantity, &s.AverageCost); err != nil {
+			return nil, err
+		}
+		stock = append(stock, s)
+	}
+
+	return stock, rows.Err()
+}
@@ -0,0 +1,195 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/lib/pq"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+)
+
+// dialect is the flavour of SQL a repository speaks. The zero value is
+// Postgres, so repositories built by the NewXRepository constructors keep
+// working unchanged. Both dialects take $n placeholders: the SQLite driver
+// binds $n to the nth argument, reused as often as the query names it.
+type dialect int
+
+const (
+	dialectPostgres dialect = iota
+	dialectSQLite
+)
+
+// traced returns db with a span started for every statement.
+func (d dialect) traced(db DBTX) DBTX {
+	system := semconv.DBSystemPostgreSQL
+	if d == dialectSQLite {
+		system = semconv.DBSystemSqlite
+	}
+	return tracedDB{db: db, system: system}
+}
+
+// ilike is the case-insensitive LIKE operator. SQLite's LIKE already ignores
+// ASCII case.
+func (d dialect) ilike() string {
+	if d == dialectSQLite {
+		return "LIKE"
+	}
+	return "ILIKE"
+}
+
+// anyOf returns the condition that value is an element of array, an array
+// argument built by d.array or an array column.
+func (d dialect) anyOf(value, array string) string {
+	if d == dialectSQLite {
+		return value + " IN (SELECT value FROM json_each(" + array + "))"
+	}
+	return value + " = ANY(" + array + ")"
+}
+
+// array returns the argument for a slice of ints, int64s or strings: a
+// Postgres array, or its JSON text for SQLite's json_each.
+func (d dialect) array(values interface{}) interface{} {
+	if d == dialectSQLite {
+		encoded, _ := json.Marshal(values)
+		return string(encoded)
+	}
+	return pq.Array(values)
+}
+
+// scanArray returns the scan destination for a string array column.
+func (d dialect) scanArray(dest *[]string) interface{} {
+	if d == dialectSQLite {
+		return &jsonStrings{dest: dest}
+	}
+	return pq.Array(dest)
+}
+
+// forUpdate is the locking clause of a SELECT ... FOR UPDATE. SQLite write
+// transactions hold the whole database, so it needs no row locks.
+func (d dialect) forUpdate() string {
+	if d == dialectSQLite {
+		return ""
+	}
+	return "FOR UPDATE"
+}
+
+// now is the current time in the form timestamp columns store it.
+func (d dialect) now() string {
+	if d == dialectSQLite {
+		return sqliteNow
+	}
+	return "CURRENT_TIMESTAMP"
+}
+
+// timestamp converts a text argument, such as a date from a query string, to
+// a timestamp that compares correctly with timestamp columns. A time with an
+// offset keeps it; a date or time without one is taken as UTC, whatever the
+// session time zone.
+func (d dialect) timestamp(placeholder string) string {
+	if d == dialectSQLite {
+		return "strftime('" + sqliteTimeLayout + "', " + placeholder + ")"
+	}
+	value := "CAST(" + placeholder + " AS TEXT)"
+	return "(CASE WHEN " + value + " ~ '" + timestampOffsetPattern + "' THEN CAST(" + value + " AS TIMESTAMPTZ)" +
+		" ELSE CAST(" + value + " AS TIMESTAMP) AT TIME ZONE 'UTC' END)"
+}
+
+// timestampOffsetPattern matches a time of day that ends in an offset, such
+// as "T10:00:00+07:00" or "10:00Z".
+const timestampOffsetPattern = `[0-9]:[0-9]{2}(:[0-9]{2}(\.[0-9]+)?)? *([Zz]|[+-][0-9]{2}(:?[0-9]{2})?)$`
+
+// jsonStrings scans a JSON array of strings.
+type jsonStrings struct {
+	dest *[]string
+}
+
+func (j *jsonStrings) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case nil:
+		*j.dest = nil
+		return nil
+	case string:
+		return json.Unmarshal([]byte(v), j.dest)
+	case []byte:
+		return json.Unmarshal(v, j.dest)
+	default:
+		return fmt.Errorf("cannot scan %T into a string array", src)
+	}
+}
+
+// sqlRepositories hands out the repositories over db, which is either the
+// pool or an open transaction.
+type sqlRepositories struct {
+	db      DBTX
+	dialect dialect
+}
+
+func (r sqlRepositories) Products() ProductStore {
+	return &ProductRepository{db: r.db, dialect: r.dialect}
+}
+
+func (r sqlRepositories) Locations() LocationStore {
+	return &LocationRepository{db: r.db, dialect: r.dialect}
+}
+
+func (r sqlRepositories) StockMovements() StockMovementStore {
+	return &StockMovementRepository{db: r.db, dialect: r.dialect}
+}
+
+func (r sqlRepositories) CostLayers() CostLayerStore {
+	return &CostLayerRepository{db: r.db}
+}
+
+func (r sqlRepositories) Snapshots() StockSnapshotStore {
+	return &StockSnapshotRepository{db: r.db}
+}
+
+func (r sqlRepositories) Reconciliation() ReconciliationStore {
+	return &ReconciliationRepository{db: r.db}
+}
+
+func (r sqlRepositories) Outbox() OutboxStore {
+	return &OutboxRepository{db: r.db, dialect: r.dialect}
+}
+
+func (r sqlRepositories) Webhooks() WebhookStore {
+	return &WebhookRepository{db: r.db, dialect: r.dialect}
+}
+
+// sqlTx is the part of a unit of work both dialects share. ctx is the
+// context the transaction was begun with; when it is done, the transaction
+// is rolled back.
+type sqlTx struct {
+	sqlRepositories
+	ctx context.Context
+	tx  *sql.Tx
+}
+
+func (t *sqlTx) Savepoint(name string) error {
+	_, err := t.tx.ExecContext(t.ctx, "SAVEPOINT "+name)
+	return err
+}
+
+func (t *sqlTx) ReleaseSavepoint(name string, rollback bool) error {
+	release := "RELEASE SAVEPOINT " + name
+	if rollback {
+		release = "ROLLBACK TO SAVEPOINT " + name + "; " + release
+	}
+	_, err := t.tx.ExecContext(t.ctx, release)
+	return err
+}
+
+func (t *sqlTx) Commit() error {
+	return t.tx.Commit()
+}
+
+func (t *sqlTx) Rollback() error {
+	err := t.tx.Rollback()
+	if errors.Is(err, sql.ErrTxDone) {
+		return nil
+	}
+	return err
+}
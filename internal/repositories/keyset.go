@@ -0,0 +1,275 @@
+package repositories
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"warehouse-api/internal/apperrors"
+	"warehouse-api/internal/models"
+)
+
+// Error codes for rejected list parameters.
+const (
+	CodeInvalidSort   = "invalid_sort"
+	CodeInvalidCursor = "invalid_cursor"
+)
+
+// sortKind is the Go type of a sort column, used to parse cursor values.
+type sortKind int
+
+const (
+	sortInt sortKind = iota
+	sortString
+	sortTime
+)
+
+// sortField is a column a list may be ordered by. value reads the column
+// back from a row for the next cursor.
+type sortField[T any] struct {
+	column string
+	kind   sortKind
+	value  func(T) interface{}
+}
+
+// keyset describes how a list is paginated: the whitelisted sort fields, the
+// unique id column that breaks ties, and the sort used when none is asked for.
+type keyset[T any] struct {
+	fields      map[string]sortField[T]
+	idColumn    string
+	id          func(T) int
+	defaultSort string
+}
+
+// cursor is the decoded form of the opaque next_cursor. It remembers the sort
+// it was issued for so it cannot be replayed against a different order.
+type cursor struct {
+	Sort  string `json:"s"`
+	Value string `json:"v"`
+	ID    int    `json:"id"`
+}
+
+// keysetPage is one page request resolved against a keyset.
+type keysetPage[T any] struct {
+	keyset *keyset[T]
+	field  sortField[T]
+	sort   string
+	desc   bool
+	limit  int
+	after  *cursor
+	value  interface{}
+}
+
+func (k *keyset[T]) page(req models.PageRequest) (*keysetPage[T], error) {
+	sortBy := req.Sort
+	if sortBy == "" {
+		sortBy = k.defaultSort
+	}
+	name := strings.TrimPrefix(sortBy, "-")
+	field, ok := k.fields[name]
+	if !ok {
+		return nil, apperrors.New(apperrors.Invalid, CodeInvalidSort,
+			fmt.Sprintf("Invalid sort %q, expected one of %s, optionally prefixed with -", sortBy, k.fieldNames()))
+	}
+
+	p := &keysetPage[T]{
+		keyset: k,
+		field:  field,
+		sort:   sortBy,
+		desc:   strings.HasPrefix(sortBy, "-"),
+		limit:  req.Limit,
+	}
+	if req.Cursor != "" {
+		if err := p.decode(req.Cursor); err != nil {
+			return nil, err
+		}
+	}
+	return p, nil
+}
+
+func (k *keyset[T]) fieldNames() string {
+	names := make([]string, 0, len(k.fields))
+	for name := range k.fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+func (p *keysetPage[T]) decode(encoded string) error {
+	invalid := apperrors.New(apperrors.Invalid, CodeInvalidCursor, "Invalid cursor")
+
+	raw, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return invalid
+	}
+	var c cursor
+	if err := json.Unmarshal(raw, &c); err != nil {
+		return invalid
+	}
+	if c.Sort != p.sort {
+		return apperrors.New(apperrors.Invalid, CodeInvalidCursor, "Cursor was issued for a different sort")
+	}
+
+	// The value is parsed back to the type of the sort column so a tampered
+	// cursor fails here rather than in the database.
+	if p.field.column != p.keyset.idColumn {
+		switch p.field.kind {
+		case sortInt:
+			p.value, err = strconv.Atoi(c.Value)
+		case sortTime:
+			p.value, err = time.Parse(time.RFC3339Nano, c.Value)
+		default:
+			p.value = c.Value
+		}
+		if err != nil {
+			return invalid
+		}
+	}
+	p.after = &c
+	return nil
+}
+
+// where returns the condition selecting the rows after the cursor, with its
+// arguments appended to args, or an empty condition on the first page.
+func (p *keysetPage[T]) where(args []interface{}) (string, []interface{}) {
+	if p.after == nil {
+		return "", args
+	}
+	op := ">"
+	if p.desc {
+		op = "<"
+	}
+	if p.field.column == p.keyset.idColumn {
+		args = append(args, p.after.ID)
+		return fmt.Sprintf("%s %s $%d", p.keyset.idColumn, op, len(args)), args
+	}
+	args = append(args, p.value, p.after.ID)
+	return fmt.Sprintf("(%s, %s) %s ($%d, $%d)", p.field.column, p.keyset.idColumn, op, len(args)-1, len(args)), args
+}
+
+// orderBy returns the ORDER BY and LIMIT clauses. One row more than the page
+// size is fetched so finish can tell whether another page follows.
+func (p *keysetPage[T]) orderBy(args []interface{}) (string, []interface{}) {
+	direction := "ASC"
+	if p.desc {
+		direction = "DESC"
+	}
+	order := p.keyset.idColumn + " " + direction
+	if p.field.column != p.keyset.idColumn {
+		order = p.field.column + " " + direction + ", " + order
+	}
+	args = append(args, p.limit+1)
+	return fmt.Sprintf("ORDER BY %s LIMIT $%d", order, len(args)), args
+}
+
+// finish trims the extra row fetched by orderBy and describes the page.
+func (p *keysetPage[T]) finish(items []T) ([]T, *models.CursorPagination) {
+	pagination := &models.CursorPagination{Limit: p.limit, Sort: p.sort}
+	if len(items) <= p.limit {
+		return items, pagination
+	}
+
+	items = items[:p.limit]
+	last := items[len(items)-1]
+	c := cursor{Sort: p.sort, ID: p.keyset.id(last)}
+	switch v := p.field.value(last).(type) {
+	case time.Time:
+		c.Value = v.Format(time.RFC3339Nano)
+	default:
+		c.Value = fmt.Sprint(v)
+	}
+	raw, _ := json.Marshal(c)
+
+	pagination.NextCursor = base64.RawURLEncoding.EncodeToString(raw)
+	pagination.HasMore = true
+	return items, pagination
+}
+
+// slice pages items that are already filtered in Go: it orders them like
+// orderBy, skips those up to the cursor like where, and finishes the page.
+func (p *keysetPage[T]) slice(items []T) ([]T, *models.CursorPagination) {
+	ordered := append([]T(nil), items...)
+	sort.SliceStable(ordered, func(i, j int) bool {
+		c := p.compare(ordered[i], p.field.value(ordered[j]), p.keyset.id(ordered[j]))
+		if p.desc {
+			return c > 0
+		}
+		return c < 0
+	})
+
+	start := 0
+	if p.after != nil {
+		value := p.value
+		if p.field.column == p.keyset.idColumn {
+			value = p.after.ID
+		}
+		for start < len(ordered) {
+			c := p.compare(ordered[start], value, p.after.ID)
+			if (p.desc && c < 0) || (!p.desc && c > 0) {
+				break
+			}
+			start++
+		}
+	}
+
+	end := start + p.limit + 1
+	if end > len(ordered) {
+		end = len(ordered)
+	}
+	return p.finish(ordered[start:end])
+}
+
+// compare orders item against the sort value and id of another row.
+func (p *keysetPage[T]) compare(item T, value interface{}, id int) int {
+	if c := compareValues(p.field.value(item), value); c != 0 {
+		return c
+	}
+	return compareValues(p.keyset.id(item), id)
+}
+
+func compareValues(a, b interface{}) int {
+	switch a := a.(type) {
+	case int:
+		b := b.(int)
+		if a < b {
+			return -1
+		} else if a > b {
+			return 1
+		}
+		return 0
+	case time.Time:
+		return a.Compare(b.(time.Time))
+	default:
+		return strings.Compare(fmt.Sprint(a), fmt.Sprint(b))
+	}
+}
+
+// PageProducts returns the page of products that ProductRepository.GetAll
+// would for req, given every product matching the other filters. Stores that
+// filter in Go use it so their cursors stay interchangeable with the SQL ones.
+func PageProducts(products []*models.Product, req models.PageRequest) ([]*models.Product, *models.CursorPagination, error) {
+	return pageSlice(productKeyset, products, req)
+}
+
+// PageLocations is PageProducts for LocationRepository.GetAll.
+func PageLocations(locations []*models.LocationWithUsage, req models.PageRequest) ([]*models.LocationWithUsage, *models.CursorPagination, error) {
+	return pageSlice(locationKeyset, locations, req)
+}
+
+// PageStockMovements is PageProducts for StockMovementRepository.GetAll.
+func PageStockMovements(movements []*models.StockMovement, req models.PageRequest) ([]*models.StockMovement, *models.CursorPagination, error) {
+	return pageSlice(movementKeyset, movements, req)
+}
+
+func pageSlice[T any](k *keyset[T], items []T, req models.PageRequest) ([]T, *models.CursorPagination, error) {
+	page, err := k.page(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	items, pagination := page.slice(items)
+	return items, pagination, nil
+}
@@ -1,81 +1,176 @@
 package repositories
 
 import (
+	"context"
 	"database/sql"
+	"fmt"
 	"warehouse-api/internal/models"
 )
 
+const locationColumns = `id, code, name, warehouse, capacity, created_at`
+
 type LocationRepository struct {
-	db *sql.DB
+	db      DBTX
+	dialect dialect
 }
 
 func NewLocationRepository(db *sql.DB) *LocationRepository {
 	return &LocationRepository{db: db}
 }
 
-func (r *LocationRepository) Create(location *models.Location) error {
+func scanLocation(row scanner) (*models.Location, error) {
+	location := &models.Location{}
+	err := row.Scan(
+		&location.ID, &location.Code, &location.Name, &location.Warehouse,
+		&location.Capacity, &location.CreatedAt,
+	)
+	return location, err
+}
+
+func (r *LocationRepository) Create(ctx context.Context, location *models.Location) error {
 	query := `
-		INSERT INTO locations (code, name, capacity)
-		VALUES ($1, $2, $3)
+		INSERT INTO locations (code, name, warehouse, capacity)
+		VALUES ($1, $2, $3, $4)
 		RETURNING id, created_at
 	`
-	err := r.db.QueryRow(query, location.Code, location.Name, location.Capacity).Scan(
+	err := r.db.QueryRowContext(ctx, query, location.Code, location.Name, location.Warehouse, location.Capacity).Scan(
 		&location.ID, &location.CreatedAt,
 	)
 	return err
 }
 
-func (r *LocationRepository) GetByID(id int) (*models.Location, error) {
-	location := &models.Location{}
-	query := `SELECT id, code, name, capacity, created_at FROM locations WHERE id = $1`
-	err := r.db.QueryRow(query, id).Scan(
-		&location.ID, &location.Code, &location.Name,
-		&location.Capacity, &location.CreatedAt,
-	)
+func (r *LocationRepository) GetByID(ctx context.Context, id int) (*models.Location, error) {
+	query := `SELECT ` + locationColumns + ` FROM locations WHERE id = $1`
+	location, err := scanLocation(r.db.QueryRowContext(ctx, query, id))
 	if err == sql.ErrNoRows {
 		return nil, nil
 	}
 	return location, err
 }
 
-func (r *LocationRepository) GetByCode(code string) (*models.Location, error) {
-	location := &models.Location{}
-	query := `SELECT id, code, name, capacity, created_at FROM locations WHERE code = $1`
-	err := r.db.QueryRow(query, code).Scan(
-		&location.ID, &location.Code, &location.Name,
-		&location.Capacity, &location.CreatedAt,
-	)
+func (r *LocationRepository) GetByCode(ctx context.Context, code string) (*models.Location, error) {
+	query := `SELECT ` + locationColumns + ` FROM locations WHERE code = $1`
+	location, err := scanLocation(r.db.QueryRowContext(ctx, query, code))
 	if err == sql.ErrNoRows {
 		return nil, nil
 	}
 	return location, err
 }
 
-func (r *LocationRepository) GetAll() ([]*models.LocationWithUsage, error) {
+// locationKeyset lists the fields locations may be sorted by, in creation
+// order by default.
+var locationKeyset = &keyset[*models.LocationWithUsage]{
+	fields: map[string]sortField[*models.LocationWithUsage]{
+		"id":         {column: "l.id", kind: sortInt, value: func(l *models.LocationWithUsage) interface{} { return l.ID }},
+		"code":       {column: "l.code", kind: sortString, value: func(l *models.LocationWithUsage) interface{} { return l.Code }},
+		"name":       {column: "l.name", kind: sortString, value: func(l *models.LocationWithUsage) interface{} { return l.Name }},
+		"capacity":   {column: "l.capacity", kind: sortInt, value: func(l *models.LocationWithUsage) interface{} { return l.Capacity }},
+		"created_at": {column: "l.created_at", kind: sortTime, value: func(l *models.LocationWithUsage) interface{} { return l.CreatedAt }},
+	},
+	idColumn:    "l.id",
+	id:          func(l *models.LocationWithUsage) int { return l.ID },
+	defaultSort: "id",
+}
+
+// GetAll returns one page of the locations matching filter with their
+// current usage, ordered by filter.Sort and starting after filter.Cursor.
+func (r *LocationRepository) GetAll(ctx context.Context, filter *models.LocationFilter) ([]*models.LocationWithUsage, *models.CursorPagination, error) {
+	page, err := locationKeyset.page(filter.PageRequest)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	whereClause := "WHERE 1=1"
+	args := []interface{}{}
+
+	if len(filter.IDs) > 0 {
+		args = append(args, r.dialect.array(filter.IDs))
+		whereClause += " AND " + r.dialect.anyOf("l.id", fmt.Sprintf("$%d", len(args)))
+	}
+	if filter.Search != "" {
+		args = append(args, "%"+filter.Search+"%")
+		whereClause += fmt.Sprintf(" AND (l.code %[1]s $%[2]d OR l.name %[1]s $%[2]d)", r.dialect.ilike(), len(args))
+	}
+	if filter.Warehouse != "" {
+		args = append(args, filter.Warehouse)
+		whereClause += fmt.Sprintf(" AND l.warehouse = $%d", len(args))
+	}
+	if filter.MinCapacity != nil {
+		args = append(args, *filter.MinCapacity)
+		whereClause += fmt.Sprintf(" AND l.capacity >= $%d", len(args))
+	}
+	if filter.MaxCapacity != nil {
+		args = append(args, *filter.MaxCapacity)
+		whereClause += fmt.Sprintf(" AND l.capacity <= $%d", len(args))
+	}
+
+	var after, orderBy string
+	after, args = page.where(args)
+	if after != "" {
+		whereClause += " AND " + after
+	}
+	orderBy, args = page.orderBy(args)
+
+	locations := []*models.LocationWithUsage{}
+	err = r.streamWithUsage(ctx, whereClause, orderBy, args, func(loc *models.LocationWithUsage) error {
+		locations = append(locations, loc)
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	locations, pagination := page.finish(locations)
+	return locations, pagination, nil
+}
+
+// StreamAll calls fn for every location with its current usage, one row at a
+// time. Returning an error from fn stops the iteration.
+func (r *LocationRepository) StreamAll(ctx context.Context, fn func(loc *models.LocationWithUsage) error) error {
+	return r.streamWithUsage(ctx, "", "ORDER BY l.id", nil, fn)
+}
+
+// GetWithUsageByIDs returns the locations among ids with their current usage,
+// in one query. IDs that do not exist are left out.
+func (r *LocationRepository) GetWithUsageByIDs(ctx context.Context, ids []int) ([]*models.LocationWithUsage, error) {
+	var locations []*models.LocationWithUsage
+	err := r.streamWithUsage(ctx, "WHERE "+r.dialect.anyOf("l.id", "$1"), "ORDER BY l.id", []interface{}{r.dialect.array(ids)}, func(loc *models.LocationWithUsage) error {
+		locations = append(locations, loc)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return locations, nil
+}
+
+// streamWithUsage runs the usage query with the given WHERE clause and
+// ORDER BY clause, which may end in a LIMIT.
+func (r *LocationRepository) streamWithUsage(ctx context.Context, where, orderBy string, args []interface{}, fn func(loc *models.LocationWithUsage) error) error {
 	query := `
 		SELECT 
-			l.id, l.code, l.name, l.capacity, l.created_at,
+			l.id, l.code, l.name, l.warehouse, l.capacity, l.created_at,
 			COALESCE(SUM(CASE WHEN sm.type = 'IN' THEN sm.quantity ELSE -sm.quantity END), 0) as current_usage
 		FROM locations l
 		LEFT JOIN stock_movements sm ON sm.location_id = l.id
-		GROUP BY l.id, l.code, l.name, l.capacity, l.created_at
-		ORDER BY l.id
+		` + where + `
+		GROUP BY l.id, l.code, l.name, l.warehouse, l.capacity, l.created_at
+		` + orderBy + `
 	`
-	rows, err := r.db.Query(query)
+	rows, err := r.db.QueryContext(ctx, query, args...)
 	if err != nil {
-		return nil, err
+		return err
 	}
 	defer rows.Close()
 
-	var locations []*models.LocationWithUsage
 	for rows.Next() {
 		loc := &models.LocationWithUsage{}
 		var usage int
 		err := rows.Scan(
-			&loc.ID, &loc.Code, &loc.Name, &loc.Capacity, &loc.CreatedAt, &usage,
+			&loc.ID, &loc.Code, &loc.Name, &loc.Warehouse, &loc.Capacity, &loc.CreatedAt, &usage,
 		)
 		if err != nil {
-			return nil, err
+			return err
 		}
 		loc.CurrentUsage = usage
 		if loc.CurrentUsage < 0 {
@@ -85,20 +180,22 @@ func (r *LocationRepository) GetAll() ([]*models.LocationWithUsage, error) {
 		if loc.Available < 0 {
 			loc.Available = 0
 		}
-		locations = append(locations, loc)
+		if err := fn(loc); err != nil {
+			return err
+		}
 	}
 
-	return locations, nil
+	return rows.Err()
 }
 
-func (r *LocationRepository) GetCurrentUsage(locationID int) (int, error) {
+func (r *LocationRepository) GetCurrentUsage(ctx context.Context, locationID int) (int, error) {
 	query := `
 		SELECT COALESCE(SUM(CASE WHEN type = 'IN' THEN quantity ELSE -quantity END), 0)
 		FROM stock_movements
 		WHERE location_id = $1
 	`
 	var usage int
-	err := r.db.QueryRow(query, locationID).Scan(&usage)
+	err := r.db.QueryRowContext(ctx, query, locationID).Scan(&usage)
 	if err != nil {
 		return 0, err
 	}
@@ -108,3 +205,13 @@ func (r *LocationRepository) GetCurrentUsage(locationID int) (int, error) {
 	return usage, nil
 }
 
+// GetByIDForUpdate locks the location row until the surrounding transaction
+// ends, so concurrent IN movements cannot overshoot its capacity together.
+func (r *LocationRepository) GetByIDForUpdate(ctx context.Context, id int) (*models.Location, error) {
+	query := `SELECT ` + locationColumns + ` FROM locations WHERE id = $1 ` + r.dialect.forUpdate()
+	location, err := scanLocation(r.db.QueryRowContext(ctx, query, id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return location, err
+}
@@ -0,0 +1,187 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+	"warehouse-api/internal/models"
+)
+
+type costLayerRepo struct {
+	db *db
+}
+
+func (r *costLayerRepo) Create(ctx context.Context, layer *models.CostLayer) error {
+	return r.db.write(func(st *state, now time.Time) error {
+		layer.ID = r.db.store.nextID("cost_layers")
+		stored := clone(layer)
+		stored.UnitCost = numeric(stored.UnitCost)
+		st.costLayers = append(st.costLayers, stored)
+		return nil
+	})
+}
+
+// GetOpen orders the layers with stock left by age.
+func (r *costLayerRepo) GetOpen(ctx context.Context, productID int) ([]*models.CostLayer, error) {
+	var layers []*models.CostLayer
+	err := r.db.read(func(st *state) error {
+		for _, layer := range st.costLayers {
+			if layer.ProductID == productID && layer.RemainingQuantity > 0 {
+				layers = append(layers, clone(layer))
+			}
+		}
+		return nil
+	})
+	sort.SliceStable(layers, func(i, j int) bool {
+		a, b := layers[i], layers[j]
+		if c := a.CreatedAt.Compare(b.CreatedAt); c != 0 {
+			return c < 0
+		}
+		return a.ID < b.ID
+	})
+	return layers, err
+}
+
+func (r *costLayerRepo) Consume(ctx context.Context, layerID, movementID, quantity int, at time.Time) error {
+	return r.db.write(func(st *state, now time.Time) error {
+		for _, layer := range st.costLayers {
+			if layer.ID != layerID {
+				continue
+			}
+			if layer.RemainingQuantity < quantity {
+				return fmt.Errorf("new row for relation \"cost_layers\" violates check constraint \"cost_layers_remaining_quantity_check\"")
+			}
+			layer.RemainingQuantity -= quantity
+		}
+		st.consumptions = append(st.consumptions, &consumption{
+			layerID:    layerID,
+			movementID: movementID,
+			quantity:   quantity,
+			createdAt:  at,
+		})
+		return nil
+	})
+}
+
+// GetValuation rebuilds every layer at asOf from its consumptions up to then.
+func (r *costLayerRepo) GetValuation(ctx context.Context, asOf time.Time) ([]*models.ValuationLine, error) {
+	var lines []*models.ValuationLine
+	err := r.db.read(func(st *state) error {
+		consumed := map[int]int{}
+		for _, c := range st.consumptions {
+			if !c.createdAt.After(asOf) {
+				consumed[c.layerID] += c.quantity
+			}
+		}
+
+		averageCost := map[int]float64{}
+		for _, m := range st.chronological() {
+			if !m.CreatedAt.After(asOf) {
+				averageCost[m.ProductID] = m.AverageCost
+			}
+		}
+
+		valued := map[balanceKey]*models.ValuationLine{}
+		for _, layer := range st.costLayers {
+			remaining := layer.Quantity - consumed[layer.ID]
+			if layer.CreatedAt.After(asOf) || remaining <= 0 {
+				continue
+			}
+			p, l := st.product(layer.ProductID), st.location(layer.LocationID)
+			if p == nil || l == nil {
+				continue
+			}
+
+			key := balanceKey{p.ID, l.ID}
+			line, ok := valued[key]
+			if !ok {
+				line = &models.ValuationLine{
+					ProductID:     p.ID,
+					SKUName:       p.SKUName,
+					CostingMethod: p.CostingMethod,
+					LocationID:    l.ID,
+					LocationCode:  l.Code,
+					LocationName:  l.Name,
+					AverageCost:   averageCost[p.ID],
+				}
+				valued[key] = line
+				lines = append(lines, line)
+			}
+			line.Quantity += remaining
+			line.LayerValue += float64(remaining) * layer.UnitCost
+		}
+		return nil
+	})
+
+	sort.Slice(lines, func(i, j int) bool {
+		if lines[i].ProductID != lines[j].ProductID {
+			return lines[i].ProductID < lines[j].ProductID
+		}
+		return lines[i].LocationID < lines[j].LocationID
+	})
+	return lines, err
+}
+
+// GetUnlayered rolls products.quantity back over the movements posted after
+// asOf, leaving out reconciliation adjustments and their reversals, and
+// subtracts what the layers held then.
+func (r *costLayerRepo) GetUnlayered(ctx context.Context, asOf time.Time) ([]*models.UnlayeredStock, error) {
+	var stock []*models.UnlayeredStock
+	err := r.db.read(func(st *state) error {
+		onHand := map[int]int{}
+		averageCost := map[int]float64{}
+		for _, p := range st.products {
+			onHand[p.ID] = p.Quantity
+		}
+		for _, m := range st.chronological() {
+			if !m.CreatedAt.After(asOf) {
+				averageCost[m.ProductID] = m.AverageCost
+				continue
+			}
+			adjusts := m.Source == models.MovementSourceAdjustment
+			if m.ReversalOf != nil {
+				if reversed := st.movement(*m.ReversalOf); reversed != nil && reversed.Source == models.MovementSourceAdjustment {
+					adjusts = true
+				}
+			}
+			if adjusts {
+				continue
+			}
+			if m.Type == "IN" {
+				onHand[m.ProductID] -= m.Quantity
+			} else {
+				onHand[m.ProductID] += m.Quantity
+			}
+		}
+
+		consumed := map[int]int{}
+		for _, c := range st.consumptions {
+			if !c.createdAt.After(asOf) {
+				consumed[c.layerID] += c.quantity
+			}
+		}
+		for _, layer := range st.costLayers {
+			if !layer.CreatedAt.After(asOf) {
+				onHand[layer.ProductID] -= layer.Quantity - consumed[layer.ID]
+			}
+		}
+
+		for _, p := range st.products {
+			if p.CreatedAt.After(asOf) || onHand[p.ID] <= 0 {
+				continue
+			}
+			stock = append(stock, &models.UnlayeredStock{
+				ProductID:     p.ID,
+				SKUName:       p.SKUName,
+				CostingMethod: p.CostingMethod,
+				Quantity:      onHand[p.ID],
+				AverageCost:   averageCost[p.ID],
+			})
+		}
+		return nil
+	})
+
+	sort.Slice(stock, func(i, j int) bool { return stock[i].ProductID < stock[j].ProductID })
+	return stock, err
+}
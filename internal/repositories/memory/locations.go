@@ -0,0 +1,162 @@
+package memory
+
+import (
+	"context"
+	"time"
+	"warehouse-api/internal/models"
+	"warehouse-api/internal/repositories"
+)
+
+type locationRepo struct {
+	db *db
+}
+
+func (st *state) location(id int) *models.Location {
+	for _, l := range st.locations {
+		if l.ID == id {
+			return l
+		}
+	}
+	return nil
+}
+
+// usage is the ledger balance of a location, which may be negative.
+func (st *state) usage(locationID int) int {
+	usage := 0
+	for _, m := range st.movements {
+		if m.LocationID == locationID {
+			usage += signed(m)
+		}
+	}
+	return usage
+}
+
+func (st *state) withUsage(l *models.Location) *models.LocationWithUsage {
+	loc := &models.LocationWithUsage{Location: *l, CurrentUsage: st.usage(l.ID)}
+	if loc.CurrentUsage < 0 {
+		loc.CurrentUsage = 0
+	}
+	loc.Available = loc.Capacity - loc.CurrentUsage
+	if loc.Available < 0 {
+		loc.Available = 0
+	}
+	return loc
+}
+
+func (r *locationRepo) Create(ctx context.Context, location *models.Location) error {
+	return r.db.write(func(st *state, now time.Time) error {
+		for _, l := range st.locations {
+			if l.Code == location.Code {
+				return uniqueViolation("locations_code_key")
+			}
+		}
+
+		location.ID = r.db.store.nextID("locations")
+		location.CreatedAt = now
+		st.locations = append(st.locations, clone(location))
+		return nil
+	})
+}
+
+func (r *locationRepo) GetByID(ctx context.Context, id int) (*models.Location, error) {
+	var location *models.Location
+	err := r.db.read(func(st *state) error {
+		location = clone(st.location(id))
+		return nil
+	})
+	return location, err
+}
+
+func (r *locationRepo) GetByCode(ctx context.Context, code string) (*models.Location, error) {
+	var location *models.Location
+	err := r.db.read(func(st *state) error {
+		for _, l := range st.locations {
+			if l.Code == code {
+				location = clone(l)
+			}
+		}
+		return nil
+	})
+	return location, err
+}
+
+// GetByIDForUpdate needs no lock of its own: the open transaction already
+// excludes every other writer.
+func (r *locationRepo) GetByIDForUpdate(ctx context.Context, id int) (*models.Location, error) {
+	return r.GetByID(ctx, id)
+}
+
+func (r *locationRepo) GetCurrentUsage(ctx context.Context, locationID int) (int, error) {
+	usage := 0
+	err := r.db.read(func(st *state) error {
+		usage = st.usage(locationID)
+		return nil
+	})
+	if usage < 0 {
+		usage = 0
+	}
+	return usage, err
+}
+
+func (r *locationRepo) GetAll(ctx context.Context, filter *models.LocationFilter) ([]*models.LocationWithUsage, *models.CursorPagination, error) {
+	locations := []*models.LocationWithUsage{}
+	err := r.db.read(func(st *state) error {
+		for _, l := range st.locations {
+			if len(filter.IDs) > 0 && !containsInt(filter.IDs, l.ID) {
+				continue
+			}
+			if filter.Search != "" && !containsFold(l.Code, filter.Search) && !containsFold(l.Name, filter.Search) {
+				continue
+			}
+			if filter.Warehouse != "" && l.Warehouse != filter.Warehouse {
+				continue
+			}
+			if filter.MinCapacity != nil && l.Capacity < *filter.MinCapacity {
+				continue
+			}
+			if filter.MaxCapacity != nil && l.Capacity > *filter.MaxCapacity {
+				continue
+			}
+			locations = append(locations, st.withUsage(l))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return repositories.PageLocations(locations, filter.PageRequest)
+}
+
+func (r *locationRepo) GetWithUsageByIDs(ctx context.Context, ids []int) ([]*models.LocationWithUsage, error) {
+	var locations []*models.LocationWithUsage
+	err := r.db.read(func(st *state) error {
+		for _, l := range st.locations {
+			if containsInt(ids, l.ID) {
+				locations = append(locations, st.withUsage(l))
+			}
+		}
+		return nil
+	})
+	return locations, err
+}
+
+// StreamAll calls fn for every location in ID order. Locations are created in
+// ID order, so the stored order already is.
+func (r *locationRepo) StreamAll(ctx context.Context, fn func(loc *models.LocationWithUsage) error) error {
+	var locations []*models.LocationWithUsage
+	err := r.db.read(func(st *state) error {
+		for _, l := range st.locations {
+			locations = append(locations, st.withUsage(l))
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, loc := range locations {
+		if err := fn(loc); err != nil {
+			return err
+		}
+	}
+	return nil
+}
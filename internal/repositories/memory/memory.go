@@ -0,0 +1,342 @@
+// Package memory is an in-memory repositories.Store with the semantics of
+// the Postgres one: units of work commit or roll back as a whole, savepoints
+// undo part of one, row locks serialise writers, timestamps are fixed at the
+// start of a transaction and IDs are never reused. It exists so the services
+// can be exercised without a database.
+package memory
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+	"warehouse-api/internal/models"
+	"warehouse-api/internal/repositories"
+)
+
+// state is the full content of the store. Every row is owned by exactly one
+// state, so a copy of it can be changed without touching the original.
+type state struct {
+	products      []*models.Product
+	locations     []*models.Location
+	movements     []*models.StockMovement
+	costLayers    []*models.CostLayer
+	consumptions  []*consumption
+	snapshots     []*models.StockSnapshot
+	snapshotLines []*snapshotLine
+	outbox        []*models.OutboxEvent
+	subscriptions []*models.WebhookSubscription
+	deliveries    []*models.WebhookDelivery
+}
+
+type consumption struct {
+	layerID    int
+	movementID int
+	quantity   int
+	createdAt  time.Time
+}
+
+type snapshotLine struct {
+	snapshotID int
+	productID  int
+	locationID int
+	quantity   int
+}
+
+func (s *state) clone() *state {
+	return &state{
+		products:      cloneAll(s.products),
+		locations:     cloneAll(s.locations),
+		movements:     cloneAll(s.movements),
+		costLayers:    cloneAll(s.costLayers),
+		consumptions:  cloneAll(s.consumptions),
+		snapshots:     cloneAll(s.snapshots),
+		snapshotLines: cloneAll(s.snapshotLines),
+		outbox:        cloneAll(s.outbox),
+		subscriptions: cloneAll(s.subscriptions),
+		deliveries:    cloneAll(s.deliveries),
+	}
+}
+
+func cloneAll[T any](rows []*T) []*T {
+	cloned := make([]*T, len(rows))
+	for i, row := range rows {
+		cloned[i] = clone(row)
+	}
+	return cloned
+}
+
+// clone copies a row so callers never share memory with the store.
+func clone[T any](row *T) *T {
+	if row == nil {
+		return nil
+	}
+	copied := *row
+	return &copied
+}
+
+// Store keeps its data in memory. Only one transaction is open at a time,
+// which gives the same outcome as the row locks Postgres takes; plain reads
+// see the last committed state and never wait. A goroutine that writes
+// through the Store while it has a transaction open deadlocks.
+type Store struct {
+	repoSet
+
+	// writer is held by the open transaction and by writes made outside one.
+	writer sync.Mutex
+
+	mu            sync.RWMutex
+	committed     *state
+	notifications map[string][]string
+
+	seqMu     sync.Mutex
+	sequences map[string]int
+
+	// Now returns the current time. Tests may replace it before first use.
+	Now func() time.Time
+}
+
+var _ repositories.Store = (*Store)(nil)
+
+// New returns an empty store.
+func New() *Store {
+	s := &Store{
+		committed:     &state{},
+		notifications: map[string][]string{},
+		sequences:     map[string]int{},
+		Now:           time.Now,
+	}
+	s.repoSet = repoSet{db: &db{store: s}}
+	return s
+}
+
+// Begin starts a unit of work, waiting for the open one to end first.
+func (s *Store) Begin(ctx context.Context) (repositories.Tx, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	s.writer.Lock()
+
+	s.mu.RLock()
+	working := s.committed.clone()
+	s.mu.RUnlock()
+
+	tx := &Tx{store: s}
+	tx.db = &db{store: s, tx: tx, state: working, now: s.now()}
+	tx.repoSet = repoSet{db: tx.db}
+	return tx, nil
+}
+
+// Notifications returns every payload committed on channel, oldest first.
+func (s *Store) Notifications(channel string) []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return append([]string(nil), s.notifications[channel]...)
+}
+
+// now is CURRENT_TIMESTAMP: UTC with microsecond precision.
+func (s *Store) now() time.Time {
+	return s.Now().UTC().Truncate(time.Microsecond)
+}
+
+// nextID draws from the sequence of table. Like a Postgres sequence it is not
+// rolled back with the transaction that drew from it.
+func (s *Store) nextID(table string) int {
+	s.seqMu.Lock()
+	defer s.seqMu.Unlock()
+	s.sequences[table]++
+	return s.sequences[table]
+}
+
+// Tx is a unit of work on a Store. It works on its own copy of the data,
+// which replaces the committed state on Commit.
+type Tx struct {
+	repoSet
+	store *Store
+
+	savepoints    []savepoint
+	notifications [][2]string
+	done          bool
+}
+
+type savepoint struct {
+	name  string
+	state *state
+}
+
+var _ repositories.Tx = (*Tx)(nil)
+
+func (t *Tx) Savepoint(name string) error {
+	if t.done {
+		return sql.ErrTxDone
+	}
+	t.savepoints = append(t.savepoints, savepoint{name: name, state: t.db.state.clone()})
+	return nil
+}
+
+func (t *Tx) ReleaseSavepoint(name string, rollback bool) error {
+	if t.done {
+		return sql.ErrTxDone
+	}
+	for i := len(t.savepoints) - 1; i >= 0; i-- {
+		if t.savepoints[i].name != name {
+			continue
+		}
+		if rollback {
+			t.db.state = t.savepoints[i].state
+		}
+		t.savepoints = t.savepoints[:i]
+		return nil
+	}
+	return fmt.Errorf("savepoint %q does not exist", name)
+}
+
+func (t *Tx) Notify(channel, payload string) error {
+	if t.done {
+		return sql.ErrTxDone
+	}
+	t.notifications = append(t.notifications, [2]string{channel, payload})
+	return nil
+}
+
+func (t *Tx) Commit() error {
+	if t.done {
+		return sql.ErrTxDone
+	}
+	t.done = true
+
+	t.store.mu.Lock()
+	t.store.committed = t.db.state
+	for _, n := range t.notifications {
+		t.store.notifications[n[0]] = append(t.store.notifications[n[0]], n[1])
+	}
+	t.store.mu.Unlock()
+
+	t.store.writer.Unlock()
+	return nil
+}
+
+func (t *Tx) Rollback() error {
+	if t.done {
+		return nil
+	}
+	t.done = true
+	t.store.writer.Unlock()
+	return nil
+}
+
+// db runs repository calls either inside a transaction (tx set) or on their
+// own against the committed state.
+type db struct {
+	store *Store
+	tx    *Tx
+	state *state
+	now   time.Time
+}
+
+// read runs fn against the data visible to the caller.
+func (d *db) read(fn func(st *state) error) error {
+	if d.tx != nil {
+		if d.tx.done {
+			return sql.ErrTxDone
+		}
+		return fn(d.state)
+	}
+	d.store.mu.RLock()
+	defer d.store.mu.RUnlock()
+	return fn(d.store.committed)
+}
+
+// write runs fn against the data visible to the caller with the time of the
+// statement. Outside a transaction fn works on a copy that is committed only
+// when fn succeeds, like a single statement in autocommit mode.
+func (d *db) write(fn func(st *state, now time.Time) error) error {
+	if d.tx != nil {
+		if d.tx.done {
+			return sql.ErrTxDone
+		}
+		return fn(d.state, d.now)
+	}
+
+	d.store.writer.Lock()
+	defer d.store.writer.Unlock()
+
+	d.store.mu.RLock()
+	working := d.store.committed.clone()
+	d.store.mu.RUnlock()
+
+	if err := fn(working, d.store.now()); err != nil {
+		return err
+	}
+
+	d.store.mu.Lock()
+	d.store.committed = working
+	d.store.mu.Unlock()
+	return nil
+}
+
+// repoSet hands out the repositories over one db.
+type repoSet struct {
+	db *db
+}
+
+func (r repoSet) Products() repositories.ProductStore {
+	return &productRepo{db: r.db}
+}
+
+func (r repoSet) Locations() repositories.LocationStore {
+	return &locationRepo{db: r.db}
+}
+
+func (r repoSet) StockMovements() repositories.StockMovementStore {
+	return &movementRepo{db: r.db}
+}
+
+func (r repoSet) CostLayers() repositories.CostLayerStore {
+	return &costLayerRepo{db: r.db}
+}
+
+func (r repoSet) Snapshots() repositories.StockSnapshotStore {
+	return &snapshotRepo{db: r.db}
+}
+
+func (r repoSet) Reconciliation() repositories.ReconciliationStore {
+	return &reconciliationRepo{db: r.db}
+}
+
+func (r repoSet) Outbox() repositories.OutboxStore {
+	return &outboxRepo{db: r.db}
+}
+
+func (r repoSet) Webhooks() repositories.WebhookStore {
+	return &webhookRepo{db: r.db}
+}
+
+// uniqueViolation is the error Postgres reports for a duplicate key.
+func uniqueViolation(constraint string) error {
+	return fmt.Errorf("duplicate key value violates unique constraint %q", constraint)
+}
+
+// numeric rounds v to the NUMERIC(18,4) columns costs are stored in.
+func numeric(v float64) float64 {
+	return math.Round(v*10000) / 10000
+}
+
+// signed is a movement's effect on the balance.
+func signed(m *models.StockMovement) int {
+	if m.Type == "IN" {
+		return m.Quantity
+	}
+	return -m.Quantity
+}
+
+func containsInt(values []int, v int) bool {
+	for _, value := range values {
+		if value == v {
+			return true
+		}
+	}
+	return false
+}
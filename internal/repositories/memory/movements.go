@@ -0,0 +1,344 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+	"warehouse-api/internal/models"
+	"warehouse-api/internal/repositories"
+)
+
+type movementRepo struct {
+	db *db
+}
+
+func (st *state) movement(id int) *models.StockMovement {
+	for _, m := range st.movements {
+		if m.ID == id {
+			return m
+		}
+	}
+	return nil
+}
+
+// chronological returns the movements ordered by created_at, then id.
+func (st *state) chronological() []*models.StockMovement {
+	movements := append([]*models.StockMovement(nil), st.movements...)
+	sort.SliceStable(movements, func(i, j int) bool {
+		if c := movements[i].CreatedAt.Compare(movements[j].CreatedAt); c != 0 {
+			return c < 0
+		}
+		return movements[i].ID < movements[j].ID
+	})
+	return movements
+}
+
+func (r *movementRepo) Create(ctx context.Context, movement *models.StockMovement) error {
+	return r.db.write(func(st *state, now time.Time) error {
+		if movement.Type != "IN" && movement.Type != "OUT" {
+			return fmt.Errorf("new row for relation \"stock_movements\" violates check constraint \"stock_movements_type_check\"")
+		}
+		if movement.Quantity <= 0 {
+			return fmt.Errorf("new row for relation \"stock_movements\" violates check constraint \"stock_movements_quantity_check\"")
+		}
+		if movement.ReversalOf != nil {
+			for _, m := range st.movements {
+				if m.ReversalOf != nil && *m.ReversalOf == *movement.ReversalOf {
+					return uniqueViolation("idx_stock_movements_reversal_of")
+				}
+			}
+		}
+
+		movement.ID = r.db.store.nextID("stock_movements")
+		movement.CreatedAt = now
+		stored := clone(movement)
+		stored.UnitCost = numeric(stored.UnitCost)
+		stored.TotalCost = numeric(stored.TotalCost)
+		stored.AverageCost = numeric(stored.AverageCost)
+		stored.ReversedAt = nil
+		stored.ReversedBy = ""
+		stored.ReversalReason = ""
+		st.movements = append(st.movements, stored)
+		return nil
+	})
+}
+
+func (r *movementRepo) GetByID(ctx context.Context, id int) (*models.StockMovement, error) {
+	var movement *models.StockMovement
+	err := r.db.read(func(st *state) error {
+		movement = clone(st.movement(id))
+		return nil
+	})
+	return movement, err
+}
+
+// GetByIDForUpdate needs no lock of its own: the open transaction already
+// excludes every other writer.
+func (r *movementRepo) GetByIDForUpdate(ctx context.Context, id int) (*models.StockMovement, error) {
+	return r.GetByID(ctx, id)
+}
+
+func (r *movementRepo) MarkReversed(ctx context.Context, movement *models.StockMovement) error {
+	return r.db.write(func(st *state, now time.Time) error {
+		if stored := st.movement(movement.ID); stored != nil {
+			stored.ReversedAt = clone(movement.ReversedAt)
+			stored.ReversedBy = movement.ReversedBy
+			stored.ReversalReason = movement.ReversalReason
+		}
+		return nil
+	})
+}
+
+// matchMovement applies every filter but pagination, like
+// movementFilterClause.
+func matchMovement(filter *models.StockMovementFilter, start, end *time.Time, m *models.StockMovement) bool {
+	switch {
+	case len(filter.ProductIDs) > 0 && !containsInt(filter.ProductIDs, m.ProductID),
+		len(filter.LocationIDs) > 0 && !containsInt(filter.LocationIDs, m.LocationID),
+		filter.Type != nil && m.Type != *filter.Type,
+		filter.Source != "" && m.Source != filter.Source,
+		filter.CreatedBy != "" && m.CreatedBy != filter.CreatedBy,
+		filter.Reference != "" && m.Reference != filter.Reference,
+		filter.MinQuantity != nil && m.Quantity < *filter.MinQuantity,
+		filter.MaxQuantity != nil && m.Quantity > *filter.MaxQuantity,
+		start != nil && m.CreatedAt.Before(*start),
+		end != nil && m.CreatedAt.After(*end):
+		return false
+	}
+	return true
+}
+
+// filterDates parses the date bounds of filter the way Postgres casts them to
+// timestamps.
+func filterDates(filter *models.StockMovementFilter) (start, end *time.Time, err error) {
+	if filter.StartDate != nil {
+		if start, err = parseTimestamp(*filter.StartDate); err != nil {
+			return nil, nil, err
+		}
+	}
+	if filter.EndDate != nil {
+		if end, err = parseTimestamp(*filter.EndDate); err != nil {
+			return nil, nil, err
+		}
+	}
+	return start, end, nil
+}
+
+var timestampLayouts = []string{time.RFC3339Nano, "2006-01-02T15:04:05.999999", "2006-01-02 15:04:05.999999", "2006-01-02"}
+
+func parseTimestamp(value string) (*time.Time, error) {
+	for _, layout := range timestampLayouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return &t, nil
+		}
+	}
+	return nil, fmt.Errorf("invalid input syntax for type timestamp: %q", value)
+}
+
+func (r *movementRepo) GetAll(ctx context.Context, filter *models.StockMovementFilter) ([]*models.StockMovement, *models.CursorPagination, error) {
+	start, end, err := filterDates(filter)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	movements := []*models.StockMovement{}
+	err = r.db.read(func(st *state) error {
+		for _, m := range st.movements {
+			if matchMovement(filter, start, end, m) {
+				movements = append(movements, clone(m))
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return repositories.PageStockMovements(movements, filter.PageRequest)
+}
+
+func (r *movementRepo) GetStockCard(ctx context.Context, productID int, locationID *int, start, end *time.Time) ([]*models.StockCardEntry, error) {
+	entries := []*models.StockCardEntry{}
+	err := r.db.read(func(st *state) error {
+		balance := 0
+		for _, m := range st.chronological() {
+			if m.ProductID != productID ||
+				(locationID != nil && m.LocationID != *locationID) ||
+				(start != nil && m.CreatedAt.Before(*start)) ||
+				(end != nil && m.CreatedAt.After(*end)) {
+				continue
+			}
+			balance += signed(m)
+			entries = append(entries, &models.StockCardEntry{
+				MovementID: m.ID,
+				LocationID: m.LocationID,
+				Type:       m.Type,
+				Quantity:   m.Quantity,
+				Balance:    balance,
+				CreatedAt:  m.CreatedAt,
+			})
+		}
+		return nil
+	})
+	return entries, err
+}
+
+func (r *movementRepo) Stream(ctx context.Context, filter *models.StockMovementFilter, fn func(movement *models.StockMovement, skuName, locationCode string) error) error {
+	start, end, err := filterDates(filter)
+	if err != nil {
+		return err
+	}
+
+	type row struct {
+		movement              *models.StockMovement
+		skuName, locationCode string
+	}
+	var rows []row
+	err = r.db.read(func(st *state) error {
+		for _, m := range st.chronological() {
+			if !matchMovement(filter, start, end, m) {
+				continue
+			}
+			rw := row{movement: clone(m)}
+			if p := st.product(m.ProductID); p != nil {
+				rw.skuName = p.SKUName
+			}
+			if l := st.location(m.LocationID); l != nil {
+				rw.locationCode = l.Code
+			}
+			rows = append(rows, rw)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, rw := range rows {
+		if err := fn(rw.movement, rw.skuName, rw.locationCode); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// balances returns the non-zero balances of the movements match accepts per
+// product and location.
+func (st *state) balances(match func(m *models.StockMovement) bool) []*models.StockBalanceLine {
+	totals := map[balanceKey]int{}
+	for _, m := range st.movements {
+		if match(m) {
+			totals[balanceKey{m.ProductID, m.LocationID}] += signed(m)
+		}
+	}
+	return st.balanceLines(totals)
+}
+
+// balanceKey identifies the balance of one product at one location.
+type balanceKey struct {
+	productID, locationID int
+}
+
+// balanceLines turns non-zero totals into lines ordered by product then
+// location, leaving out products and locations that no longer exist as the
+// SQL join does.
+func (st *state) balanceLines(totals map[balanceKey]int) []*models.StockBalanceLine {
+	var lines []*models.StockBalanceLine
+	for k, quantity := range totals {
+		p, l := st.product(k.productID), st.location(k.locationID)
+		if quantity == 0 || p == nil || l == nil {
+			continue
+		}
+		lines = append(lines, &models.StockBalanceLine{
+			ProductID:    p.ID,
+			SKUName:      p.SKUName,
+			LocationID:   l.ID,
+			LocationCode: l.Code,
+			LocationName: l.Name,
+			Quantity:     quantity,
+		})
+	}
+	sortBalances(lines)
+	return lines
+}
+
+func sortBalances(lines []*models.StockBalanceLine) {
+	sort.Slice(lines, func(i, j int) bool {
+		if lines[i].ProductID != lines[j].ProductID {
+			return lines[i].ProductID < lines[j].ProductID
+		}
+		return lines[i].LocationID < lines[j].LocationID
+	})
+}
+
+func (r *movementRepo) collectBalances(match func(m *models.StockMovement) bool) ([]*models.StockBalanceLine, error) {
+	var lines []*models.StockBalanceLine
+	err := r.db.read(func(st *state) error {
+		lines = st.balances(match)
+		return nil
+	})
+	return lines, err
+}
+
+func (r *movementRepo) StreamBalances(ctx context.Context, fn func(line *models.StockBalanceLine) error) error {
+	lines, err := r.collectBalances(func(*models.StockMovement) bool { return true })
+	if err != nil {
+		return err
+	}
+	for _, line := range lines {
+		if err := fn(line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *movementRepo) GetBalancesByProducts(ctx context.Context, productIDs []int) ([]*models.StockBalanceLine, error) {
+	return r.collectBalances(func(m *models.StockMovement) bool { return containsInt(productIDs, m.ProductID) })
+}
+
+func (r *movementRepo) GetBalancesByLocations(ctx context.Context, locationIDs []int) ([]*models.StockBalanceLine, error) {
+	return r.collectBalances(func(m *models.StockMovement) bool { return containsInt(locationIDs, m.LocationID) })
+}
+
+func (r *movementRepo) GetBalance(ctx context.Context, productID, locationID int) (int, error) {
+	balance := 0
+	err := r.db.read(func(st *state) error {
+		for _, m := range st.movements {
+			if m.ProductID == productID && m.LocationID == locationID {
+				balance += signed(m)
+			}
+		}
+		return nil
+	})
+	return balance, err
+}
+
+func (r *movementRepo) GetRecentByProducts(ctx context.Context, productIDs []int, limit int) ([]*models.StockMovement, error) {
+	var movements []*models.StockMovement
+	err := r.db.read(func(st *state) error {
+		chronological := st.chronological()
+		for _, productID := range sortedUnique(productIDs) {
+			taken := 0
+			for i := len(chronological) - 1; i >= 0 && taken < limit; i-- {
+				if m := chronological[i]; m.ProductID == productID {
+					movements = append(movements, clone(m))
+					taken++
+				}
+			}
+		}
+		return nil
+	})
+	return movements, err
+}
+
+func sortedUnique(ids []int) []int {
+	var unique []int
+	for _, id := range ids {
+		if !containsInt(unique, id) {
+			unique = append(unique, id)
+		}
+	}
+	sort.Ints(unique)
+	return unique
+}
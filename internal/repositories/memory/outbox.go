@@ -0,0 +1,109 @@
+package memory
+
+import (
+	"context"
+	"time"
+	"warehouse-api/internal/models"
+)
+
+type outboxRepo struct {
+	db *db
+}
+
+func (r *outboxRepo) Create(ctx context.Context, event *models.Event, payload []byte) error {
+	return r.db.write(func(st *state, now time.Time) error {
+		for _, e := range st.outbox {
+			if e.EventID == event.ID {
+				return uniqueViolation("outbox_events_event_id_key")
+			}
+		}
+		st.outbox = append(st.outbox, &models.OutboxEvent{
+			ID:            int64(r.db.store.nextID("outbox_events")),
+			EventID:       event.ID,
+			EventType:     event.Type,
+			AggregateType: event.AggregateType,
+			AggregateID:   event.AggregateID,
+			Payload:       append([]byte(nil), payload...),
+			CreatedAt:     now,
+		})
+		return nil
+	})
+}
+
+// LockUnpublished needs no lock of its own: the open transaction already
+// excludes every other relay.
+func (r *outboxRepo) LockUnpublished(ctx context.Context, limit int) ([]*models.OutboxEvent, error) {
+	return r.find(limit, func(e *models.OutboxEvent) bool { return e.PublishedAt == nil })
+}
+
+func (r *outboxRepo) MarkPublished(ctx context.Context, ids []int64) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	return r.db.write(func(st *state, now time.Time) error {
+		for _, e := range st.outbox {
+			for _, id := range ids {
+				if e.ID == id && e.PublishedAt == nil {
+					publishedAt := now
+					e.PublishedAt = &publishedAt
+				}
+			}
+		}
+		return nil
+	})
+}
+
+// AssignPositions positions events in ID order, which is also the order they
+// committed in, since transactions are serialised.
+func (r *outboxRepo) AssignPositions(ctx context.Context, limit int) (int, error) {
+	n := 0
+	err := r.db.write(func(st *state, now time.Time) error {
+		var last int64
+		for _, e := range st.outbox {
+			if e.Position != nil && *e.Position > last {
+				last = *e.Position
+			}
+		}
+		for _, e := range st.outbox {
+			if n == limit {
+				break
+			}
+			if e.Position == nil {
+				last++
+				position := last
+				e.Position = &position
+				n++
+			}
+		}
+		return nil
+	})
+	return n, err
+}
+
+// GetAfter relies on positions being assigned in ID order, so events stored
+// in ID order are also in position order.
+func (r *outboxRepo) GetAfter(ctx context.Context, afterPosition int64, limit int, aggregateType string, aggregateID *int) ([]*models.OutboxEvent, error) {
+	return r.find(limit, func(e *models.OutboxEvent) bool {
+		return e.Position != nil && *e.Position > afterPosition &&
+			(aggregateType == "" || e.AggregateType == aggregateType) &&
+			(aggregateID == nil || e.AggregateID == *aggregateID)
+	})
+}
+
+// find returns up to limit events match accepts in ID order, which is the
+// order they are stored in.
+func (r *outboxRepo) find(limit int, match func(e *models.OutboxEvent) bool) ([]*models.OutboxEvent, error) {
+	var events []*models.OutboxEvent
+	err := r.db.read(func(st *state) error {
+		for _, e := range st.outbox {
+			if len(events) == limit {
+				break
+			}
+			if match(e) {
+				events = append(events, clone(e))
+			}
+		}
+		return nil
+	})
+	return events, err
+}
@@ -0,0 +1,172 @@
+package memory
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+	"warehouse-api/internal/models"
+	"warehouse-api/internal/repositories"
+)
+
+type productRepo struct {
+	db *db
+}
+
+func (st *state) product(id int) *models.Product {
+	for _, p := range st.products {
+		if p.ID == id {
+			return p
+		}
+	}
+	return nil
+}
+
+func checkCostingMethod(method string) error {
+	if method != models.CostingFIFO && method != models.CostingAVG {
+		return fmt.Errorf("new row for relation \"products\" violates check constraint \"products_costing_method_check\"")
+	}
+	return nil
+}
+
+func (r *productRepo) Create(ctx context.Context, product *models.Product) error {
+	return r.db.write(func(st *state, now time.Time) error {
+		for _, p := range st.products {
+			if p.SKUName == product.SKUName {
+				return uniqueViolation("products_sku_name_key")
+			}
+		}
+		if err := checkCostingMethod(product.CostingMethod); err != nil {
+			return err
+		}
+
+		product.ID = r.db.store.nextID("products")
+		product.CreatedAt = now
+		product.UpdatedAt = now
+		st.products = append(st.products, &models.Product{
+			ID:            product.ID,
+			SKUName:       product.SKUName,
+			Quantity:      product.Quantity,
+			CostingMethod: product.CostingMethod,
+			ReorderLevel:  product.ReorderLevel,
+			CreatedAt:     now,
+			UpdatedAt:     now,
+		})
+		return nil
+	})
+}
+
+func (r *productRepo) GetByID(ctx context.Context, id int) (*models.Product, error) {
+	var product *models.Product
+	err := r.db.read(func(st *state) error {
+		product = clone(st.product(id))
+		return nil
+	})
+	return product, err
+}
+
+// GetByIDForUpdate needs no lock of its own: the open transaction already
+// excludes every other writer.
+func (r *productRepo) GetByIDForUpdate(ctx context.Context, id int) (*models.Product, error) {
+	return r.GetByID(ctx, id)
+}
+
+func (r *productRepo) GetBySKU(ctx context.Context, skuName string) (*models.Product, error) {
+	var product *models.Product
+	err := r.db.read(func(st *state) error {
+		for _, p := range st.products {
+			if p.SKUName == skuName {
+				product = clone(p)
+			}
+		}
+		return nil
+	})
+	return product, err
+}
+
+func (r *productRepo) GetByIDs(ctx context.Context, ids []int) ([]*models.Product, error) {
+	var products []*models.Product
+	err := r.db.read(func(st *state) error {
+		for _, p := range st.products {
+			if containsInt(ids, p.ID) {
+				products = append(products, clone(p))
+			}
+		}
+		return nil
+	})
+	sort.Slice(products, func(i, j int) bool { return products[i].ID < products[j].ID })
+	return products, err
+}
+
+func (r *productRepo) GetAll(ctx context.Context, filter *models.ProductFilter) ([]*models.Product, *models.CursorPagination, error) {
+	products := []*models.Product{}
+	err := r.db.read(func(st *state) error {
+		for _, p := range st.products {
+			if len(filter.IDs) > 0 && !containsInt(filter.IDs, p.ID) {
+				continue
+			}
+			if filter.Search != "" && !containsFold(p.SKUName, filter.Search) {
+				continue
+			}
+			if filter.CostingMethod != "" && p.CostingMethod != filter.CostingMethod {
+				continue
+			}
+			if filter.MinQuantity != nil && p.Quantity < *filter.MinQuantity {
+				continue
+			}
+			if filter.MaxQuantity != nil && p.Quantity > *filter.MaxQuantity {
+				continue
+			}
+			products = append(products, clone(p))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return repositories.PageProducts(products, filter.PageRequest)
+}
+
+func (r *productRepo) Update(ctx context.Context, product *models.Product) error {
+	return r.db.write(func(st *state, now time.Time) error {
+		for _, p := range st.products {
+			if p.SKUName == product.SKUName && p.ID != product.ID {
+				return uniqueViolation("products_sku_name_key")
+			}
+		}
+		if err := checkCostingMethod(product.CostingMethod); err != nil {
+			return err
+		}
+
+		stored := st.product(product.ID)
+		if stored == nil {
+			return sql.ErrNoRows
+		}
+		stored.SKUName = product.SKUName
+		stored.Quantity = product.Quantity
+		stored.CostingMethod = product.CostingMethod
+		stored.ReorderLevel = product.ReorderLevel
+		stored.UpdatedAt = now
+		product.UpdatedAt = now
+		return nil
+	})
+}
+
+func (r *productRepo) UpdateStock(ctx context.Context, id int, quantity int, averageCost float64) error {
+	return r.db.write(func(st *state, now time.Time) error {
+		if stored := st.product(id); stored != nil {
+			stored.Quantity = quantity
+			stored.AverageCost = numeric(averageCost)
+			stored.UpdatedAt = now
+		}
+		return nil
+	})
+}
+
+// containsFold reports whether substr is within s ignoring case, like ILIKE
+// '%substr%'.
+func containsFold(s, substr string) bool {
+	return strings.Contains(strings.ToLower(s), strings.ToLower(substr))
+}
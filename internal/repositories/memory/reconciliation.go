@@ -0,0 +1,118 @@
+package memory
+
+import (
+	"context"
+	"sort"
+	"warehouse-api/internal/models"
+)
+
+type reconciliationRepo struct {
+	db *db
+}
+
+func (r *reconciliationRepo) GetProductDrift(ctx context.Context) ([]*models.Discrepancy, error) {
+	var discrepancies []*models.Discrepancy
+	err := r.db.read(func(st *state) error {
+		ledger := map[int]int{}
+		for _, m := range st.movements {
+			ledger[m.ProductID] += signed(m)
+		}
+		for _, p := range st.products {
+			if p.Quantity == ledger[p.ID] {
+				continue
+			}
+			productID := p.ID
+			discrepancies = append(discrepancies, &models.Discrepancy{
+				Kind:       models.DiscrepancyProductQuantity,
+				ProductID:  &productID,
+				SKUName:    p.SKUName,
+				Stored:     p.Quantity,
+				Ledger:     ledger[p.ID],
+				Difference: p.Quantity - ledger[p.ID],
+			})
+		}
+		return nil
+	})
+	return discrepancies, err
+}
+
+func (r *reconciliationRepo) GetNegativeBalances(ctx context.Context) ([]*models.Discrepancy, error) {
+	var discrepancies []*models.Discrepancy
+	err := r.db.read(func(st *state) error {
+		for _, line := range st.balances(func(*models.StockMovement) bool { return true }) {
+			if line.Quantity >= 0 {
+				continue
+			}
+			productID, locationID := line.ProductID, line.LocationID
+			discrepancies = append(discrepancies, &models.Discrepancy{
+				Kind:         models.DiscrepancyLocationBalance,
+				ProductID:    &productID,
+				SKUName:      line.SKUName,
+				LocationID:   &locationID,
+				LocationCode: line.LocationCode,
+				Ledger:       line.Quantity,
+				Difference:   -line.Quantity,
+			})
+		}
+		return nil
+	})
+	return discrepancies, err
+}
+
+func (r *reconciliationRepo) GetOverCapacity(ctx context.Context) ([]*models.Discrepancy, error) {
+	var discrepancies []*models.Discrepancy
+	err := r.db.read(func(st *state) error {
+		for _, l := range st.locations {
+			usage := st.usage(l.ID)
+			if usage <= l.Capacity {
+				continue
+			}
+			locationID := l.ID
+			discrepancies = append(discrepancies, &models.Discrepancy{
+				Kind:         models.DiscrepancyLocationCapacity,
+				LocationID:   &locationID,
+				LocationCode: l.Code,
+				Stored:       l.Capacity,
+				Ledger:       usage,
+				Difference:   l.Capacity - usage,
+			})
+		}
+		return nil
+	})
+	return discrepancies, err
+}
+
+// GetProductBalances orders the balances largest first, then by location.
+func (r *reconciliationRepo) GetProductBalances(ctx context.Context, productID int) ([]*models.StockBalanceLine, error) {
+	var lines []*models.StockBalanceLine
+	err := r.db.read(func(st *state) error {
+		totals := map[int]int{}
+		for _, m := range st.movements {
+			if m.ProductID == productID {
+				totals[m.LocationID] += signed(m)
+			}
+		}
+		for locationID, quantity := range totals {
+			l := st.location(locationID)
+			if quantity == 0 || l == nil {
+				continue
+			}
+			lines = append(lines, &models.StockBalanceLine{
+				ProductID:    productID,
+				LocationID:   l.ID,
+				LocationCode: l.Code,
+				LocationName: l.Name,
+				Quantity:     quantity,
+			})
+		}
+		return nil
+	})
+
+	sort.Slice(lines, func(i, j int) bool {
+		if lines[i].Quantity != lines[j].Quantity {
+			return lines[i].Quantity > lines[j].Quantity
+		}
+		return lines[i].LocationID < lines[j].LocationID
+	})
+	return lines, err
+}
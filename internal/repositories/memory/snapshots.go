@@ -0,0 +1,111 @@
+package memory
+
+import (
+	"context"
+	"sort"
+	"time"
+	"warehouse-api/internal/models"
+)
+
+type snapshotRepo struct {
+	db *db
+}
+
+// ledger sums the lines of snapshot snapshotID, taken at snapshotAt, and the
+// movements after it up to asOf, per product and location. match narrows
+// both.
+func (st *state) ledger(snapshotID int, snapshotAt, asOf time.Time, match func(productID, locationID int) bool) map[balanceKey]int {
+	totals := map[balanceKey]int{}
+	for _, line := range st.snapshotLines {
+		if line.snapshotID == snapshotID && match(line.productID, line.locationID) {
+			totals[balanceKey{line.productID, line.locationID}] += line.quantity
+		}
+	}
+	for _, m := range st.movements {
+		if m.CreatedAt.After(snapshotAt) && !m.CreatedAt.After(asOf) && match(m.ProductID, m.LocationID) {
+			totals[balanceKey{m.ProductID, m.LocationID}] += signed(m)
+		}
+	}
+	return totals
+}
+
+func snapshotBounds(snapshot *models.StockSnapshot) (int, time.Time) {
+	if snapshot == nil {
+		return 0, time.Time{}
+	}
+	return snapshot.ID, snapshot.TakenAt
+}
+
+func (r *snapshotRepo) Create(ctx context.Context, snapshot *models.StockSnapshot) (bool, error) {
+	created := false
+	err := r.db.write(func(st *state, now time.Time) error {
+		for _, s := range st.snapshots {
+			if s.TakenAt.Equal(snapshot.TakenAt) {
+				return nil
+			}
+		}
+
+		snapshot.ID = r.db.store.nextID("stock_snapshots")
+		snapshot.CreatedAt = now
+		st.snapshots = append(st.snapshots, clone(snapshot))
+		created = true
+		return nil
+	})
+	return created, err
+}
+
+func (r *snapshotRepo) CreateLines(ctx context.Context, snapshot, previous *models.StockSnapshot) error {
+	previousID, previousAt := snapshotBounds(previous)
+	return r.db.write(func(st *state, now time.Time) error {
+		totals := st.ledger(previousID, previousAt, snapshot.TakenAt, func(int, int) bool { return true })
+		for k, quantity := range totals {
+			if quantity != 0 {
+				st.snapshotLines = append(st.snapshotLines, &snapshotLine{
+					snapshotID: snapshot.ID,
+					productID:  k.productID,
+					locationID: k.locationID,
+					quantity:   quantity,
+				})
+			}
+		}
+		return nil
+	})
+}
+
+func (r *snapshotRepo) GetLatest(ctx context.Context, asOf time.Time) (*models.StockSnapshot, error) {
+	var latest *models.StockSnapshot
+	err := r.db.read(func(st *state) error {
+		for _, s := range st.snapshots {
+			if !s.TakenAt.After(asOf) && (latest == nil || s.TakenAt.After(latest.TakenAt)) {
+				latest = s
+			}
+		}
+		latest = clone(latest)
+		return nil
+	})
+	return latest, err
+}
+
+func (r *snapshotRepo) GetAll(ctx context.Context) ([]*models.StockSnapshot, error) {
+	var snapshots []*models.StockSnapshot
+	err := r.db.read(func(st *state) error {
+		snapshots = cloneAll(st.snapshots)
+		return nil
+	})
+	sort.Slice(snapshots, func(i, j int) bool { return snapshots[i].TakenAt.After(snapshots[j].TakenAt) })
+	return snapshots, err
+}
+
+func (r *snapshotRepo) GetBalances(ctx context.Context, snapshot *models.StockSnapshot, asOf time.Time, productID, locationID *int) ([]*models.StockBalanceLine, error) {
+	snapshotID, snapshotAt := snapshotBounds(snapshot)
+	match := func(p, l int) bool {
+		return (productID == nil || *productID == p) && (locationID == nil || *locationID == l)
+	}
+
+	var lines []*models.StockBalanceLine
+	err := r.db.read(func(st *state) error {
+		lines = st.balanceLines(st.ledger(snapshotID, snapshotAt, asOf, match))
+		return nil
+	})
+	return lines, err
+}
@@ -0,0 +1,228 @@
+package memory
+
+import (
+	"context"
+	"sort"
+	"time"
+	"warehouse-api/internal/models"
+)
+
+type webhookRepo struct {
+	db *db
+}
+
+func (st *state) subscription(id int) *models.WebhookSubscription {
+	for _, s := range st.subscriptions {
+		if s.ID == id {
+			return s
+		}
+	}
+	return nil
+}
+
+func (st *state) delivery(id int) *models.WebhookDelivery {
+	for _, d := range st.deliveries {
+		if d.ID == id {
+			return d
+		}
+	}
+	return nil
+}
+
+func (r *webhookRepo) CreateSubscription(ctx context.Context, subscription *models.WebhookSubscription) error {
+	return r.db.write(func(st *state, now time.Time) error {
+		subscription.ID = r.db.store.nextID("webhook_subscriptions")
+		subscription.CreatedAt = now
+		stored := clone(subscription)
+		stored.EventTypes = append([]string(nil), subscription.EventTypes...)
+		st.subscriptions = append(st.subscriptions, stored)
+		return nil
+	})
+}
+
+func (r *webhookRepo) GetSubscriptions(ctx context.Context) ([]*models.WebhookSubscription, error) {
+	var subscriptions []*models.WebhookSubscription
+	err := r.db.read(func(st *state) error {
+		for _, s := range st.subscriptions {
+			subscription := clone(s)
+			subscription.Secret = ""
+			subscription.EventTypes = append([]string(nil), s.EventTypes...)
+			subscriptions = append(subscriptions, subscription)
+		}
+		return nil
+	})
+	return subscriptions, err
+}
+
+// DeleteSubscription cascades to the subscription's deliveries.
+func (r *webhookRepo) DeleteSubscription(ctx context.Context, id int) (bool, error) {
+	found := false
+	err := r.db.write(func(st *state, now time.Time) error {
+		if st.subscription(id) == nil {
+			return nil
+		}
+		found = true
+
+		var subscriptions []*models.WebhookSubscription
+		for _, s := range st.subscriptions {
+			if s.ID != id {
+				subscriptions = append(subscriptions, s)
+			}
+		}
+		var deliveries []*models.WebhookDelivery
+		for _, d := range st.deliveries {
+			if d.SubscriptionID != id {
+				deliveries = append(deliveries, d)
+			}
+		}
+		st.subscriptions, st.deliveries = subscriptions, deliveries
+		return nil
+	})
+	return found, err
+}
+
+func (r *webhookRepo) CreateDeliveries(ctx context.Context, event *models.Event, payload []byte, traceParent string) error {
+	return r.db.write(func(st *state, now time.Time) error {
+		for _, s := range st.subscriptions {
+			subscribed := false
+			for _, eventType := range s.EventTypes {
+				subscribed = subscribed || eventType == event.Type
+			}
+			if !subscribed {
+				continue
+			}
+			st.deliveries = append(st.deliveries, &models.WebhookDelivery{
+				ID:             r.db.store.nextID("webhook_deliveries"),
+				SubscriptionID: s.ID,
+				EventID:        event.ID,
+				EventType:      event.Type,
+				Payload:        append([]byte(nil), payload...),
+				Status:         models.WebhookDeliveryPending,
+				NextAttemptAt:  now,
+				CreatedAt:      now,
+				TraceParent:    traceParent,
+			})
+		}
+		return nil
+	})
+}
+
+// ClaimDue needs no SKIP LOCKED: the claim is a single write, so no other
+// worker can claim the same deliveries in between.
+func (r *webhookRepo) ClaimDue(ctx context.Context, limit int, lease time.Duration) ([]*models.WebhookDelivery, error) {
+	var deliveries []*models.WebhookDelivery
+	err := r.db.write(func(st *state, now time.Time) error {
+		var due []*models.WebhookDelivery
+		for _, d := range st.deliveries {
+			if d.Status == models.WebhookDeliveryPending && !d.NextAttemptAt.After(now) {
+				due = append(due, d)
+			}
+		}
+		sort.SliceStable(due, func(i, j int) bool {
+			if c := due[i].NextAttemptAt.Compare(due[j].NextAttemptAt); c != 0 {
+				return c < 0
+			}
+			return due[i].ID < due[j].ID
+		})
+		if len(due) > limit {
+			due = due[:limit]
+		}
+
+		for _, d := range due {
+			s := st.subscription(d.SubscriptionID)
+			if s == nil {
+				continue
+			}
+			d.NextAttemptAt = now.Add(lease).Truncate(time.Microsecond)
+			claimed := clone(d)
+			claimed.URL = s.URL
+			claimed.Secret = s.Secret
+			deliveries = append(deliveries, claimed)
+		}
+		return nil
+	})
+	return deliveries, err
+}
+
+func (r *webhookRepo) MarkDelivered(ctx context.Context, id, statusCode int) error {
+	return r.db.write(func(st *state, now time.Time) error {
+		if d := st.delivery(id); d != nil {
+			deliveredAt := now
+			d.Status = models.WebhookDeliveryDelivered
+			d.Attempts++
+			d.LastStatusCode = &statusCode
+			d.LastError = ""
+			d.DeliveredAt = &deliveredAt
+		}
+		return nil
+	})
+}
+
+func (r *webhookRepo) MarkFailed(ctx context.Context, id int, statusCode *int, lastError string, nextAttemptAt *time.Time) error {
+	return r.db.write(func(st *state, now time.Time) error {
+		d := st.delivery(id)
+		if d == nil {
+			return nil
+		}
+		d.Status = models.WebhookDeliveryPending
+		if nextAttemptAt == nil {
+			d.Status = models.WebhookDeliveryDead
+		} else {
+			d.NextAttemptAt = nextAttemptAt.UTC().Truncate(time.Microsecond)
+		}
+		d.Attempts++
+		d.LastStatusCode = clone(statusCode)
+		d.LastError = lastError
+		return nil
+	})
+}
+
+func (r *webhookRepo) Redeliver(ctx context.Context, id int) (*models.WebhookDelivery, error) {
+	var delivery *models.WebhookDelivery
+	err := r.db.write(func(st *state, now time.Time) error {
+		d := st.delivery(id)
+		if d == nil {
+			return nil
+		}
+		d.Status = models.WebhookDeliveryPending
+		d.Attempts = 0
+		d.NextAttemptAt = now
+		d.DeliveredAt = nil
+		delivery = clone(d)
+		return nil
+	})
+	return delivery, err
+}
+
+// GetDeliveries returns one page of the deliveries matching filter, newest
+// first, and the total number matching.
+func (r *webhookRepo) GetDeliveries(ctx context.Context, filter *models.WebhookDeliveryFilter) ([]*models.WebhookDelivery, int, error) {
+	var matching []*models.WebhookDelivery
+	err := r.db.read(func(st *state) error {
+		for i := len(st.deliveries) - 1; i >= 0; i-- {
+			d := st.deliveries[i]
+			if filter.SubscriptionID != nil && d.SubscriptionID != *filter.SubscriptionID {
+				continue
+			}
+			if filter.Status != "" && d.Status != filter.Status {
+				continue
+			}
+			matching = append(matching, clone(d))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+
+	total := len(matching)
+	offset := (filter.Page - 1) * filter.Limit
+	if offset > total {
+		offset = total
+	}
+	end := offset + filter.Limit
+	if end > total {
+		end = total
+	}
+	return matching[offset:end], total, nil
+}
@@ -0,0 +1,132 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"warehouse-api/internal/models"
+)
+
+const outboxColumns = `id, position, event_id, event_type, aggregate_type, aggregate_id, payload, created_at, published_at`
+
+// positionLockID is the advisory lock key AssignPositions holds.
+const positionLockID int64 = 0x77682d706f73
+
+type OutboxRepository struct {
+	db      DBTX
+	dialect dialect
+}
+
+func NewOutboxRepository(db *sql.DB) *OutboxRepository {
+	return &OutboxRepository{db: db}
+}
+
+func (r *OutboxRepository) Create(ctx context.Context, event *models.Event, payload []byte) error {
+	query := `
+		INSERT INTO outbox_events (event_id, event_type, aggregate_type, aggregate_id, payload)
+		VALUES ($1, $2, $3, $4, $5)
+	`
+	_, err := r.db.ExecContext(ctx, query, event.ID, event.Type, event.AggregateType, event.AggregateID, payload)
+	return err
+}
+
+// LockUnpublished returns up to limit unpublished events in the order they
+// were recorded and locks them until the surrounding transaction ends. It
+// deliberately waits on rows another relay holds instead of skipping them, so
+// two relays never publish events of one aggregate out of order.
+func (r *OutboxRepository) LockUnpublished(ctx context.Context, limit int) ([]*models.OutboxEvent, error) {
+	query := `
+		SELECT ` + outboxColumns + ` FROM outbox_events
+		WHERE published_at IS NULL
+		ORDER BY id
+		LIMIT $1
+		` + r.dialect.forUpdate()
+	return r.query(ctx, query, limit)
+}
+
+func (r *OutboxRepository) MarkPublished(ctx context.Context, ids []int64) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	query := `UPDATE outbox_events SET published_at = ` + r.dialect.now() + ` WHERE ` + r.dialect.anyOf("id", "$1") + ` AND published_at IS NULL`
+	_, err := r.db.ExecContext(ctx, query, r.dialect.array(ids))
+	return err
+}
+
+// AssignPositions gives up to limit events without a position the next ones,
+// in ID order, and returns how many it positioned. Only committed events are
+// seen, and on Postgres an advisory lock held until the transaction ends
+// makes every relay's positions commit before the next relay hands out
+// higher ones. Positions therefore become visible in order, so a reader
+// paging by position never passes one that has yet to commit. A SQLite
+// write transaction already excludes every other.
+func (r *OutboxRepository) AssignPositions(ctx context.Context, limit int) (int, error) {
+	if r.dialect == dialectPostgres {
+		if _, err := r.db.ExecContext(ctx, `SELECT pg_advisory_xact_lock($1)`, positionLockID); err != nil {
+			return 0, err
+		}
+	}
+	query := `
+		UPDATE outbox_events SET position = numbered.position
+		FROM (
+			SELECT id, (SELECT COALESCE(MAX(position), 0) FROM outbox_events) + ROW_NUMBER() OVER (ORDER BY id) AS position
+			FROM outbox_events
+			WHERE position IS NULL
+			ORDER BY id
+			LIMIT $1
+		) AS numbered
+		WHERE outbox_events.id = numbered.id
+	`
+	result, err := r.db.ExecContext(ctx, query, limit)
+	if err != nil {
+		return 0, err
+	}
+	n, err := result.RowsAffected()
+	return int(n), err
+}
+
+// GetAfter returns up to limit positioned events with a position above
+// afterPosition, in position order, optionally restricted to one aggregate.
+func (r *OutboxRepository) GetAfter(ctx context.Context, afterPosition int64, limit int, aggregateType string, aggregateID *int) ([]*models.OutboxEvent, error) {
+	whereClause := "WHERE position > $1"
+	args := []interface{}{afterPosition}
+	argIndex := 2
+
+	if aggregateType != "" {
+		whereClause += fmt.Sprintf(" AND aggregate_type = $%d", argIndex)
+		args = append(args, aggregateType)
+		argIndex++
+	}
+	if aggregateID != nil {
+		whereClause += fmt.Sprintf(" AND aggregate_id = $%d", argIndex)
+		args = append(args, *aggregateID)
+		argIndex++
+	}
+
+	query := `SELECT ` + outboxColumns + ` FROM outbox_events ` + whereClause + fmt.Sprintf(" ORDER BY position LIMIT $%d", argIndex)
+	args = append(args, limit)
+	return r.query(ctx, query, args...)
+}
+
+func (r *OutboxRepository) query(ctx context.Context, query string, args ...interface{}) ([]*models.OutboxEvent, error) {
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []*models.OutboxEvent
+	for rows.Next() {
+		event := &models.OutboxEvent{}
+		err := rows.Scan(
+			&event.ID, &event.Position, &event.EventID, &event.EventType, &event.AggregateType, &event.AggregateID,
+			&event.Payload, &event.CreatedAt, &event.PublishedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, event)
+	}
+
+	return events, rows.Err()
+}
@@ -0,0 +1,48 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+)
+
+var (
+	_ ProductStore        = (*ProductRepository)(nil)
+	_ LocationStore       = (*LocationRepository)(nil)
+	_ StockMovementStore  = (*StockMovementRepository)(nil)
+	_ CostLayerStore      = (*CostLayerRepository)(nil)
+	_ StockSnapshotStore  = (*StockSnapshotRepository)(nil)
+	_ ReconciliationStore = (*ReconciliationRepository)(nil)
+	_ OutboxStore         = (*OutboxRepository)(nil)
+	_ WebhookStore        = (*WebhookRepository)(nil)
+)
+
+type postgresStore struct {
+	sqlRepositories
+	db *sql.DB
+}
+
+// NewPostgresStore returns a Store backed by db. Its units of work are
+// database transactions at the default isolation level; the row locks taken
+// by the GetByIDForUpdate methods serialise conflicting writers.
+func NewPostgresStore(db *sql.DB) Store {
+	return &postgresStore{sqlRepositories: sqlRepositories{db: dialectPostgres.traced(db)}, db: db}
+}
+
+func (s *postgresStore) Begin(ctx context.Context) (Tx, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &postgresTx{sqlTx{sqlRepositories: sqlRepositories{db: dialectPostgres.traced(tx)}, ctx: ctx, tx: tx}}, nil
+}
+
+type postgresTx struct {
+	sqlTx
+}
+
+// Notify uses pg_notify, which Postgres only delivers once the transaction
+// commits.
+func (t *postgresTx) Notify(channel, payload string) error {
+	_, err := t.tx.ExecContext(t.ctx, `SELECT pg_notify($1, $2)`, channel, payload)
+	return err
+}
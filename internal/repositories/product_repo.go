@@ -1,132 +1,193 @@
 package repositories
 
 import (
+	"context"
 	"database/sql"
+	"fmt"
 	"warehouse-api/internal/models"
 )
 
+const productColumns = `id, sku_name, quantity, costing_method, average_cost, reorder_level, created_at, updated_at`
+
 type ProductRepository struct {
-	db *sql.DB
+	db      DBTX
+	dialect dialect
 }
 
 func NewProductRepository(db *sql.DB) *ProductRepository {
 	return &ProductRepository{db: db}
 }
 
-func (r *ProductRepository) Create(product *models.Product) error {
+func scanProduct(row scanner) (*models.Product, error) {
+	product := &models.Product{}
+	err := row.Scan(
+		&product.ID, &product.SKUName, &product.Quantity,
+		&product.CostingMethod, &product.AverageCost, &product.ReorderLevel,
+		&product.CreatedAt, &product.UpdatedAt,
+	)
+	return product, err
+}
+
+func (r *ProductRepository) Create(ctx context.Context, product *models.Product) error {
 	query := `
-		INSERT INTO products (sku_name, quantity)
-		VALUES ($1, $2)
+		INSERT INTO products (sku_name, quantity, costing_method, reorder_level)
+		VALUES ($1, $2, $3, $4)
 		RETURNING id, created_at, updated_at
 	`
-	err := r.db.QueryRow(query, product.SKUName, product.Quantity).Scan(
+	err := r.db.QueryRowContext(ctx, query, product.SKUName, product.Quantity, product.CostingMethod, product.ReorderLevel).Scan(
 		&product.ID, &product.CreatedAt, &product.UpdatedAt,
 	)
 	return err
 }
 
-func (r *ProductRepository) GetByID(id int) (*models.Product, error) {
-	product := &models.Product{}
-	query := `SELECT id, sku_name, quantity, created_at, updated_at FROM products WHERE id = $1`
-	err := r.db.QueryRow(query, id).Scan(
-		&product.ID, &product.SKUName, &product.Quantity,
-		&product.CreatedAt, &product.UpdatedAt,
-	)
+func (r *ProductRepository) GetByID(ctx context.Context, id int) (*models.Product, error) {
+	query := `SELECT ` + productColumns + ` FROM products WHERE id = $1`
+	product, err := scanProduct(r.db.QueryRowContext(ctx, query, id))
 	if err == sql.ErrNoRows {
 		return nil, nil
 	}
 	return product, err
 }
 
-func (r *ProductRepository) GetBySKU(skuName string) (*models.Product, error) {
-	product := &models.Product{}
-	query := `SELECT id, sku_name, quantity, created_at, updated_at FROM products WHERE sku_name = $1`
-	err := r.db.QueryRow(query, skuName).Scan(
-		&product.ID, &product.SKUName, &product.Quantity,
-		&product.CreatedAt, &product.UpdatedAt,
-	)
+// GetByIDForUpdate locks the product row until the surrounding transaction
+// ends, so concurrent movements on the same product are serialised.
+func (r *ProductRepository) GetByIDForUpdate(ctx context.Context, id int) (*models.Product, error) {
+	query := `SELECT ` + productColumns + ` FROM products WHERE id = $1 ` + r.dialect.forUpdate()
+	product, err := scanProduct(r.db.QueryRowContext(ctx, query, id))
 	if err == sql.ErrNoRows {
 		return nil, nil
 	}
 	return product, err
 }
 
-func (r *ProductRepository) GetAll(page, limit int, search string) ([]*models.Product, int, error) {
-	offset := (page - 1) * limit
-	var products []*models.Product
-	var total int
+func (r *ProductRepository) GetBySKU(ctx context.Context, skuName string) (*models.Product, error) {
+	query := `SELECT ` + productColumns + ` FROM products WHERE sku_name = $1`
+	product, err := scanProduct(r.db.QueryRowContext(ctx, query, skuName))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return product, err
+}
 
-	// Count total
-	countQuery := `SELECT COUNT(*) FROM products`
-	if search != "" {
-		countQuery += ` WHERE sku_name ILIKE $1`
-		err := r.db.QueryRow(countQuery, "%"+search+"%").Scan(&total)
-		if err != nil {
-			return nil, 0, err
-		}
-	} else {
-		err := r.db.QueryRow(countQuery).Scan(&total)
-		if err != nil {
-			return nil, 0, err
-		}
+// GetByIDs returns the products among ids in one query. IDs that do not
+// exist are left out.
+func (r *ProductRepository) GetByIDs(ctx context.Context, ids []int) ([]*models.Product, error) {
+	query := `SELECT ` + productColumns + ` FROM products WHERE ` + r.dialect.anyOf("id", "$1") + ` ORDER BY id`
+	rows, err := r.db.QueryContext(ctx, query, r.dialect.array(ids))
+	if err != nil {
+		return nil, err
 	}
+	defer rows.Close()
 
-	// Get products
-	query := `SELECT id, sku_name, quantity, created_at, updated_at FROM products`
-	if search != "" {
-		query += ` WHERE sku_name ILIKE $1`
-		query += ` ORDER BY id DESC LIMIT $2 OFFSET $3`
-		rows, err := r.db.Query(query, "%"+search+"%", limit, offset)
+	var products []*models.Product
+	for rows.Next() {
+		product, err := scanProduct(rows)
 		if err != nil {
-			return nil, 0, err
+			return nil, err
 		}
-		defer rows.Close()
-
-		for rows.Next() {
-			product := &models.Product{}
-			err := rows.Scan(&product.ID, &product.SKUName, &product.Quantity,
-				&product.CreatedAt, &product.UpdatedAt)
-			if err != nil {
-				return nil, 0, err
-			}
-			products = append(products, product)
-		}
-	} else {
-		query += ` ORDER BY id DESC LIMIT $1 OFFSET $2`
-		rows, err := r.db.Query(query, limit, offset)
+		products = append(products, product)
+	}
+	return products, rows.Err()
+}
+
+// productKeyset lists the fields products may be sorted by, newest first by
+// default.
+var productKeyset = &keyset[*models.Product]{
+	fields: map[string]sortField[*models.Product]{
+		"id":         {column: "id", kind: sortInt, value: func(p *models.Product) interface{} { return p.ID }},
+		"sku_name":   {column: "sku_name", kind: sortString, value: func(p *models.Product) interface{} { return p.SKUName }},
+		"quantity":   {column: "quantity", kind: sortInt, value: func(p *models.Product) interface{} { return p.Quantity }},
+		"created_at": {column: "created_at", kind: sortTime, value: func(p *models.Product) interface{} { return p.CreatedAt }},
+		"updated_at": {column: "updated_at", kind: sortTime, value: func(p *models.Product) interface{} { return p.UpdatedAt }},
+	},
+	idColumn:    "id",
+	id:          func(p *models.Product) int { return p.ID },
+	defaultSort: "-id",
+}
+
+// GetAll returns one page of the products matching filter, ordered by
+// filter.Sort and starting after filter.Cursor.
+func (r *ProductRepository) GetAll(ctx context.Context, filter *models.ProductFilter) ([]*models.Product, *models.CursorPagination, error) {
+	page, err := productKeyset.page(filter.PageRequest)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	whereClause := "WHERE 1=1"
+	args := []interface{}{}
+
+	if len(filter.IDs) > 0 {
+		args = append(args, r.dialect.array(filter.IDs))
+		whereClause += " AND " + r.dialect.anyOf("id", fmt.Sprintf("$%d", len(args)))
+	}
+	if filter.Search != "" {
+		args = append(args, "%"+filter.Search+"%")
+		whereClause += fmt.Sprintf(" AND sku_name %s $%d", r.dialect.ilike(), len(args))
+	}
+	if filter.CostingMethod != "" {
+		args = append(args, filter.CostingMethod)
+		whereClause += fmt.Sprintf(" AND costing_method = $%d", len(args))
+	}
+	if filter.MinQuantity != nil {
+		args = append(args, *filter.MinQuantity)
+		whereClause += fmt.Sprintf(" AND quantity >= $%d", len(args))
+	}
+	if filter.MaxQuantity != nil {
+		args = append(args, *filter.MaxQuantity)
+		whereClause += fmt.Sprintf(" AND quantity <= $%d", len(args))
+	}
+
+	var after, orderBy string
+	after, args = page.where(args)
+	if after != "" {
+		whereClause += " AND " + after
+	}
+	orderBy, args = page.orderBy(args)
+
+	query := `SELECT ` + productColumns + ` FROM products ` + whereClause + ` ` + orderBy
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	products := []*models.Product{}
+	for rows.Next() {
+		product, err := scanProduct(rows)
 		if err != nil {
-			return nil, 0, err
-		}
-		defer rows.Close()
-
-		for rows.Next() {
-			product := &models.Product{}
-			err := rows.Scan(&product.ID, &product.SKUName, &product.Quantity,
-				&product.CreatedAt, &product.UpdatedAt)
-			if err != nil {
-				return nil, 0, err
-			}
-			products = append(products, product)
+			return nil, nil, err
 		}
+		products = append(products, product)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
 	}
 
-	return products, total, nil
+	products, pagination := page.finish(products)
+	return products, pagination, nil
 }
 
-func (r *ProductRepository) Update(product *models.Product) error {
+func (r *ProductRepository) Update(ctx context.Context, product *models.Product) error {
 	query := `
 		UPDATE products
-		SET sku_name = $1, quantity = $2, updated_at = CURRENT_TIMESTAMP
-		WHERE id = $3
+		SET sku_name = $1, quantity = $2, costing_method = $3, reorder_level = $4, updated_at = ` + r.dialect.now() + `
+		WHERE id = $5
 		RETURNING updated_at
 	`
-	err := r.db.QueryRow(query, product.SKUName, product.Quantity, product.ID).Scan(&product.UpdatedAt)
+	err := r.db.QueryRowContext(ctx, query, product.SKUName, product.Quantity, product.CostingMethod, product.ReorderLevel, product.ID).Scan(&product.UpdatedAt)
 	return err
 }
 
-func (r *ProductRepository) UpdateQuantity(id int, quantity int) error {
-	query := `UPDATE products SET quantity = $1, updated_at = CURRENT_TIMESTAMP WHERE id = $2`
-	_, err := r.db.Exec(query, quantity, id)
+func (r *ProductRepository) UpdateQuantity(ctx context.Context, id int, quantity int) error {
+	query := `UPDATE products SET quantity = $1, updated_at = ` + r.dialect.now() + ` WHERE id = $2`
+	_, err := r.db.ExecContext(ctx, query, quantity, id)
 	return err
 }
 
+// UpdateStock stores the on-hand quantity together with the moving-average
+// unit cost produced by a stock movement.
+func (r *ProductRepository) UpdateStock(ctx context.Context, id int, quantity int, averageCost float64) error {
+	query := `UPDATE products SET quantity = $1, average_cost = $2, updated_at = ` + r.dialect.now() + ` WHERE id = $3`
+	_, err := r.db.ExecContext(ctx, query, quantity, averageCost, id)
+	return err
+}
@@ -0,0 +1,148 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"warehouse-api/internal/models"
+)
+
+// ReconciliationRepository compares stored figures with the stock ledger.
+type ReconciliationRepository struct {
+	db DBTX
+}
+
+func NewReconciliationRepository(db *sql.DB) *ReconciliationRepository {
+	return &ReconciliationRepository{db: db}
+}
+
+// GetProductDrift returns every product whose stored quantity differs from
+// its ledger balance.
+func (r *ReconciliationRepository) GetProductDrift(ctx context.Context) ([]*models.Discrepancy, error) {
+	query := `
+		SELECT p.id, p.sku_name, p.quantity, COALESCE(ledger.quantity, 0)
+		FROM products p
+		LEFT JOIN (
+			SELECT product_id, SUM(CASE WHEN type = 'IN' THEN quantity ELSE -quantity END) AS quantity
+			FROM stock_movements
+			GROUP BY product_id
+		) ledger ON ledger.product_id = p.id
+		WHERE p.quantity <> COALESCE(ledger.quantity, 0)
+		ORDER BY p.id
+	`
+	rows, err := r.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var discrepancies []*models.Discrepancy
+	for rows.Next() {
+		d := &models.Discrepancy{Kind: models.DiscrepancyProductQuantity}
+		var productID int
+		if err := rows.Scan(&productID, &d.SKUName, &d.Stored, &d.Ledger); err != nil {
+			return nil, err
+		}
+		d.ProductID = &productID
+		d.Difference = d.Stored - d.Ledger
+		discrepancies = append(discrepancies, d)
+	}
+
+	return discrepancies, rows.Err()
+}
+
+// GetNegativeBalances returns every product and location whose ledger
+// balance is below zero.
+func (r *ReconciliationRepository) GetNegativeBalances(ctx context.Context) ([]*models.Discrepancy, error) {
+	query := `
+		SELECT p.id, p.sku_name, l.id, l.code, SUM(CASE WHEN sm.type = 'IN' THEN sm.quantity ELSE -sm.quantity END)
+		FROM stock_movements sm
+		JOIN products p ON p.id = sm.product_id
+		JOIN locations l ON l.id = sm.location_id
+		GROUP BY p.id, p.sku_name, l.id, l.code
+		HAVING SUM(CASE WHEN sm.type = 'IN' THEN sm.quantity ELSE -sm.quantity END) < 0
+		ORDER BY p.id, l.id
+	`
+	rows, err := r.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var discrepancies []*models.Discrepancy
+	for rows.Next() {
+		d := &models.Discrepancy{Kind: models.DiscrepancyLocationBalance}
+		var productID, locationID int
+		if err := rows.Scan(&productID, &d.SKUName, &locationID, &d.LocationCode, &d.Ledger); err != nil {
+			return nil, err
+		}
+		d.ProductID = &productID
+		d.LocationID = &locationID
+		d.Difference = d.Stored - d.Ledger
+		discrepancies = append(discrepancies, d)
+	}
+
+	return discrepancies, rows.Err()
+}
+
+// GetOverCapacity returns every location whose ledger usage exceeds its
+// capacity. Stored holds the capacity.
+func (r *ReconciliationRepository) GetOverCapacity(ctx context.Context) ([]*models.Discrepancy, error) {
+	query := `
+		SELECT l.id, l.code, l.capacity, SUM(CASE WHEN sm.type = 'IN' THEN sm.quantity ELSE -sm.quantity END)
+		FROM locations l
+		JOIN stock_movements sm ON sm.location_id = l.id
+		GROUP BY l.id, l.code, l.capacity
+		HAVING SUM(CASE WHEN sm.type = 'IN' THEN sm.quantity ELSE -sm.quantity END) > l.capacity
+		ORDER BY l.id
+	`
+	rows, err := r.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var discrepancies []*models.Discrepancy
+	for rows.Next() {
+		d := &models.Discrepancy{Kind: models.DiscrepancyLocationCapacity}
+		var locationID int
+		if err := rows.Scan(&locationID, &d.LocationCode, &d.Stored, &d.Ledger); err != nil {
+			return nil, err
+		}
+		d.LocationID = &locationID
+		d.Difference = d.Stored - d.Ledger
+		discrepancies = append(discrepancies, d)
+	}
+
+	return discrepancies, rows.Err()
+}
+
+// GetProductBalances returns the non-zero ledger balances of a product per
+// location, largest first.
+func (r *ReconciliationRepository) GetProductBalances(ctx context.Context, productID int) ([]*models.StockBalanceLine, error) {
+	query := `
+		SELECT l.id, l.code, l.name, SUM(CASE WHEN sm.type = 'IN' THEN sm.quantity ELSE -sm.quantity END) AS quantity
+		FROM stock_movements sm
+		JOIN locations l ON l.id = sm.location_id
+		WHERE sm.product_id = $1
+		GROUP BY l.id, l.code, l.name
+		HAVING SUM(CASE WHEN sm.type = 'IN' THEN sm.quantity ELSE -sm.quantity END) <> 0
+		ORDER BY quantity DESC, l.id
+	`
+	rows, err := r.db.QueryContext(ctx, query, productID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var lines []*models.StockBalanceLine
+	for rows.Next() {
+		line := &models.StockBalanceLine{ProductID: productID}
+		err := rows.Scan(&line.LocationID, &line.LocationCode, &line.LocationName, &line.Quantity)
+		if err != nil {
+			return nil, err
+		}
+		lines = append(lines, line)
+	}
+
+	return lines, rows.Err()
+}
@@ -0,0 +1,181 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+	"math"
+	"sync"
+	"time"
+)
+
+// The SQLite schema stores timestamps as UTC text with millisecond precision,
+// the form strftime's %f produces, so they sort and compare correctly as text.
+const (
+	sqliteTimeLayout   = "%Y-%m-%d %H:%M:%f"
+	sqliteGoTimeLayout = "2006-01-02 15:04:05.000"
+	sqliteNow          = "strftime('" + sqliteTimeLayout + "', 'now')"
+)
+
+// sqliteDB binds arguments the way the SQLite schema stores them: times as
+// text in sqliteGoTimeLayout, and floats rounded to four decimal places as a
+// Postgres NUMERIC(18,4) column would round them. Every float the
+// repositories bind is such a value.
+type sqliteDB struct {
+	db DBTX
+}
+
+func (s sqliteDB) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	return s.db.ExecContext(ctx, query, sqliteArgs(args)...)
+}
+
+func (s sqliteDB) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	return s.db.QueryContext(ctx, query, sqliteArgs(args)...)
+}
+
+func (s sqliteDB) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	return s.db.QueryRowContext(ctx, query, sqliteArgs(args)...)
+}
+
+func sqliteArgs(args []interface{}) []interface{} {
+	converted := make([]interface{}, len(args))
+	for i, arg := range args {
+		switch v := arg.(type) {
+		case time.Time:
+			converted[i] = v.UTC().Format(sqliteGoTimeLayout)
+		case *time.Time:
+			if v != nil {
+				converted[i] = v.UTC().Format(sqliteGoTimeLayout)
+			}
+		case float64:
+			converted[i] = math.Round(v*10000) / 10000
+		default:
+			converted[i] = arg
+		}
+	}
+	return converted
+}
+
+// sqliteListenerBuffer is how many notifications a listener may fall behind
+// before further ones are dropped.
+const sqliteListenerBuffer = 256
+
+// SQLiteStore is a Store backed by a SQLite database, for sites that cannot
+// run Postgres. The database must be opened with _txlock=immediate, as
+// config.ConnectDB does: every unit of work then holds the database's single
+// write lock from its start, which serialises writers the way the Postgres
+// row locks do.
+type SQLiteStore struct {
+	sqlRepositories
+	db *sql.DB
+
+	mu        sync.Mutex
+	listeners map[string][]chan string
+}
+
+func NewSQLiteStore(db *sql.DB) *SQLiteStore {
+	return &SQLiteStore{
+		sqlRepositories: sqlRepositories{db: dialectSQLite.traced(sqliteDB{db: db}), dialect: dialectSQLite},
+		db:              db,
+		listeners:       map[string][]chan string{},
+	}
+}
+
+func (s *SQLiteStore) Begin(ctx context.Context) (Tx, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &sqliteTx{
+		sqlTx: sqlTx{sqlRepositories: sqlRepositories{db: dialectSQLite.traced(sqliteDB{db: tx}), dialect: dialectSQLite}, ctx: ctx, tx: tx},
+		store: s,
+	}, nil
+}
+
+// Listen returns a channel that receives the payload of every notification
+// sent on channel once its unit of work commits. SQLite has no LISTEN/NOTIFY,
+// so only this store's units of work are heard; a SQLite database belongs to
+// a single process. When the listener falls behind, notifications are
+// dropped, as Postgres drops those sent while a listener is disconnected.
+func (s *SQLiteStore) Listen(channel string) <-chan string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	listener := make(chan string, sqliteListenerBuffer)
+	s.listeners[channel] = append(s.listeners[channel], listener)
+	return listener
+}
+
+func (s *SQLiteStore) deliver(notifications []notification) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, n := range notifications {
+		for _, listener := range s.listeners[n.channel] {
+			select {
+			case listener <- n.payload:
+			default:
+				slog.Warn("Dropped notification: listener is behind", slog.String("channel", n.channel))
+			}
+		}
+	}
+}
+
+type notification struct {
+	channel string
+	payload string
+}
+
+type sqliteTx struct {
+	sqlTx
+	store         *SQLiteStore
+	notifications []notification
+	savepoints    []sqliteSavepoint
+}
+
+// sqliteSavepoint remembers how many notifications were queued when a
+// savepoint was taken, so rolling back to it drops the later ones.
+type sqliteSavepoint struct {
+	name          string
+	notifications int
+}
+
+func (t *sqliteTx) Savepoint(name string) error {
+	if err := t.sqlTx.Savepoint(name); err != nil {
+		return err
+	}
+	t.savepoints = append(t.savepoints, sqliteSavepoint{name: name, notifications: len(t.notifications)})
+	return nil
+}
+
+func (t *sqliteTx) ReleaseSavepoint(name string, rollback bool) error {
+	if err := t.sqlTx.ReleaseSavepoint(name, rollback); err != nil {
+		return err
+	}
+	for i := len(t.savepoints) - 1; i >= 0; i-- {
+		if t.savepoints[i].name != name {
+			continue
+		}
+		if rollback {
+			t.notifications = t.notifications[:t.savepoints[i].notifications]
+		}
+		t.savepoints = t.savepoints[:i]
+		break
+	}
+	return nil
+}
+
+// Notify queues the notification until the unit of work commits.
+func (t *sqliteTx) Notify(channel, payload string) error {
+	t.notifications = append(t.notifications, notification{channel: channel, payload: payload})
+	return nil
+}
+
+func (t *sqliteTx) Commit() error {
+	if err := t.tx.Commit(); err != nil {
+		return err
+	}
+	t.store.deliver(t.notifications)
+	t.notifications = nil
+	return nil
+}
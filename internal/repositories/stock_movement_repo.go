@@ -1,104 +1,386 @@
 package repositories
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
+	"time"
 	"warehouse-api/internal/models"
 )
 
+const stockMovementColumns = `id, product_id, location_id, type, quantity, unit_cost, total_cost, average_cost,
+	source, reference, note, created_by, created_at,
+	reversal_of, reversed_at, reversed_by, reversal_reason`
+
 type StockMovementRepository struct {
-	db *sql.DB
+	db      DBTX
+	dialect dialect
 }
 
 func NewStockMovementRepository(db *sql.DB) *StockMovementRepository {
 	return &StockMovementRepository{db: db}
 }
 
-func (r *StockMovementRepository) Create(movement *models.StockMovement) error {
+func scanStockMovement(row scanner) (*models.StockMovement, error) {
+	movement := &models.StockMovement{}
+	err := row.Scan(
+		&movement.ID, &movement.ProductID, &movement.LocationID,
+		&movement.Type, &movement.Quantity,
+		&movement.UnitCost, &movement.TotalCost, &movement.AverageCost,
+		&movement.Source, &movement.Reference, &movement.Note, &movement.CreatedBy,
+		&movement.CreatedAt,
+		&movement.ReversalOf, &movement.ReversedAt, &movement.ReversedBy, &movement.ReversalReason,
+	)
+	return movement, err
+}
+
+func (r *StockMovementRepository) Create(ctx context.Context, movement *models.StockMovement) error {
 	query := `
-		INSERT INTO stock_movements (product_id, location_id, type, quantity)
-		VALUES ($1, $2, $3, $4)
+		INSERT INTO stock_movements (
+			product_id, location_id, type, quantity, unit_cost, total_cost, average_cost,
+			source, reference, note, created_by, reversal_of
+		)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
 		RETURNING id, created_at
 	`
-	err := r.db.QueryRow(query, movement.ProductID, movement.LocationID, movement.Type, movement.Quantity).Scan(
-		&movement.ID, &movement.CreatedAt,
-	)
+	err := r.db.QueryRowContext(ctx, query,
+		movement.ProductID, movement.LocationID, movement.Type, movement.Quantity,
+		movement.UnitCost, movement.TotalCost, movement.AverageCost,
+		movement.Source, movement.Reference, movement.Note, movement.CreatedBy,
+		movement.ReversalOf,
+	).Scan(&movement.ID, &movement.CreatedAt)
 	return err
 }
 
-func (r *StockMovementRepository) GetAll(filter *models.StockMovementFilter) ([]*models.StockMovement, int, error) {
-	var movements []*models.StockMovement
-	var total int
+func (r *StockMovementRepository) GetByID(ctx context.Context, id int) (*models.StockMovement, error) {
+	query := `SELECT ` + stockMovementColumns + ` FROM stock_movements WHERE id = $1`
+	movement, err := scanStockMovement(r.db.QueryRowContext(ctx, query, id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return movement, err
+}
+
+// GetByIDForUpdate locks the movement row until the surrounding transaction
+// ends, so two reversals of the same movement cannot both succeed.
+func (r *StockMovementRepository) GetByIDForUpdate(ctx context.Context, id int) (*models.StockMovement, error) {
+	query := `SELECT ` + stockMovementColumns + ` FROM stock_movements WHERE id = $1 ` + r.dialect.forUpdate()
+	movement, err := scanStockMovement(r.db.QueryRowContext(ctx, query, id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return movement, err
+}
 
-	// Build WHERE clause
+// MarkReversed records on the original movement who reversed it, when and why.
+func (r *StockMovementRepository) MarkReversed(ctx context.Context, movement *models.StockMovement) error {
+	query := `
+		UPDATE stock_movements
+		SET reversed_at = $1, reversed_by = $2, reversal_reason = $3
+		WHERE id = $4
+	`
+	_, err := r.db.ExecContext(ctx, query, movement.ReversedAt, movement.ReversedBy, movement.ReversalReason, movement.ID)
+	return err
+}
+
+// filterClause builds the WHERE clause and arguments for filter. The columns
+// are unqualified so the clause also works inside a subquery.
+func (r *StockMovementRepository) filterClause(filter *models.StockMovementFilter) (string, []interface{}) {
 	whereClause := "WHERE 1=1"
 	args := []interface{}{}
-	argIndex := 1
 
-	if filter.ProductID != nil {
-		whereClause += ` AND product_id = $` + fmt.Sprintf("%d", argIndex)
-		args = append(args, *filter.ProductID)
-		argIndex++
+	if len(filter.ProductIDs) > 0 {
+		args = append(args, r.dialect.array(filter.ProductIDs))
+		whereClause += " AND " + r.dialect.anyOf("product_id", fmt.Sprintf("$%d", len(args)))
 	}
-	if filter.LocationID != nil {
-		whereClause += ` AND location_id = $` + fmt.Sprintf("%d", argIndex)
-		args = append(args, *filter.LocationID)
-		argIndex++
+	if len(filter.LocationIDs) > 0 {
+		args = append(args, r.dialect.array(filter.LocationIDs))
+		whereClause += " AND " + r.dialect.anyOf("location_id", fmt.Sprintf("$%d", len(args)))
 	}
 	if filter.Type != nil {
-		whereClause += ` AND type = $` + fmt.Sprintf("%d", argIndex)
 		args = append(args, *filter.Type)
-		argIndex++
+		whereClause += fmt.Sprintf(" AND type = $%d", len(args))
+	}
+	if filter.Source != "" {
+		args = append(args, filter.Source)
+		whereClause += fmt.Sprintf(" AND source = $%d", len(args))
+	}
+	if filter.CreatedBy != "" {
+		args = append(args, filter.CreatedBy)
+		whereClause += fmt.Sprintf(" AND created_by = $%d", len(args))
+	}
+	if filter.Reference != "" {
+		args = append(args, filter.Reference)
+		whereClause += fmt.Sprintf(" AND reference = $%d", len(args))
+	}
+	if filter.MinQuantity != nil {
+		args = append(args, *filter.MinQuantity)
+		whereClause += fmt.Sprintf(" AND quantity >= $%d", len(args))
+	}
+	if filter.MaxQuantity != nil {
+		args = append(args, *filter.MaxQuantity)
+		whereClause += fmt.Sprintf(" AND quantity <= $%d", len(args))
 	}
 	if filter.StartDate != nil {
-		whereClause += ` AND created_at >= $` + fmt.Sprintf("%d", argIndex)
 		args = append(args, *filter.StartDate)
-		argIndex++
+		whereClause += " AND created_at >= " + r.dialect.timestamp(fmt.Sprintf("$%d", len(args)))
 	}
 	if filter.EndDate != nil {
-		whereClause += ` AND created_at <= $` + fmt.Sprintf("%d", argIndex)
 		args = append(args, *filter.EndDate)
-		argIndex++
+		whereClause += " AND created_at <= " + r.dialect.timestamp(fmt.Sprintf("$%d", len(args)))
+	}
+
+	return whereClause, args
+}
+
+// movementKeyset lists the fields movements may be sorted by, newest first by
+// default.
+var movementKeyset = &keyset[*models.StockMovement]{
+	fields: map[string]sortField[*models.StockMovement]{
+		"id":         {column: "id", kind: sortInt, value: func(m *models.StockMovement) interface{} { return m.ID }},
+		"quantity":   {column: "quantity", kind: sortInt, value: func(m *models.StockMovement) interface{} { return m.Quantity }},
+		"created_at": {column: "created_at", kind: sortTime, value: func(m *models.StockMovement) interface{} { return m.CreatedAt }},
+	},
+	idColumn:    "id",
+	id:          func(m *models.StockMovement) int { return m.ID },
+	defaultSort: "-created_at",
+}
+
+// GetAll returns one page of the movements matching filter, ordered by
+// filter.Sort and starting after filter.Cursor. Movements inserted while a
+// client pages through the list never shift the later pages.
+func (r *StockMovementRepository) GetAll(ctx context.Context, filter *models.StockMovementFilter) ([]*models.StockMovement, *models.CursorPagination, error) {
+	page, err := movementKeyset.page(filter.PageRequest)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	whereClause, args := r.filterClause(filter)
+
+	var after, orderBy string
+	after, args = page.where(args)
+	if after != "" {
+		whereClause += " AND " + after
 	}
+	orderBy, args = page.orderBy(args)
 
-	// Count total
-	countQuery := `SELECT COUNT(*) FROM stock_movements ` + whereClause
-	err := r.db.QueryRow(countQuery, args...).Scan(&total)
+	query := `SELECT ` + stockMovementColumns + ` FROM stock_movements ` + whereClause + ` ` + orderBy
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	movements := []*models.StockMovement{}
+	for rows.Next() {
+		movement, err := scanStockMovement(rows)
+		if err != nil {
+			return nil, nil, err
+		}
+		movements = append(movements, movement)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	movements, pagination := page.finish(movements)
+	return movements, pagination, nil
+}
+
+// GetStockCard lists a product's movements in chronological order. Balance
+// holds the running total of the listed movements only; callers add the
+// opening balance.
+func (r *StockMovementRepository) GetStockCard(ctx context.Context, productID int, locationID *int, start, end *time.Time) ([]*models.StockCardEntry, error) {
+	whereClause := "WHERE product_id = $1"
+	args := []interface{}{productID}
+
+	if locationID != nil {
+		args = append(args, *locationID)
+		whereClause += fmt.Sprintf(" AND location_id = $%d", len(args))
+	}
+	if start != nil {
+		args = append(args, *start)
+		whereClause += fmt.Sprintf(" AND created_at >= $%d", len(args))
+	}
+	if end != nil {
+		args = append(args, *end)
+		whereClause += fmt.Sprintf(" AND created_at <= $%d", len(args))
+	}
+
+	query := `
+		SELECT id, location_id, type, quantity,
+			SUM(CASE WHEN type = 'IN' THEN quantity ELSE -quantity END) OVER (ORDER BY created_at, id),
+			created_at
+		FROM stock_movements ` + whereClause + `
+		ORDER BY created_at, id
+	`
+	rows, err := r.db.QueryContext(ctx, query, args...)
 	if err != nil {
-		return nil, 0, err
+		return nil, err
 	}
+	defer rows.Close()
 
-	// Get movements
-	offset := (filter.Page - 1) * filter.Limit
-	limitArgs := []interface{}{}
-	limitArgs = append(limitArgs, args...)
-	limitArgs = append(limitArgs, filter.Limit, offset)
-	
-	query := `SELECT id, product_id, location_id, type, quantity, created_at 
-			  FROM stock_movements ` + whereClause + ` ORDER BY created_at DESC LIMIT $` + fmt.Sprintf("%d", argIndex) + ` OFFSET $` + fmt.Sprintf("%d", argIndex+1)
+	entries := []*models.StockCardEntry{}
+	for rows.Next() {
+		entry := &models.StockCardEntry{}
+		err := rows.Scan(
+			&entry.MovementID, &entry.LocationID, &entry.Type,
+			&entry.Quantity, &entry.Balance, &entry.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
 
-	rows, err := r.db.Query(query, limitArgs...)
+	return entries, rows.Err()
+}
+
+// Stream calls fn for every movement matching filter, oldest first, along
+// with the product SKU and location code. Rows are read one at a time so the
+// result set is never held in memory; returning an error from fn stops the
+// iteration.
+func (r *StockMovementRepository) Stream(ctx context.Context, filter *models.StockMovementFilter, fn func(movement *models.StockMovement, skuName, locationCode string) error) error {
+	whereClause, args := r.filterClause(filter)
+	query := `
+		SELECT m.*, COALESCE(p.sku_name, ''), COALESCE(l.code, '')
+		FROM (SELECT ` + stockMovementColumns + ` FROM stock_movements ` + whereClause + `) m
+		LEFT JOIN products p ON p.id = m.product_id
+		LEFT JOIN locations l ON l.id = m.location_id
+		ORDER BY m.created_at, m.id
+	`
+	rows, err := r.db.QueryContext(ctx, query, args...)
 	if err != nil {
-		return nil, 0, err
+		return err
 	}
 	defer rows.Close()
 
 	for rows.Next() {
 		movement := &models.StockMovement{}
+		var skuName, locationCode string
 		err := rows.Scan(
 			&movement.ID, &movement.ProductID, &movement.LocationID,
-			&movement.Type, &movement.Quantity, &movement.CreatedAt,
+			&movement.Type, &movement.Quantity,
+			&movement.UnitCost, &movement.TotalCost, &movement.AverageCost,
+			&movement.Source, &movement.Reference, &movement.Note, &movement.CreatedBy,
+			&movement.CreatedAt,
+			&movement.ReversalOf, &movement.ReversedAt, &movement.ReversedBy, &movement.ReversalReason,
+			&skuName, &locationCode,
 		)
 		if err != nil {
-			return nil, 0, err
-			}
-		movements = append(movements, movement)
+			return err
+		}
+		if err := fn(movement, skuName, locationCode); err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
+
+// StreamBalances calls fn for every product and location with a non-zero
+// ledger balance, ordered by product then location.
+func (r *StockMovementRepository) StreamBalances(ctx context.Context, fn func(line *models.StockBalanceLine) error) error {
+	return r.streamBalances(ctx, "", nil, fn)
+}
+
+// GetBalancesByProducts returns the non-zero balances of the products among
+// productIDs at every location, in one query.
+func (r *StockMovementRepository) GetBalancesByProducts(ctx context.Context, productIDs []int) ([]*models.StockBalanceLine, error) {
+	return r.collectBalances(ctx, "WHERE "+r.dialect.anyOf("sm.product_id", "$1"), r.dialect.array(productIDs))
+}
+
+// GetBalancesByLocations returns the non-zero balances of every product at
+// the locations among locationIDs, in one query.
+func (r *StockMovementRepository) GetBalancesByLocations(ctx context.Context, locationIDs []int) ([]*models.StockBalanceLine, error) {
+	return r.collectBalances(ctx, "WHERE "+r.dialect.anyOf("sm.location_id", "$1"), r.dialect.array(locationIDs))
+}
+
+func (r *StockMovementRepository) collectBalances(ctx context.Context, where string, args ...interface{}) ([]*models.StockBalanceLine, error) {
+	var lines []*models.StockBalanceLine
+	err := r.streamBalances(ctx, where, args, func(line *models.StockBalanceLine) error {
+		lines = append(lines, line)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return lines, nil
+}
+
+func (r *StockMovementRepository) streamBalances(ctx context.Context, where string, args []interface{}, fn func(line *models.StockBalanceLine) error) error {
+	query := `
+		SELECT p.id, p.sku_name, l.id, l.code, l.name, SUM(CASE WHEN sm.type = 'IN' THEN sm.quantity ELSE -sm.quantity END)
+		FROM stock_movements sm
+		JOIN products p ON p.id = sm.product_id
+		JOIN locations l ON l.id = sm.location_id
+		` + where + `
+		GROUP BY p.id, p.sku_name, l.id, l.code, l.name
+		HAVING SUM(CASE WHEN sm.type = 'IN' THEN sm.quantity ELSE -sm.quantity END) <> 0
+		ORDER BY p.id, l.id
+	`
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return err
 	}
+	defer rows.Close()
 
-	return movements, total, nil
+	for rows.Next() {
+		line := &models.StockBalanceLine{}
+		err := rows.Scan(
+			&line.ProductID, &line.SKUName,
+			&line.LocationID, &line.LocationCode, &line.LocationName,
+			&line.Quantity,
+		)
+		if err != nil {
+			return err
+		}
+		if err := fn(line); err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
 }
 
-func (r *StockMovementRepository) BeginTx() (*sql.Tx, error) {
-	return r.db.Begin()
+// GetBalance returns the ledger balance of a product at one location.
+func (r *StockMovementRepository) GetBalance(ctx context.Context, productID, locationID int) (int, error) {
+	query := `
+		SELECT COALESCE(SUM(CASE WHEN type = 'IN' THEN quantity ELSE -quantity END), 0)
+		FROM stock_movements
+		WHERE product_id = $1 AND location_id = $2
+	`
+	var balance int
+	err := r.db.QueryRowContext(ctx, query, productID, locationID).Scan(&balance)
+	return balance, err
 }
 
+// GetRecentByProducts returns up to limit of the latest movements of each
+// product among productIDs, newest first, in one query.
+func (r *StockMovementRepository) GetRecentByProducts(ctx context.Context, productIDs []int, limit int) ([]*models.StockMovement, error) {
+	query := `
+		SELECT ` + stockMovementColumns + `
+		FROM (
+			SELECT *, ROW_NUMBER() OVER (PARTITION BY product_id ORDER BY created_at DESC, id DESC) AS rank
+			FROM stock_movements
+			WHERE ` + r.dialect.anyOf("product_id", "$1") + `
+		) m
+		WHERE rank <= $2
+		ORDER BY product_id, created_at DESC, id DESC
+	`
+	rows, err := r.db.QueryContext(ctx, query, r.dialect.array(productIDs), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var movements []*models.StockMovement
+	for rows.Next() {
+		movement, err := scanStockMovement(rows)
+		if err != nil {
+			return nil, err
+		}
+		movements = append(movements, movement)
+	}
+	return movements, rows.Err()
+}
@@ -0,0 +1,153 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+	"warehouse-api/internal/models"
+)
+
+type StockSnapshotRepository struct {
+	db DBTX
+}
+
+func NewStockSnapshotRepository(db *sql.DB) *StockSnapshotRepository {
+	return &StockSnapshotRepository{db: db}
+}
+
+// ledgerQuery returns the per product and location ledger deltas that make up
+// the balance at $3: the lines of snapshot $1 (taken at $2) plus every
+// movement after it. extra is appended to both branches as a filter.
+func ledgerQuery(extra string) string {
+	return `
+		SELECT product_id, location_id, quantity
+		FROM stock_snapshot_lines
+		WHERE snapshot_id = $1` + extra + `
+		UNION ALL
+		SELECT product_id, location_id, CASE WHEN type = 'IN' THEN quantity ELSE -quantity END
+		FROM stock_movements
+		WHERE created_at > $2 AND created_at <= $3` + extra
+}
+
+// Create stores a snapshot header. It returns false without error when a
+// snapshot already exists for the same instant.
+func (r *StockSnapshotRepository) Create(ctx context.Context, snapshot *models.StockSnapshot) (bool, error) {
+	query := `
+		INSERT INTO stock_snapshots (taken_at)
+		VALUES ($1)
+		ON CONFLICT (taken_at) DO NOTHING
+		RETURNING id, created_at
+	`
+	err := r.db.QueryRowContext(ctx, query, snapshot.TakenAt).Scan(&snapshot.ID, &snapshot.CreatedAt)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// CreateLines fills snapshot from the previous snapshot (nil for none) plus
+// the movements made between the two.
+func (r *StockSnapshotRepository) CreateLines(ctx context.Context, snapshot, previous *models.StockSnapshot) error {
+	previousID, previousAt := snapshotBounds(previous)
+	query := `
+		INSERT INTO stock_snapshot_lines (snapshot_id, product_id, location_id, quantity)
+		SELECT $4, product_id, location_id, SUM(quantity)
+		FROM (` + ledgerQuery("") + `) ledger
+		GROUP BY product_id, location_id
+		HAVING SUM(quantity) <> 0
+	`
+	_, err := r.db.ExecContext(ctx, query, previousID, previousAt, snapshot.TakenAt, snapshot.ID)
+	return err
+}
+
+// GetLatest returns the most recent snapshot taken at or before asOf.
+func (r *StockSnapshotRepository) GetLatest(ctx context.Context, asOf time.Time) (*models.StockSnapshot, error) {
+	snapshot := &models.StockSnapshot{}
+	query := `
+		SELECT id, taken_at, created_at FROM stock_snapshots
+		WHERE taken_at <= $1
+		ORDER BY taken_at DESC
+		LIMIT 1
+	`
+	err := r.db.QueryRowContext(ctx, query, asOf).Scan(&snapshot.ID, &snapshot.TakenAt, &snapshot.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return snapshot, err
+}
+
+func (r *StockSnapshotRepository) GetAll(ctx context.Context) ([]*models.StockSnapshot, error) {
+	rows, err := r.db.QueryContext(ctx, `SELECT id, taken_at, created_at FROM stock_snapshots ORDER BY taken_at DESC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var snapshots []*models.StockSnapshot
+	for rows.Next() {
+		snapshot := &models.StockSnapshot{}
+		if err := rows.Scan(&snapshot.ID, &snapshot.TakenAt, &snapshot.CreatedAt); err != nil {
+			return nil, err
+		}
+		snapshots = append(snapshots, snapshot)
+	}
+
+	return snapshots, rows.Err()
+}
+
+// GetBalances returns the non-zero ledger balances at asOf, starting from
+// snapshot (nil to replay the whole ledger) and optionally narrowed to a
+// product and/or location.
+func (r *StockSnapshotRepository) GetBalances(ctx context.Context, snapshot *models.StockSnapshot, asOf time.Time, productID, locationID *int) ([]*models.StockBalanceLine, error) {
+	snapshotID, snapshotAt := snapshotBounds(snapshot)
+	args := []interface{}{snapshotID, snapshotAt, asOf}
+
+	filter := ""
+	if productID != nil {
+		args = append(args, *productID)
+		filter += fmt.Sprintf(" AND product_id = $%d", len(args))
+	}
+	if locationID != nil {
+		args = append(args, *locationID)
+		filter += fmt.Sprintf(" AND location_id = $%d", len(args))
+	}
+
+	query := `
+		SELECT p.id, p.sku_name, l.id, l.code, l.name, SUM(ledger.quantity)
+		FROM (` + ledgerQuery(filter) + `) ledger
+		JOIN products p ON p.id = ledger.product_id
+		JOIN locations l ON l.id = ledger.location_id
+		GROUP BY p.id, p.sku_name, l.id, l.code, l.name
+		HAVING SUM(ledger.quantity) <> 0
+		ORDER BY p.id, l.id
+	`
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var lines []*models.StockBalanceLine
+	for rows.Next() {
+		line := &models.StockBalanceLine{}
+		err := rows.Scan(
+			&line.ProductID, &line.SKUName,
+			&line.LocationID, &line.LocationCode, &line.LocationName,
+			&line.Quantity,
+		)
+		if err != nil {
+			return nil, err
+		}
+		lines = append(lines, line)
+	}
+
+	return lines, rows.Err()
+}
+
+func snapshotBounds(snapshot *models.StockSnapshot) (int, time.Time) {
+	if snapshot == nil {
+		return 0, time.Time{}
+	}
+	return snapshot.ID, snapshot.TakenAt
+}
@@ -0,0 +1,141 @@
+package repositories
+
+import (
+	"context"
+	"time"
+	"warehouse-api/internal/models"
+)
+
+// ProductStore persists products.
+type ProductStore interface {
+	Create(ctx context.Context, product *models.Product) error
+	GetByID(ctx context.Context, id int) (*models.Product, error)
+	// GetByIDForUpdate returns the product and holds it until the surrounding
+	// transaction ends, so concurrent movements on it are serialised.
+	GetByIDForUpdate(ctx context.Context, id int) (*models.Product, error)
+	GetBySKU(ctx context.Context, skuName string) (*models.Product, error)
+	GetByIDs(ctx context.Context, ids []int) ([]*models.Product, error)
+	GetAll(ctx context.Context, filter *models.ProductFilter) ([]*models.Product, *models.CursorPagination, error)
+	Update(ctx context.Context, product *models.Product) error
+	UpdateStock(ctx context.Context, id int, quantity int, averageCost float64) error
+}
+
+// LocationStore persists locations and derives their usage from the ledger.
+type LocationStore interface {
+	Create(ctx context.Context, location *models.Location) error
+	GetByID(ctx context.Context, id int) (*models.Location, error)
+	GetByCode(ctx context.Context, code string) (*models.Location, error)
+	// GetByIDForUpdate returns the location and holds it until the
+	// surrounding transaction ends, so concurrent IN movements cannot
+	// overshoot its capacity together.
+	GetByIDForUpdate(ctx context.Context, id int) (*models.Location, error)
+	GetCurrentUsage(ctx context.Context, locationID int) (int, error)
+	GetAll(ctx context.Context, filter *models.LocationFilter) ([]*models.LocationWithUsage, *models.CursorPagination, error)
+	GetWithUsageByIDs(ctx context.Context, ids []int) ([]*models.LocationWithUsage, error)
+	StreamAll(ctx context.Context, fn func(loc *models.LocationWithUsage) error) error
+}
+
+// StockMovementStore persists the stock ledger.
+type StockMovementStore interface {
+	Create(ctx context.Context, movement *models.StockMovement) error
+	GetByID(ctx context.Context, id int) (*models.StockMovement, error)
+	// GetByIDForUpdate returns the movement and holds it until the
+	// surrounding transaction ends, so two reversals of it cannot both
+	// succeed.
+	GetByIDForUpdate(ctx context.Context, id int) (*models.StockMovement, error)
+	MarkReversed(ctx context.Context, movement *models.StockMovement) error
+	GetAll(ctx context.Context, filter *models.StockMovementFilter) ([]*models.StockMovement, *models.CursorPagination, error)
+	GetStockCard(ctx context.Context, productID int, locationID *int, start, end *time.Time) ([]*models.StockCardEntry, error)
+	Stream(ctx context.Context, filter *models.StockMovementFilter, fn func(movement *models.StockMovement, skuName, locationCode string) error) error
+	StreamBalances(ctx context.Context, fn func(line *models.StockBalanceLine) error) error
+	GetBalancesByProducts(ctx context.Context, productIDs []int) ([]*models.StockBalanceLine, error)
+	GetBalancesByLocations(ctx context.Context, locationIDs []int) ([]*models.StockBalanceLine, error)
+	GetBalance(ctx context.Context, productID, locationID int) (int, error)
+	GetRecentByProducts(ctx context.Context, productIDs []int, limit int) ([]*models.StockMovement, error)
+}
+
+// CostLayerStore persists the cost layers IN movements create and OUT
+// movements consume.
+type CostLayerStore interface {
+	Create(ctx context.Context, layer *models.CostLayer) error
+	GetOpen(ctx context.Context, productID int) ([]*models.CostLayer, error)
+	Consume(ctx context.Context, layerID, movementID, quantity int, at time.Time) error
+	GetValuation(ctx context.Context, asOf time.Time) ([]*models.ValuationLine, error)
+	GetUnlayered(ctx context.Context, asOf time.Time) ([]*models.UnlayeredStock, error)
+}
+
+// StockSnapshotStore persists ledger snapshots.
+type StockSnapshotStore interface {
+	Create(ctx context.Context, snapshot *models.StockSnapshot) (bool, error)
+	CreateLines(ctx context.Context, snapshot, previous *models.StockSnapshot) error
+	GetLatest(ctx context.Context, asOf time.Time) (*models.StockSnapshot, error)
+	GetAll(ctx context.Context) ([]*models.StockSnapshot, error)
+	GetBalances(ctx context.Context, snapshot *models.StockSnapshot, asOf time.Time, productID, locationID *int) ([]*models.StockBalanceLine, error)
+}
+
+// ReconciliationStore compares stored figures with the stock ledger.
+type ReconciliationStore interface {
+	GetProductDrift(ctx context.Context) ([]*models.Discrepancy, error)
+	GetNegativeBalances(ctx context.Context) ([]*models.Discrepancy, error)
+	GetOverCapacity(ctx context.Context) ([]*models.Discrepancy, error)
+	GetProductBalances(ctx context.Context, productID int) ([]*models.StockBalanceLine, error)
+}
+
+// OutboxStore persists events waiting to be relayed.
+type OutboxStore interface {
+	Create(ctx context.Context, event *models.Event, payload []byte) error
+	LockUnpublished(ctx context.Context, limit int) ([]*models.OutboxEvent, error)
+	MarkPublished(ctx context.Context, ids []int64) error
+	AssignPositions(ctx context.Context, limit int) (int, error)
+	GetAfter(ctx context.Context, afterPosition int64, limit int, aggregateType string, aggregateID *int) ([]*models.OutboxEvent, error)
+}
+
+// WebhookStore persists webhook subscriptions and their delivery queue.
+type WebhookStore interface {
+	CreateSubscription(ctx context.Context, subscription *models.WebhookSubscription) error
+	GetSubscriptions(ctx context.Context) ([]*models.WebhookSubscription, error)
+	DeleteSubscription(ctx context.Context, id int) (bool, error)
+	CreateDeliveries(ctx context.Context, event *models.Event, payload []byte, traceParent string) error
+	ClaimDue(ctx context.Context, limit int, lease time.Duration) ([]*models.WebhookDelivery, error)
+	MarkDelivered(ctx context.Context, id, statusCode int) error
+	MarkFailed(ctx context.Context, id int, statusCode *int, lastError string, nextAttemptAt *time.Time) error
+	Redeliver(ctx context.Context, id int) (*models.WebhookDelivery, error)
+	GetDeliveries(ctx context.Context, filter *models.WebhookDeliveryFilter) ([]*models.WebhookDelivery, int, error)
+}
+
+// Repositories hands out the repositories of one store. Those of a Store run
+// every call on its own; those of a Tx run inside the transaction.
+type Repositories interface {
+	Products() ProductStore
+	Locations() LocationStore
+	StockMovements() StockMovementStore
+	CostLayers() CostLayerStore
+	Snapshots() StockSnapshotStore
+	Reconciliation() ReconciliationStore
+	Outbox() OutboxStore
+	Webhooks() WebhookStore
+}
+
+// Store is where the services keep their data. Begin starts a unit of work.
+type Store interface {
+	Repositories
+	Begin(ctx context.Context) (Tx, error)
+}
+
+// Tx is a unit of work: everything done through its repositories becomes
+// visible to others on Commit, or not at all. Rollback after Commit is a
+// no-op, so it can always be deferred.
+type Tx interface {
+	Repositories
+	// Savepoint marks a point that ReleaseSavepoint can roll back to, so a
+	// step that fails can be undone without abandoning the transaction.
+	Savepoint(name string) error
+	// ReleaseSavepoint forgets the named savepoint, first undoing
+	// everything done since it when rollback is set.
+	ReleaseSavepoint(name string, rollback bool) error
+	// Notify sends payload to the listeners of channel once the transaction
+	// commits.
+	Notify(channel, payload string) error
+	Commit() error
+	Rollback() error
+}
@@ -0,0 +1,242 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+	"warehouse-api/internal/models"
+)
+
+const webhookDeliveryColumns = `id, subscription_id, event_id, event_type, payload, status, attempts, next_attempt_at, last_status_code, last_error, created_at, delivered_at, trace_parent`
+
+type WebhookRepository struct {
+	db      DBTX
+	dialect dialect
+}
+
+func NewWebhookRepository(db *sql.DB) *WebhookRepository {
+	return &WebhookRepository{db: db}
+}
+
+func scanWebhookDelivery(row scanner, extra ...interface{}) (*models.WebhookDelivery, error) {
+	delivery := &models.WebhookDelivery{}
+	var lastStatusCode sql.NullInt64
+	dest := []interface{}{
+		&delivery.ID, &delivery.SubscriptionID, &delivery.EventID, &delivery.EventType,
+		&delivery.Payload, &delivery.Status, &delivery.Attempts, &delivery.NextAttemptAt,
+		&lastStatusCode, &delivery.LastError, &delivery.CreatedAt, &delivery.DeliveredAt,
+		&delivery.TraceParent,
+	}
+	err := row.Scan(append(dest, extra...)...)
+	if lastStatusCode.Valid {
+		code := int(lastStatusCode.Int64)
+		delivery.LastStatusCode = &code
+	}
+	return delivery, err
+}
+
+func (r *WebhookRepository) CreateSubscription(ctx context.Context, subscription *models.WebhookSubscription) error {
+	query := `
+		INSERT INTO webhook_subscriptions (url, secret, event_types)
+		VALUES ($1, $2, $3)
+		RETURNING id, created_at
+	`
+	return r.db.QueryRowContext(ctx, query, subscription.URL, subscription.Secret, r.dialect.array(subscription.EventTypes)).Scan(
+		&subscription.ID, &subscription.CreatedAt,
+	)
+}
+
+// GetSubscriptions returns every subscription without its secret.
+func (r *WebhookRepository) GetSubscriptions(ctx context.Context) ([]*models.WebhookSubscription, error) {
+	query := `SELECT id, url, event_types, created_at FROM webhook_subscriptions ORDER BY id`
+	rows, err := r.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var subscriptions []*models.WebhookSubscription
+	for rows.Next() {
+		subscription := &models.WebhookSubscription{}
+		err := rows.Scan(&subscription.ID, &subscription.URL, r.dialect.scanArray(&subscription.EventTypes), &subscription.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		subscriptions = append(subscriptions, subscription)
+	}
+
+	return subscriptions, rows.Err()
+}
+
+// DeleteSubscription removes a subscription and its deliveries. It reports
+// whether the subscription existed.
+func (r *WebhookRepository) DeleteSubscription(ctx context.Context, id int) (bool, error) {
+	result, err := r.db.ExecContext(ctx, `DELETE FROM webhook_subscriptions WHERE id = $1`, id)
+	if err != nil {
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	return affected > 0, err
+}
+
+// CreateDeliveries queues event for every subscription to its type. Run it in
+// the transaction that caused the event, so the deliveries exist exactly when
+// the change does.
+func (r *WebhookRepository) CreateDeliveries(ctx context.Context, event *models.Event, payload []byte, traceParent string) error {
+	query := `
+		INSERT INTO webhook_deliveries (subscription_id, event_id, event_type, payload, trace_parent)
+		SELECT id, $1, $2, $3, $4
+		FROM webhook_subscriptions
+		WHERE ` + r.dialect.anyOf("$2", "event_types")
+	_, err := r.db.ExecContext(ctx, query, event.ID, event.Type, payload, traceParent)
+	return err
+}
+
+// ClaimDue returns up to limit pending deliveries whose next attempt is due,
+// with the subscription URL and secret, and pushes their next attempt back by
+// lease so no other worker picks them up while they are being sent.
+func (r *WebhookRepository) ClaimDue(ctx context.Context, limit int, lease time.Duration) ([]*models.WebhookDelivery, error) {
+	query := `
+		WITH due AS (
+			SELECT id FROM webhook_deliveries
+			WHERE status = 'pending' AND next_attempt_at <= CURRENT_TIMESTAMP
+			ORDER BY next_attempt_at, id
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		)
+		UPDATE webhook_deliveries d
+		SET next_attempt_at = CURRENT_TIMESTAMP + make_interval(secs => $2)
+		FROM due, webhook_subscriptions s
+		WHERE d.id = due.id AND s.id = d.subscription_id
+		RETURNING d.id, d.subscription_id, d.event_id, d.event_type, d.payload, d.status, d.attempts,
+			d.next_attempt_at, d.last_status_code, d.last_error, d.created_at, d.delivered_at, d.trace_parent,
+			s.url, s.secret
+	`
+	if r.dialect == dialectSQLite {
+		query = sqliteClaimDue
+	}
+	rows, err := r.db.QueryContext(ctx, query, limit, lease.Seconds())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var deliveries []*models.WebhookDelivery
+	for rows.Next() {
+		var url, secret string
+		delivery, err := scanWebhookDelivery(rows, &url, &secret)
+		if err != nil {
+			return nil, err
+		}
+		delivery.URL = url
+		delivery.Secret = secret
+		deliveries = append(deliveries, delivery)
+	}
+
+	return deliveries, rows.Err()
+}
+
+// sqliteClaimDue is ClaimDue for SQLite, which has no UPDATE ... FROM with
+// row locks; the write transaction already keeps other workers out.
+const sqliteClaimDue = `
+	UPDATE webhook_deliveries
+	SET next_attempt_at = strftime('` + sqliteTimeLayout + `', 'now', '+' || $2 || ' seconds')
+	WHERE id IN (
+		SELECT id FROM webhook_deliveries
+		WHERE status = 'pending' AND next_attempt_at <= ` + sqliteNow + `
+		ORDER BY next_attempt_at, id
+		LIMIT $1
+	)
+	RETURNING ` + webhookDeliveryColumns + `,
+		(SELECT url FROM webhook_subscriptions s WHERE s.id = subscription_id),
+		(SELECT secret FROM webhook_subscriptions s WHERE s.id = subscription_id)
+`
+
+func (r *WebhookRepository) MarkDelivered(ctx context.Context, id, statusCode int) error {
+	query := `
+		UPDATE webhook_deliveries
+		SET status = 'delivered', attempts = attempts + 1, last_status_code = $2, last_error = '',
+			delivered_at = ` + r.dialect.now() + `
+		WHERE id = $1
+	`
+	_, err := r.db.ExecContext(ctx, query, id, statusCode)
+	return err
+}
+
+// MarkFailed records a failed attempt. The delivery is retried at
+// nextAttemptAt, or moved to the dead-letter list when nextAttemptAt is nil.
+func (r *WebhookRepository) MarkFailed(ctx context.Context, id int, statusCode *int, lastError string, nextAttemptAt *time.Time) error {
+	status := models.WebhookDeliveryPending
+	if nextAttemptAt == nil {
+		status = models.WebhookDeliveryDead
+	}
+	query := `
+		UPDATE webhook_deliveries
+		SET status = $2, attempts = attempts + 1, last_status_code = $3, last_error = $4,
+			next_attempt_at = COALESCE($5, next_attempt_at)
+		WHERE id = $1
+	`
+	_, err := r.db.ExecContext(ctx, query, id, status, statusCode, lastError, nextAttemptAt)
+	return err
+}
+
+// Redeliver queues a delivery to be sent again straight away with a fresh
+// set of retries. It returns nil when the delivery does not exist.
+func (r *WebhookRepository) Redeliver(ctx context.Context, id int) (*models.WebhookDelivery, error) {
+	query := `
+		UPDATE webhook_deliveries
+		SET status = 'pending', attempts = 0, next_attempt_at = ` + r.dialect.now() + `, delivered_at = NULL
+		WHERE id = $1
+		RETURNING ` + webhookDeliveryColumns
+	delivery, err := scanWebhookDelivery(r.db.QueryRowContext(ctx, query, id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return delivery, err
+}
+
+func (r *WebhookRepository) GetDeliveries(ctx context.Context, filter *models.WebhookDeliveryFilter) ([]*models.WebhookDelivery, int, error) {
+	whereClause := "WHERE 1=1"
+	args := []interface{}{}
+	argIndex := 1
+
+	if filter.SubscriptionID != nil {
+		whereClause += fmt.Sprintf(" AND subscription_id = $%d", argIndex)
+		args = append(args, *filter.SubscriptionID)
+		argIndex++
+	}
+	if filter.Status != "" {
+		whereClause += fmt.Sprintf(" AND status = $%d", argIndex)
+		args = append(args, filter.Status)
+		argIndex++
+	}
+
+	var total int
+	err := r.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM webhook_deliveries `+whereClause, args...).Scan(&total)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	offset := (filter.Page - 1) * filter.Limit
+	query := `SELECT ` + webhookDeliveryColumns + ` FROM webhook_deliveries ` + whereClause +
+		fmt.Sprintf(" ORDER BY id DESC LIMIT $%d OFFSET $%d", argIndex, argIndex+1)
+	args = append(args, filter.Limit, offset)
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	var deliveries []*models.WebhookDelivery
+	for rows.Next() {
+		delivery, err := scanWebhookDelivery(rows)
+		if err != nil {
+			return nil, 0, err
+		}
+		deliveries = append(deliveries, delivery)
+	}
+
+	return deliveries, total, rows.Err()
+}
@@ -0,0 +1,47 @@
+package services
+
+import (
+	"fmt"
+	"warehouse-api/internal/apperrors"
+)
+
+// Errors returned by the services. Handlers map them to responses by kind,
+// and clients see their codes, so codes must not change.
+var (
+	ErrProductNotFound             = apperrors.New(apperrors.NotFound, "product_not_found", "product not found")
+	ErrLocationNotFound            = apperrors.New(apperrors.NotFound, "location_not_found", "location not found")
+	ErrStockMovementNotFound       = apperrors.New(apperrors.NotFound, "stock_movement_not_found", "stock movement not found")
+	ErrWebhookSubscriptionNotFound = apperrors.New(apperrors.NotFound, "webhook_subscription_not_found", "webhook subscription not found")
+	ErrWebhookDeliveryNotFound     = apperrors.New(apperrors.NotFound, "webhook_delivery_not_found", "webhook delivery not found")
+
+	ErrSKUExists          = apperrors.New(apperrors.Conflict, "sku_exists", "SKU name already exists")
+	ErrLocationCodeExists = apperrors.New(apperrors.Conflict, "location_code_exists", "location code already exists")
+	ErrAlreadyReversed    = apperrors.New(apperrors.Conflict, "already_reversed", "stock movement already reversed")
+
+	ErrInsufficientQuantity      = apperrors.New(apperrors.FailedPrecondition, "insufficient_quantity", "insufficient product quantity")
+	ErrInsufficientLocationStock = apperrors.New(apperrors.FailedPrecondition, "insufficient_location_stock", "insufficient stock at location")
+	ErrCapacityExceeded          = apperrors.New(apperrors.FailedPrecondition, "capacity_exceeded", "location capacity exceeded")
+	ErrReverseReversal           = apperrors.New(apperrors.FailedPrecondition, "reversal_not_reversible", "cannot reverse a reversal movement")
+
+	ErrSnapshotTooRecent = apperrors.New(apperrors.Invalid, "snapshot_too_recent",
+		fmt.Sprintf("snapshot time must be at least %s in the past", SnapshotSafetyLag))
+	ErrMovementRequired = apperrors.New(apperrors.Invalid, apperrors.CodeValidationFailed, "movement is required")
+
+	// ErrImportRowsInvalid is answered with the import report as details.
+	ErrImportRowsInvalid = apperrors.New(apperrors.Unprocessable, "import_rows_invalid", "Import file has invalid rows, nothing was imported")
+)
+
+// rejectsLine reports whether err rejects just one line of a bulk request,
+// such as an import row: it failed validation or a business rule. Any other
+// error, such as a lost connection or a timeout, aborts the whole request.
+func rejectsLine(err error) bool {
+	switch apperrors.KindOf(err) {
+	case apperrors.Invalid, apperrors.Unprocessable, apperrors.NotFound, apperrors.Conflict, apperrors.FailedPrecondition:
+		return true
+	default:
+		return false
+	}
+}
+
+// CodeInvalidFile is the code of errors reading an uploaded import file.
+const CodeInvalidFile = "invalid_file"
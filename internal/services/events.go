@@ -0,0 +1,46 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"time"
+	"warehouse-api/internal/models"
+	"warehouse-api/internal/repositories"
+)
+
+// EventRecorder records an event inside the transaction of the change that
+// caused it, so the event is committed or rolled back together with it.
+type EventRecorder interface {
+	Record(ctx context.Context, tx repositories.Tx, event *models.Event) error
+}
+
+// EventRecorders records every event with each recorder in turn.
+type EventRecorders []EventRecorder
+
+func (r EventRecorders) Record(ctx context.Context, tx repositories.Tx, event *models.Event) error {
+	for _, recorder := range r {
+		if err := recorder.Record(ctx, tx, event); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// newEvent wraps data about one aggregate in an event envelope with a random
+// ID.
+func newEvent(eventType, aggregateType string, aggregateID int, data interface{}) *models.Event {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		panic(err)
+	}
+	return &models.Event{
+		ID:         hex.EncodeToString(id),
+		Type:       eventType,
+		OccurredAt: time.Now().UTC(),
+		Data:       data,
+
+		AggregateType: aggregateType,
+		AggregateID:   aggregateID,
+	}
+}
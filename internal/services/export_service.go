@@ -0,0 +1,108 @@
+package services
+
+import (
+	"context"
+	"io"
+	"warehouse-api/internal/models"
+	"warehouse-api/internal/repositories"
+	"warehouse-api/internal/tabular"
+	"warehouse-api/internal/tracing"
+)
+
+var movementExportColumns = []string{
+	"id", "created_at", "type", "product_id", "sku_name", "location_id", "location_code",
+	"quantity", "unit_cost", "total_cost", "average_cost", "source", "reference", "note",
+	"created_by", "reversal_of", "reversed_at", "reversed_by", "reversal_reason",
+}
+
+var stockExportColumns = []string{
+	"product_id", "sku_name", "location_id", "location_code", "location_name", "quantity",
+}
+
+var locationExportColumns = []string{
+	"id", "code", "name", "warehouse", "capacity", "current_usage", "available", "utilisation_pct", "created_at",
+}
+
+// ExportService streams ledger data to a tabular writer row by row, so an
+// export never holds its full result set in memory.
+type ExportService struct {
+	store repositories.Store
+}
+
+func NewExportService(store repositories.Store) *ExportService {
+	return &ExportService{store: store}
+}
+
+// ExportMovements writes every movement matching filter, oldest first.
+// Pagination fields on filter are ignored.
+func (s *ExportService) ExportMovements(ctx context.Context, w io.Writer, format string, filter *models.StockMovementFilter) error {
+	ctx, span := tracing.Start(ctx, "ExportService.ExportMovements")
+	defer span.End()
+
+	out, err := tabular.NewWriter(w, format, movementExportColumns)
+	if err != nil {
+		return err
+	}
+
+	err = s.store.StockMovements().Stream(ctx, filter, func(m *models.StockMovement, skuName, locationCode string) error {
+		return out.Write(
+			m.ID, m.CreatedAt, m.Type, m.ProductID, skuName, m.LocationID, locationCode,
+			m.Quantity, m.UnitCost, m.TotalCost, m.AverageCost, m.Source, m.Reference, m.Note,
+			m.CreatedBy, m.ReversalOf, m.ReversedAt, m.ReversedBy, m.ReversalReason,
+		)
+	})
+	if err != nil {
+		return err
+	}
+
+	return out.Close()
+}
+
+// ExportStock writes the current on-hand quantity of every product at every
+// location that holds it.
+func (s *ExportService) ExportStock(ctx context.Context, w io.Writer, format string) error {
+	ctx, span := tracing.Start(ctx, "ExportService.ExportStock")
+	defer span.End()
+
+	out, err := tabular.NewWriter(w, format, stockExportColumns)
+	if err != nil {
+		return err
+	}
+
+	err = s.store.StockMovements().StreamBalances(ctx, func(line *models.StockBalanceLine) error {
+		return out.Write(
+			line.ProductID, line.SKUName, line.LocationID, line.LocationCode, line.LocationName, line.Quantity,
+		)
+	})
+	if err != nil {
+		return err
+	}
+
+	return out.Close()
+}
+
+// ExportLocations writes every location with its usage and utilisation.
+func (s *ExportService) ExportLocations(ctx context.Context, w io.Writer, format string) error {
+	ctx, span := tracing.Start(ctx, "ExportService.ExportLocations")
+	defer span.End()
+
+	out, err := tabular.NewWriter(w, format, locationExportColumns)
+	if err != nil {
+		return err
+	}
+
+	err = s.store.Locations().StreamAll(ctx, func(loc *models.LocationWithUsage) error {
+		utilisation := 0.0
+		if loc.Capacity > 0 {
+			utilisation = roundCost(float64(loc.CurrentUsage) * 100 / float64(loc.Capacity))
+		}
+		return out.Write(
+			loc.ID, loc.Code, loc.Name, loc.Warehouse, loc.Capacity, loc.CurrentUsage, loc.Available, utilisation, loc.CreatedAt,
+		)
+	})
+	if err != nil {
+		return err
+	}
+
+	return out.Close()
+}
@@ -0,0 +1,286 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"warehouse-api/internal/metrics"
+	"warehouse-api/internal/models"
+	"warehouse-api/internal/repositories"
+	"warehouse-api/internal/tabular"
+	"warehouse-api/internal/tracing"
+	"warehouse-api/internal/utils"
+)
+
+type ImportService struct {
+	store           repositories.Store
+	productService  *ProductService
+	locationService *LocationService
+	stockService    *StockService
+}
+
+func NewImportService(
+	store repositories.Store,
+	productService *ProductService,
+	locationService *LocationService,
+	stockService *StockService,
+) *ImportService {
+	return &ImportService{
+		store:           store,
+		productService:  productService,
+		locationService: locationService,
+		stockService:    stockService,
+	}
+}
+
+// importRow applies one row inside the import transaction. A column,
+// validation or business rule error rejects just that row; any other error
+// aborts the import.
+type importRow func(ctx context.Context, tx repositories.Tx, row tabular.Row, username string) error
+
+// rowFieldError rejects a row because of one of its columns.
+type rowFieldError struct {
+	field   string
+	message string
+}
+
+func (e *rowFieldError) Error() string {
+	return e.field + " " + e.message
+}
+
+// rowValidationError rejects a row that failed request validation.
+type rowValidationError struct {
+	fields []utils.FieldError
+}
+
+func (e *rowValidationError) Error() string {
+	return "invalid row"
+}
+
+// Import loads products, locations or opening balances from parsed rows.
+// Every row goes through the same rules as the corresponding create
+// endpoint, inside one transaction and under its own savepoint, so a single
+// run reports every rejected row. The transaction is committed only when all
+// rows are valid and dryRun is false; opening balances are posted as IN
+// movements with source IMPORT.
+func (s *ImportService) Import(ctx context.Context, kind string, rows []tabular.Row, dryRun bool, username string) (*models.ImportReport, error) {
+	ctx, span := tracing.Start(ctx, "ImportService.Import")
+	defer span.End()
+
+	var apply importRow
+	switch kind {
+	case models.ImportProducts:
+		apply = s.importProduct
+	case models.ImportLocations:
+		apply = s.importLocation
+	case models.ImportOpeningBalances:
+		apply = s.importOpeningBalance
+	default:
+		return nil, fmt.Errorf("unknown import kind %q", kind)
+	}
+
+	report := &models.ImportReport{
+		Kind:      kind,
+		DryRun:    dryRun,
+		TotalRows: len(rows),
+		Errors:    []*models.ImportRowError{},
+	}
+
+	tx, err := s.store.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	for _, row := range rows {
+		if err := tx.Savepoint("import_row"); err != nil {
+			return nil, err
+		}
+
+		rowErr := apply(ctx, tx, row, username)
+		if err := tx.ReleaseSavepoint("import_row", rowErr != nil); err != nil {
+			return nil, err
+		}
+
+		if rowErr != nil {
+			rowErrors := importRowErrors(row, rowErr)
+			if rowErrors == nil {
+				return nil, rowErr
+			}
+			report.Errors = append(report.Errors, rowErrors...)
+			continue
+		}
+		report.ValidRows++
+	}
+
+	if dryRun || len(report.Errors) > 0 {
+		return report, nil
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+	report.Imported = report.ValidRows
+	slog.InfoContext(ctx, "Import committed", slog.String("kind", kind), slog.Int("imported", report.Imported))
+	if kind == models.ImportOpeningBalances {
+		// Every opening balance row posts one IN movement
+		metrics.MovementsPosted.WithLabelValues("IN", models.MovementSourceImport).Add(float64(report.Imported))
+	}
+
+	return report, nil
+}
+
+func (s *ImportService) importProduct(ctx context.Context, tx repositories.Tx, row tabular.Row, username string) error {
+	quantity, err := intColumn(row, "quantity")
+	if err != nil {
+		return err
+	}
+	reorderLevel, err := intColumn(row, "reorder_level")
+	if err != nil {
+		return err
+	}
+
+	req := &models.CreateProductRequest{
+		SKUName:       row.Get("sku_name"),
+		Quantity:      quantity,
+		CostingMethod: strings.ToUpper(row.Get("costing_method")),
+		ReorderLevel:  reorderLevel,
+	}
+	if err := validateRow(req); err != nil {
+		return err
+	}
+
+	_, err = s.productService.create(ctx, tx, req)
+	return err
+}
+
+func (s *ImportService) importLocation(ctx context.Context, tx repositories.Tx, row tabular.Row, username string) error {
+	capacity, err := intColumn(row, "capacity")
+	if err != nil {
+		return err
+	}
+
+	req := &models.CreateLocationRequest{
+		Code:      row.Get("code"),
+		Name:      row.Get("name"),
+		Warehouse: row.Get("warehouse"),
+		Capacity:  capacity,
+	}
+	if err := validateRow(req); err != nil {
+		return err
+	}
+
+	_, err = s.locationService.create(ctx, tx, req)
+	return err
+}
+
+func (s *ImportService) importOpeningBalance(ctx context.Context, tx repositories.Tx, row tabular.Row, username string) error {
+	quantity, err := intColumn(row, "quantity")
+	if err != nil {
+		return err
+	}
+
+	req := &models.CreateStockMovementRequest{
+		Type:      "IN",
+		Quantity:  quantity,
+		Reference: row.Get("reference"),
+		Note:      row.Get("note"),
+	}
+
+	if value := row.Get("unit_cost"); value != "" {
+		unitCost, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return &rowFieldError{field: "unit_cost", message: "must be a number"}
+		}
+		req.UnitCost = &unitCost
+	}
+
+	// Products and locations are referenced by their natural keys
+	sku := row.Get("sku_name")
+	if sku == "" {
+		return &rowFieldError{field: "sku_name", message: "is required"}
+	}
+	product, err := tx.Products().GetBySKU(ctx, sku)
+	if err != nil {
+		return err
+	}
+	if product == nil {
+		return &rowFieldError{field: "sku_name", message: "product not found"}
+	}
+	req.ProductID = product.ID
+
+	code := row.Get("location_code")
+	if code == "" {
+		return &rowFieldError{field: "location_code", message: "is required"}
+	}
+	location, err := tx.Locations().GetByCode(ctx, code)
+	if err != nil {
+		return err
+	}
+	if location == nil {
+		return &rowFieldError{field: "location_code", message: "location not found"}
+	}
+	req.LocationID = location.ID
+
+	if err := validateRow(req); err != nil {
+		return err
+	}
+
+	_, err = s.stockService.post(ctx, tx, req, postOptions{
+		source:    models.MovementSourceImport,
+		createdBy: username,
+	})
+	return err
+}
+
+// intColumn parses an optional integer column; a blank value is 0 and is left
+// to request validation to reject when the field is required.
+func intColumn(row tabular.Row, column string) (int, error) {
+	value := row.Get(column)
+	if value == "" {
+		return 0, nil
+	}
+	parsed, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, &rowFieldError{field: column, message: "must be a whole number"}
+	}
+	return parsed, nil
+}
+
+func validateRow(req interface{}) error {
+	err := utils.ValidateStruct(req)
+	if err == nil {
+		return nil
+	}
+	if fields := utils.FieldErrors(req, err); fields != nil {
+		return &rowValidationError{fields: fields}
+	}
+	return err
+}
+
+// importRowErrors describes why err rejected row, or returns nil when err
+// does not reject a row but must abort the import.
+func importRowErrors(row tabular.Row, err error) []*models.ImportRowError {
+	var fieldErr *rowFieldError
+	if errors.As(err, &fieldErr) {
+		return []*models.ImportRowError{{Row: row.Number, Field: fieldErr.field, Message: fieldErr.message}}
+	}
+
+	var validationErr *rowValidationError
+	if errors.As(err, &validationErr) {
+		rowErrors := make([]*models.ImportRowError, 0, len(validationErr.fields))
+		for _, field := range validationErr.fields {
+			rowErrors = append(rowErrors, &models.ImportRowError{Row: row.Number, Field: field.Field, Message: field.Message})
+		}
+		return rowErrors
+	}
+
+	if !rejectsLine(err) {
+		return nil
+	}
+	return []*models.ImportRowError{{Row: row.Number, Message: err.Error()}}
+}
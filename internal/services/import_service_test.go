@@ -0,0 +1,112 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"warehouse-api/internal/models"
+	"warehouse-api/internal/tabular"
+)
+
+func openingBalance(number int, sku, code, quantity string) tabular.Row {
+	return tabular.Row{Number: number, Values: map[string]string{
+		"sku_name":      sku,
+		"location_code": code,
+		"quantity":      quantity,
+		"unit_cost":     "2.5",
+	}}
+}
+
+func TestImportRejectsWholeFileOnAnyInvalidRow(t *testing.T) {
+	env := newTestEnv(t)
+	ctx := context.Background()
+	env.product(t, "SKU-1", models.CostingFIFO, 0)
+	env.location(t, "A1", 100)
+
+	report, err := env.imports.Import(ctx, models.ImportOpeningBalances, []tabular.Row{
+		openingBalance(2, "SKU-1", "A1", "5"),
+		openingBalance(3, "SKU-404", "A1", "5"),
+		openingBalance(4, "SKU-1", "A1", "five"),
+		openingBalance(5, "SKU-1", "A1", "0"),
+	}, false, "importer")
+	if err != nil {
+		t.Fatalf("import: %v", err)
+	}
+
+	expectInt(t, "valid rows", report.ValidRows, 1)
+	expectInt(t, "imported", report.Imported, 0)
+	want := []models.ImportRowError{
+		{Row: 3, Field: "sku_name"},
+		{Row: 4, Field: "quantity"},
+		{Row: 5, Field: "quantity"},
+	}
+	if len(report.Errors) != len(want) {
+		t.Fatalf("errors = %d, want %d", len(report.Errors), len(want))
+	}
+	for i, w := range want {
+		if report.Errors[i].Row != w.Row || report.Errors[i].Field != w.Field {
+			t.Errorf("error %d = row %d %s, want row %d %s", i, report.Errors[i].Row, report.Errors[i].Field, w.Row, w.Field)
+		}
+	}
+	expectInt(t, "movements", len(env.movements(t)), 0)
+}
+
+func TestImportAbortsOnErrorsThatAreNotTheRows(t *testing.T) {
+	env := newTestEnv(t)
+	ctx := context.Background()
+	env.product(t, "SKU-1", models.CostingFIFO, 0)
+	env.product(t, "SKU-2", models.CostingFIFO, 0)
+	env.location(t, "A1", 100)
+
+	for _, fail := range []error{
+		errors.New("connection reset by peer"),
+		fmt.Errorf("query: %w", context.DeadlineExceeded),
+	} {
+		store := &failingStore{Store: env.store, failSKU: "SKU-2", err: fail}
+		imports := NewImportService(store, env.products, env.locations, env.stock)
+		report, err := imports.Import(ctx, models.ImportOpeningBalances, []tabular.Row{
+			openingBalance(2, "SKU-1", "A1", "5"),
+			openingBalance(3, "SKU-2", "A1", "5"),
+			openingBalance(4, "SKU-404", "A1", "5"),
+		}, false, "importer")
+		if !errors.Is(err, fail) {
+			t.Errorf("import with %q: got report %+v and error %v, want the error", fail, report, err)
+		}
+	}
+	expectInt(t, "movements", len(env.movements(t)), 0)
+}
+
+func TestImportOpeningBalances(t *testing.T) {
+	env := newTestEnv(t)
+	ctx := context.Background()
+	product := env.product(t, "SKU-1", models.CostingFIFO, 0)
+	location := env.location(t, "A1", 100)
+	rows := []tabular.Row{
+		openingBalance(2, "SKU-1", "A1", "5"),
+		openingBalance(3, "SKU-1", "A1", "3"),
+	}
+
+	report, err := env.imports.Import(ctx, models.ImportOpeningBalances, rows, true, "importer")
+	if err != nil {
+		t.Fatalf("dry run: %v", err)
+	}
+	expectInt(t, "valid rows", report.ValidRows, 2)
+	expectInt(t, "imported by dry run", report.Imported, 0)
+	expectInt(t, "movements after dry run", len(env.movements(t)), 0)
+
+	report, err = env.imports.Import(ctx, models.ImportOpeningBalances, rows, false, "importer")
+	if err != nil {
+		t.Fatalf("import: %v", err)
+	}
+	expectInt(t, "imported", report.Imported, 2)
+
+	for _, m := range env.movements(t) {
+		if m.Source != models.MovementSourceImport || m.CreatedBy != "importer" {
+			t.Errorf("movement %d from %s by %s, want IMPORT by importer", m.ID, m.Source, m.CreatedBy)
+		}
+	}
+	expectInt(t, "quantity", env.getProduct(t, product.ID).Quantity, 8)
+	expectInt(t, "usage", env.usage(t, location.ID), 8)
+	expectFloat(t, "average", env.getProduct(t, product.ID).AverageCost, 2.5)
+}
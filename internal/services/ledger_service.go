@@ -0,0 +1,189 @@
+package services
+
+import (
+	"context"
+	"time"
+	"warehouse-api/internal/models"
+	"warehouse-api/internal/repositories"
+	"warehouse-api/internal/tracing"
+)
+
+// SnapshotSafetyLag is how far in the past a snapshot must be taken. Movement
+// timestamps are assigned when their transaction starts, so a movement still
+// in flight could otherwise land before a snapshot that has already been
+// written and be missed by it.
+const SnapshotSafetyLag = 5 * time.Minute
+
+type LedgerService struct {
+	store repositories.Store
+}
+
+func NewLedgerService(store repositories.Store) *LedgerService {
+	return &LedgerService{store: store}
+}
+
+// GetBalances reconstructs the ledger balances at asOf from the latest
+// snapshot taken at or before it plus the movements made since.
+func (s *LedgerService) GetBalances(ctx context.Context, asOf time.Time, productID, locationID *int) (*models.StockBalanceReport, error) {
+	ctx, span := tracing.Start(ctx, "LedgerService.GetBalances")
+	defer span.End()
+
+	snapshotRepo := s.store.Snapshots()
+
+	snapshot, err := snapshotRepo.GetLatest(ctx, asOf)
+	if err != nil {
+		return nil, err
+	}
+
+	lines, err := snapshotRepo.GetBalances(ctx, snapshot, asOf, productID, locationID)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &models.StockBalanceReport{
+		AsOf:      asOf,
+		Products:  []*models.ProductBalance{},
+		Locations: []*models.LocationQuantity{},
+	}
+	if snapshot != nil {
+		report.SnapshotID = &snapshot.ID
+	}
+
+	var current *models.ProductBalance
+	locations := map[int]*models.LocationQuantity{}
+	for _, line := range lines {
+		if current == nil || current.ProductID != line.ProductID {
+			current = &models.ProductBalance{
+				ProductID: line.ProductID,
+				SKUName:   line.SKUName,
+				Locations: []*models.LocationQuantity{},
+			}
+			report.Products = append(report.Products, current)
+		}
+		current.Quantity += line.Quantity
+		current.Locations = append(current.Locations, &models.LocationQuantity{
+			LocationID:   line.LocationID,
+			LocationCode: line.LocationCode,
+			LocationName: line.LocationName,
+			Quantity:     line.Quantity,
+		})
+
+		total, ok := locations[line.LocationID]
+		if !ok {
+			total = &models.LocationQuantity{
+				LocationID:   line.LocationID,
+				LocationCode: line.LocationCode,
+				LocationName: line.LocationName,
+			}
+			locations[line.LocationID] = total
+			report.Locations = append(report.Locations, total)
+		}
+		total.Quantity += line.Quantity
+	}
+
+	return report, nil
+}
+
+// CreateSnapshot stores the ledger balances at takenAt. Taking a snapshot for
+// an instant that already has one returns the existing snapshot.
+func (s *LedgerService) CreateSnapshot(ctx context.Context, takenAt time.Time) (*models.StockSnapshot, error) {
+	ctx, span := tracing.Start(ctx, "LedgerService.CreateSnapshot")
+	defer span.End()
+
+	if takenAt.After(time.Now().Add(-SnapshotSafetyLag)) {
+		return nil, ErrSnapshotTooRecent
+	}
+
+	tx, err := s.store.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	snapshotRepo := tx.Snapshots()
+
+	previous, err := snapshotRepo.GetLatest(ctx, takenAt)
+	if err != nil {
+		return nil, err
+	}
+	if previous != nil && previous.TakenAt.Equal(takenAt) {
+		return previous, nil
+	}
+
+	snapshot := &models.StockSnapshot{TakenAt: takenAt}
+	created, err := snapshotRepo.Create(ctx, snapshot)
+	if err != nil {
+		return nil, err
+	}
+	if !created {
+		// A concurrent request stored the same snapshot first
+		return s.store.Snapshots().GetLatest(ctx, takenAt)
+	}
+
+	err = snapshotRepo.CreateLines(ctx, snapshot, previous)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+
+	return snapshot, nil
+}
+
+func (s *LedgerService) GetSnapshots(ctx context.Context) ([]*models.StockSnapshot, error) {
+	ctx, span := tracing.Start(ctx, "LedgerService.GetSnapshots")
+	defer span.End()
+
+	return s.store.Snapshots().GetAll(ctx)
+}
+
+// GetStockCard lists a product's movements with a running balance that starts
+// from the ledger balance just before start.
+func (s *LedgerService) GetStockCard(ctx context.Context, productID int, locationID *int, start, end *time.Time) (*models.StockCard, error) {
+	ctx, span := tracing.Start(ctx, "LedgerService.GetStockCard")
+	defer span.End()
+
+	product, err := s.store.Products().GetByID(ctx, productID)
+	if err != nil {
+		return nil, err
+	}
+	if product == nil {
+		return nil, ErrProductNotFound
+	}
+
+	card := &models.StockCard{
+		ProductID:  product.ID,
+		SKUName:    product.SKUName,
+		LocationID: locationID,
+		StartDate:  start,
+		EndDate:    end,
+	}
+
+	if start != nil {
+		// Timestamps have microsecond precision
+		opening, err := s.GetBalances(ctx, start.Add(-time.Microsecond), &productID, locationID)
+		if err != nil {
+			return nil, err
+		}
+		for _, balance := range opening.Products {
+			card.OpeningBalance += balance.Quantity
+		}
+	}
+
+	entries, err := s.store.StockMovements().GetStockCard(ctx, productID, locationID, start, end)
+	if err != nil {
+		return nil, err
+	}
+
+	card.ClosingBalance = card.OpeningBalance
+	for _, entry := range entries {
+		entry.Balance += card.OpeningBalance
+		card.ClosingBalance = entry.Balance
+	}
+	card.Entries = entries
+
+	return card, nil
+}
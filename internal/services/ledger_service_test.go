@@ -0,0 +1,90 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+	"warehouse-api/internal/models"
+)
+
+func TestGetBalancesAsOf(t *testing.T) {
+	env := newTestEnv(t)
+	ctx := context.Background()
+	product := env.product(t, "SKU-1", models.CostingFIFO, 0)
+	a := env.location(t, "A1", 100)
+	b := env.location(t, "B1", 100)
+	first := env.move(t, movement(product.ID, a.ID, "IN", 10, 1))
+	env.move(t, movement(product.ID, b.ID, "IN", 5, 1))
+	last := env.move(t, movement(product.ID, a.ID, "OUT", 3, -1))
+
+	snapshot, err := env.ledger.CreateSnapshot(ctx, first.CreatedAt)
+	if err != nil {
+		t.Fatalf("create snapshot: %v", err)
+	}
+
+	report, err := env.ledger.GetBalances(ctx, last.CreatedAt.Add(-time.Microsecond), nil, nil)
+	if err != nil {
+		t.Fatalf("get balances: %v", err)
+	}
+	if report.SnapshotID == nil || *report.SnapshotID != snapshot.ID {
+		t.Errorf("snapshot_id = %v, want %d", report.SnapshotID, snapshot.ID)
+	}
+	if len(report.Products) != 1 || report.Products[0].Quantity != 15 {
+		t.Fatalf("products = %+v, want SKU-1 with 15", report.Products)
+	}
+	if len(report.Locations) != 2 || report.Locations[0].Quantity != 10 || report.Locations[1].Quantity != 5 {
+		t.Errorf("locations = %+v, want A1 10 and B1 5", report.Locations)
+	}
+
+	report, err = env.ledger.GetBalances(ctx, time.Now(), &product.ID, &a.ID)
+	if err != nil {
+		t.Fatalf("get balances: %v", err)
+	}
+	if len(report.Products) != 1 || report.Products[0].Quantity != 7 {
+		t.Errorf("products = %+v, want SKU-1 with 7 at A1", report.Products)
+	}
+}
+
+func TestCreateSnapshot(t *testing.T) {
+	env := newTestEnv(t)
+	ctx := context.Background()
+
+	_, err := env.ledger.CreateSnapshot(ctx, time.Now())
+	expectError(t, err, ErrSnapshotTooRecent)
+
+	takenAt := time.Now().Add(-time.Hour).UTC().Truncate(time.Microsecond)
+	snapshot, err := env.ledger.CreateSnapshot(ctx, takenAt)
+	if err != nil {
+		t.Fatalf("create snapshot: %v", err)
+	}
+	again, err := env.ledger.CreateSnapshot(ctx, takenAt)
+	if err != nil {
+		t.Fatalf("create snapshot again: %v", err)
+	}
+	if again.ID != snapshot.ID {
+		t.Errorf("second snapshot for the same instant has id %d, want %d", again.ID, snapshot.ID)
+	}
+}
+
+func TestGetStockCard(t *testing.T) {
+	env := newTestEnv(t)
+	ctx := context.Background()
+	product := env.product(t, "SKU-1", models.CostingFIFO, 0)
+	location := env.location(t, "A1", 100)
+	env.move(t, movement(product.ID, location.ID, "IN", 10, 1))
+	start := env.move(t, movement(product.ID, location.ID, "OUT", 4, -1))
+	env.move(t, movement(product.ID, location.ID, "IN", 2, 1))
+
+	card, err := env.ledger.GetStockCard(ctx, product.ID, nil, &start.CreatedAt, nil)
+	if err != nil {
+		t.Fatalf("stock card: %v", err)
+	}
+	expectInt(t, "opening balance", card.OpeningBalance, 10)
+	expectInt(t, "closing balance", card.ClosingBalance, 8)
+	if len(card.Entries) != 2 || card.Entries[0].Balance != 6 || card.Entries[1].Balance != 8 {
+		t.Errorf("entries = %+v, want balances 6 and 8", card.Entries)
+	}
+
+	_, err = env.ledger.GetStockCard(ctx, 999, nil, nil, nil)
+	expectError(t, err, ErrProductNotFound)
+}
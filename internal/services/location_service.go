@@ -1,36 +1,74 @@
 package services
 
 import (
-	"errors"
+	"context"
 	"warehouse-api/internal/models"
 	"warehouse-api/internal/repositories"
+	"warehouse-api/internal/tracing"
 )
 
 type LocationService struct {
-	locationRepo *repositories.LocationRepository
+	store  repositories.Store
+	events EventRecorder
 }
 
-func NewLocationService(locationRepo *repositories.LocationRepository) *LocationService {
-	return &LocationService{locationRepo: locationRepo}
+func NewLocationService(store repositories.Store, events EventRecorder) *LocationService {
+	return &LocationService{
+		store:  store,
+		events: events,
+	}
 }
 
-func (s *LocationService) Create(req *models.CreateLocationRequest) (*models.Location, error) {
+func (s *LocationService) Create(ctx context.Context, req *models.CreateLocationRequest) (*models.Location, error) {
+	ctx, span := tracing.Start(ctx, "LocationService.Create")
+	defer span.End()
+
+	tx, err := s.store.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	location, err := s.create(ctx, tx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+
+	return location, nil
+}
+
+// create applies the creation rules inside tx, which may belong to a caller
+// such as an import, and records the location.created event.
+func (s *LocationService) create(ctx context.Context, tx repositories.Tx, req *models.CreateLocationRequest) (*models.Location, error) {
+	locationRepo := tx.Locations()
+
 	// Check if code already exists
-	existing, err := s.locationRepo.GetByCode(req.Code)
+	existing, err := locationRepo.GetByCode(ctx, req.Code)
 	if err != nil {
 		return nil, err
 	}
 	if existing != nil {
-		return nil, errors.New("location code already exists")
+		return nil, ErrLocationCodeExists
 	}
 
 	location := &models.Location{
-		Code:     req.Code,
-		Name:     req.Name,
-		Capacity: req.Capacity,
+		Code:      req.Code,
+		Name:      req.Name,
+		Warehouse: req.Warehouse,
+		Capacity:  req.Capacity,
 	}
 
-	err = s.locationRepo.Create(location)
+	err = locationRepo.Create(ctx, location)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.events.Record(ctx, tx, newEvent(models.EventLocationCreated, models.AggregateLocation, location.ID, location))
 	if err != nil {
 		return nil, err
 	}
@@ -38,11 +76,27 @@ func (s *LocationService) Create(req *models.CreateLocationRequest) (*models.Loc
 	return location, nil
 }
 
-func (s *LocationService) GetAll() ([]*models.LocationWithUsage, error) {
-	return s.locationRepo.GetAll()
+func (s *LocationService) GetAll(ctx context.Context, filter *models.LocationFilter) ([]*models.LocationWithUsage, *models.CursorPagination, error) {
+	ctx, span := tracing.Start(ctx, "LocationService.GetAll")
+	defer span.End()
+
+	filter.Limit = pageLimit(filter.Limit)
+	return s.store.Locations().GetAll(ctx, filter)
+}
+
+// GetWithUsageByIDs returns the locations among ids with their current
+// usage in a single query, for callers that batch lookups.
+func (s *LocationService) GetWithUsageByIDs(ctx context.Context, ids []int) ([]*models.LocationWithUsage, error) {
+	ctx, span := tracing.Start(ctx, "LocationService.GetWithUsageByIDs")
+	defer span.End()
+
+	return s.store.Locations().GetWithUsageByIDs(ctx, ids)
 }
 
-func (s *LocationService) GetCurrentUsage(locationID int) (int, error) {
-	return s.locationRepo.GetCurrentUsage(locationID)
+func (s *LocationService) GetCurrentUsage(ctx context.Context, locationID int) (int, error) {
+	ctx, span := tracing.Start(ctx, "LocationService.GetCurrentUsage")
+	defer span.End()
+
+	return s.store.Locations().GetCurrentUsage(ctx, locationID)
 }
 
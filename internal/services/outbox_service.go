@@ -0,0 +1,154 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"warehouse-api/internal/eventbus"
+	"warehouse-api/internal/models"
+	"warehouse-api/internal/repositories"
+	"warehouse-api/internal/tracing"
+)
+
+const outboxBatchSize = 100
+
+// OutboxService records events in the outbox inside the transaction that
+// raised them and relays them to a sink afterwards, so an event is published
+// if and only if its change committed.
+type OutboxService struct {
+	store repositories.Store
+	sink  eventbus.Sink
+}
+
+// NewOutboxService returns an outbox relaying to sink. With a nil sink events
+// are still recorded and readable through GetEvents, and Relay only positions
+// them.
+func NewOutboxService(store repositories.Store, sink eventbus.Sink) *OutboxService {
+	return &OutboxService{
+		store: store,
+		sink:  sink,
+	}
+}
+
+func (s *OutboxService) Record(ctx context.Context, tx repositories.Tx, event *models.Event) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	return tx.Outbox().Create(ctx, event, payload)
+}
+
+// Relay positions every committed event, which makes it readable through
+// GetEvents, then publishes unpublished events in the order they were
+// recorded until none are left, and returns how many it published. It stops
+// at the first event the sink rejects so later events of the same aggregate
+// are never published ahead of it; that event is retried on the next call.
+func (s *OutboxService) Relay(ctx context.Context) (int, error) {
+	ctx, span := tracing.Start(ctx, "OutboxService.Relay")
+	defer span.End()
+
+	for ctx.Err() == nil {
+		n, err := s.positionBatch(ctx)
+		if err != nil {
+			return 0, err
+		}
+		if n < outboxBatchSize {
+			break
+		}
+	}
+
+	if s.sink == nil {
+		return 0, nil
+	}
+
+	published := 0
+	for ctx.Err() == nil {
+		n, err := s.relayBatch(ctx)
+		published += n
+		if err != nil {
+			return published, err
+		}
+		if n < outboxBatchSize {
+			break
+		}
+	}
+	return published, nil
+}
+
+// positionBatch positions up to a batch of committed events in a
+// transaction of its own, so the positions commit, and become readable, as
+// soon as they are handed out.
+func (s *OutboxService) positionBatch(ctx context.Context) (int, error) {
+	tx, err := s.store.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	n, err := tx.Outbox().AssignPositions(ctx, outboxBatchSize)
+	if err != nil {
+		return 0, err
+	}
+	return n, tx.Commit()
+}
+
+func (s *OutboxService) relayBatch(ctx context.Context) (int, error) {
+	tx, err := s.store.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	outboxRepo := tx.Outbox()
+
+	events, err := outboxRepo.LockUnpublished(ctx, outboxBatchSize)
+	if err != nil {
+		return 0, err
+	}
+
+	var ids []int64
+	var publishErr error
+	for _, event := range events {
+		msg := &eventbus.Message{
+			ID:      event.EventID,
+			Subject: "warehouse." + event.EventType,
+			Key:     fmt.Sprintf("%s:%d", event.AggregateType, event.AggregateID),
+			Payload: event.Payload,
+		}
+		if publishErr = s.sink.Publish(ctx, msg); publishErr != nil {
+			publishErr = fmt.Errorf("publish outbox event %d: %w", event.ID, publishErr)
+			break
+		}
+		ids = append(ids, event.ID)
+	}
+
+	// Keep what was published even when the batch stopped early
+	if err := outboxRepo.MarkPublished(ctx, ids); err != nil {
+		return 0, err
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+
+	if publishErr != nil {
+		return len(ids), publishErr
+	}
+	return len(ids), nil
+}
+
+// GetEvents reads the event stream after the given position, for consumers
+// that pull instead of subscribing to the sink. Events are served once the
+// relay has positioned them, in the order their transactions committed, so
+// a consumer that resumes after the last position it read misses nothing.
+func (s *OutboxService) GetEvents(ctx context.Context, afterPosition int64, limit int, aggregateType string, aggregateID *int) ([]*models.OutboxEvent, error) {
+	ctx, span := tracing.Start(ctx, "OutboxService.GetEvents")
+	defer span.End()
+
+	if limit < 1 {
+		limit = 100
+	}
+	if limit > 1000 {
+		limit = 1000
+	}
+	return s.store.Outbox().GetAfter(ctx, afterPosition, limit, aggregateType, aggregateID)
+}
@@ -0,0 +1,15 @@
+package services
+
+import "warehouse-api/internal/models"
+
+// pageLimit applies the default page size and caps larger requests, so a
+// client cannot ask for an unbounded page.
+func pageLimit(limit int) int {
+	if limit < 1 {
+		return models.DefaultPageLimit
+	}
+	if limit > models.MaxPageLimit {
+		return models.MaxPageLimit
+	}
+	return limit
+}
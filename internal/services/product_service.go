@@ -1,35 +1,79 @@
 package services
 
 import (
-	"errors"
+	"context"
 	"warehouse-api/internal/models"
 	"warehouse-api/internal/repositories"
+	"warehouse-api/internal/tracing"
 )
 
 type ProductService struct {
-	productRepo *repositories.ProductRepository
+	store  repositories.Store
+	events EventRecorder
 }
 
-func NewProductService(productRepo *repositories.ProductRepository) *ProductService {
-	return &ProductService{productRepo: productRepo}
+func NewProductService(store repositories.Store, events EventRecorder) *ProductService {
+	return &ProductService{
+		store:  store,
+		events: events,
+	}
+}
+
+func (s *ProductService) Create(ctx context.Context, req *models.CreateProductRequest) (*models.Product, error) {
+	ctx, span := tracing.Start(ctx, "ProductService.Create")
+	defer span.End()
+
+	tx, err := s.store.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	product, err := s.create(ctx, tx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+
+	return product, nil
 }
 
-func (s *ProductService) Create(req *models.CreateProductRequest) (*models.Product, error) {
+// create applies the creation rules inside tx, which may belong to a caller
+// such as an import, and records the product.created event.
+func (s *ProductService) create(ctx context.Context, tx repositories.Tx, req *models.CreateProductRequest) (*models.Product, error) {
+	productRepo := tx.Products()
+
 	// Check if SKU already exists
-	existing, err := s.productRepo.GetBySKU(req.SKUName)
+	existing, err := productRepo.GetBySKU(ctx, req.SKUName)
 	if err != nil {
 		return nil, err
 	}
 	if existing != nil {
-		return nil, errors.New("SKU name already exists")
+		return nil, ErrSKUExists
+	}
+
+	costingMethod := req.CostingMethod
+	if costingMethod == "" {
+		costingMethod = models.CostingFIFO
 	}
 
 	product := &models.Product{
-		SKUName:  req.SKUName,
-		Quantity: req.Quantity,
+		SKUName:       req.SKUName,
+		Quantity:      req.Quantity,
+		CostingMethod: costingMethod,
+		ReorderLevel:  req.ReorderLevel,
+	}
+
+	err = productRepo.Create(ctx, product)
+	if err != nil {
+		return nil, err
 	}
 
-	err = s.productRepo.Create(product)
+	err = s.events.Record(ctx, tx, newEvent(models.EventProductCreated, models.AggregateProduct, product.ID, product))
 	if err != nil {
 		return nil, err
 	}
@@ -37,51 +81,88 @@ func (s *ProductService) Create(req *models.CreateProductRequest) (*models.Produ
 	return product, nil
 }
 
-func (s *ProductService) GetByID(id int) (*models.Product, error) {
-	product, err := s.productRepo.GetByID(id)
+func (s *ProductService) GetByID(ctx context.Context, id int) (*models.Product, error) {
+	ctx, span := tracing.Start(ctx, "ProductService.GetByID")
+	defer span.End()
+
+	product, err := s.store.Products().GetByID(ctx, id)
 	if err != nil {
 		return nil, err
 	}
 	if product == nil {
-		return nil, errors.New("product not found")
+		return nil, ErrProductNotFound
 	}
 	return product, nil
 }
 
-func (s *ProductService) GetAll(page, limit int, search string) ([]*models.Product, int, error) {
-	if page < 1 {
-		page = 1
-	}
-	if limit < 1 {
-		limit = 10
-	}
-	return s.productRepo.GetAll(page, limit, search)
+// GetByIDs returns the products among ids in a single query, for callers
+// that batch lookups.
+func (s *ProductService) GetByIDs(ctx context.Context, ids []int) ([]*models.Product, error) {
+	ctx, span := tracing.Start(ctx, "ProductService.GetByIDs")
+	defer span.End()
+
+	return s.store.Products().GetByIDs(ctx, ids)
+}
+
+func (s *ProductService) GetAll(ctx context.Context, filter *models.ProductFilter) ([]*models.Product, *models.CursorPagination, error) {
+	ctx, span := tracing.Start(ctx, "ProductService.GetAll")
+	defer span.End()
+
+	filter.Limit = pageLimit(filter.Limit)
+	return s.store.Products().GetAll(ctx, filter)
 }
 
-func (s *ProductService) Update(id int, req *models.UpdateProductRequest) (*models.Product, error) {
-	product, err := s.productRepo.GetByID(id)
+func (s *ProductService) Update(ctx context.Context, id int, req *models.UpdateProductRequest) (*models.Product, error) {
+	ctx, span := tracing.Start(ctx, "ProductService.Update")
+	defer span.End()
+
+	tx, err := s.store.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	productRepo := tx.Products()
+
+	product, err := productRepo.GetByIDForUpdate(ctx, id)
 	if err != nil {
 		return nil, err
 	}
 	if product == nil {
-		return nil, errors.New("product not found")
+		return nil, ErrProductNotFound
 	}
 
 	// Check if SKU name is being changed and if new SKU already exists
 	if product.SKUName != req.SKUName {
-		existing, err := s.productRepo.GetBySKU(req.SKUName)
+		existing, err := productRepo.GetBySKU(ctx, req.SKUName)
 		if err != nil {
 			return nil, err
 		}
 		if existing != nil && existing.ID != id {
-			return nil, errors.New("SKU name already exists")
+			return nil, ErrSKUExists
 		}
 	}
 
 	product.SKUName = req.SKUName
 	product.Quantity = req.Quantity
+	if req.CostingMethod != "" {
+		product.CostingMethod = req.CostingMethod
+	}
+	if req.ReorderLevel != nil {
+		product.ReorderLevel = *req.ReorderLevel
+	}
+
+	err = productRepo.Update(ctx, product)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.events.Record(ctx, tx, newEvent(models.EventProductUpdated, models.AggregateProduct, product.ID, product))
+	if err != nil {
+		return nil, err
+	}
 
-	err = s.productRepo.Update(product)
+	err = tx.Commit()
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,190 @@
+package services
+
+import (
+	"context"
+	"time"
+	"warehouse-api/internal/models"
+	"warehouse-api/internal/repositories"
+	"warehouse-api/internal/tracing"
+)
+
+type ReconciliationService struct {
+	store        repositories.Store
+	stockService *StockService
+}
+
+func NewReconciliationService(store repositories.Store, stockService *StockService) *ReconciliationService {
+	return &ReconciliationService{
+		store:        store,
+		stockService: stockService,
+	}
+}
+
+// Reconcile compares product quantities and location balances with the stock
+// ledger and reports every discrepancy. With req.Repair set, it posts
+// ADJUSTMENT movements that bring the ledger in line with the stored product
+// quantities; stored figures are never edited in place.
+func (s *ReconciliationService) Reconcile(ctx context.Context, req *models.ReconcileRequest, username string) (*models.ReconciliationReport, error) {
+	ctx, span := tracing.Start(ctx, "ReconciliationService.Reconcile")
+	defer span.End()
+
+	report := &models.ReconciliationReport{
+		CheckedAt:     time.Now().UTC(),
+		Repair:        req.Repair,
+		Discrepancies: []*models.Discrepancy{},
+		Adjustments:   []*models.StockMovement{},
+	}
+
+	reconciliationRepo := s.store.Reconciliation()
+
+	drift, err := reconciliationRepo.GetProductDrift(ctx)
+	if err != nil {
+		return nil, err
+	}
+	negative, err := reconciliationRepo.GetNegativeBalances(ctx)
+	if err != nil {
+		return nil, err
+	}
+	overCapacity, err := reconciliationRepo.GetOverCapacity(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	report.Discrepancies = append(report.Discrepancies, drift...)
+	report.Discrepancies = append(report.Discrepancies, negative...)
+	report.Discrepancies = append(report.Discrepancies, overCapacity...)
+
+	if !req.Repair {
+		return report, nil
+	}
+
+	var productIDs []int
+	seen := map[int]bool{}
+	for _, d := range append(drift, negative...) {
+		if !seen[*d.ProductID] {
+			seen[*d.ProductID] = true
+			productIDs = append(productIDs, *d.ProductID)
+		}
+	}
+
+	for _, productID := range productIDs {
+		adjustments, balanced, err := s.repairProduct(ctx, productID, req.LocationID, username)
+		if err != nil {
+			return nil, err
+		}
+		report.Adjustments = append(report.Adjustments, adjustments...)
+
+		for _, d := range drift {
+			if *d.ProductID == productID {
+				d.Repaired = balanced
+			}
+		}
+		for _, d := range negative {
+			if *d.ProductID == productID {
+				d.Repaired = true
+			}
+		}
+	}
+
+	return report, nil
+}
+
+// repairProduct brings one product's ledger in line with its stored quantity
+// in a single transaction: negative location balances are raised to zero,
+// then any remaining difference is posted at the location holding the most
+// stock (or fallbackLocationID when none does). It reports whether the
+// product ended up balanced.
+func (s *ReconciliationService) repairProduct(ctx context.Context, productID int, fallbackLocationID *int, username string) ([]*models.StockMovement, bool, error) {
+	tx, err := s.store.Begin(ctx)
+	if err != nil {
+		return nil, false, err
+	}
+	defer tx.Rollback()
+
+	product, err := tx.Products().GetByIDForUpdate(ctx, productID)
+	if err != nil {
+		return nil, false, err
+	}
+	if product == nil {
+		return nil, true, nil
+	}
+
+	balances, err := tx.Reconciliation().GetProductBalances(ctx, productID)
+	if err != nil {
+		return nil, false, err
+	}
+
+	var adjustments []*models.StockMovement
+	adjust := func(locationID int, movementType string, quantity int, note string) error {
+		movement, err := s.stockService.post(ctx, tx, &models.CreateStockMovementRequest{
+			ProductID:  productID,
+			LocationID: locationID,
+			Type:       movementType,
+			Quantity:   quantity,
+			Note:       note,
+		}, postOptions{
+			source:     models.MovementSourceAdjustment,
+			createdBy:  username,
+			ledgerOnly: true,
+		})
+		if err != nil {
+			return err
+		}
+		adjustments = append(adjustments, movement)
+		return nil
+	}
+
+	ledger := 0
+	for _, balance := range balances {
+		if balance.Quantity < 0 {
+			err := adjust(balance.LocationID, "IN", -balance.Quantity, "Reconciliation: negative location balance")
+			if err != nil {
+				return nil, false, err
+			}
+			balance.Quantity = 0
+		}
+		ledger += balance.Quantity
+	}
+
+	difference := product.Quantity - ledger
+	balanced := true
+	note := "Reconciliation: products.quantity differs from ledger"
+	if difference > 0 {
+		locationID := fallbackLocationID
+		if len(balances) > 0 && balances[0].Quantity > 0 {
+			locationID = &balances[0].LocationID
+		}
+		if locationID == nil {
+			balanced = false
+		} else if err := adjust(*locationID, "IN", difference, note); err != nil {
+			return nil, false, err
+		}
+	} else if difference < 0 {
+		remaining := -difference
+		for _, balance := range balances {
+			if remaining == 0 {
+				break
+			}
+			if balance.Quantity <= 0 {
+				continue
+			}
+			take := balance.Quantity
+			if take > remaining {
+				take = remaining
+			}
+			if err := adjust(balance.LocationID, "OUT", take, note); err != nil {
+				return nil, false, err
+			}
+			remaining -= take
+		}
+		balanced = remaining == 0
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, false, err
+	}
+	observePosted(ctx, adjustments...)
+
+	return adjustments, balanced, nil
+}
@@ -0,0 +1,97 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"warehouse-api/internal/models"
+)
+
+func TestReconcileRepairsQuantityDrift(t *testing.T) {
+	env := newTestEnv(t)
+	ctx := context.Background()
+	product := env.product(t, "SKU-1", models.CostingFIFO, 0)
+	location := env.location(t, "A1", 100)
+	env.move(t, movement(product.ID, location.ID, "IN", 10, 1))
+
+	// Editing the stored quantity bypasses the ledger
+	_, err := env.products.Update(ctx, product.ID, &models.UpdateProductRequest{SKUName: "SKU-1", Quantity: 13})
+	if err != nil {
+		t.Fatalf("update product: %v", err)
+	}
+
+	report, err := env.reconciliation.Reconcile(ctx, &models.ReconcileRequest{}, "auditor")
+	if err != nil {
+		t.Fatalf("reconcile: %v", err)
+	}
+	if len(report.Discrepancies) != 1 || report.Discrepancies[0].Difference != 3 {
+		t.Fatalf("discrepancies = %+v, want one difference of 3", report.Discrepancies)
+	}
+	expectInt(t, "adjustments without repair", len(report.Adjustments), 0)
+
+	report, err = env.reconciliation.Reconcile(ctx, &models.ReconcileRequest{Repair: true}, "auditor")
+	if err != nil {
+		t.Fatalf("repair: %v", err)
+	}
+	if len(report.Adjustments) != 1 {
+		t.Fatalf("adjustments = %d, want 1", len(report.Adjustments))
+	}
+	adjustment := report.Adjustments[0]
+	if adjustment.Type != "IN" || adjustment.Quantity != 3 || adjustment.Source != models.MovementSourceAdjustment {
+		t.Errorf("adjustment = %s %d from %s, want IN 3 from ADJUSTMENT", adjustment.Type, adjustment.Quantity, adjustment.Source)
+	}
+	if !report.Discrepancies[0].Repaired {
+		t.Error("discrepancy not marked repaired")
+	}
+	// The adjustment fixes the ledger, not the stored quantity
+	expectInt(t, "quantity", env.getProduct(t, product.ID).Quantity, 13)
+
+	report, err = env.reconciliation.Reconcile(ctx, &models.ReconcileRequest{}, "auditor")
+	if err != nil {
+		t.Fatalf("reconcile: %v", err)
+	}
+	expectInt(t, "discrepancies after repair", len(report.Discrepancies), 0)
+}
+
+func TestReconcileRepairsNegativeLocationBalance(t *testing.T) {
+	env := newTestEnv(t)
+	ctx := context.Background()
+	// Stock without layers may leave from a location with no stock there
+	product, err := env.products.Create(ctx, &models.CreateProductRequest{SKUName: "SKU-1", CostingMethod: models.CostingFIFO, Quantity: 4})
+	if err != nil {
+		t.Fatalf("create product: %v", err)
+	}
+	a := env.location(t, "A1", 100)
+	b := env.location(t, "B1", 100)
+	env.move(t, movement(product.ID, a.ID, "IN", 10, 1))
+	env.move(t, movement(product.ID, b.ID, "OUT", 4, -1))
+
+	report, err := env.reconciliation.Reconcile(ctx, &models.ReconcileRequest{Repair: true}, "auditor")
+	if err != nil {
+		t.Fatalf("repair: %v", err)
+	}
+	// The four units never entered the ledger, so the quantity differs too
+	kinds := map[string]bool{}
+	for _, d := range report.Discrepancies {
+		kinds[d.Kind] = true
+	}
+	if len(report.Discrepancies) != 2 || !kinds[models.DiscrepancyLocationBalance] || !kinds[models.DiscrepancyProductQuantity] {
+		t.Fatalf("discrepancies = %+v, want a negative location balance and a product quantity", report.Discrepancies)
+	}
+	// Raising B1 to zero brings the ledger to the stored quantity
+	if len(report.Adjustments) != 1 {
+		t.Fatalf("adjustments = %d, want 1", len(report.Adjustments))
+	}
+	if in := report.Adjustments[0]; in.Type != "IN" || in.LocationID != b.ID || in.Quantity != 4 {
+		t.Errorf("adjustment = %s %d at %d, want IN 4 at B1", in.Type, in.Quantity, in.LocationID)
+	}
+
+	expectInt(t, "quantity", env.getProduct(t, product.ID).Quantity, 10)
+	expectInt(t, "usage of A1", env.usage(t, a.ID), 10)
+	expectInt(t, "usage of B1", env.usage(t, b.ID), 0)
+
+	report, err = env.reconciliation.Reconcile(ctx, &models.ReconcileRequest{}, "auditor")
+	if err != nil {
+		t.Fatalf("reconcile: %v", err)
+	}
+	expectInt(t, "discrepancies after repair", len(report.Discrepancies), 0)
+}
@@ -0,0 +1,248 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+	"warehouse-api/internal/models"
+	"warehouse-api/internal/repositories"
+	"warehouse-api/internal/repositories/memory"
+)
+
+// testEnv wires every service to one in-memory store, the way newApp wires
+// them to Postgres.
+type testEnv struct {
+	store *memory.Store
+	clock time.Time
+
+	products       *ProductService
+	locations      *LocationService
+	stock          *StockService
+	ledger         *LedgerService
+	reconciliation *ReconciliationService
+	imports        *ImportService
+	valuation      *ValuationService
+	outbox         *OutboxService
+	stream         *StreamService
+}
+
+func newTestEnv(t *testing.T) *testEnv {
+	t.Helper()
+
+	store := memory.New()
+	env := &testEnv{store: store, clock: time.Now().Add(-24 * time.Hour)}
+	// Every unit of work happens a second after the previous one, so
+	// timestamps are distinct and well in the past.
+	store.Now = func() time.Time {
+		env.clock = env.clock.Add(time.Second)
+		return env.clock
+	}
+
+	env.outbox = NewOutboxService(store, nil)
+	env.stream = NewStreamService(store)
+	events := EventRecorders{env.outbox, NewWebhookService(store), env.stream}
+
+	env.products = NewProductService(store, events)
+	env.locations = NewLocationService(store, events)
+	env.stock = NewStockService(store, events)
+	env.ledger = NewLedgerService(store)
+	env.reconciliation = NewReconciliationService(store, env.stock)
+	env.imports = NewImportService(store, env.products, env.locations, env.stock)
+	env.valuation = NewValuationService(store)
+	return env
+}
+
+// failingStore is the test store with lookups of the product failSKU or
+// failID failing with err, as though the database had gone away mid-request.
+type failingStore struct {
+	*memory.Store
+	failSKU string
+	failID  int
+	err     error
+}
+
+func (s *failingStore) Begin(ctx context.Context) (repositories.Tx, error) {
+	tx, err := s.Store.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &failingTx{Tx: tx, store: s}, nil
+}
+
+type failingTx struct {
+	repositories.Tx
+	store *failingStore
+}
+
+func (tx *failingTx) Products() repositories.ProductStore {
+	return &failingProducts{ProductStore: tx.Tx.Products(), store: tx.store}
+}
+
+type failingProducts struct {
+	repositories.ProductStore
+	store *failingStore
+}
+
+func (p *failingProducts) GetBySKU(ctx context.Context, skuName string) (*models.Product, error) {
+	if skuName == p.store.failSKU {
+		return nil, p.store.err
+	}
+	return p.ProductStore.GetBySKU(ctx, skuName)
+}
+
+func (p *failingProducts) GetByIDForUpdate(ctx context.Context, id int) (*models.Product, error) {
+	if id == p.store.failID {
+		return nil, p.store.err
+	}
+	return p.ProductStore.GetByIDForUpdate(ctx, id)
+}
+
+func (e *testEnv) product(t *testing.T, sku, costingMethod string, reorderLevel int) *models.Product {
+	t.Helper()
+	ctx := context.Background()
+	product, err := e.products.Create(ctx, &models.CreateProductRequest{
+		SKUName:       sku,
+		CostingMethod: costingMethod,
+		ReorderLevel:  reorderLevel,
+	})
+	if err != nil {
+		t.Fatalf("create product %s: %v", sku, err)
+	}
+	return product
+}
+
+func (e *testEnv) location(t *testing.T, code string, capacity int) *models.Location {
+	t.Helper()
+	ctx := context.Background()
+	location, err := e.locations.Create(ctx, &models.CreateLocationRequest{Code: code, Name: code, Capacity: capacity})
+	if err != nil {
+		t.Fatalf("create location %s: %v", code, err)
+	}
+	return location
+}
+
+// movement builds a request; a unitCost below zero leaves the cost out.
+func movement(productID, locationID int, movementType string, quantity int, unitCost float64) *models.CreateStockMovementRequest {
+	req := &models.CreateStockMovementRequest{
+		ProductID:  productID,
+		LocationID: locationID,
+		Type:       movementType,
+		Quantity:   quantity,
+	}
+	if unitCost >= 0 {
+		req.UnitCost = &unitCost
+	}
+	return req
+}
+
+func (e *testEnv) move(t *testing.T, req *models.CreateStockMovementRequest) *models.StockMovement {
+	t.Helper()
+	ctx := context.Background()
+	m, err := e.stock.Create(ctx, req, "tester")
+	if err != nil {
+		t.Fatalf("post %s %d: %v", req.Type, req.Quantity, err)
+	}
+	return m
+}
+
+// getProduct reads the committed product.
+func (e *testEnv) getProduct(t *testing.T, id int) *models.Product {
+	t.Helper()
+	ctx := context.Background()
+	product, err := e.products.GetByID(ctx, id)
+	if err != nil {
+		t.Fatalf("get product %d: %v", id, err)
+	}
+	return product
+}
+
+func (e *testEnv) usage(t *testing.T, locationID int) int {
+	t.Helper()
+	ctx := context.Background()
+	usage, err := e.locations.GetCurrentUsage(ctx, locationID)
+	if err != nil {
+		t.Fatalf("get usage of location %d: %v", locationID, err)
+	}
+	return usage
+}
+
+// movements returns every committed movement, oldest first.
+func (e *testEnv) movements(t *testing.T) []*models.StockMovement {
+	t.Helper()
+	ctx := context.Background()
+	filter := &models.StockMovementFilter{}
+	filter.PageRequest = models.PageRequest{Sort: "id", Limit: models.MaxPageLimit}
+	movements, _, err := e.stock.GetAll(ctx, filter)
+	if err != nil {
+		t.Fatalf("list movements: %v", err)
+	}
+	return movements
+}
+
+// events returns the types of every committed event, in order.
+func (e *testEnv) events(t *testing.T) []string {
+	t.Helper()
+	ctx := context.Background()
+	if _, err := e.outbox.Relay(ctx); err != nil {
+		t.Fatalf("position outbox: %v", err)
+	}
+	events, err := e.outbox.GetEvents(ctx, 0, 1000, "", nil)
+	if err != nil {
+		t.Fatalf("read outbox: %v", err)
+	}
+	types := make([]string, 0, len(events))
+	for _, event := range events {
+		types = append(types, event.EventType)
+	}
+	return types
+}
+
+func countOf(values []string, value string) int {
+	n := 0
+	for _, v := range values {
+		if v == value {
+			n++
+		}
+	}
+	return n
+}
+
+func expectError(t *testing.T, err, want error) {
+	t.Helper()
+	if !errors.Is(err, want) {
+		t.Fatalf("got error %v, want %v", err, want)
+	}
+}
+
+func expectFloat(t *testing.T, name string, got, want float64) {
+	t.Helper()
+	if got != want {
+		t.Errorf("%s = %v, want %v", name, got, want)
+	}
+}
+
+// movementNotifications counts the stream notifications committed for
+// movements, leaving out those for products and locations.
+func (e *testEnv) movementNotifications(t *testing.T) int {
+	t.Helper()
+	n := 0
+	for _, payload := range e.store.Notifications(StreamChannel) {
+		var notification streamNotification
+		if err := json.Unmarshal([]byte(payload), &notification); err != nil {
+			t.Fatalf("stream notification %q: %v", payload, err)
+		}
+		if notification.MovementID != 0 {
+			n++
+		}
+	}
+	return n
+}
+
+func expectInt(t *testing.T, name string, got, want int) {
+	t.Helper()
+	if got != want {
+		t.Errorf("%s = %d, want %d", name, got, want)
+	}
+}
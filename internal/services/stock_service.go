@@ -1,124 +1,464 @@
 package services
 
 import (
-	"database/sql"
-	"errors"
+	"context"
+	"fmt"
+	"log/slog"
+	"warehouse-api/internal/apperrors"
+	"warehouse-api/internal/metrics"
 	"warehouse-api/internal/models"
 	"warehouse-api/internal/repositories"
+	"warehouse-api/internal/tracing"
+	"warehouse-api/internal/utils"
 )
 
 type StockService struct {
-	stockRepo    *repositories.StockMovementRepository
-	productRepo  *repositories.ProductRepository
-	locationRepo *repositories.LocationRepository
-	db           *sql.DB
-}
-
-func NewStockService(
-	stockRepo *repositories.StockMovementRepository,
-	productRepo *repositories.ProductRepository,
-	locationRepo *repositories.LocationRepository,
-	db *sql.DB,
-) *StockService {
+	store  repositories.Store
+	events EventRecorder
+}
+
+func NewStockService(store repositories.Store, events EventRecorder) *StockService {
 	return &StockService{
-		stockRepo:    stockRepo,
-		productRepo:  productRepo,
-		locationRepo: locationRepo,
-		db:           db,
+		store:  store,
+		events: events,
 	}
 }
 
-func (s *StockService) Create(req *models.CreateStockMovementRequest) (*models.StockMovement, error) {
+// postOptions describe how a movement is posted beyond what the request
+// carries.
+type postOptions struct {
+	source    string
+	createdBy string
+	// ledgerOnly records the movement and its cost layers without changing
+	// products.quantity or enforcing the quantity and capacity rules. It is
+	// used for adjustments that bring the ledger in line with the stored
+	// quantity.
+	ledgerOnly bool
+	// reverses is the movement this one compensates, if any.
+	reverses *models.StockMovement
+}
+
+func (s *StockService) Create(ctx context.Context, req *models.CreateStockMovementRequest, username string) (*models.StockMovement, error) {
+	ctx, span := tracing.Start(ctx, "StockService.Create")
+	defer span.End()
+
+	// Start transaction
+	tx, err := s.store.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	movement, err := s.post(ctx, tx, req, postOptions{
+		source:    models.MovementSourceManual,
+		createdBy: username,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Commit transaction
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+	observePosted(ctx, movement)
+
+	return movement, nil
+}
+
+// post validates a movement against the business rules and records it inside
+// tx: the product and location rows are locked, the product quantity and
+// average cost are updated, the movement is inserted and its cost layers are
+// created or consumed. The events the movement raises are recorded in tx as
+// well.
+func (s *StockService) post(ctx context.Context, tx repositories.Tx, req *models.CreateStockMovementRequest, opts postOptions) (*models.StockMovement, error) {
+	productRepo := tx.Products()
+	locationRepo := tx.Locations()
+	stockRepo := tx.StockMovements()
+	costLayerRepo := tx.CostLayers()
+
 	// Validate product exists
-	product, err := s.productRepo.GetByID(req.ProductID)
+	product, err := productRepo.GetByIDForUpdate(ctx, req.ProductID)
 	if err != nil {
 		return nil, err
 	}
 	if product == nil {
-		return nil, errors.New("product not found")
+		return nil, ErrProductNotFound
 	}
 
 	// Validate location exists
-	location, err := s.locationRepo.GetByID(req.LocationID)
+	location, err := locationRepo.GetByIDForUpdate(ctx, req.LocationID)
 	if err != nil {
 		return nil, err
 	}
 	if location == nil {
-		return nil, errors.New("location not found")
+		return nil, ErrLocationNotFound
 	}
 
-	// Start transaction
-	tx, err := s.db.Begin()
+	layers, err := costLayerRepo.GetOpen(ctx, req.ProductID)
 	if err != nil {
 		return nil, err
 	}
-	defer tx.Rollback()
+	if opts.reverses != nil {
+		// Take back the very layer the reversed IN movement created
+		layers = preferLayer(layers, opts.reverses.ID)
+	}
+
+	movement := &models.StockMovement{
+		ProductID:  req.ProductID,
+		LocationID: req.LocationID,
+		Type:       req.Type,
+		Quantity:   req.Quantity,
+		Source:     opts.source,
+		Reference:  req.Reference,
+		Note:       req.Note,
+		CreatedBy:  opts.createdBy,
+	}
+	if opts.reverses != nil {
+		movement.ReversalOf = &opts.reverses.ID
+	}
 
 	// Business rules validation
+	var draws []layerDraw
+	var stockLow, locationFull bool
+	var currentUsage int
 	if req.Type == "OUT" {
-		// Check if product has enough quantity
-		if product.Quantity < req.Quantity {
-			return nil, errors.New("insufficient product quantity")
+		if !opts.ledgerOnly {
+			// Check if product has enough quantity
+			if product.Quantity < req.Quantity {
+				return nil, rejected(ctx, req, ErrInsufficientQuantity)
+			}
+			// Stock received elsewhere cannot leave from here
+			if available(layers, product, req.LocationID) < req.Quantity {
+				return nil, rejected(ctx, req, ErrInsufficientLocationStock)
+			}
+			stockLow = product.Quantity > product.ReorderLevel && product.Quantity-req.Quantity <= product.ReorderLevel
+			product.Quantity -= req.Quantity
+		}
+		draws = costOut(layers, product, movement)
+	} else if req.Type == "IN" {
+		onHand := product.Quantity
+		if opts.ledgerOnly {
+			// products.quantity already counts the stock being layered
+			onHand -= req.Quantity
+		} else {
+			// Check location capacity
+			currentUsage, err = locationRepo.GetCurrentUsage(ctx, req.LocationID)
+			if err != nil {
+				return nil, err
+			}
+			if currentUsage+req.Quantity > location.Capacity {
+				return nil, rejected(ctx, req, ErrCapacityExceeded)
+			}
+			currentUsage += req.Quantity
+			locationFull = currentUsage == location.Capacity
+			product.Quantity += req.Quantity
 		}
-		// Update product quantity
-		newQuantity := product.Quantity - req.Quantity
-		_, err = tx.Exec("UPDATE products SET quantity = $1, updated_at = CURRENT_TIMESTAMP WHERE id = $2", newQuantity, req.ProductID)
+		costIn(layers, product, onHand, movement, req.UnitCost)
+	}
+
+	// Update product quantity
+	err = productRepo.UpdateStock(ctx, product.ID, product.Quantity, product.AverageCost)
+	if err != nil {
+		return nil, err
+	}
+
+	// Create stock movement
+	err = stockRepo.Create(ctx, movement)
+	if err != nil {
+		return nil, err
+	}
+
+	// Maintain cost layers
+	if movement.Type == "IN" {
+		err = costLayerRepo.Create(ctx, &models.CostLayer{
+			ProductID:         movement.ProductID,
+			LocationID:        movement.LocationID,
+			MovementID:        movement.ID,
+			UnitCost:          movement.UnitCost,
+			Quantity:          movement.Quantity,
+			RemainingQuantity: movement.Quantity,
+			CreatedAt:         movement.CreatedAt,
+		})
 		if err != nil {
 			return nil, err
 		}
-	} else if req.Type == "IN" {
-		// Check location capacity
-		currentUsage, err := s.locationRepo.GetCurrentUsage(req.LocationID)
+	}
+	for _, draw := range draws {
+		err = costLayerRepo.Consume(ctx, draw.layerID, movement.ID, draw.quantity, movement.CreatedAt)
 		if err != nil {
 			return nil, err
 		}
-		if currentUsage+req.Quantity > location.Capacity {
-			return nil, errors.New("location capacity exceeded")
-		}
-		// Update product quantity
-		newQuantity := product.Quantity + req.Quantity
-		_, err = tx.Exec("UPDATE products SET quantity = $1, updated_at = CURRENT_TIMESTAMP WHERE id = $2", newQuantity, req.ProductID)
-		if err != nil {
+	}
+
+	// Record events
+	events := []*models.Event{newEvent(models.EventMovementCreated, models.AggregateProduct, movement.ProductID, movement)}
+	if stockLow {
+		events = append(events, newEvent(models.EventStockLow, models.AggregateProduct, product.ID, &models.StockLowEvent{
+			ProductID:    product.ID,
+			SKUName:      product.SKUName,
+			Quantity:     product.Quantity,
+			ReorderLevel: product.ReorderLevel,
+			MovementID:   movement.ID,
+		}))
+	}
+	if locationFull {
+		events = append(events, newEvent(models.EventLocationFull, models.AggregateLocation, location.ID, &models.LocationFullEvent{
+			LocationID:   location.ID,
+			Code:         location.Code,
+			Capacity:     location.Capacity,
+			CurrentUsage: currentUsage,
+			MovementID:   movement.ID,
+		}))
+	}
+	for _, event := range events {
+		if err := s.events.Record(ctx, tx, event); err != nil {
 			return nil, err
 		}
 	}
 
-	// Create stock movement
-	movement := &models.StockMovement{
-		ProductID:  req.ProductID,
-		LocationID: req.LocationID,
-		Type:       req.Type,
-		Quantity:   req.Quantity,
+	return movement, nil
+}
+
+// observePosted logs committed movements and counts them in
+// metrics.MovementsPosted. It is called after the commit, since post runs
+// inside transactions and savepoints that may still be rolled back.
+func observePosted(ctx context.Context, movements ...*models.StockMovement) {
+	for _, movement := range movements {
+		metrics.MovementsPosted.WithLabelValues(movement.Type, movement.Source).Inc()
+		slog.InfoContext(ctx, "Stock movement posted",
+			slog.Int("movement_id", movement.ID),
+			slog.Int("product_id", movement.ProductID),
+			slog.Int("location_id", movement.LocationID),
+			slog.String("type", movement.Type),
+			slog.String("source", movement.Source),
+			slog.Int("quantity", movement.Quantity),
+		)
 	}
+}
 
-	query := `
-		INSERT INTO stock_movements (product_id, location_id, type, quantity)
-		VALUES ($1, $2, $3, $4)
-		RETURNING id, created_at
-	`
-	err = tx.QueryRow(query, movement.ProductID, movement.LocationID, movement.Type, movement.Quantity).Scan(
-		&movement.ID, &movement.CreatedAt,
+// rejected logs a movement a stock rule refused and counts it in
+// metrics.MovementsRejected, then returns err.
+func rejected(ctx context.Context, req *models.CreateStockMovementRequest, err *apperrors.Error) error {
+	metrics.MovementsRejected.WithLabelValues(err.Code).Inc()
+	slog.InfoContext(ctx, "Stock movement rejected",
+		slog.String("reason", err.Code),
+		slog.Int("product_id", req.ProductID),
+		slog.Int("location_id", req.LocationID),
+		slog.String("type", req.Type),
+		slog.Int("quantity", req.Quantity),
 	)
+	return err
+}
+
+// BatchLineError reports which line of an atomic batch was rejected. It
+// unwraps to the line's error, so it is answered like that error.
+type BatchLineError struct {
+	Index int
+	Err   error
+}
+
+func (e *BatchLineError) Error() string {
+	return fmt.Sprintf("movements[%d]: %v", e.Index, e.Err)
+}
+
+func (e *BatchLineError) Unwrap() error {
+	return e.Err
+}
+
+// CreateBatch posts many movements in one transaction with the same
+// validation as Create. Lines are applied in order, so capacity and quantity
+// checks see the effect of the earlier lines in the batch. In atomic mode the
+// first rejected line aborts the whole batch with a *BatchLineError; in
+// best-effort mode each line runs under its own savepoint and lines rejected
+// by validation or a business rule are reported alongside the posted ones.
+// Any other error, such as a lost connection, aborts the batch in either
+// mode.
+func (s *StockService) CreateBatch(ctx context.Context, req *models.BatchStockMovementRequest, username string) (*models.BatchStockMovementResult, error) {
+	ctx, span := tracing.Start(ctx, "StockService.CreateBatch")
+	defer span.End()
+
+	mode := req.Mode
+	if mode == "" {
+		mode = models.BatchModeAtomic
+	}
+	bestEffort := mode == models.BatchModeBestEffort
+
+	tx, err := s.store.Begin(ctx)
 	if err != nil {
 		return nil, err
 	}
+	defer tx.Rollback()
+
+	opts := postOptions{
+		source:    models.MovementSourceManual,
+		createdBy: username,
+	}
+
+	result := &models.BatchStockMovementResult{
+		Mode:    mode,
+		Results: make([]*models.BatchLineResult, 0, len(req.Movements)),
+	}
+	for i, line := range req.Movements {
+		lineResult := &models.BatchLineResult{Index: i}
+		result.Results = append(result.Results, lineResult)
+
+		err := validateBatchLine(line)
+		if err == nil && bestEffort {
+			if spErr := tx.Savepoint("batch_line"); spErr != nil {
+				return nil, spErr
+			}
+			lineResult.Movement, err = s.post(ctx, tx, line, opts)
+			if spErr := tx.ReleaseSavepoint("batch_line", err != nil); spErr != nil {
+				return nil, spErr
+			}
+		} else if err == nil {
+			lineResult.Movement, err = s.post(ctx, tx, line, opts)
+		}
+
+		if err != nil {
+			if !bestEffort || !rejectsLine(err) {
+				return nil, &BatchLineError{Index: i, Err: err}
+			}
+			lineResult.Error = err.Error()
+			result.Failed++
+			continue
+		}
+
+		lineResult.Success = true
+		result.Succeeded++
+	}
 
-	// Commit transaction
 	err = tx.Commit()
 	if err != nil {
 		return nil, err
 	}
+	for _, line := range result.Results {
+		if line.Movement != nil {
+			observePosted(ctx, line.Movement)
+		}
+	}
 
-	return movement, nil
+	return result, nil
 }
 
-func (s *StockService) GetAll(filter *models.StockMovementFilter) ([]*models.StockMovement, int, error) {
-	if filter.Page < 1 {
-		filter.Page = 1
+func validateBatchLine(line *models.CreateStockMovementRequest) error {
+	if line == nil {
+		return ErrMovementRequired
 	}
-	if filter.Limit < 1 {
-		filter.Limit = 10
+	if err := utils.ValidateStruct(line); err != nil {
+		return utils.ValidationError(line, err)
 	}
-	return s.stockRepo.GetAll(filter)
+	return nil
+}
+
+// Reverse posts a compensating movement for a mistaken one and marks the
+// original as reversed. The compensating movement goes through the same
+// validation as any other, so reversing an IN fails if the stock has already
+// left, and reversing an OUT fails if the location has since filled up.
+func (s *StockService) Reverse(ctx context.Context, id int, req *models.ReverseStockMovementRequest, username string) (*models.StockMovementReversal, error) {
+	ctx, span := tracing.Start(ctx, "StockService.Reverse")
+	defer span.End()
+
+	tx, err := s.store.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	stockRepo := tx.StockMovements()
+
+	original, err := stockRepo.GetByIDForUpdate(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if original == nil {
+		return nil, ErrStockMovementNotFound
+	}
+	if original.ReversalOf != nil {
+		return nil, ErrReverseReversal
+	}
+	if original.ReversedAt != nil {
+		return nil, ErrAlreadyReversed
+	}
+
+	compensating := &models.CreateStockMovementRequest{
+		ProductID:  original.ProductID,
+		LocationID: original.LocationID,
+		Type:       "IN",
+		Quantity:   original.Quantity,
+		Reference:  original.Reference,
+		Note:       req.Reason,
+	}
+	if original.Type == "IN" {
+		compensating.Type = "OUT"
+	} else {
+		// Put the goods back at the cost they left with
+		compensating.UnitCost = &original.UnitCost
+	}
+
+	reversal, err := s.post(ctx, tx, compensating, postOptions{
+		source:    models.MovementSourceReversal,
+		createdBy: username,
+		// Adjustments never touched products.quantity, so neither may
+		// their reversal
+		ledgerOnly: original.Source == models.MovementSourceAdjustment,
+		reverses:   original,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	original.ReversedAt = &reversal.CreatedAt
+	original.ReversedBy = username
+	original.ReversalReason = req.Reason
+	err = stockRepo.MarkReversed(ctx, original)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+	observePosted(ctx, reversal)
+
+	return &models.StockMovementReversal{Original: original, Reversal: reversal}, nil
+}
+
+func (s *StockService) GetAll(ctx context.Context, filter *models.StockMovementFilter) ([]*models.StockMovement, *models.CursorPagination, error) {
+	ctx, span := tracing.Start(ctx, "StockService.GetAll")
+	defer span.End()
+
+	filter.Limit = pageLimit(filter.Limit)
+	return s.store.StockMovements().GetAll(ctx, filter)
+}
+
+// GetBalancesByProducts returns the per-location balances of the products
+// among productIDs in a single query.
+func (s *StockService) GetBalancesByProducts(ctx context.Context, productIDs []int) ([]*models.StockBalanceLine, error) {
+	ctx, span := tracing.Start(ctx, "StockService.GetBalancesByProducts")
+	defer span.End()
+
+	return s.store.StockMovements().GetBalancesByProducts(ctx, productIDs)
+}
+
+// GetBalancesByLocations returns the balance of every product held at the
+// locations among locationIDs in a single query.
+func (s *StockService) GetBalancesByLocations(ctx context.Context, locationIDs []int) ([]*models.StockBalanceLine, error) {
+	ctx, span := tracing.Start(ctx, "StockService.GetBalancesByLocations")
+	defer span.End()
+
+	return s.store.StockMovements().GetBalancesByLocations(ctx, locationIDs)
+}
+
+// GetRecentByProducts returns up to limit of the latest movements of each
+// product among productIDs in a single query.
+func (s *StockService) GetRecentByProducts(ctx context.Context, productIDs []int, limit int) ([]*models.StockMovement, error) {
+	ctx, span := tracing.Start(ctx, "StockService.GetRecentByProducts")
+	defer span.End()
+
+	return s.store.StockMovements().GetRecentByProducts(ctx, productIDs, limit)
 }
 
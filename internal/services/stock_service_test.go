@@ -0,0 +1,561 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+	"warehouse-api/internal/apperrors"
+	"warehouse-api/internal/metrics"
+	"warehouse-api/internal/models"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestCreateRejectsUnknownProductAndLocation(t *testing.T) {
+	env := newTestEnv(t)
+	ctx := context.Background()
+	product := env.product(t, "SKU-1", models.CostingFIFO, 0)
+	location := env.location(t, "A1", 100)
+
+	_, err := env.stock.Create(ctx, movement(999, location.ID, "IN", 1, 1), "tester")
+	expectError(t, err, ErrProductNotFound)
+
+	_, err = env.stock.Create(ctx, movement(product.ID, 999, "IN", 1, 1), "tester")
+	expectError(t, err, ErrLocationNotFound)
+
+	if n := len(env.movements(t)); n != 0 {
+		t.Fatalf("%d movements recorded, want none", n)
+	}
+}
+
+func TestOutRequiresProductQuantity(t *testing.T) {
+	env := newTestEnv(t)
+	ctx := context.Background()
+	product := env.product(t, "SKU-1", models.CostingFIFO, 0)
+	location := env.location(t, "A1", 100)
+	env.move(t, movement(product.ID, location.ID, "IN", 5, 1))
+
+	_, err := env.stock.Create(ctx, movement(product.ID, location.ID, "OUT", 6, -1), "tester")
+	expectError(t, err, ErrInsufficientQuantity)
+
+	expectInt(t, "quantity", env.getProduct(t, product.ID).Quantity, 5)
+	expectInt(t, "movements", len(env.movements(t)), 1)
+
+	// The whole quantity may leave
+	env.move(t, movement(product.ID, location.ID, "OUT", 5, -1))
+	expectInt(t, "quantity", env.getProduct(t, product.ID).Quantity, 0)
+	expectInt(t, "usage", env.usage(t, location.ID), 0)
+}
+
+func TestInRespectsLocationCapacity(t *testing.T) {
+	env := newTestEnv(t)
+	ctx := context.Background()
+	product := env.product(t, "SKU-1", models.CostingFIFO, 0)
+	location := env.location(t, "A1", 10)
+	env.move(t, movement(product.ID, location.ID, "IN", 6, 1))
+
+	_, err := env.stock.Create(ctx, movement(product.ID, location.ID, "IN", 5, 1), "tester")
+	expectError(t, err, ErrCapacityExceeded)
+	expectInt(t, "usage", env.usage(t, location.ID), 6)
+	expectInt(t, "quantity", env.getProduct(t, product.ID).Quantity, 6)
+	expectInt(t, "location.full events", countOf(env.events(t), models.EventLocationFull), 0)
+
+	// Filling the location exactly is allowed and announced
+	env.move(t, movement(product.ID, location.ID, "IN", 4, 1))
+	expectInt(t, "usage", env.usage(t, location.ID), 10)
+	expectInt(t, "location.full events", countOf(env.events(t), models.EventLocationFull), 1)
+}
+
+func TestStockLowFiresOnceWhenCrossingReorderLevel(t *testing.T) {
+	env := newTestEnv(t)
+	product := env.product(t, "SKU-1", models.CostingFIFO, 5)
+	location := env.location(t, "A1", 100)
+	env.move(t, movement(product.ID, location.ID, "IN", 10, 1))
+
+	env.move(t, movement(product.ID, location.ID, "OUT", 4, -1))
+	expectInt(t, "stock.low after 10->6", countOf(env.events(t), models.EventStockLow), 0)
+
+	env.move(t, movement(product.ID, location.ID, "OUT", 1, -1))
+	expectInt(t, "stock.low after 6->5", countOf(env.events(t), models.EventStockLow), 1)
+
+	env.move(t, movement(product.ID, location.ID, "OUT", 1, -1))
+	expectInt(t, "stock.low after 5->4", countOf(env.events(t), models.EventStockLow), 1)
+}
+
+func TestFIFOCosting(t *testing.T) {
+	env := newTestEnv(t)
+	ctx := context.Background()
+	product := env.product(t, "SKU-1", models.CostingFIFO, 0)
+	location := env.location(t, "A1", 100)
+
+	env.move(t, movement(product.ID, location.ID, "IN", 10, 2))
+	in := env.move(t, movement(product.ID, location.ID, "IN", 10, 4))
+	expectFloat(t, "average after receipts", in.AverageCost, 3)
+
+	out := env.move(t, movement(product.ID, location.ID, "OUT", 15, -1))
+	expectFloat(t, "cost of goods sold", out.TotalCost, 40)
+	expectFloat(t, "unit cost", out.UnitCost, 2.6667)
+	// Only the 5 units from the 4.00 layer are left
+	expectFloat(t, "average after issue", env.getProduct(t, product.ID).AverageCost, 4)
+
+	report, err := env.valuation.GetValuation(ctx, time.Now())
+	if err != nil {
+		t.Fatalf("valuation: %v", err)
+	}
+	expectFloat(t, "stock value", report.TotalValue, 20)
+
+	// Before the issue all 20 units were on hand
+	report, err = env.valuation.GetValuation(ctx, in.CreatedAt)
+	if err != nil {
+		t.Fatalf("valuation: %v", err)
+	}
+	expectFloat(t, "stock value before issue", report.TotalValue, 60)
+}
+
+func TestAVGCosting(t *testing.T) {
+	env := newTestEnv(t)
+	ctx := context.Background()
+	product := env.product(t, "SKU-1", models.CostingAVG, 0)
+	location := env.location(t, "A1", 100)
+
+	env.move(t, movement(product.ID, location.ID, "IN", 10, 2))
+	env.move(t, movement(product.ID, location.ID, "IN", 10, 4))
+
+	out := env.move(t, movement(product.ID, location.ID, "OUT", 15, -1))
+	expectFloat(t, "cost of goods sold", out.TotalCost, 45)
+	expectFloat(t, "unit cost", out.UnitCost, 3)
+	expectFloat(t, "average after issue", env.getProduct(t, product.ID).AverageCost, 3)
+
+	report, err := env.valuation.GetValuation(ctx, time.Now())
+	if err != nil {
+		t.Fatalf("valuation: %v", err)
+	}
+	expectFloat(t, "stock value", report.TotalValue, 15)
+}
+
+func TestValuationIncludesUnlayeredStock(t *testing.T) {
+	env := newTestEnv(t)
+	ctx := context.Background()
+	location := env.location(t, "A1", 100)
+
+	// Ten units are added by editing the product, so no layer holds them
+	avg := env.product(t, "SKU-AVG", models.CostingAVG, 0)
+	env.move(t, movement(avg.ID, location.ID, "IN", 10, 2))
+	if _, err := env.products.Update(ctx, avg.ID, &models.UpdateProductRequest{SKUName: "SKU-AVG", Quantity: 20}); err != nil {
+		t.Fatalf("update product: %v", err)
+	}
+	in := env.move(t, movement(avg.ID, location.ID, "IN", 10, 5))
+	expectFloat(t, "average over all stock on hand", in.AverageCost, 3)
+
+	// Five units come with the product when it is created
+	fifo, err := env.products.Create(ctx, &models.CreateProductRequest{SKUName: "SKU-FIFO", CostingMethod: models.CostingFIFO, Quantity: 5})
+	if err != nil {
+		t.Fatalf("create product: %v", err)
+	}
+	in = env.move(t, movement(fifo.ID, location.ID, "IN", 5, 4))
+	expectFloat(t, "FIFO average over layers", in.AverageCost, 4)
+
+	report, err := env.valuation.GetValuation(ctx, time.Now())
+	if err != nil {
+		t.Fatalf("valuation: %v", err)
+	}
+	if len(report.Products) != 2 {
+		t.Fatalf("valued %d products, want 2", len(report.Products))
+	}
+	for _, want := range []struct {
+		product   *models.ProductValuation
+		quantity  int
+		unlayered int
+		value     float64
+	}{
+		{report.Products[0], 30, 10, 90},
+		{report.Products[1], 10, 5, 40},
+	} {
+		expectInt(t, want.product.SKUName+" quantity", want.product.Quantity, want.quantity)
+		expectInt(t, want.product.SKUName+" unlayered quantity", want.product.UnlayeredQuantity, want.unlayered)
+		expectFloat(t, want.product.SKUName+" value", want.product.Value, want.value)
+	}
+	expectFloat(t, "stock value", report.TotalValue, 130)
+}
+
+func TestInWithoutUnitCostKeepsAverage(t *testing.T) {
+	env := newTestEnv(t)
+	product := env.product(t, "SKU-1", models.CostingFIFO, 0)
+	location := env.location(t, "A1", 100)
+	env.move(t, movement(product.ID, location.ID, "IN", 10, 3))
+
+	in := env.move(t, movement(product.ID, location.ID, "IN", 10, -1))
+	expectFloat(t, "unit cost", in.UnitCost, 3)
+	expectFloat(t, "average", in.AverageCost, 3)
+}
+
+func TestOutDrawsLayersAtItsLocationFirst(t *testing.T) {
+	env := newTestEnv(t)
+	product := env.product(t, "SKU-1", models.CostingFIFO, 0)
+	a := env.location(t, "A1", 100)
+	b := env.location(t, "B1", 100)
+	env.move(t, movement(product.ID, a.ID, "IN", 5, 1))
+	env.move(t, movement(product.ID, b.ID, "IN", 5, 3))
+
+	out := env.move(t, movement(product.ID, b.ID, "OUT", 5, -1))
+	expectFloat(t, "cost of goods sold", out.TotalCost, 15)
+	expectFloat(t, "average after issue", env.getProduct(t, product.ID).AverageCost, 1)
+}
+
+func TestOutTakesOnlyStockAtItsLocation(t *testing.T) {
+	env := newTestEnv(t)
+	ctx := context.Background()
+	a := env.location(t, "A1", 100)
+	b := env.location(t, "B1", 100)
+
+	// Stock received at A1 cannot leave from B1
+	product := env.product(t, "SKU-1", models.CostingFIFO, 0)
+	env.move(t, movement(product.ID, a.ID, "IN", 10, 1))
+	_, err := env.stock.Create(ctx, movement(product.ID, b.ID, "OUT", 4, -1), "tester")
+	expectError(t, err, ErrInsufficientLocationStock)
+	expectInt(t, "quantity", env.getProduct(t, product.ID).Quantity, 10)
+
+	// Stock without layers has no location, so it may leave from any, at
+	// the average cost
+	loose, err := env.products.Create(ctx, &models.CreateProductRequest{SKUName: "LOOSE-1", CostingMethod: models.CostingFIFO, Quantity: 5})
+	if err != nil {
+		t.Fatalf("create product: %v", err)
+	}
+	env.move(t, movement(loose.ID, a.ID, "IN", 10, 3))
+	_, err = env.stock.Create(ctx, movement(loose.ID, b.ID, "OUT", 6, -1), "tester")
+	expectError(t, err, ErrInsufficientLocationStock)
+	out := env.move(t, movement(loose.ID, b.ID, "OUT", 5, -1))
+	expectFloat(t, "cost of the unlayered stock", out.TotalCost, 15)
+	expectInt(t, "usage of A1", env.usage(t, a.ID), 20)
+
+	// A1's layers are untouched, so its stock is still valued at its cost
+	report, err := env.valuation.GetValuation(ctx, time.Now())
+	if err != nil {
+		t.Fatalf("valuation: %v", err)
+	}
+	for _, p := range report.Products {
+		if p.ProductID == loose.ID && (p.Quantity != 10 || p.Value != 30 || p.UnlayeredQuantity != 0) {
+			t.Errorf("LOOSE-1 valued at %d (%d unlayered) for %v, want 10 for 30", p.Quantity, p.UnlayeredQuantity, p.Value)
+		}
+	}
+}
+
+func TestReverseIn(t *testing.T) {
+	env := newTestEnv(t)
+	ctx := context.Background()
+	product := env.product(t, "SKU-1", models.CostingFIFO, 0)
+	location := env.location(t, "A1", 100)
+	env.move(t, movement(product.ID, location.ID, "IN", 10, 2))
+	mistaken := env.move(t, movement(product.ID, location.ID, "IN", 10, 4))
+
+	result, err := env.stock.Reverse(ctx, mistaken.ID, &models.ReverseStockMovementRequest{Reason: "wrong supplier"}, "auditor")
+	if err != nil {
+		t.Fatalf("reverse: %v", err)
+	}
+
+	reversal := result.Reversal
+	if reversal.Type != "OUT" || reversal.Quantity != 10 || reversal.Source != models.MovementSourceReversal {
+		t.Errorf("reversal = %s %d from %s, want OUT 10 from REVERSAL", reversal.Type, reversal.Quantity, reversal.Source)
+	}
+	if reversal.ReversalOf == nil || *reversal.ReversalOf != mistaken.ID {
+		t.Errorf("reversal_of = %v, want %d", reversal.ReversalOf, mistaken.ID)
+	}
+	// The very layer the mistaken receipt created is taken back
+	expectFloat(t, "reversal cost", reversal.TotalCost, 40)
+	expectFloat(t, "average after reversal", env.getProduct(t, product.ID).AverageCost, 2)
+	expectInt(t, "quantity", env.getProduct(t, product.ID).Quantity, 10)
+
+	original, err := env.store.StockMovements().GetByID(ctx, mistaken.ID)
+	if err != nil {
+		t.Fatalf("get original: %v", err)
+	}
+	if original.ReversedAt == nil || original.ReversedBy != "auditor" || original.ReversalReason != "wrong supplier" {
+		t.Errorf("original not marked reversed: %+v", original)
+	}
+}
+
+func TestReverseOutRestoresCost(t *testing.T) {
+	env := newTestEnv(t)
+	ctx := context.Background()
+	product := env.product(t, "SKU-1", models.CostingFIFO, 0)
+	location := env.location(t, "A1", 100)
+	env.move(t, movement(product.ID, location.ID, "IN", 10, 2))
+	out := env.move(t, movement(product.ID, location.ID, "OUT", 4, -1))
+
+	result, err := env.stock.Reverse(ctx, out.ID, &models.ReverseStockMovementRequest{Reason: "returned"}, "auditor")
+	if err != nil {
+		t.Fatalf("reverse: %v", err)
+	}
+	if result.Reversal.Type != "IN" {
+		t.Errorf("reversal type = %s, want IN", result.Reversal.Type)
+	}
+	expectFloat(t, "reversal unit cost", result.Reversal.UnitCost, 2)
+	expectInt(t, "quantity", env.getProduct(t, product.ID).Quantity, 10)
+	expectFloat(t, "average", env.getProduct(t, product.ID).AverageCost, 2)
+}
+
+func TestReverseRules(t *testing.T) {
+	env := newTestEnv(t)
+	ctx := context.Background()
+	product := env.product(t, "SKU-1", models.CostingFIFO, 0)
+	location := env.location(t, "A1", 100)
+	in := env.move(t, movement(product.ID, location.ID, "IN", 10, 1))
+	reason := &models.ReverseStockMovementRequest{Reason: "mistake"}
+
+	_, err := env.stock.Reverse(ctx, 999, reason, "auditor")
+	expectError(t, err, ErrStockMovementNotFound)
+
+	// Reversing an IN whose stock has left fails like any other OUT
+	env.move(t, movement(product.ID, location.ID, "OUT", 8, -1))
+	_, err = env.stock.Reverse(ctx, in.ID, reason, "auditor")
+	expectError(t, err, ErrInsufficientQuantity)
+
+	original, err := env.store.StockMovements().GetByID(ctx, in.ID)
+	if err != nil {
+		t.Fatalf("get original: %v", err)
+	}
+	if original.ReversedAt != nil {
+		t.Fatalf("failed reversal marked the movement reversed")
+	}
+
+	env.move(t, movement(product.ID, location.ID, "IN", 8, 1))
+	result, err := env.stock.Reverse(ctx, in.ID, reason, "auditor")
+	if err != nil {
+		t.Fatalf("reverse: %v", err)
+	}
+
+	_, err = env.stock.Reverse(ctx, in.ID, reason, "auditor")
+	expectError(t, err, ErrAlreadyReversed)
+
+	_, err = env.stock.Reverse(ctx, result.Reversal.ID, reason, "auditor")
+	expectError(t, err, ErrReverseReversal)
+}
+
+func TestReverseOutFailsWhenLocationFilledUp(t *testing.T) {
+	env := newTestEnv(t)
+	ctx := context.Background()
+	product := env.product(t, "SKU-1", models.CostingFIFO, 0)
+	location := env.location(t, "A1", 10)
+	env.move(t, movement(product.ID, location.ID, "IN", 10, 1))
+	out := env.move(t, movement(product.ID, location.ID, "OUT", 3, -1))
+	env.move(t, movement(product.ID, location.ID, "IN", 3, 1))
+
+	_, err := env.stock.Reverse(ctx, out.ID, &models.ReverseStockMovementRequest{Reason: "returned"}, "auditor")
+	expectError(t, err, ErrCapacityExceeded)
+}
+
+func TestAtomicBatchPostsAllOrNothing(t *testing.T) {
+	env := newTestEnv(t)
+	ctx := context.Background()
+	product := env.product(t, "SKU-1", models.CostingFIFO, 0)
+	location := env.location(t, "A1", 10)
+
+	// Each line alone fits; together they do not, because later lines see
+	// the earlier ones
+	_, err := env.stock.CreateBatch(ctx, &models.BatchStockMovementRequest{
+		Movements: []*models.CreateStockMovementRequest{
+			movement(product.ID, location.ID, "IN", 6, 1),
+			movement(product.ID, location.ID, "IN", 6, 1),
+		},
+	}, "tester")
+
+	var lineErr *BatchLineError
+	if !errors.As(err, &lineErr) || lineErr.Index != 1 {
+		t.Fatalf("got error %v, want a *BatchLineError for line 1", err)
+	}
+	expectError(t, err, ErrCapacityExceeded)
+
+	expectInt(t, "movements", len(env.movements(t)), 0)
+	expectInt(t, "quantity", env.getProduct(t, product.ID).Quantity, 0)
+	expectInt(t, "movement.created events", countOf(env.events(t), models.EventMovementCreated), 0)
+	if n := env.movementNotifications(t); n != 0 {
+		t.Errorf("%d stream notifications sent for a rolled back batch", n)
+	}
+
+	result, err := env.stock.CreateBatch(ctx, &models.BatchStockMovementRequest{
+		Mode: models.BatchModeAtomic,
+		Movements: []*models.CreateStockMovementRequest{
+			movement(product.ID, location.ID, "IN", 6, 1),
+			movement(product.ID, location.ID, "OUT", 2, -1),
+		},
+	}, "tester")
+	if err != nil {
+		t.Fatalf("batch: %v", err)
+	}
+	expectInt(t, "succeeded", result.Succeeded, 2)
+	expectInt(t, "quantity", env.getProduct(t, product.ID).Quantity, 4)
+}
+
+func TestBestEffortBatchRollsBackOnlyRejectedLines(t *testing.T) {
+	env := newTestEnv(t)
+	ctx := context.Background()
+	product := env.product(t, "SKU-1", models.CostingFIFO, 0)
+	location := env.location(t, "A1", 10)
+
+	result, err := env.stock.CreateBatch(ctx, &models.BatchStockMovementRequest{
+		Mode: models.BatchModeBestEffort,
+		Movements: []*models.CreateStockMovementRequest{
+			movement(product.ID, location.ID, "IN", 6, 1),
+			movement(product.ID, location.ID, "IN", 6, 1),
+			nil,
+			movement(product.ID, location.ID, "OUT", 0, -1),
+			movement(product.ID, location.ID, "IN", 4, 1),
+		},
+	}, "tester")
+	if err != nil {
+		t.Fatalf("batch: %v", err)
+	}
+
+	expectInt(t, "succeeded", result.Succeeded, 2)
+	expectInt(t, "failed", result.Failed, 3)
+	for i, want := range []bool{true, false, false, false, true} {
+		if result.Results[i].Success != want {
+			t.Errorf("line %d success = %v, want %v (%s)", i, result.Results[i].Success, want, result.Results[i].Error)
+		}
+	}
+
+	expectInt(t, "usage", env.usage(t, location.ID), 10)
+	expectInt(t, "quantity", env.getProduct(t, product.ID).Quantity, 10)
+	events := env.events(t)
+	expectInt(t, "movement.created events", countOf(events, models.EventMovementCreated), 2)
+	expectInt(t, "location.full events", countOf(events, models.EventLocationFull), 1)
+	expectInt(t, "stream notifications", env.movementNotifications(t), 2)
+}
+
+func TestBestEffortBatchAbortsOnErrorsThatAreNotRejections(t *testing.T) {
+	env := newTestEnv(t)
+	ctx := context.Background()
+	product := env.product(t, "SKU-1", models.CostingFIFO, 0)
+	broken := env.product(t, "SKU-2", models.CostingFIFO, 0)
+	location := env.location(t, "A1", 10)
+
+	fail := errors.New("connection reset by peer")
+	stock := NewStockService(&failingStore{Store: env.store, failID: broken.ID, err: fail}, EventRecorders{env.outbox})
+	_, err := stock.CreateBatch(ctx, &models.BatchStockMovementRequest{
+		Mode: models.BatchModeBestEffort,
+		Movements: []*models.CreateStockMovementRequest{
+			movement(product.ID, location.ID, "IN", 6, 1),
+			movement(product.ID, location.ID, "OUT", 60, -1),
+			movement(broken.ID, location.ID, "IN", 1, 1),
+		},
+	}, "tester")
+
+	var lineErr *BatchLineError
+	if !errors.As(err, &lineErr) || lineErr.Index != 2 || !errors.Is(err, fail) {
+		t.Fatalf("got error %v, want a *BatchLineError for line 2 wrapping %v", err, fail)
+	}
+	expectInt(t, "movements", len(env.movements(t)), 0)
+	expectInt(t, "quantity", env.getProduct(t, product.ID).Quantity, 0)
+}
+
+func TestFailedMovementRecordsNoEvents(t *testing.T) {
+	env := newTestEnv(t)
+	ctx := context.Background()
+	product := env.product(t, "SKU-1", models.CostingFIFO, 0)
+	location := env.location(t, "A1", 10)
+	env.move(t, movement(product.ID, location.ID, "IN", 10, 1))
+	before := env.events(t)
+
+	_, err := env.stock.Create(ctx, movement(product.ID, location.ID, "IN", 1, 1), "tester")
+	expectError(t, err, ErrCapacityExceeded)
+
+	expectInt(t, "events", len(env.events(t)), len(before))
+	expectInt(t, "stream notifications", env.movementNotifications(t), 1)
+}
+
+func TestMovementMetrics(t *testing.T) {
+	env := newTestEnv(t)
+	ctx := context.Background()
+	product := env.product(t, "SKU-1", models.CostingFIFO, 0)
+	location := env.location(t, "A1", 10)
+
+	posted := metrics.MovementsPosted.WithLabelValues("IN", models.MovementSourceManual)
+	rejected := metrics.MovementsRejected.WithLabelValues(ErrCapacityExceeded.Code)
+	postedBefore, rejectedBefore := testutil.ToFloat64(posted), testutil.ToFloat64(rejected)
+
+	// Only the committed line of a best-effort batch counts as posted
+	_, err := env.stock.CreateBatch(ctx, &models.BatchStockMovementRequest{
+		Mode: models.BatchModeBestEffort,
+		Movements: []*models.CreateStockMovementRequest{
+			movement(product.ID, location.ID, "IN", 8, 1),
+			movement(product.ID, location.ID, "IN", 8, 1),
+		},
+	}, "tester")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectFloat(t, "posted", testutil.ToFloat64(posted)-postedBefore, 1)
+	expectFloat(t, "rejected", testutil.ToFloat64(rejected)-rejectedBefore, 1)
+
+	// An atomic batch posts nothing when a line is rejected
+	_, err = env.stock.CreateBatch(ctx, &models.BatchStockMovementRequest{
+		Movements: []*models.CreateStockMovementRequest{
+			movement(product.ID, location.ID, "IN", 1, 1),
+			movement(product.ID, location.ID, "IN", 5, 1),
+		},
+	}, "tester")
+	expectError(t, err, ErrCapacityExceeded)
+	expectFloat(t, "posted", testutil.ToFloat64(posted)-postedBefore, 1)
+	expectFloat(t, "rejected", testutil.ToFloat64(rejected)-rejectedBefore, 2)
+}
+
+func TestExpiredContextPostsNothing(t *testing.T) {
+	env := newTestEnv(t)
+	product := env.product(t, "SKU-1", models.CostingFIFO, 0)
+	location := env.location(t, "A1", 10)
+
+	ctx, cancel := context.WithTimeout(context.Background(), -time.Second)
+	defer cancel()
+	_, err := env.stock.Create(ctx, movement(product.ID, location.ID, "IN", 1, 1), "tester")
+	if apperrors.KindOf(err) != apperrors.Timeout {
+		t.Fatalf("error = %v, want a timeout", err)
+	}
+
+	if n := len(env.movements(t)); n != 0 {
+		t.Fatalf("%d movements recorded, want none", n)
+	}
+}
+
+func TestListMovementsPagesWithCursor(t *testing.T) {
+	env := newTestEnv(t)
+	ctx := context.Background()
+	product := env.product(t, "SKU-1", models.CostingFIFO, 0)
+	location := env.location(t, "A1", 100)
+	for quantity := 1; quantity <= 5; quantity++ {
+		env.move(t, movement(product.ID, location.ID, "IN", quantity, 1))
+	}
+
+	var quantities []int
+	filter := &models.StockMovementFilter{}
+	filter.PageRequest = models.PageRequest{Sort: "-quantity", Limit: 2}
+	for page := 0; ; page++ {
+		movements, pagination, err := env.stock.GetAll(ctx, filter)
+		if err != nil {
+			t.Fatalf("page %d: %v", page, err)
+		}
+		for _, m := range movements {
+			quantities = append(quantities, m.Quantity)
+		}
+		if !pagination.HasMore {
+			break
+		}
+		filter.Cursor = pagination.NextCursor
+	}
+
+	want := []int{5, 4, 3, 2, 1}
+	if len(quantities) != len(want) {
+		t.Fatalf("quantities = %v, want %v", quantities, want)
+	}
+	for i := range want {
+		if quantities[i] != want[i] {
+			t.Fatalf("quantities = %v, want %v", quantities, want)
+		}
+	}
+
+	filter.Sort = "quantity"
+	_, _, err := env.stock.GetAll(ctx, filter)
+	if err == nil {
+		t.Fatal("cursor accepted for a different sort")
+	}
+}
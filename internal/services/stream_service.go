@@ -0,0 +1,337 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"sync"
+	"time"
+	"warehouse-api/internal/logging"
+	"warehouse-api/internal/models"
+	"warehouse-api/internal/repositories"
+
+	"github.com/lib/pq"
+)
+
+// StreamChannel is the Postgres NOTIFY channel committed movements, product
+// changes and new locations are announced on. Every API replica listens on
+// it, so subscribers see changes made through any replica.
+const StreamChannel = "stock_stream"
+
+const streamBuffer = 64
+
+// streamNotification is the NOTIFY payload. It only carries IDs: the current
+// figures are read back when it arrives, after the change has committed.
+// Exactly one ID is set.
+type streamNotification struct {
+	MovementID int `json:"movement_id,omitempty"`
+	ProductID  int `json:"product_id,omitempty"`
+	LocationID int `json:"location_id,omitempty"`
+}
+
+// StreamSubscription receives the updates matching its filter on Messages
+// until it is unsubscribed. Messages is closed if the subscriber falls more
+// than a buffer behind, or when the service is closed.
+type StreamSubscription struct {
+	Messages <-chan *models.StreamMessage
+
+	filter   *models.StreamFilter
+	messages chan *models.StreamMessage
+	closed   bool
+}
+
+// ShuttingDown reports whether Messages was closed because the service was
+// closed rather than because the subscriber fell behind. It is only
+// meaningful once Messages is closed.
+func (sub *StreamSubscription) ShuttingDown() bool {
+	return sub.closed
+}
+
+type StreamService struct {
+	store repositories.Store
+
+	mu            sync.Mutex
+	subscriptions map[*StreamSubscription]struct{}
+	closed        bool
+}
+
+func NewStreamService(store repositories.Store) *StreamService {
+	return &StreamService{
+		store:         store,
+		subscriptions: make(map[*StreamSubscription]struct{}),
+	}
+}
+
+// Record announces a created movement, a created or updated product, or a
+// created location on StreamChannel. The notification is only delivered once
+// tx commits. stock.low and location.full follow from a movement, whose
+// updates already carry the new figures, so they are not announced again.
+func (s *StreamService) Record(ctx context.Context, tx repositories.Tx, event *models.Event) error {
+	var notification streamNotification
+	switch data := event.Data.(type) {
+	case *models.StockMovement:
+		if event.Type != models.EventMovementCreated {
+			return nil
+		}
+		notification.MovementID = data.ID
+	case *models.Product:
+		notification.ProductID = data.ID
+	case *models.Location:
+		notification.LocationID = data.ID
+	default:
+		return nil
+	}
+
+	payload, err := json.Marshal(&notification)
+	if err != nil {
+		return err
+	}
+	return tx.Notify(StreamChannel, string(payload))
+}
+
+func (s *StreamService) Subscribe(filter *models.StreamFilter) *StreamSubscription {
+	messages := make(chan *models.StreamMessage, streamBuffer)
+	sub := &StreamSubscription{Messages: messages, filter: filter, messages: messages}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		sub.closed = true
+		close(messages)
+		return sub
+	}
+	s.subscriptions[sub] = struct{}{}
+	return sub
+}
+
+// Close ends every subscription, and any made later, so that long-lived
+// streams do not hold up a graceful shutdown.
+func (s *StreamService) Close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.closed = true
+	for sub := range s.subscriptions {
+		delete(s.subscriptions, sub)
+		sub.closed = true
+		close(sub.messages)
+	}
+}
+
+func (s *StreamService) Unsubscribe(sub *StreamSubscription) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.subscriptions[sub]; ok {
+		delete(s.subscriptions, sub)
+		close(sub.messages)
+	}
+}
+
+// Run fans notifications from listener out to subscribers until ctx is done.
+// listener must already be listening on StreamChannel.
+func (s *StreamService) Run(ctx context.Context, listener *pq.Listener) {
+	ping := time.NewTicker(90 * time.Second)
+	defer ping.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case n := <-listener.Notify:
+			// A nil notification means the connection was re-established;
+			// anything sent while it was down is lost.
+			if n == nil {
+				continue
+			}
+			s.handle(ctx, n.Extra)
+		case <-ping.C:
+			// Detect a dead connection while no notifications arrive
+			go listener.Ping()
+		}
+	}
+}
+
+// RunLocal is Run for a store that delivers StreamChannel notifications in
+// process, such as repositories.SQLiteStore: it fans out the payloads until
+// ctx is done or payloads is closed.
+func (s *StreamService) RunLocal(ctx context.Context, payloads <-chan string) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case payload, ok := <-payloads:
+			if !ok {
+				return
+			}
+			s.handle(ctx, payload)
+		}
+	}
+}
+
+func (s *StreamService) handle(ctx context.Context, payload string) {
+	var notification streamNotification
+	if err := json.Unmarshal([]byte(payload), &notification); err != nil {
+		slog.ErrorContext(ctx, "Invalid stream notification", slog.String("payload", payload), logging.Err(err))
+		return
+	}
+	var err error
+	switch {
+	case notification.ProductID != 0:
+		err = s.publishProduct(ctx, notification.ProductID)
+	case notification.LocationID != 0:
+		err = s.publishLocation(ctx, notification.LocationID)
+	default:
+		err = s.publish(ctx, notification.MovementID)
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to publish stream update", slog.String("payload", payload), logging.Err(err))
+	}
+}
+
+// publish sends the movement, the product balance and the location usage
+// after it to every matching subscriber.
+func (s *StreamService) publish(ctx context.Context, movementID int) error {
+	if !s.hasSubscribers() {
+		return nil
+	}
+
+	stockRepo := s.store.StockMovements()
+	locationRepo := s.store.Locations()
+
+	movement, err := stockRepo.GetByID(ctx, movementID)
+	if err != nil || movement == nil {
+		return err
+	}
+	product, err := s.store.Products().GetByID(ctx, movement.ProductID)
+	if err != nil || product == nil {
+		return err
+	}
+	location, err := locationRepo.GetByID(ctx, movement.LocationID)
+	if err != nil || location == nil {
+		return err
+	}
+	balance, err := stockRepo.GetBalance(ctx, movement.ProductID, movement.LocationID)
+	if err != nil {
+		return err
+	}
+	usage, err := locationRepo.GetCurrentUsage(ctx, movement.LocationID)
+	if err != nil {
+		return err
+	}
+
+	messages := []*models.StreamMessage{
+		{Type: models.StreamMovement, Data: movement},
+		{Type: models.StreamBalance, Data: &models.StreamBalanceData{
+			ProductID:       product.ID,
+			SKUName:         product.SKUName,
+			LocationID:      location.ID,
+			LocationCode:    location.Code,
+			Warehouse:       location.Warehouse,
+			Quantity:        balance,
+			ProductQuantity: product.Quantity,
+		}},
+		{Type: models.StreamLocationUsage, Data: withUsage(location, usage)},
+	}
+	s.deliver(messages, func(filter *models.StreamFilter) bool {
+		return streamMatches(filter, movement.ProductID, location)
+	})
+	return nil
+}
+
+// publishProduct sends a created or updated product, with its quantity, to
+// every subscriber not limited to a location or warehouse.
+func (s *StreamService) publishProduct(ctx context.Context, productID int) error {
+	if !s.hasSubscribers() {
+		return nil
+	}
+
+	product, err := s.store.Products().GetByID(ctx, productID)
+	if err != nil || product == nil {
+		return err
+	}
+	messages := []*models.StreamMessage{{Type: models.StreamProduct, Data: product}}
+	s.deliver(messages, func(filter *models.StreamFilter) bool {
+		return filter.LocationID == nil && filter.Warehouse == "" && (filter.ProductID == nil || *filter.ProductID == product.ID)
+	})
+	return nil
+}
+
+// publishLocation sends a created location and its usage to every matching
+// subscriber not limited to a product.
+func (s *StreamService) publishLocation(ctx context.Context, locationID int) error {
+	if !s.hasSubscribers() {
+		return nil
+	}
+
+	locationRepo := s.store.Locations()
+	location, err := locationRepo.GetByID(ctx, locationID)
+	if err != nil || location == nil {
+		return err
+	}
+	usage, err := locationRepo.GetCurrentUsage(ctx, locationID)
+	if err != nil {
+		return err
+	}
+	messages := []*models.StreamMessage{{Type: models.StreamLocationUsage, Data: withUsage(location, usage)}}
+	s.deliver(messages, func(filter *models.StreamFilter) bool {
+		return filter.ProductID == nil && streamMatches(filter, 0, location)
+	})
+	return nil
+}
+
+func withUsage(location *models.Location, usage int) *models.LocationWithUsage {
+	locationUsage := &models.LocationWithUsage{
+		Location:     *location,
+		CurrentUsage: usage,
+		Available:    location.Capacity - usage,
+	}
+	if locationUsage.Available < 0 {
+		locationUsage.Available = 0
+	}
+	return locationUsage
+}
+
+// deliver sends messages, in order, to every subscriber whose filter matches.
+func (s *StreamService) deliver(messages []*models.StreamMessage, matches func(filter *models.StreamFilter) bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for sub := range s.subscriptions {
+		if !matches(sub.filter) {
+			continue
+		}
+		for _, msg := range messages {
+			select {
+			case sub.messages <- msg:
+			default:
+				// Too slow: drop the subscriber rather than block everyone
+				delete(s.subscriptions, sub)
+				close(sub.messages)
+			}
+			if _, ok := s.subscriptions[sub]; !ok {
+				break
+			}
+		}
+	}
+}
+
+func (s *StreamService) hasSubscribers() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.subscriptions) > 0
+}
+
+func streamMatches(filter *models.StreamFilter, productID int, location *models.Location) bool {
+	if filter.ProductID != nil && *filter.ProductID != productID {
+		return false
+	}
+	if filter.LocationID != nil && *filter.LocationID != location.ID {
+		return false
+	}
+	if filter.Warehouse != "" && filter.Warehouse != location.Warehouse {
+		return false
+	}
+	return true
+}
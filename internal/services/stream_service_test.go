@@ -0,0 +1,61 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"warehouse-api/internal/models"
+)
+
+// replayStream hands every notification committed so far to the stream
+// service, as Run does for those arriving from Postgres.
+func (e *testEnv) replayStream(t *testing.T) {
+	t.Helper()
+	for _, payload := range e.store.Notifications(StreamChannel) {
+		e.stream.handle(context.Background(), payload)
+	}
+}
+
+func TestStreamAnnouncesProductsAndLocations(t *testing.T) {
+	env := newTestEnv(t)
+	ctx := context.Background()
+
+	all := env.stream.Subscribe(&models.StreamFilter{})
+	defer env.stream.Unsubscribe(all)
+	warehouse := env.stream.Subscribe(&models.StreamFilter{Warehouse: "JKT-1"})
+	defer env.stream.Unsubscribe(warehouse)
+
+	product := env.product(t, "STREAM-1", "FIFO", 0)
+	if _, err := env.products.Update(ctx, product.ID, &models.UpdateProductRequest{SKUName: product.SKUName, Quantity: 7}); err != nil {
+		t.Fatalf("update product: %v", err)
+	}
+	location, err := env.locations.Create(ctx, &models.CreateLocationRequest{Code: "S1", Name: "S1", Warehouse: "JKT-1", Capacity: 50})
+	if err != nil {
+		t.Fatalf("create location: %v", err)
+	}
+	env.replayStream(t)
+
+	// The product's creation, its edited quantity, then the new location
+	var types []string
+	for len(all.Messages) > 0 {
+		msg := <-all.Messages
+		types = append(types, msg.Type)
+		switch data := msg.Data.(type) {
+		case *models.Product:
+			if len(types) == 2 {
+				expectInt(t, "streamed quantity", data.Quantity, 7)
+			}
+		case *models.LocationWithUsage:
+			expectInt(t, "streamed location", data.ID, location.ID)
+			expectInt(t, "streamed availability", data.Available, 50)
+		}
+	}
+	if len(types) != 3 || types[0] != models.StreamProduct || types[1] != models.StreamProduct || types[2] != models.StreamLocationUsage {
+		t.Errorf("unfiltered subscriber got %v, want two product updates and a location usage", types)
+	}
+
+	// Products belong to no warehouse
+	expectInt(t, "updates in JKT-1", len(warehouse.Messages), 1)
+	if msg := <-warehouse.Messages; msg.Type != models.StreamLocationUsage {
+		t.Errorf("JKT-1 subscriber got %s, want the new location", msg.Type)
+	}
+}
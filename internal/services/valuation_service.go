@@ -0,0 +1,213 @@
+package services
+
+import (
+	"context"
+	"math"
+	"sort"
+	"time"
+	"warehouse-api/internal/models"
+	"warehouse-api/internal/repositories"
+	"warehouse-api/internal/tracing"
+)
+
+type ValuationService struct {
+	store repositories.Store
+}
+
+func NewValuationService(store repositories.Store) *ValuationService {
+	return &ValuationService{store: store}
+}
+
+// GetValuation values the stock on hand at asOf, per product and location.
+// FIFO products are valued at the cost of their remaining layers, AVG
+// products at their moving-average cost at that instant. Stock without cost
+// layers, such as the quantity a product was created with, is reported as
+// the product's unlayered quantity and valued at the average cost.
+func (s *ValuationService) GetValuation(ctx context.Context, asOf time.Time) (*models.ValuationReport, error) {
+	ctx, span := tracing.Start(ctx, "ValuationService.GetValuation")
+	defer span.End()
+
+	lines, err := s.store.CostLayers().GetValuation(ctx, asOf)
+	if err != nil {
+		return nil, err
+	}
+	unlayered, err := s.store.CostLayers().GetUnlayered(ctx, asOf)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &models.ValuationReport{
+		AsOf:     asOf,
+		Products: []*models.ProductValuation{},
+	}
+
+	products := map[int]*models.ProductValuation{}
+	product := func(id int, skuName, costingMethod string) *models.ProductValuation {
+		valuation, ok := products[id]
+		if !ok {
+			valuation = &models.ProductValuation{
+				ProductID:     id,
+				SKUName:       skuName,
+				CostingMethod: costingMethod,
+				Locations:     []*models.LocationValuation{},
+			}
+			products[id] = valuation
+			report.Products = append(report.Products, valuation)
+		}
+		return valuation
+	}
+
+	for _, line := range lines {
+		current := product(line.ProductID, line.SKUName, line.CostingMethod)
+
+		value := line.LayerValue
+		if line.CostingMethod == models.CostingAVG {
+			value = float64(line.Quantity) * line.AverageCost
+		}
+		value = roundCost(value)
+
+		current.Locations = append(current.Locations, &models.LocationValuation{
+			LocationID:   line.LocationID,
+			LocationCode: line.LocationCode,
+			LocationName: line.LocationName,
+			Quantity:     line.Quantity,
+			Value:        value,
+		})
+		current.Quantity += line.Quantity
+		current.Value = roundCost(current.Value + value)
+		report.TotalValue = roundCost(report.TotalValue + value)
+	}
+
+	for _, stock := range unlayered {
+		current := product(stock.ProductID, stock.SKUName, stock.CostingMethod)
+		value := roundCost(float64(stock.Quantity) * stock.AverageCost)
+		current.UnlayeredQuantity = stock.Quantity
+		current.Quantity += stock.Quantity
+		current.Value = roundCost(current.Value + value)
+		report.TotalValue = roundCost(report.TotalValue + value)
+	}
+	sort.Slice(report.Products, func(i, j int) bool { return report.Products[i].ProductID < report.Products[j].ProductID })
+
+	return report, nil
+}
+
+// layerDraw is the quantity an OUT movement takes from one cost layer.
+type layerDraw struct {
+	layerID  int
+	quantity int
+}
+
+// costIn prices an IN movement and updates the product's moving-average cost.
+// onHand is the product's stock before the movement. AVG products average
+// over all of it; FIFO products over their layers, which is also the cost
+// charged for stock without layers. When no unit cost is supplied the
+// current average cost is used, so the receipt does not move the average.
+func costIn(layers []*models.CostLayer, product *models.Product, onHand int, movement *models.StockMovement, unitCost *float64) {
+	cost := product.AverageCost
+	if unitCost != nil {
+		cost = *unitCost
+	}
+
+	layered, value := layerTotals(layers)
+	if product.CostingMethod != models.CostingAVG || onHand < layered {
+		onHand = layered
+	}
+	if product.CostingMethod == models.CostingAVG {
+		// Stock without layers, such as the quantity the product was created
+		// with, counts towards the average too
+		value = float64(onHand) * product.AverageCost
+	}
+	onHand += movement.Quantity
+	value += float64(movement.Quantity) * cost
+
+	product.AverageCost = roundCost(value / float64(onHand))
+	movement.UnitCost = roundCost(cost)
+	movement.TotalCost = roundCost(float64(movement.Quantity) * cost)
+	movement.AverageCost = product.AverageCost
+}
+
+// costOut computes the cost of goods sold for an OUT movement and returns the
+// layer draws that realise it. Only layers received at the movement's
+// location are drawn; quantity they do not cover (stock that was never
+// received through a costed IN movement, and so has no location) is charged
+// at the product's average cost.
+func costOut(layers []*models.CostLayer, product *models.Product, movement *models.StockMovement) []layerDraw {
+	var draws []layerDraw
+	var layerCost float64
+	remaining := movement.Quantity
+	for _, layer := range layers {
+		if remaining == 0 {
+			break
+		}
+		if layer.LocationID != movement.LocationID {
+			continue
+		}
+		take := layer.RemainingQuantity
+		if take > remaining {
+			take = remaining
+		}
+		draws = append(draws, layerDraw{layerID: layer.ID, quantity: take})
+		layerCost += float64(take) * layer.UnitCost
+		remaining -= take
+	}
+
+	cogs := float64(movement.Quantity) * product.AverageCost
+	if product.CostingMethod == models.CostingFIFO {
+		cogs = layerCost + float64(remaining)*product.AverageCost
+
+		onHand, value := layerTotals(layers)
+		onHand -= movement.Quantity - remaining
+		value -= layerCost
+		if onHand > 0 {
+			product.AverageCost = roundCost(value / float64(onHand))
+		}
+	}
+
+	movement.TotalCost = roundCost(cogs)
+	movement.UnitCost = roundCost(cogs / float64(movement.Quantity))
+	movement.AverageCost = product.AverageCost
+	return draws
+}
+
+// available returns how much of a product an OUT movement at locationID may
+// take: what is left of the layers received there, plus the product's stock
+// without layers, which has no location.
+func available(layers []*models.CostLayer, product *models.Product, locationID int) int {
+	var here, layered int
+	for _, layer := range layers {
+		layered += layer.RemainingQuantity
+		if layer.LocationID == locationID {
+			here += layer.RemainingQuantity
+		}
+	}
+	if unlayered := product.Quantity - layered; unlayered > 0 {
+		here += unlayered
+	}
+	return here
+}
+
+// preferLayer moves the layer created by movementID to the front so it is
+// consumed first.
+func preferLayer(layers []*models.CostLayer, movementID int) []*models.CostLayer {
+	for i, layer := range layers {
+		if layer.MovementID == movementID {
+			ordered := append([]*models.CostLayer{layer}, layers[:i]...)
+			return append(ordered, layers[i+1:]...)
+		}
+	}
+	return layers
+}
+
+func layerTotals(layers []*models.CostLayer) (int, float64) {
+	var quantity int
+	var value float64
+	for _, layer := range layers {
+		quantity += layer.RemainingQuantity
+		value += float64(layer.RemainingQuantity) * layer.UnitCost
+	}
+	return quantity, value
+}
+
+func roundCost(v float64) float64 {
+	return math.Round(v*10000) / 10000
+}
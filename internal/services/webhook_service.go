@@ -0,0 +1,250 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+	"warehouse-api/internal/logging"
+	"warehouse-api/internal/models"
+	"warehouse-api/internal/repositories"
+	"warehouse-api/internal/tracing"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Webhook retry policy: attempt n+1 is made WebhookRetryBase * 2^(n-1) after
+// attempt n, capped at WebhookRetryMax. After WebhookMaxAttempts failures the
+// delivery is dead.
+const (
+	WebhookMaxAttempts = 10
+	WebhookRetryBase   = 30 * time.Second
+	WebhookRetryMax    = 6 * time.Hour
+
+	webhookTimeout   = 10 * time.Second
+	webhookBatchSize = 20
+)
+
+type WebhookService struct {
+	store  repositories.Store
+	client *http.Client
+}
+
+// NewWebhookService returns a service whose HTTP client sends the
+// traceparent header of the span each delivery is made in.
+func NewWebhookService(store repositories.Store) *WebhookService {
+	return &WebhookService{
+		store:  store,
+		client: &http.Client{Timeout: webhookTimeout, Transport: otelhttp.NewTransport(http.DefaultTransport)},
+	}
+}
+
+// Record queues event for every subscriber to its type inside tx, with the
+// trace context of ctx so the deliveries continue the trace.
+func (s *WebhookService) Record(ctx context.Context, tx repositories.Tx, event *models.Event) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	return tx.Webhooks().CreateDeliveries(ctx, event, payload, tracing.Inject(ctx))
+}
+
+// CreateSubscription stores a subscription, generating a signing secret when
+// none is given. The secret is only ever returned here.
+func (s *WebhookService) CreateSubscription(ctx context.Context, req *models.CreateWebhookRequest) (*models.WebhookSubscription, error) {
+	ctx, span := tracing.Start(ctx, "WebhookService.CreateSubscription")
+	defer span.End()
+
+	secret := req.Secret
+	if secret == "" {
+		buf := make([]byte, 32)
+		if _, err := rand.Read(buf); err != nil {
+			return nil, err
+		}
+		secret = hex.EncodeToString(buf)
+	}
+
+	subscription := &models.WebhookSubscription{
+		URL:        req.URL,
+		Secret:     secret,
+		EventTypes: req.EventTypes,
+	}
+	err := s.store.Webhooks().CreateSubscription(ctx, subscription)
+	if err != nil {
+		return nil, err
+	}
+
+	return subscription, nil
+}
+
+func (s *WebhookService) GetSubscriptions(ctx context.Context) ([]*models.WebhookSubscription, error) {
+	ctx, span := tracing.Start(ctx, "WebhookService.GetSubscriptions")
+	defer span.End()
+
+	return s.store.Webhooks().GetSubscriptions(ctx)
+}
+
+func (s *WebhookService) DeleteSubscription(ctx context.Context, id int) error {
+	ctx, span := tracing.Start(ctx, "WebhookService.DeleteSubscription")
+	defer span.End()
+
+	found, err := s.store.Webhooks().DeleteSubscription(ctx, id)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return ErrWebhookSubscriptionNotFound
+	}
+	return nil
+}
+
+func (s *WebhookService) GetDeliveries(ctx context.Context, filter *models.WebhookDeliveryFilter) ([]*models.WebhookDelivery, int, error) {
+	ctx, span := tracing.Start(ctx, "WebhookService.GetDeliveries")
+	defer span.End()
+
+	if filter.Page < 1 {
+		filter.Page = 1
+	}
+	if filter.Limit < 1 {
+		filter.Limit = 10
+	}
+	return s.store.Webhooks().GetDeliveries(ctx, filter)
+}
+
+func (s *WebhookService) Redeliver(ctx context.Context, id int) (*models.WebhookDelivery, error) {
+	ctx, span := tracing.Start(ctx, "WebhookService.Redeliver")
+	defer span.End()
+
+	delivery, err := s.store.Webhooks().Redeliver(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if delivery == nil {
+		return nil, ErrWebhookDeliveryNotFound
+	}
+	return delivery, nil
+}
+
+// DeliverDue sends every delivery that is due, a batch at a time, and returns
+// how many were attempted.
+func (s *WebhookService) DeliverDue(ctx context.Context) (int, error) {
+	attempted := 0
+	for ctx.Err() == nil {
+		// Claim for longer than a send can take so a slow batch is not
+		// picked up twice.
+		deliveries, err := s.store.Webhooks().ClaimDue(ctx, webhookBatchSize, 2*webhookTimeout*webhookBatchSize)
+		if err != nil {
+			return attempted, err
+		}
+		if len(deliveries) == 0 {
+			break
+		}
+
+		for _, delivery := range deliveries {
+			if err := s.deliver(ctx, delivery); err != nil {
+				return attempted, err
+			}
+			attempted++
+		}
+	}
+	return attempted, nil
+}
+
+// deliver POSTs one delivery and records the outcome, in a span continuing
+// the trace of the request that raised the event. Only failing to record the
+// outcome is returned as an error.
+func (s *WebhookService) deliver(ctx context.Context, delivery *models.WebhookDelivery) error {
+	ctx, span := tracing.Start(tracing.Extract(ctx, delivery.TraceParent), "WebhookService.deliver",
+		trace.WithAttributes(attribute.Int("webhook.delivery_id", delivery.ID), attribute.String("webhook.event_type", delivery.EventType)))
+	defer span.End()
+
+	statusCode, sendErr := s.send(ctx, delivery)
+	if sendErr == nil {
+		return s.store.Webhooks().MarkDelivered(ctx, delivery.ID, *statusCode)
+	}
+
+	var nextAttemptAt *time.Time
+	if attempts := delivery.Attempts + 1; attempts < WebhookMaxAttempts {
+		next := time.Now().Add(webhookBackoff(attempts))
+		nextAttemptAt = &next
+	}
+	attrs := []slog.Attr{
+		slog.Int("delivery_id", delivery.ID),
+		slog.String("event_type", delivery.EventType),
+		slog.Int("attempts", delivery.Attempts+1),
+		logging.Err(sendErr),
+	}
+	if statusCode != nil {
+		attrs = append(attrs, slog.Int("status", *statusCode))
+	}
+	if nextAttemptAt == nil {
+		slog.LogAttrs(ctx, slog.LevelError, "Webhook delivery abandoned", attrs...)
+	} else {
+		slog.LogAttrs(ctx, slog.LevelWarn, "Webhook delivery failed", attrs...)
+	}
+	return s.store.Webhooks().MarkFailed(ctx, delivery.ID, statusCode, sendErr.Error(), nextAttemptAt)
+}
+
+// send POSTs the payload and succeeds on any 2xx response. The status code is
+// nil when no response was received.
+func (s *WebhookService) send(ctx context.Context, delivery *models.WebhookDelivery) (*int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, delivery.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return nil, err
+	}
+
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Webhook-Id", delivery.EventID)
+	req.Header.Set("X-Webhook-Event", delivery.EventType)
+	req.Header.Set("X-Webhook-Delivery", strconv.Itoa(delivery.ID))
+	req.Header.Set("X-Webhook-Timestamp", timestamp)
+	req.Header.Set("X-Webhook-Signature", "sha256="+SignWebhook(delivery.Secret, timestamp, delivery.Payload))
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	statusCode := resp.StatusCode
+	if statusCode < 200 || statusCode > 299 {
+		return &statusCode, fmt.Errorf("unexpected response status %s", resp.Status)
+	}
+	return &statusCode, nil
+}
+
+// SignWebhook returns the hex HMAC-SHA256 of "<timestamp>.<payload>" keyed
+// with secret, as sent in the X-Webhook-Signature header.
+func SignWebhook(secret, timestamp string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// webhookBackoff returns the wait before the next attempt after attempts
+// failures.
+func webhookBackoff(attempts int) time.Duration {
+	wait := WebhookRetryBase
+	for i := 1; i < attempts; i++ {
+		wait *= 2
+		if wait >= WebhookRetryMax {
+			return WebhookRetryMax
+		}
+	}
+	return wait
+}
@@ -0,0 +1,105 @@
+// Package tabular reads and writes row-oriented files (CSV, XLSX, NDJSON)
+// for the import and export endpoints.
+package tabular
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// Supported file formats.
+const (
+	FormatCSV    = "csv"
+	FormatXLSX   = "xlsx"
+	FormatNDJSON = "ndjson"
+)
+
+// Row is one data row keyed by lower-cased header name. Number is the row's
+// line in the file, counting the header as row 1, so errors can be reported
+// the way a spreadsheet shows them.
+type Row struct {
+	Number int
+	Values map[string]string
+}
+
+// Get returns the trimmed value of a column, or "" when it is absent.
+func (r Row) Get(column string) string {
+	return strings.TrimSpace(r.Values[column])
+}
+
+// FormatFromFilename derives the format from a file extension.
+func FormatFromFilename(name string) (string, error) {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".csv":
+		return FormatCSV, nil
+	case ".xlsx":
+		return FormatXLSX, nil
+	}
+	return "", fmt.Errorf("unsupported file type %q, expected .csv or .xlsx", filepath.Ext(name))
+}
+
+// Read parses a CSV or XLSX file whose first row holds the column names. Only
+// the first sheet of a workbook is read. Blank rows are skipped.
+func Read(r io.Reader, format string) ([]Row, error) {
+	var records [][]string
+	switch format {
+	case FormatCSV:
+		reader := csv.NewReader(r)
+		reader.FieldsPerRecord = -1
+		reader.TrimLeadingSpace = true
+		var err error
+		records, err = reader.ReadAll()
+		if err != nil {
+			return nil, fmt.Errorf("invalid CSV: %w", err)
+		}
+	case FormatXLSX:
+		workbook, err := excelize.OpenReader(r)
+		if err != nil {
+			return nil, fmt.Errorf("invalid XLSX: %w", err)
+		}
+		defer workbook.Close()
+		records, err = workbook.GetRows(workbook.GetSheetName(0))
+		if err != nil {
+			return nil, fmt.Errorf("invalid XLSX: %w", err)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported format %q", format)
+	}
+
+	if len(records) == 0 {
+		return nil, errors.New("file is empty")
+	}
+
+	header := make([]string, len(records[0]))
+	for i, name := range records[0] {
+		// Spreadsheet tools like to prepend a byte order mark
+		name = strings.TrimPrefix(name, "\ufeff")
+		header[i] = strings.ToLower(strings.TrimSpace(name))
+	}
+
+	var rows []Row
+	for i, record := range records[1:] {
+		row := Row{Number: i + 2, Values: map[string]string{}}
+		blank := true
+		for j, value := range record {
+			if j >= len(header) || header[j] == "" {
+				continue
+			}
+			row.Values[header[j]] = value
+			if strings.TrimSpace(value) != "" {
+				blank = false
+			}
+		}
+		if !blank {
+			rows = append(rows, row)
+		}
+	}
+
+	return rows, nil
+}
@@ -0,0 +1,92 @@
+// Package tracing sets up OpenTelemetry. Spans are started through Start
+// from the HTTP and gRPC middleware, every service method and every SQL
+// statement, and trace context travels in and out as W3C traceparent
+// headers. Without an exporter configured the spans are never recorded, but
+// an incoming trace context is still passed on, to webhooks among others.
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"warehouse-api/internal/config"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ServiceName is the service.name spans are reported under unless
+// OTEL_SERVICE_NAME says otherwise.
+const ServiceName = "warehouse-api"
+
+var tracer = otel.Tracer("warehouse-api")
+
+// Start starts a span named name as a child of the span in ctx. It follows
+// whichever tracer provider Setup installed, even when called before it.
+func Start(ctx context.Context, name string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	return tracer.Start(ctx, name, opts...)
+}
+
+// Inject returns the traceparent header for the span in ctx, or "" when
+// there is none, for work that carries the trace beyond this request.
+func Inject(ctx context.Context) string {
+	carrier := propagation.MapCarrier{}
+	otel.GetTextMapPropagator().Inject(ctx, carrier)
+	return carrier.Get("traceparent")
+}
+
+// Extract returns ctx continuing the trace of a traceparent header saved by
+// Inject.
+func Extract(ctx context.Context, traceParent string) context.Context {
+	if traceParent == "" {
+		return ctx
+	}
+	return otel.GetTextMapPropagator().Extract(ctx, propagation.MapCarrier{"traceparent": traceParent})
+}
+
+// Setup installs the W3C trace context propagator and, when
+// cfg.TracesExporter is otlp, a tracer provider exporting spans over OTLP.
+// The exporter reads its endpoint, headers and TLS settings from the
+// standard OTEL_EXPORTER_OTLP_* variables, and the provider its sampler from
+// OTEL_TRACES_SAMPLER. The returned function flushes and stops the exporter.
+func Setup(ctx context.Context, cfg *config.Config) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	if cfg.TracesExporter != config.TracesExporterOTLP {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	var exporter sdktrace.SpanExporter
+	var err error
+	if cfg.OTLPProtocol == config.OTLPProtocolGRPC {
+		exporter, err = otlptracegrpc.New(ctx)
+	} else {
+		exporter, err = otlptracehttp.New(ctx)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to create OTLP exporter: %w", err)
+	}
+
+	// Attributes from OTEL_SERVICE_NAME and OTEL_RESOURCE_ATTRIBUTES
+	// override the defaults
+	res, err := resource.New(ctx,
+		resource.WithAttributes(semconv.ServiceName(ServiceName)),
+		resource.WithTelemetrySDK(),
+		resource.WithHost(),
+		resource.WithFromEnv(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to describe tracing resource: %w", err)
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+	)
+	otel.SetTracerProvider(provider)
+	return provider.Shutdown, nil
+}
@@ -1,7 +1,11 @@
 package utils
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"net/http"
+	"warehouse-api/internal/apperrors"
 
 	"github.com/gin-gonic/gin"
 )
@@ -10,7 +14,6 @@ type APIResponse struct {
 	Success bool        `json:"success"`
 	Message string      `json:"message"`
 	Data    interface{} `json:"data,omitempty"`
-	Error   string      `json:"error,omitempty"`
 }
 
 func SuccessResponse(c *gin.Context, message string, data interface{}) {
@@ -21,48 +24,59 @@ func SuccessResponse(c *gin.Context, message string, data interface{}) {
 	})
 }
 
-func ErrorResponse(c *gin.Context, statusCode int, message string, err error) {
-	errorMsg := ""
-	if err != nil {
-		errorMsg = err.Error()
-	}
-	c.JSON(statusCode, APIResponse{
-		Success: false,
-		Message: message,
-		Error:   errorMsg,
-	})
-}
+// ProblemContentType is the media type of RFC 7807 problem details.
+const ProblemContentType = "application/problem+json"
 
-func BadRequestResponse(c *gin.Context, message string) {
-	c.JSON(http.StatusBadRequest, APIResponse{
-		Success: false,
-		Message: message,
-	})
+// Problem is an RFC 7807 problem details object. Code is the stable error
+// code from apperrors; Errors lists the failing fields of a validation error
+// and Details carries extra data such as an import report.
+type Problem struct {
+	Type     string       `json:"type"`
+	Title    string       `json:"title"`
+	Status   int          `json:"status"`
+	Detail   string       `json:"detail"`
+	Instance string       `json:"instance"`
+	Code     string       `json:"code"`
+	Errors   []FieldError `json:"errors,omitempty"`
+	Details  interface{}  `json:"details,omitempty"`
 }
 
-func UnauthorizedResponse(c *gin.Context, message string) {
-	c.JSON(http.StatusUnauthorized, APIResponse{
-		Success: false,
-		Message: message,
-	})
-}
+// ErrorResponse answers with the problem details for err. This is the one
+// place errors become responses: the status comes from the kind of the
+// *apperrors.Error in err's chain, and errors without one are reported as a
+// bare 500. Any failure after the request's deadline passed is a 504, since
+// drivers report the query they cancelled in their own words. err is attached
+// to the request with the *apperrors.Error it was answered as, for the
+// request log to report.
+func ErrorResponse(c *gin.Context, err error) {
+	appErr := apperrors.As(err)
+	if appErr.Kind == apperrors.Internal && errors.Is(c.Request.Context().Err(), context.DeadlineExceeded) {
+		appErr = apperrors.ErrTimeout
+	}
+	status := appErr.Kind.HTTPStatus()
+	c.Error(err).SetMeta(appErr)
 
-func NotFoundResponse(c *gin.Context, message string) {
-	c.JSON(http.StatusNotFound, APIResponse{
-		Success: false,
-		Message: message,
-	})
-}
+	problem := &Problem{
+		Type:     "about:blank",
+		Title:    http.StatusText(status),
+		Status:   status,
+		Detail:   err.Error(),
+		Instance: c.Request.URL.Path,
+		Code:     appErr.Code,
+		Errors:   appErr.Fields,
+		Details:  appErr.Details,
+	}
+	switch appErr.Kind {
+	case apperrors.Internal:
+		problem.Detail = "An unexpected error occurred"
+	case apperrors.Timeout:
+		problem.Detail = appErr.Message
+	}
 
-func InternalServerErrorResponse(c *gin.Context, message string, err error) {
-	errorMsg := ""
+	body, err := json.Marshal(problem)
 	if err != nil {
-		errorMsg = err.Error()
+		c.Status(http.StatusInternalServerError)
+		return
 	}
-	c.JSON(http.StatusInternalServerError, APIResponse{
-		Success: false,
-		Message: message,
-		Error:   errorMsg,
-	})
+	c.Data(status, ProblemContentType, body)
 }
-
@@ -0,0 +1,85 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"warehouse-api/internal/apperrors"
+
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+)
+
+// FieldError describes why a single field failed validation.
+type FieldError = apperrors.FieldError
+
+// ValidateStruct checks v against its `binding` tags, exactly as gin does when
+// a request body is bound. Use it for payloads that do not arrive as a single
+// JSON body, such as batch lines or imported rows.
+func ValidateStruct(v interface{}) error {
+	return binding.Validator.ValidateStruct(v)
+}
+
+// FieldErrors turns the validation errors returned for v into one entry per
+// failing field, named by its JSON tag. It returns nil when err is not a
+// validation error.
+func FieldErrors(v interface{}, err error) []FieldError {
+	var validationErrors validator.ValidationErrors
+	if !errors.As(err, &validationErrors) {
+		return nil
+	}
+
+	t := reflect.TypeOf(v)
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	fields := make([]FieldError, 0, len(validationErrors))
+	for _, fe := range validationErrors {
+		name := fe.Field()
+		if sf, ok := t.FieldByName(fe.StructField()); ok {
+			if tag := strings.Split(sf.Tag.Get("json"), ",")[0]; tag != "" && tag != "-" {
+				name = tag
+			}
+		}
+		fields = append(fields, FieldError{Field: name, Message: validationMessage(fe)})
+	}
+	return fields
+}
+
+// ValidationError converts an error from ValidateStruct or from binding v
+// into an *apperrors.Error: one entry per failing field for validation
+// failures, invalid_body for anything else, such as malformed JSON.
+func ValidationError(v interface{}, err error) error {
+	if fields := FieldErrors(v, err); fields != nil {
+		return apperrors.Validation(fields)
+	}
+	return apperrors.New(apperrors.Invalid, apperrors.CodeInvalidBody, "Invalid request body: "+err.Error())
+}
+
+func validationMessage(fe validator.FieldError) string {
+	switch fe.Tag() {
+	case "required":
+		return "is required"
+	case "gt":
+		return fmt.Sprintf("must be greater than %s", fe.Param())
+	case "gte":
+		return fmt.Sprintf("must be at least %s", fe.Param())
+	case "lt":
+		return fmt.Sprintf("must be less than %s", fe.Param())
+	case "lte":
+		return fmt.Sprintf("must be at most %s", fe.Param())
+	case "min":
+		return fmt.Sprintf("must have at least %s items", fe.Param())
+	case "max":
+		if fe.Kind() == reflect.String {
+			return fmt.Sprintf("must be at most %s characters", fe.Param())
+		}
+		return fmt.Sprintf("must have at most %s items", fe.Param())
+	case "oneof":
+		return fmt.Sprintf("must be one of: %s", strings.ReplaceAll(fe.Param(), " ", ", "))
+	default:
+		return fmt.Sprintf("failed the %q rule", fe.Tag())
+	}
+}
@@ -0,0 +1,69 @@
+package workers
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Group runs the background workers of a process and remembers which are
+// running, for the readiness probe. A worker returns only once its context is
+// done; one that returns earlier has stopped for good.
+type Group struct {
+	wg sync.WaitGroup
+
+	mu      sync.Mutex
+	stopped map[string]bool
+}
+
+func NewGroup() *Group {
+	return &Group{stopped: map[string]bool{}}
+}
+
+// Go runs run in a new goroutine as the worker called name until it returns.
+func (g *Group) Go(ctx context.Context, name string, run func(ctx context.Context)) {
+	g.mu.Lock()
+	g.stopped[name] = false
+	g.mu.Unlock()
+
+	g.wg.Add(1)
+	go func() {
+		defer g.wg.Done()
+		run(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+
+		slog.Error("Worker stopped", slog.String("worker", name))
+		g.mu.Lock()
+		g.stopped[name] = true
+		g.mu.Unlock()
+	}()
+}
+
+// Check returns an error naming the workers that stopped before their
+// context was done.
+func (g *Group) Check(ctx context.Context) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	var stopped []string
+	for name, done := range g.stopped {
+		if done {
+			stopped = append(stopped, name)
+		}
+	}
+	if len(stopped) == 0 {
+		return nil
+	}
+	sort.Strings(stopped)
+	return fmt.Errorf("stopped: %s", strings.Join(stopped, ", "))
+}
+
+// Wait blocks until every worker has returned.
+func (g *Group) Wait() {
+	g.wg.Wait()
+}
@@ -0,0 +1,37 @@
+package workers
+
+import (
+	"context"
+	"log/slog"
+	"time"
+	"warehouse-api/internal/logging"
+	"warehouse-api/internal/services"
+)
+
+// OutboxRelay publishes outbox events to the configured sink as they are
+// committed.
+type OutboxRelay struct {
+	outboxService *services.OutboxService
+	interval      time.Duration
+}
+
+func NewOutboxRelay(outboxService *services.OutboxService, interval time.Duration) *OutboxRelay {
+	return &OutboxRelay{outboxService: outboxService, interval: interval}
+}
+
+func (w *OutboxRelay) Run(ctx context.Context) {
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := w.outboxService.Relay(ctx); err != nil && ctx.Err() == nil {
+			slog.ErrorContext(ctx, "Failed to relay outbox events", logging.Err(err))
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package workers
+
+import (
+	"context"
+	"log/slog"
+	"time"
+	"warehouse-api/internal/logging"
+	"warehouse-api/internal/services"
+)
+
+// SnapshotWorker periodically snapshots the stock ledger so point-in-time
+// queries only have to replay the movements made since the last snapshot.
+// Snapshots are taken at interval boundaries (midnight UTC for the default
+// 24h) once the boundary is older than services.SnapshotSafetyLag.
+type SnapshotWorker struct {
+	ledgerService *services.LedgerService
+	interval      time.Duration
+}
+
+func NewSnapshotWorker(ledgerService *services.LedgerService, interval time.Duration) *SnapshotWorker {
+	return &SnapshotWorker{ledgerService: ledgerService, interval: interval}
+}
+
+func (w *SnapshotWorker) Run(ctx context.Context) {
+	ticker := time.NewTicker(w.tick())
+	defer ticker.Stop()
+
+	for {
+		w.snapshot(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// tick checks for a due snapshot often enough that one is taken shortly
+// after its boundary passes the safety lag.
+func (w *SnapshotWorker) tick() time.Duration {
+	if w.interval < time.Hour {
+		return w.interval
+	}
+	return time.Hour
+}
+
+func (w *SnapshotWorker) snapshot(ctx context.Context) {
+	takenAt := time.Now().UTC().Add(-services.SnapshotSafetyLag).Truncate(w.interval)
+	if _, err := w.ledgerService.CreateSnapshot(ctx, takenAt); err != nil && ctx.Err() == nil {
+		slog.ErrorContext(ctx, "Failed to create stock snapshot", slog.Time("taken_at", takenAt), logging.Err(err))
+	}
+}
@@ -0,0 +1,37 @@
+package workers
+
+import (
+	"context"
+	"log/slog"
+	"time"
+	"warehouse-api/internal/logging"
+	"warehouse-api/internal/services"
+)
+
+// WebhookWorker sends queued webhook deliveries as they fall due. Deliveries
+// are claimed with row locks, so several API instances can run it at once.
+type WebhookWorker struct {
+	webhookService *services.WebhookService
+	interval       time.Duration
+}
+
+func NewWebhookWorker(webhookService *services.WebhookService, interval time.Duration) *WebhookWorker {
+	return &WebhookWorker{webhookService: webhookService, interval: interval}
+}
+
+func (w *WebhookWorker) Run(ctx context.Context) {
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := w.webhookService.DeliverDue(ctx); err != nil && ctx.Err() == nil {
+			slog.ErrorContext(ctx, "Failed to deliver webhooks", logging.Err(err))
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
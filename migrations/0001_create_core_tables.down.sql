@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS stock_movements;
+DROP TABLE IF EXISTS locations;
+DROP TABLE IF EXISTS products;
@@ -0,0 +1,8 @@
+DROP TABLE IF EXISTS cost_layer_consumptions;
+DROP TABLE IF EXISTS cost_layers;
+
+ALTER TABLE stock_movements DROP COLUMN IF EXISTS average_cost;
+ALTER TABLE stock_movements DROP COLUMN IF EXISTS total_cost;
+ALTER TABLE stock_movements DROP COLUMN IF EXISTS unit_cost;
+ALTER TABLE products DROP COLUMN IF EXISTS average_cost;
+ALTER TABLE products DROP COLUMN IF EXISTS costing_method;
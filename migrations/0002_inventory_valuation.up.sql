@@ -0,0 +1,29 @@
+-- Inventory valuation
+ALTER TABLE products ADD COLUMN IF NOT EXISTS costing_method VARCHAR(10) NOT NULL DEFAULT 'FIFO' CHECK (costing_method IN ('FIFO', 'AVG'));
+ALTER TABLE products ADD COLUMN IF NOT EXISTS average_cost NUMERIC(18,4) NOT NULL DEFAULT 0;
+ALTER TABLE stock_movements ADD COLUMN IF NOT EXISTS unit_cost NUMERIC(18,4) NOT NULL DEFAULT 0;
+ALTER TABLE stock_movements ADD COLUMN IF NOT EXISTS total_cost NUMERIC(18,4) NOT NULL DEFAULT 0;
+ALTER TABLE stock_movements ADD COLUMN IF NOT EXISTS average_cost NUMERIC(18,4) NOT NULL DEFAULT 0;
+
+-- Cost layers received by IN movements
+CREATE TABLE IF NOT EXISTS cost_layers (
+    id SERIAL PRIMARY KEY,
+    product_id INTEGER NOT NULL REFERENCES products(id) ON DELETE CASCADE,
+    location_id INTEGER NOT NULL REFERENCES locations(id) ON DELETE CASCADE,
+    movement_id INTEGER NOT NULL REFERENCES stock_movements(id) ON DELETE CASCADE,
+    unit_cost NUMERIC(18,4) NOT NULL,
+    quantity INTEGER NOT NULL CHECK (quantity > 0),
+    remaining_quantity INTEGER NOT NULL CHECK (remaining_quantity >= 0),
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Quantities drawn from cost layers by OUT movements
+CREATE TABLE IF NOT EXISTS cost_layer_consumptions (
+    id SERIAL PRIMARY KEY,
+    layer_id INTEGER NOT NULL REFERENCES cost_layers(id) ON DELETE CASCADE,
+    movement_id INTEGER NOT NULL REFERENCES stock_movements(id) ON DELETE CASCADE,
+    quantity INTEGER NOT NULL CHECK (quantity > 0),
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_cost_layers_product_id ON cost_layers(product_id);
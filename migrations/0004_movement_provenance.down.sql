@@ -0,0 +1,4 @@
+ALTER TABLE stock_movements DROP COLUMN IF EXISTS created_by;
+ALTER TABLE stock_movements DROP COLUMN IF EXISTS note;
+ALTER TABLE stock_movements DROP COLUMN IF EXISTS reference;
+ALTER TABLE stock_movements DROP COLUMN IF EXISTS source;
@@ -0,0 +1,5 @@
+-- Movement provenance
+ALTER TABLE stock_movements ADD COLUMN IF NOT EXISTS source VARCHAR(20) NOT NULL DEFAULT 'MANUAL';
+ALTER TABLE stock_movements ADD COLUMN IF NOT EXISTS reference VARCHAR(100) NOT NULL DEFAULT '';
+ALTER TABLE stock_movements ADD COLUMN IF NOT EXISTS note TEXT NOT NULL DEFAULT '';
+ALTER TABLE stock_movements ADD COLUMN IF NOT EXISTS created_by VARCHAR(100) NOT NULL DEFAULT '';
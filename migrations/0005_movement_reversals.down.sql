@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS idx_stock_movements_reversal_of;
+ALTER TABLE stock_movements DROP COLUMN IF EXISTS reversal_reason;
+ALTER TABLE stock_movements DROP COLUMN IF EXISTS reversed_by;
+ALTER TABLE stock_movements DROP COLUMN IF EXISTS reversed_at;
+ALTER TABLE stock_movements DROP COLUMN IF EXISTS reversal_of;
@@ -0,0 +1,6 @@
+-- Movement reversals
+ALTER TABLE stock_movements ADD COLUMN IF NOT EXISTS reversal_of INTEGER REFERENCES stock_movements(id);
+ALTER TABLE stock_movements ADD COLUMN IF NOT EXISTS reversed_at TIMESTAMP;
+ALTER TABLE stock_movements ADD COLUMN IF NOT EXISTS reversed_by VARCHAR(100) NOT NULL DEFAULT '';
+ALTER TABLE stock_movements ADD COLUMN IF NOT EXISTS reversal_reason TEXT NOT NULL DEFAULT '';
+CREATE UNIQUE INDEX IF NOT EXISTS idx_stock_movements_reversal_of ON stock_movements(reversal_of);
@@ -0,0 +1,3 @@
+-- W3C traceparent of the request that raised the event, so the delivery
+-- continues its trace
+ALTER TABLE webhook_deliveries ADD COLUMN IF NOT EXISTS trace_parent TEXT NOT NULL DEFAULT '';
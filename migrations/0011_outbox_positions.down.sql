@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_outbox_events_unpositioned;
+DROP INDEX IF EXISTS idx_outbox_events_position;
+ALTER TABLE outbox_events DROP COLUMN IF EXISTS position;
@@ -0,0 +1,8 @@
+-- Position of each event in commit order, stamped by the relay once the
+-- event's transaction has committed. Events recorded so far have all
+-- committed, so their IDs serve, and cursors already handed out stay valid.
+ALTER TABLE outbox_events ADD COLUMN IF NOT EXISTS position BIGINT;
+UPDATE outbox_events SET position = id WHERE position IS NULL;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_outbox_events_position ON outbox_events(position);
+CREATE INDEX IF NOT EXISTS idx_outbox_events_unpositioned ON outbox_events(id) WHERE position IS NULL;
@@ -0,0 +1,31 @@
+-- Store every timestamp as an instant. The columns were TIMESTAMP, filled
+-- by CURRENT_TIMESTAMP in the session time zone but compared with instants
+-- from the application, so on a server whose TimeZone is not UTC every as-of
+-- balance, ledger window and snapshot was shifted by the offset. Existing
+-- values are read as wall times in the time zone of the session running this
+-- migration, which is the one they were written in unless the server's
+-- TimeZone has changed since.
+ALTER TABLE products
+    ALTER COLUMN created_at TYPE TIMESTAMPTZ USING created_at AT TIME ZONE current_setting('TimeZone'),
+    ALTER COLUMN updated_at TYPE TIMESTAMPTZ USING updated_at AT TIME ZONE current_setting('TimeZone');
+ALTER TABLE locations
+    ALTER COLUMN created_at TYPE TIMESTAMPTZ USING created_at AT TIME ZONE current_setting('TimeZone');
+ALTER TABLE stock_movements
+    ALTER COLUMN created_at TYPE TIMESTAMPTZ USING created_at AT TIME ZONE current_setting('TimeZone'),
+    ALTER COLUMN reversed_at TYPE TIMESTAMPTZ USING reversed_at AT TIME ZONE current_setting('TimeZone');
+ALTER TABLE cost_layers
+    ALTER COLUMN created_at TYPE TIMESTAMPTZ USING created_at AT TIME ZONE current_setting('TimeZone');
+ALTER TABLE cost_layer_consumptions
+    ALTER COLUMN created_at TYPE TIMESTAMPTZ USING created_at AT TIME ZONE current_setting('TimeZone');
+ALTER TABLE stock_snapshots
+    ALTER COLUMN taken_at TYPE TIMESTAMPTZ USING taken_at AT TIME ZONE current_setting('TimeZone'),
+    ALTER COLUMN created_at TYPE TIMESTAMPTZ USING created_at AT TIME ZONE current_setting('TimeZone');
+ALTER TABLE webhook_subscriptions
+    ALTER COLUMN created_at TYPE TIMESTAMPTZ USING created_at AT TIME ZONE current_setting('TimeZone');
+ALTER TABLE webhook_deliveries
+    ALTER COLUMN next_attempt_at TYPE TIMESTAMPTZ USING next_attempt_at AT TIME ZONE current_setting('TimeZone'),
+    ALTER COLUMN created_at TYPE TIMESTAMPTZ USING created_at AT TIME ZONE current_setting('TimeZone'),
+    ALTER COLUMN delivered_at TYPE TIMESTAMPTZ USING delivered_at AT TIME ZONE current_setting('TimeZone');
+ALTER TABLE outbox_events
+    ALTER COLUMN created_at TYPE TIMESTAMPTZ USING created_at AT TIME ZONE current_setting('TimeZone'),
+    ALTER COLUMN published_at TYPE TIMESTAMPTZ USING published_at AT TIME ZONE current_setting('TimeZone');
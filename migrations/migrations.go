@@ -0,0 +1,26 @@
+// Package migrations embeds the numbered schema migrations applied by
+// internal/migrate. Version N is NNNN_name.up.sql together with the
+// NNNN_name.down.sql that undoes it. The sqlite directory holds the same
+// versions, under the same names, written for SQLite.
+package migrations
+
+import (
+	"embed"
+	"io/fs"
+)
+
+//go:embed *.sql
+var FS embed.FS
+
+//go:embed sqlite/*.sql
+var sqliteFS embed.FS
+
+// For returns the migrations for the named database/sql driver: FS for
+// "postgres", the sqlite directory for "sqlite".
+func For(driver string) fs.FS {
+	if driver == "sqlite" {
+		sub, _ := fs.Sub(sqliteFS, "sqlite")
+		return sub
+	}
+	return FS
+}
@@ -0,0 +1,8 @@
+DROP TABLE IF EXISTS cost_layer_consumptions;
+DROP TABLE IF EXISTS cost_layers;
+
+ALTER TABLE stock_movements DROP COLUMN average_cost;
+ALTER TABLE stock_movements DROP COLUMN total_cost;
+ALTER TABLE stock_movements DROP COLUMN unit_cost;
+ALTER TABLE products DROP COLUMN average_cost;
+ALTER TABLE products DROP COLUMN costing_method;
@@ -0,0 +1,29 @@
+-- Inventory valuation
+ALTER TABLE products ADD COLUMN costing_method VARCHAR(10) NOT NULL DEFAULT 'FIFO' CHECK (costing_method IN ('FIFO', 'AVG'));
+ALTER TABLE products ADD COLUMN average_cost NUMERIC(18,4) NOT NULL DEFAULT 0;
+ALTER TABLE stock_movements ADD COLUMN unit_cost NUMERIC(18,4) NOT NULL DEFAULT 0;
+ALTER TABLE stock_movements ADD COLUMN total_cost NUMERIC(18,4) NOT NULL DEFAULT 0;
+ALTER TABLE stock_movements ADD COLUMN average_cost NUMERIC(18,4) NOT NULL DEFAULT 0;
+
+-- Cost layers received by IN movements
+CREATE TABLE IF NOT EXISTS cost_layers (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    product_id INTEGER NOT NULL REFERENCES products(id) ON DELETE CASCADE,
+    location_id INTEGER NOT NULL REFERENCES locations(id) ON DELETE CASCADE,
+    movement_id INTEGER NOT NULL REFERENCES stock_movements(id) ON DELETE CASCADE,
+    unit_cost NUMERIC(18,4) NOT NULL,
+    quantity INTEGER NOT NULL CHECK (quantity > 0),
+    remaining_quantity INTEGER NOT NULL CHECK (remaining_quantity >= 0),
+    created_at TIMESTAMP DEFAULT (strftime('%Y-%m-%d %H:%M:%f', 'now'))
+);
+
+-- Quantities drawn from cost layers by OUT movements
+CREATE TABLE IF NOT EXISTS cost_layer_consumptions (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    layer_id INTEGER NOT NULL REFERENCES cost_layers(id) ON DELETE CASCADE,
+    movement_id INTEGER NOT NULL REFERENCES stock_movements(id) ON DELETE CASCADE,
+    quantity INTEGER NOT NULL CHECK (quantity > 0),
+    created_at TIMESTAMP DEFAULT (strftime('%Y-%m-%d %H:%M:%f', 'now'))
+);
+
+CREATE INDEX IF NOT EXISTS idx_cost_layers_product_id ON cost_layers(product_id);
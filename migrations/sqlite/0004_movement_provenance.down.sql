@@ -0,0 +1,4 @@
+ALTER TABLE stock_movements DROP COLUMN created_by;
+ALTER TABLE stock_movements DROP COLUMN note;
+ALTER TABLE stock_movements DROP COLUMN reference;
+ALTER TABLE stock_movements DROP COLUMN source;
@@ -0,0 +1,5 @@
+-- Movement provenance
+ALTER TABLE stock_movements ADD COLUMN source VARCHAR(20) NOT NULL DEFAULT 'MANUAL';
+ALTER TABLE stock_movements ADD COLUMN reference VARCHAR(100) NOT NULL DEFAULT '';
+ALTER TABLE stock_movements ADD COLUMN note TEXT NOT NULL DEFAULT '';
+ALTER TABLE stock_movements ADD COLUMN created_by VARCHAR(100) NOT NULL DEFAULT '';
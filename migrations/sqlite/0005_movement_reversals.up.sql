@@ -0,0 +1,6 @@
+-- Movement reversals
+ALTER TABLE stock_movements ADD COLUMN reversal_of INTEGER REFERENCES stock_movements(id);
+ALTER TABLE stock_movements ADD COLUMN reversed_at TIMESTAMP;
+ALTER TABLE stock_movements ADD COLUMN reversed_by VARCHAR(100) NOT NULL DEFAULT '';
+ALTER TABLE stock_movements ADD COLUMN reversal_reason TEXT NOT NULL DEFAULT '';
+CREATE UNIQUE INDEX IF NOT EXISTS idx_stock_movements_reversal_of ON stock_movements(reversal_of);
@@ -0,0 +1,2 @@
+-- Warehouse grouping for real-time stream filters
+ALTER TABLE locations ADD COLUMN warehouse VARCHAR(50) NOT NULL DEFAULT '';
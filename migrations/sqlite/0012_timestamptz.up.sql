@@ -0,0 +1,3 @@
+-- SQLite stores timestamps as UTC text already; this version only keeps the
+-- numbering in step with Postgres, where the columns become TIMESTAMPTZ.
+SELECT 1;
@@ -0,0 +1,8 @@
+// Package warehousev1 holds the code generated from warehouse.proto. After
+// editing the .proto, regenerate it with protoc, protoc-gen-go and
+// protoc-gen-go-grpc on the PATH:
+//
+//	go generate ./proto/...
+package warehousev1
+
+//go:generate protoc -I ../.. --go_out=../.. --go_opt=paths=source_relative --go-grpc_out=../.. --go-grpc_opt=paths=source_relative warehouse/v1/warehouse.proto